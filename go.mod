@@ -2,4 +2,4 @@ module tcp-server.com/m
 
 go 1.24.6
 
-require github.com/spaolacci/murmur3 v1.1.0 // indirect
+require github.com/spaolacci/murmur3 v1.1.0
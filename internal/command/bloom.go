@@ -0,0 +1,296 @@
+package command
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+
+	"tcp-server.com/m/internal/config"
+	"tcp-server.com/m/internal/datastructure"
+	"tcp-server.com/m/internal/protocol"
+)
+
+var (
+	errBFNotFound  = errors.New("ERR not found")
+	errBFErrorRate = errors.New("ERR (0 < error rate range < 1)")
+	errBFCapacity  = errors.New("ERR (capacity should be larger than 0)")
+)
+
+func parseBFErrorRate(arg string) (float64, error) {
+	errRate, err := strconv.ParseFloat(arg, 64)
+	if err != nil {
+		return 0, errors.New("ERR bad error rate")
+	}
+	if errRate <= 0 || errRate >= 1 {
+		return 0, errBFErrorRate
+	}
+	return errRate, nil
+}
+
+func parseBFCapacity(arg string) (uint64, error) {
+	capacity, err := strconv.ParseUint(arg, 10, 64)
+	if err != nil {
+		return 0, errors.New("ERR bad capacity")
+	}
+	if capacity == 0 {
+		return 0, errBFCapacity
+	}
+	return capacity, nil
+}
+
+func parseBFExpansion(arg string) (uint64, error) {
+	expansion, err := strconv.ParseUint(arg, 10, 64)
+	if err != nil {
+		return 0, errors.New("ERR bad expansion")
+	}
+	if expansion == 0 {
+		return 0, errors.New("ERR expansion should be greater or equal to 1")
+	}
+	return expansion, nil
+}
+
+/*
+Parse the optional [EXPANSION expansion] [NONSCALING] of BF.RESERVE and
+BF.INSERT at args[i]. Returns how many args were consumed, 0 when args[i]
+is neither of them
+*/
+func parseBFScaling(args []string, i int, expansion *uint64, nonScaling *bool) (int, error) {
+	switch strings.ToUpper(args[i]) {
+	case "EXPANSION":
+		if i+1 >= len(args) {
+			return 0, errSyntax
+		}
+		var err error
+		if *expansion, err = parseBFExpansion(args[i+1]); err != nil {
+			return 0, err
+		}
+		return 2, nil
+	case "NONSCALING":
+		*nonScaling = true
+		return 1, nil
+	}
+	return 0, nil
+}
+
+/*
+Expansion to create the filter with, 0 for NONSCALING
+*/
+func bfExpansion(expansion uint64, nonScaling bool, explicit bool) (uint64, error) {
+	if !nonScaling {
+		return expansion, nil
+	}
+	if explicit {
+		return 0, errors.New("ERR Non scaling filters cannot expand")
+	}
+	return 0, nil
+}
+
+/*
+BF.RESERVE key error_rate capacity [EXPANSION expansion] [NONSCALING]
+*/
+func (e *Executor) CmdBFReverse(args []string) []byte {
+	en := protocol.Encoder{}
+	errRate, err := parseBFErrorRate(args[1])
+	if err != nil {
+		return en.Encode(err, false)
+	}
+	entries, err := parseBFCapacity(args[2])
+	if err != nil {
+		return en.Encode(err, false)
+	}
+
+	expansion, nonScaling, explicit := config.BFDefaultExpansion, false, false
+	for i := 3; i < len(args); {
+		n, err := parseBFScaling(args, i, &expansion, &nonScaling)
+		if err != nil {
+			return en.Encode(err, false)
+		}
+		if n == 0 {
+			return en.Encode(errSyntax, false)
+		}
+		explicit = explicit || n == 2
+		i += n
+	}
+	if expansion, err = bfExpansion(expansion, nonScaling, explicit); err != nil {
+		return en.Encode(err, false)
+	}
+
+	if e.store.NewBF(args[0], errRate, entries, expansion) == -1 {
+		return en.Encode(errors.New("ERR item exists"), false)
+	}
+	return en.Encode("OK", true)
+}
+
+func (e *Executor) CmdBFAdd(args []string) []byte {
+	en := protocol.Encoder{}
+	return en.Encode(e.store.BFAdd(args[0], args[1:])[0], false)
+}
+
+func (e *Executor) CmdBFMAdd(args []string) []byte {
+	en := protocol.Encoder{}
+	return en.Encode(e.store.BFAdd(args[0], args[1:]), false)
+}
+
+func (e *Executor) CmdBFExist(args []string) []byte {
+	en := protocol.Encoder{}
+	return en.Encode(e.store.BFQuery(args[0], args[1:])[0], false)
+}
+
+func (e *Executor) CmdBFMExist(args []string) []byte {
+	en := protocol.Encoder{}
+	return en.Encode(e.store.BFQuery(args[0], args[1:]), false)
+}
+
+/*
+BF.INSERT key [CAPACITY capacity] [ERROR error] [EXPANSION expansion]
+[NOCREATE] [NONSCALING] ITEMS item [item ...]
+*/
+func (e *Executor) CmdBFInsert(args []string) []byte {
+	en := protocol.Encoder{}
+
+	errRate, capacity := config.BFDefaultErrorRate, config.BFDefaultCapacity
+	expansion, nonScaling, explicit := config.BFDefaultExpansion, false, false
+	noCreate := false
+	var items []string
+	var err error
+	for i := 1; i < len(args) && items == nil; i++ {
+		n, err := parseBFScaling(args, i, &expansion, &nonScaling)
+		if err != nil {
+			return en.Encode(err, false)
+		}
+		if n > 0 {
+			explicit = explicit || n == 2
+			i += n - 1
+			continue
+		}
+
+		switch strings.ToUpper(args[i]) {
+		case "CAPACITY":
+			if i+1 >= len(args) {
+				return en.Encode(errSyntax, false)
+			}
+			if capacity, err = parseBFCapacity(args[i+1]); err != nil {
+				return en.Encode(err, false)
+			}
+			i++
+		case "ERROR":
+			if i+1 >= len(args) {
+				return en.Encode(errSyntax, false)
+			}
+			if errRate, err = parseBFErrorRate(args[i+1]); err != nil {
+				return en.Encode(err, false)
+			}
+			i++
+		case "NOCREATE":
+			noCreate = true
+		case "ITEMS":
+			items = args[i+1:]
+		default:
+			return en.Encode(errSyntax, false)
+		}
+	}
+	if len(items) == 0 {
+		return en.Encode(errors.New("ERR wrong number of arguments for 'BF.INSERT' command"), false)
+	}
+	if expansion, err = bfExpansion(expansion, nonScaling, explicit); err != nil {
+		return en.Encode(err, false)
+	}
+
+	res := e.store.BFInsert(args[0], errRate, capacity, expansion, noCreate, items)
+	if res == nil {
+		return en.Encode(errBFNotFound, false)
+	}
+	return en.Encode(res, false)
+}
+
+/*
+BF.INFO key [CAPACITY | SIZE | FILTERS | ITEMS | EXPANSION]
+*/
+func (e *Executor) CmdBFInfo(args []string) []byte {
+	en := protocol.Encoder{}
+	if len(args) > 2 {
+		return en.Encode(errors.New("ERR wrong number of arguments for 'BF.INFO' command"), false)
+	}
+	info, ok := e.store.BFInfo(args[0])
+	if !ok {
+		return en.Encode(errBFNotFound, false)
+	}
+
+	var expansion any
+	if info.Expansion > 0 {
+		expansion = info.Expansion
+	}
+	fields := []any{
+		"Capacity", info.Capacity,
+		"Size", info.Size,
+		"Number of filters", info.Filters,
+		"Number of items inserted", info.Items,
+		"Expansion rate", expansion,
+	}
+	if len(args) == 1 {
+		return en.Encode(fields, false)
+	}
+
+	idx := -1
+	switch strings.ToUpper(args[1]) {
+	case "CAPACITY":
+		idx = 1
+	case "SIZE":
+		idx = 3
+	case "FILTERS":
+		idx = 5
+	case "ITEMS":
+		idx = 7
+	case "EXPANSION":
+		idx = 9
+	default:
+		return en.Encode(errors.New("ERR Invalid information value"), false)
+	}
+	return en.Encode([]any{fields[idx]}, false)
+}
+
+func (e *Executor) CmdBFCard(args []string) []byte {
+	en := protocol.Encoder{}
+	info, _ := e.store.BFInfo(args[0])
+	return en.Encode(info.Items, false)
+}
+
+func parseDumpIterator(arg string) (int64, error) {
+	iter, err := strconv.ParseInt(arg, 10, 64)
+	if err != nil || iter < 0 {
+		return 0, datastructure.ErrDumpIterator
+	}
+	return iter, nil
+}
+
+/*
+BF.SCANDUMP key iterator, start with iterator 0 and call again with the
+returned iterator until it is 0
+*/
+func (e *Executor) CmdBFScanDump(args []string) []byte {
+	en := protocol.Encoder{}
+	iter, err := parseDumpIterator(args[1])
+	if err != nil {
+		return en.Encode(err, false)
+	}
+	next, chunk, ok := e.store.BFScanDump(args[0], iter)
+	if !ok {
+		return en.Encode(errBFNotFound, false)
+	}
+	return en.Encode([]any{next, string(chunk)}, false)
+}
+
+/*
+BF.LOADCHUNK key iterator data, replaying the BF.SCANDUMP replies in order
+*/
+func (e *Executor) CmdBFLoadChunk(args []string) []byte {
+	en := protocol.Encoder{}
+	iter, err := parseDumpIterator(args[1])
+	if err != nil || iter == 0 {
+		return en.Encode(datastructure.ErrDumpIterator, false)
+	}
+	if err := e.store.BFLoadChunk(args[0], iter, []byte(args[2])); err != nil {
+		return en.Encode(err, false)
+	}
+	return en.Encode("OK", true)
+}
@@ -0,0 +1,160 @@
+package command
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+
+	"tcp-server.com/m/internal/datastructure"
+	"tcp-server.com/m/internal/protocol"
+)
+
+var errCMSExists = errors.New("ERR CMS: key already exists")
+
+func (e *Executor) CmdInitCMS(args []string) []byte {
+	en := protocol.Encoder{}
+	errRate, err := strconv.ParseFloat(args[1], 64)
+	if err != nil || errRate <= 0 || errRate >= 1 {
+		return en.Encode(errors.New("ERR CMS: invalid overestimation value"), false)
+	}
+	errProb, err := strconv.ParseFloat(args[2], 64)
+	if err != nil || errProb <= 0 || errProb >= 1 {
+		return en.Encode(errors.New("ERR CMS: invalid prob value"), false)
+	}
+	res := e.store.NewCMS(args[0], errRate, errProb)
+	if res == -1 {
+		return en.Encode(errCMSExists, false)
+	}
+	return en.Encode("OK", true)
+}
+
+/*
+CMS.INITBYDIM key width depth
+*/
+func (e *Executor) CmdInitCMSByDim(args []string) []byte {
+	en := protocol.Encoder{}
+	width, err := strconv.ParseUint(args[1], 10, 32)
+	if err != nil || width == 0 {
+		return en.Encode(errors.New("ERR CMS: invalid width"), false)
+	}
+	depth, err := strconv.ParseUint(args[2], 10, 32)
+	if err != nil || depth == 0 {
+		return en.Encode(errors.New("ERR CMS: invalid depth"), false)
+	}
+	if e.store.NewCMSByDim(args[0], uint32(width), uint32(depth)) == -1 {
+		return en.Encode(errCMSExists, false)
+	}
+	return en.Encode("OK", true)
+}
+
+/*
+CMS.INCRBY key item increment [item increment ...]
+*/
+func (e *Executor) CmdIncrBy(args []string) []byte {
+	en := protocol.Encoder{}
+	if len(args)%2 != 1 {
+		return en.Encode(errors.New("ERR wrong number of arguments for 'CMS.INCRBY' command"), false)
+	}
+	items := make([]string, 0, len(args)/2)
+	values := make([]uint32, 0, len(args)/2)
+	for i := 1; i < len(args); i += 2 {
+		value, err := strconv.ParseUint(args[i+1], 10, 32)
+		if err != nil {
+			return en.Encode(errors.New("ERR CMS: Cannot parse number"), false)
+		}
+		items = append(items, args[i])
+		values = append(values, uint32(value))
+	}
+	res, ok := e.store.CMSIncrBy(args[0], items, values)
+	if !ok {
+		return en.Encode(datastructure.ErrCMSNotFound, false)
+	}
+	return en.Encode(res, false)
+}
+
+/*
+CMS.QUERY key item [item ...]
+*/
+func (e *Executor) CmdCMSQuery(args []string) []byte {
+	en := protocol.Encoder{}
+	res, ok := e.store.CMSQuery(args[0], args[1:])
+	if !ok {
+		return en.Encode(datastructure.ErrCMSNotFound, false)
+	}
+	return en.Encode(res, false)
+}
+
+/*
+CMS.MERGE destination numKeys source [source ...] [WEIGHTS weight [weight ...]]
+*/
+func (e *Executor) CmdCMSMerge(args []string) []byte {
+	en := protocol.Encoder{}
+	srcs, opts, err := parseNumKeys(args[1:], CmdCMSMerge)
+	if err != nil {
+		return en.Encode(err, false)
+	}
+
+	weights := make([]int64, len(srcs))
+	for i := range weights {
+		weights[i] = 1
+	}
+	if len(opts) > 0 {
+		if strings.ToUpper(opts[0]) != "WEIGHTS" || len(opts) != len(srcs)+1 {
+			return en.Encode(errSyntax, false)
+		}
+		for i, opt := range opts[1:] {
+			if weights[i], err = strconv.ParseInt(opt, 10, 64); err != nil {
+				return en.Encode(errors.New("ERR CMS: invalid weight value"), false)
+			}
+		}
+	}
+
+	if err := e.store.CMSMerge(args[0], srcs, weights); err != nil {
+		return en.Encode(err, false)
+	}
+	return en.Encode("OK", true)
+}
+
+func (e *Executor) CmdCMSInfo(args []string) []byte {
+	en := protocol.Encoder{}
+	info, ok := e.store.CMSInfo(args[0])
+	if !ok {
+		return en.Encode(datastructure.ErrCMSNotFound, false)
+	}
+	return en.Encode([]any{
+		"width", int(info.Width),
+		"depth", int(info.Depth),
+		"count", int(info.Count),
+	}, false)
+}
+
+/*
+CMS.SCANDUMP key iterator, same protocol as BF.SCANDUMP
+*/
+func (e *Executor) CmdCMSScanDump(args []string) []byte {
+	en := protocol.Encoder{}
+	iter, err := parseDumpIterator(args[1])
+	if err != nil {
+		return en.Encode(err, false)
+	}
+	next, chunk, ok := e.store.CMSScanDump(args[0], iter)
+	if !ok {
+		return en.Encode(datastructure.ErrCMSNotFound, false)
+	}
+	return en.Encode([]any{next, string(chunk)}, false)
+}
+
+/*
+CMS.LOADCHUNK key iterator data, replaying the CMS.SCANDUMP replies in order
+*/
+func (e *Executor) CmdCMSLoadChunk(args []string) []byte {
+	en := protocol.Encoder{}
+	iter, err := parseDumpIterator(args[1])
+	if err != nil || iter == 0 {
+		return en.Encode(datastructure.ErrDumpIterator, false)
+	}
+	if err := e.store.CMSLoadChunk(args[0], iter, []byte(args[2])); err != nil {
+		return en.Encode(err, false)
+	}
+	return en.Encode("OK", true)
+}
@@ -0,0 +1,243 @@
+package command
+
+import (
+	"errors"
+	"slices"
+	"strings"
+
+	"tcp-server.com/m/internal/glob"
+	"tcp-server.com/m/internal/protocol"
+)
+
+/*
+COMMAND [COUNT | INFO [command ...] | DOCS [command ...] | LIST [FILTERBY
+MODULE name | ACLCAT category | PATTERN pattern] | GETKEYS command [arg ...]]
+*/
+func (e *Executor) CmdCommand(args []string) []byte {
+	en := protocol.Encoder{}
+	if len(args) == 0 {
+		return en.Encode(commandInfos(nil), false)
+	}
+	switch sub := strings.ToUpper(args[0]); {
+	case sub == "COUNT" && len(args) == 1:
+		return en.Encode(len(Specs()), false)
+	case sub == "INFO":
+		return en.Encode(commandInfos(args[1:]), false)
+	case sub == "DOCS":
+		return en.Encode(commandDocs(args[1:]), false)
+	case sub == "LIST" && (len(args) == 1 || len(args) == 4):
+		names, err := listCommands(args[1:])
+		if err != nil {
+			return en.Encode(err, false)
+		}
+		return en.Encode(names, false)
+	case sub == "GETKEYS" && len(args) >= 2:
+		keys, err := commandKeys(args[1:])
+		if err != nil {
+			return en.Encode(err, false)
+		}
+		return en.Encode(keys, false)
+	case sub == "COUNT" || sub == "LIST" || sub == "GETKEYS":
+		return en.Encode(errors.New("ERR wrong number of arguments for 'COMMAND|"+strings.ToLower(sub)+"' command"), false)
+	}
+	return en.Encode(errors.New("ERR unknown subcommand '"+args[0]+"'. Try COMMAND HELP."), false)
+}
+
+/*
+Entries of the commands named in `names`, nil for unknown ones, or of every
+command when empty
+*/
+func commandInfos(names []string) []any {
+	res := make([]any, 0)
+	if len(names) == 0 {
+		for _, spec := range Specs() {
+			res = append(res, spec.info())
+		}
+		return res
+	}
+	for _, name := range names {
+		if spec := Lookup(strings.ToUpper(name)); spec != nil {
+			res = append(res, spec.info())
+		} else {
+			res = append(res, nil)
+		}
+	}
+	return res
+}
+
+/*
+Name followed by the documentation of each command of `names`, unknown ones
+being left out, or of every command when empty
+*/
+func commandDocs(names []string) []any {
+	specs := Specs()
+	if len(names) > 0 {
+		specs = specs[:0]
+		for _, name := range names {
+			if spec := Lookup(strings.ToUpper(name)); spec != nil {
+				specs = append(specs, spec)
+			}
+		}
+	}
+	res := make([]any, 0, 2*len(specs))
+	for _, spec := range specs {
+		doc := []any{"summary", spec.Summary, "group", spec.Group}
+		if spec.Module != "" {
+			doc = append(doc, "module", spec.Module)
+		}
+		res = append(res, strings.ToLower(spec.Name), doc)
+	}
+	return res
+}
+
+/*
+Names of the commands, `filter` being empty or FILTERBY MODULE name |
+ACLCAT category | PATTERN pattern
+*/
+func listCommands(filter []string) ([]string, error) {
+	match := func(spec *Spec) bool { return true }
+	if len(filter) > 0 {
+		if strings.ToUpper(filter[0]) != "FILTERBY" {
+			return nil, errSyntax
+		}
+		value := filter[2]
+		switch strings.ToUpper(filter[1]) {
+		case "MODULE":
+			match = func(spec *Spec) bool { return spec.Module == value }
+		case "ACLCAT":
+			category := "@" + strings.ToLower(value)
+			match = func(spec *Spec) bool { return slices.Contains(spec.categories(), category) }
+		case "PATTERN":
+			match = func(spec *Spec) bool { return glob.Match(strings.ToLower(value), strings.ToLower(spec.Name)) }
+		default:
+			return nil, errSyntax
+		}
+	}
+	res := make([]string, 0)
+	for _, spec := range Specs() {
+		if match(spec) {
+			res = append(res, strings.ToLower(spec.Name))
+		}
+	}
+	return res, nil
+}
+
+/*
+Keys of the command line `argv`
+*/
+func commandKeys(argv []string) ([]string, error) {
+	spec := Lookup(strings.ToUpper(argv[0]))
+	if spec == nil {
+		return nil, errors.New("ERR Invalid command specified")
+	}
+	if !spec.arityOK(len(argv) - 1) {
+		return nil, errors.New("ERR Invalid number of arguments specified for command")
+	}
+	keys := spec.keys(argv[1:])
+	if keys == nil {
+		return nil, errors.New("ERR Invalid arguments specified for command")
+	}
+	if len(keys) == 0 {
+		return nil, errors.New("ERR The command has no key arguments")
+	}
+	return keys, nil
+}
+
+/*
+Entry of COMMAND INFO: name, arity, flags, first key, last key, step, ACL
+categories, tips, key specifications and subcommands
+*/
+func (spec *Spec) info() []any {
+	flags := spec.Flags.Names()
+	if spec.Keys != nil {
+		flags = append(flags, "movablekeys")
+	}
+	return []any{
+		strings.ToLower(spec.Name), spec.Arity, statuses(flags),
+		spec.FirstKey, spec.LastKey, spec.Step,
+		statuses(spec.categories()), []any{}, spec.keySpecs(), []any{},
+	}
+}
+
+/*
+ACL categories of the command, derived from its flags and group
+*/
+func (spec *Spec) categories() []string {
+	res := make([]string, 0)
+	add := func(names ...string) {
+		for _, name := range names {
+			if !slices.Contains(res, "@"+name) {
+				res = append(res, "@"+name)
+			}
+		}
+	}
+	switch {
+	case spec.Flags&FlagWrite != 0:
+		add("write")
+	case spec.Flags&FlagReadonly != 0:
+		add("read")
+	}
+	if category, ok := groupCategories[spec.Group]; ok {
+		add(category)
+	}
+	if spec.Flags&FlagFast != 0 {
+		add("fast")
+	} else {
+		add("slow")
+	}
+	if spec.Flags&FlagBlocking != 0 {
+		add("blocking")
+	}
+	if spec.Flags&FlagAdmin != 0 {
+		add("admin", "dangerous")
+	}
+	if spec.Flags&FlagPubSub != 0 {
+		add("pubsub")
+	}
+	return res
+}
+
+/*
+Key specifications: the fixed key range, plus an incomplete one for keys
+found by parsing the arguments
+*/
+func (spec *Spec) keySpecs() []any {
+	access := "RO"
+	if spec.Flags&FlagWrite != 0 {
+		access = "RW"
+	}
+	res := make([]any, 0)
+	if spec.FirstKey > 0 {
+		// The last key is relative to the first one unless counted from
+		// the end
+		last := spec.LastKey
+		if last >= 0 {
+			last -= spec.FirstKey
+		}
+		res = append(res, []any{
+			"flags", statuses([]string{access}),
+			"begin_search", []any{"type", "index", "spec", []any{"index", spec.FirstKey}},
+			"find_keys", []any{"type", "range", "spec", []any{"lastkey", last, "keystep", spec.Step, "limit", 0}},
+		})
+	}
+	if spec.Keys != nil {
+		res = append(res, []any{
+			"flags", statuses([]string{access, "incomplete"}),
+			"begin_search", []any{"type", "unknown", "spec", []any{}},
+			"find_keys", []any{"type", "unknown", "spec", []any{}},
+		})
+	}
+	return res
+}
+
+/*
+Array of simple strings
+*/
+func statuses(names []string) []any {
+	en := protocol.Encoder{}
+	res := make([]any, len(names))
+	for i, name := range names {
+		res[i] = protocol.Raw(en.Encode(name, true))
+	}
+	return res
+}
@@ -0,0 +1,142 @@
+package command
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	"tcp-server.com/m/internal/config"
+	"tcp-server.com/m/internal/datastructure"
+	"tcp-server.com/m/internal/glob"
+	"tcp-server.com/m/internal/protocol"
+)
+
+/*
+Parameter exposed through CONFIG GET/SET, read only without `set`
+*/
+type configParam struct {
+	name string
+	get  func() string
+	set  func(e *Executor, value string) error
+}
+
+var configParams = []configParam{
+	{
+		// Set at startup only
+		name: "databases",
+		get:  func() string { return strconv.Itoa(config.Databases) },
+	},
+	{
+		name: "notify-keyspace-events",
+		get:  func() string { return config.NotifyKeyspaceEvents.Load().(string) },
+		set: func(e *Executor, value string) error {
+			flags, ok := datastructure.ParseNotifyFlags(value)
+			if !ok {
+				return errors.New("Invalid event class character. Use 'Ag$lshzxeKEtmdn'.")
+			}
+			config.NotifyKeyspaceEvents.Store(datastructure.NotifyFlagsString(flags))
+			for _, db := range e.dbs {
+				db.SetNotifyFlags(flags)
+			}
+			return nil
+		},
+	},
+	{
+		// No eviction yet, the policy decides what OBJECT reports
+		name: "maxmemory-policy",
+		get:  func() string { return config.EvictionPolicy.Load().(string) },
+		set: func(e *Executor, value string) error {
+			policies := []string{"noeviction", "allkeys-lru", "allkeys-lfu", "allkeys-random",
+				"volatile-lru", "volatile-lfu", "volatile-random", "volatile-ttl"}
+			if !slices.Contains(policies, strings.ToLower(value)) {
+				return errors.New("argument(s) must be one of the following: " + strings.Join(policies, ", "))
+			}
+			config.EvictionPolicy.Store(strings.ToLower(value))
+			return nil
+		},
+	},
+	{
+		name: "zset-max-listpack-entries",
+		get:  func() string { return strconv.FormatInt(config.ZsetMaxListpackEntries.Load(), 10) },
+		set: func(e *Executor, value string) error {
+			return setNonNegative(&config.ZsetMaxListpackEntries, value)
+		},
+	},
+	{
+		name: "zset-max-listpack-value",
+		get:  func() string { return strconv.FormatInt(config.ZsetMaxListpackValue.Load(), 10) },
+		set: func(e *Executor, value string) error {
+			return setNonNegative(&config.ZsetMaxListpackValue, value)
+		},
+	},
+	{
+		name: "lua-time-limit",
+		get:  func() string { return strconv.FormatInt(config.ScriptTimeLimitMs.Load(), 10) },
+		set: func(e *Executor, value string) error {
+			return setNonNegative(&config.ScriptTimeLimitMs, value)
+		},
+	},
+}
+
+func setNonNegative(param *atomic.Int64, value string) error {
+	n, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || n < 0 {
+		return errors.New("argument couldn't be parsed into an integer")
+	}
+	param.Store(n)
+	return nil
+}
+
+func lookupConfigParam(name string) *configParam {
+	for i := range configParams {
+		if strings.EqualFold(configParams[i].name, name) {
+			return &configParams[i]
+		}
+	}
+	return nil
+}
+
+/*
+CONFIG GET parameter [parameter ...]
+CONFIG SET parameter value [parameter value ...]
+*/
+func (e *Executor) CmdConfig(args []string) []byte {
+	en := protocol.Encoder{}
+	switch sub := strings.ToUpper(args[0]); {
+	case sub == "GET" && len(args) >= 2:
+		res := make([]string, 0)
+		for _, p := range configParams {
+			for _, pattern := range args[1:] {
+				if glob.Match(strings.ToLower(pattern), p.name) {
+					res = append(res, p.name, p.get())
+					break
+				}
+			}
+		}
+		return en.Encode(res, false)
+	case sub == "SET" && len(args) >= 3 && len(args)%2 == 1:
+		params := make([]*configParam, 0, len(args)/2)
+		for i := 1; i < len(args); i += 2 {
+			p := lookupConfigParam(args[i])
+			if p == nil {
+				return en.Encode(fmt.Errorf("ERR Unknown option or number of arguments for CONFIG SET - '%s'", args[i]), false)
+			}
+			if p.set == nil {
+				return en.Encode(fmt.Errorf("ERR CONFIG SET failed (possibly related to argument '%s') - can't set immutable config", p.name), false)
+			}
+			params = append(params, p)
+		}
+		for i, p := range params {
+			if err := p.set(e, args[2*i+2]); err != nil {
+				return en.Encode(fmt.Errorf("ERR CONFIG SET failed (possibly related to argument '%s') - %v", p.name, err), false)
+			}
+		}
+		return en.Encode("OK", true)
+	case sub == "GET" || sub == "SET":
+		return en.Encode(errors.New("ERR wrong number of arguments for 'CONFIG|"+strings.ToLower(sub)+"' command"), false)
+	}
+	return en.Encode(errors.New("ERR unknown subcommand '"+args[0]+"'. Try CONFIG HELP."), false)
+}
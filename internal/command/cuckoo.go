@@ -0,0 +1,150 @@
+package command
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+
+	"tcp-server.com/m/internal/config"
+	"tcp-server.com/m/internal/protocol"
+)
+
+var errCFNotFound = errors.New("ERR Not found")
+
+func parseRangedUint(arg string, min uint64, max uint64, err error) (uint64, error) {
+	v, perr := strconv.ParseUint(arg, 10, 64)
+	if perr != nil || v < min || v > max {
+		return 0, err
+	}
+	return v, nil
+}
+
+/*
+CF.RESERVE key capacity [BUCKETSIZE bucketsize] [MAXITERATIONS maxiterations]
+[EXPANSION expansion]
+*/
+func (e *Executor) CmdCFReserve(args []string) []byte {
+	en := protocol.Encoder{}
+	if len(args)%2 != 0 {
+		return en.Encode(errors.New("ERR wrong number of arguments for 'CF.RESERVE' command"), false)
+	}
+	capacity, err := parseRangedUint(args[1], 1, 1<<48, errors.New("ERR Bad capacity"))
+	if err != nil {
+		return en.Encode(err, false)
+	}
+
+	bucketSize, maxIterations, expansion := config.CFDefaultBucketSize, uint64(config.CFDefaultMaxIterations), config.CFDefaultExpansion
+	for i := 2; i < len(args); i += 2 {
+		switch strings.ToUpper(args[i]) {
+		case "BUCKETSIZE":
+			bucketSize, err = parseRangedUint(args[i+1], 1, 255, errors.New("ERR Bad bucket size"))
+		case "MAXITERATIONS":
+			maxIterations, err = parseRangedUint(args[i+1], 1, 65535, errors.New("ERR MAXITERATIONS: value must be an integer between 1 and 65535, inclusive."))
+		case "EXPANSION":
+			expansion, err = parseRangedUint(args[i+1], 0, 32768, errors.New("ERR EXPANSION: value must be an integer between 0 and 32768, inclusive."))
+		default:
+			err = errSyntax
+		}
+		if err != nil {
+			return en.Encode(err, false)
+		}
+	}
+	if capacity < bucketSize*2 {
+		return en.Encode(errors.New("ERR Capacity must be at least (BucketSize * 2)"), false)
+	}
+
+	if e.store.NewCF(args[0], capacity, bucketSize, int(maxIterations), expansion) == -1 {
+		return en.Encode(errors.New("ERR item exists"), false)
+	}
+	return en.Encode("OK", true)
+}
+
+func (e *Executor) CmdCFAdd(args []string) []byte {
+	en := protocol.Encoder{}
+	return en.Encode(e.store.CFAdd(args[0], args[1:], false)[0], false)
+}
+
+func (e *Executor) CmdCFAddNX(args []string) []byte {
+	en := protocol.Encoder{}
+	return en.Encode(e.store.CFAdd(args[0], args[1:], true)[0], false)
+}
+
+/*
+CF.INSERT key [CAPACITY capacity] [NOCREATE] ITEMS item [item ...]
+*/
+func (e *Executor) CmdCFInsert(args []string) []byte {
+	en := protocol.Encoder{}
+
+	capacity, noCreate := config.CFDefaultCapacity, false
+	var items []string
+	var err error
+	for i := 1; i < len(args) && items == nil; i++ {
+		switch strings.ToUpper(args[i]) {
+		case "CAPACITY":
+			if i+1 >= len(args) {
+				return en.Encode(errSyntax, false)
+			}
+			if capacity, err = parseRangedUint(args[i+1], 1, 1<<48, errors.New("ERR Bad capacity")); err != nil {
+				return en.Encode(err, false)
+			}
+			i++
+		case "NOCREATE":
+			noCreate = true
+		case "ITEMS":
+			items = args[i+1:]
+		default:
+			return en.Encode(errSyntax, false)
+		}
+	}
+	if len(items) == 0 {
+		return en.Encode(errors.New("ERR wrong number of arguments for 'CF.INSERT' command"), false)
+	}
+
+	res := e.store.CFInsert(args[0], capacity, noCreate, false, items)
+	if res == nil {
+		return en.Encode(errCFNotFound, false)
+	}
+	return en.Encode(res, false)
+}
+
+func (e *Executor) CmdCFExists(args []string) []byte {
+	en := protocol.Encoder{}
+	return en.Encode(e.store.CFExists(args[0], args[1:])[0], false)
+}
+
+func (e *Executor) CmdCFMExists(args []string) []byte {
+	en := protocol.Encoder{}
+	return en.Encode(e.store.CFExists(args[0], args[1:]), false)
+}
+
+func (e *Executor) CmdCFDel(args []string) []byte {
+	en := protocol.Encoder{}
+	res, ok := e.store.CFDel(args[0], args[1])
+	if !ok {
+		return en.Encode(errCFNotFound, false)
+	}
+	return en.Encode(res, false)
+}
+
+func (e *Executor) CmdCFCount(args []string) []byte {
+	en := protocol.Encoder{}
+	return en.Encode(e.store.CFCount(args[0], args[1]), false)
+}
+
+func (e *Executor) CmdCFInfo(args []string) []byte {
+	en := protocol.Encoder{}
+	info, ok := e.store.CFInfo(args[0])
+	if !ok {
+		return en.Encode(errCFNotFound, false)
+	}
+	return en.Encode([]any{
+		"Size", info.Size,
+		"Number of buckets", info.Buckets,
+		"Number of filters", info.Filters,
+		"Number of items inserted", info.Items,
+		"Number of items deleted", info.Deleted,
+		"Bucket size", info.BucketSize,
+		"Expansion rate", info.Expansion,
+		"Max iterations", info.MaxIterations,
+	}, false)
+}
@@ -0,0 +1,166 @@
+package command
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+
+	"tcp-server.com/m/internal/datastructure"
+	"tcp-server.com/m/internal/protocol"
+)
+
+var (
+	errDBIndex     = errors.New("ERR DB index is out of range")
+	errSameObjects = errors.New("ERR source and destination objects are the same")
+)
+
+/*
+Database at index `arg`
+*/
+func (e *Executor) parseDB(arg string) (*datastructure.Storage, error) {
+	idx, err := strconv.Atoi(arg)
+	if err != nil {
+		return nil, errNotInteger
+	}
+	if idx < 0 || idx >= len(e.dbs) {
+		return nil, errDBIndex
+	}
+	return e.dbs[idx], nil
+}
+
+/*
+Check the optional ASYNC or SYNC argument of FLUSHDB and FLUSHALL. Both
+flush the same way: Go values are left to the garbage collector, and module
+values are freed by the command so that their Free callbacks never run
+alongside module commands
+*/
+func checkFlushMode(args []string) error {
+	if len(args) == 0 {
+		return nil
+	}
+	switch strings.ToUpper(args[0]) {
+	case "ASYNC", "SYNC":
+		return nil
+	}
+	return errSyntax
+}
+
+/*
+SELECT index
+*/
+func (e *Executor) CmdSelect(args []string) []byte {
+	en := protocol.Encoder{}
+	db, err := e.parseDB(args[0])
+	if err != nil {
+		return en.Encode(err, false)
+	}
+	e.store = db
+	return en.Encode("OK", true)
+}
+
+/*
+DBSIZE
+*/
+func (e *Executor) CmdDBSize(args []string) []byte {
+	en := protocol.Encoder{}
+	return en.Encode(e.store.KeySpace().Key, false)
+}
+
+/*
+FLUSHDB [ASYNC | SYNC]
+*/
+func (e *Executor) CmdFlushDB(args []string) []byte {
+	en := protocol.Encoder{}
+	if err := checkFlushMode(args); err != nil {
+		return en.Encode(err, false)
+	}
+	e.store.Flush()
+	return en.Encode("OK", true)
+}
+
+/*
+FLUSHALL [ASYNC | SYNC]
+*/
+func (e *Executor) CmdFlushAll(args []string) []byte {
+	en := protocol.Encoder{}
+	if err := checkFlushMode(args); err != nil {
+		return en.Encode(err, false)
+	}
+	for _, db := range e.dbs {
+		db.Flush()
+	}
+	return en.Encode("OK", true)
+}
+
+/*
+MOVE key db
+*/
+func (e *Executor) CmdMove(args []string) []byte {
+	en := protocol.Encoder{}
+	dst, err := e.parseDB(args[1])
+	if err != nil {
+		return en.Encode(err, false)
+	}
+	if dst == e.store {
+		return en.Encode(errSameObjects, false)
+	}
+	if e.store.Move(args[0], dst) {
+		return en.Encode(1, false)
+	}
+	return en.Encode(0, false)
+}
+
+/*
+SWAPDB index1 index2
+*/
+func (e *Executor) CmdSwapDB(args []string) []byte {
+	en := protocol.Encoder{}
+	first, err := strconv.Atoi(args[0])
+	if err != nil {
+		return en.Encode(errors.New("ERR invalid first DB index"), false)
+	}
+	second, err := strconv.Atoi(args[1])
+	if err != nil {
+		return en.Encode(errors.New("ERR invalid second DB index"), false)
+	}
+	if first < 0 || first >= len(e.dbs) || second < 0 || second >= len(e.dbs) {
+		return en.Encode(errDBIndex, false)
+	}
+	e.dbs[first].Swap(e.dbs[second])
+	return en.Encode("OK", true)
+}
+
+/*
+COPY source destination [DB destination-db] [REPLACE]
+*/
+func (e *Executor) CmdCopy(args []string) []byte {
+	en := protocol.Encoder{}
+	dst := e.store
+	replace := false
+	for i := 2; i < len(args); i++ {
+		switch opt := strings.ToUpper(args[i]); {
+		case opt == "REPLACE":
+			replace = true
+		case opt == "DB" && i+1 < len(args):
+			db, err := e.parseDB(args[i+1])
+			if err != nil {
+				return en.Encode(err, false)
+			}
+			dst = db
+			i++
+		default:
+			return en.Encode(errSyntax, false)
+		}
+	}
+	if dst == e.store && args[0] == args[1] {
+		return en.Encode(errSameObjects, false)
+	}
+	copied, err := e.store.Copy(args[0], dst, args[1], replace)
+	if err != nil {
+		return en.Encode(errors.New("ERR "+err.Error()), false)
+	}
+	if copied {
+		return en.Encode(1, false)
+	}
+	return en.Encode(0, false)
+}
@@ -0,0 +1,175 @@
+package command
+
+/*
+Group and summary of the builtin commands, reported by COMMAND DOCS
+*/
+var builtinDocs = map[string]struct {
+	group   string
+	summary string
+}{
+	CmdPing:               {"connection", "Returns the server's liveliness response."},
+	CmdSet:                {"string", "Sets the string value of a key, ignoring its type. The key is created if it doesn't exist."},
+	CmdGet:                {"string", "Returns the string value of a key."},
+	CmdTtl:                {"generic", "Returns the expiration time in seconds of a key."},
+	CmdExpire:             {"generic", "Sets the expiration time of a key."},
+	CmdExist:              {"generic", "Determines whether one or more keys exist."},
+	CmdDel:                {"generic", "Deletes one or more keys."},
+	CmdZadd:               {"sorted-set", "Adds one or more members to a sorted set, or updates their scores. Creates the key if it doesn't exist."},
+	CmdZrank:              {"sorted-set", "Returns the index of a member in a sorted set ordered by ascending scores."},
+	CmdZScore:             {"sorted-set", "Returns the score of a member in a sorted set."},
+	CmdZrevrank:           {"sorted-set", "Returns the index of a member in a sorted set ordered by descending scores."},
+	CmdZrem:               {"sorted-set", "Removes one or more members from a sorted set. Deletes the sorted set if all members were removed."},
+	CmdZcard:              {"sorted-set", "Returns the number of members in a sorted set."},
+	CmdZcount:             {"sorted-set", "Returns the count of members in a sorted set that have scores within a range."},
+	CmdZincrby:            {"sorted-set", "Increments the score of a member in a sorted set."},
+	CmdZmscore:            {"sorted-set", "Returns the score of one or more members in a sorted set."},
+	CmdZrange:             {"sorted-set", "Returns members in a sorted set within a range of indexes, scores or lexicographical values."},
+	CmdZrangeStore:        {"sorted-set", "Stores a range of members from sorted set in a key."},
+	CmdZremRangeByRank:    {"sorted-set", "Removes members in a sorted set within a range of indexes."},
+	CmdZremRangeByScore:   {"sorted-set", "Removes members in a sorted set within a range of scores."},
+	CmdZremRangeByLex:     {"sorted-set", "Removes members in a sorted set within a lexicographical range."},
+	CmdZpopMin:            {"sorted-set", "Returns the lowest-scoring members from a sorted set after removing them."},
+	CmdZpopMax:            {"sorted-set", "Returns the highest-scoring members from a sorted set after removing them."},
+	CmdZrandMember:        {"sorted-set", "Returns one or more random members from a sorted set."},
+	CmdZlexcount:          {"sorted-set", "Returns the number of members in a sorted set within a lexicographical range."},
+	CmdZunion:             {"sorted-set", "Returns the union of multiple sorted sets."},
+	CmdZinter:             {"sorted-set", "Returns the intersect of multiple sorted sets."},
+	CmdZdiff:              {"sorted-set", "Returns the difference between multiple sorted sets."},
+	CmdZunionStore:        {"sorted-set", "Stores the union of multiple sorted sets in a key."},
+	CmdZinterStore:        {"sorted-set", "Stores the intersect of multiple sorted sets in a key."},
+	CmdZdiffStore:         {"sorted-set", "Stores the difference of multiple sorted sets in a key."},
+	CmdZinterCard:         {"sorted-set", "Returns the number of members of the intersect of multiple sorted sets."},
+	CmdCMSINIT:            {"cms", "Initializes a Count-Min Sketch to accommodate requested tolerances."},
+	CmdCMSInitByDim:       {"cms", "Initializes a Count-Min Sketch to dimensions specified by user."},
+	CmdCMSIncrBy:          {"cms", "Increases the count of one or more items by increment."},
+	CmdCMSQuery:           {"cms", "Returns the count for one or more items in a sketch."},
+	CmdCMSMerge:           {"cms", "Merges several sketches into one sketch."},
+	CmdCMSInfo:            {"cms", "Returns information about a sketch."},
+	CmdCMSScanDump:        {"cms", "Begins an incremental save of the sketch."},
+	CmdCMSLoadChunk:       {"cms", "Restores a sketch previously saved with CMS.SCANDUMP."},
+	CmdBFReverse:          {"bf", "Creates a new Bloom Filter."},
+	CmdBFAdd:              {"bf", "Adds an item to a Bloom Filter."},
+	CmdBFMAdd:             {"bf", "Adds one or more items to a Bloom Filter. A filter will be created if it does not exist."},
+	CmdBFExist:            {"bf", "Checks whether an item exists in a Bloom Filter."},
+	CmdBFMExist:           {"bf", "Checks whether one or more items exist in a Bloom Filter."},
+	CmdBFInsert:           {"bf", "Adds one or more items to a Bloom Filter. A filter will be created if it does not exist."},
+	CmdBFInfo:             {"bf", "Returns information about a Bloom Filter."},
+	CmdBFCard:             {"bf", "Returns the cardinality of a Bloom filter."},
+	CmdBFScanDump:         {"bf", "Begins an incremental save of the bloom filter."},
+	CmdBFLoadChunk:        {"bf", "Restores a filter previously saved using SCANDUMP."},
+	CmdCFReserve:          {"cf", "Creates a new Cuckoo Filter."},
+	CmdCFAdd:              {"cf", "Adds an item to a Cuckoo Filter."},
+	CmdCFAddNX:            {"cf", "Adds an item to a Cuckoo Filter if the item did not exist previously."},
+	CmdCFInsert:           {"cf", "Adds one or more items to a Cuckoo Filter. A filter will be created if it does not exist."},
+	CmdCFExists:           {"cf", "Checks whether one or more items exist in a Cuckoo Filter."},
+	CmdCFMExists:          {"cf", "Checks whether one or more items exist in a Cuckoo Filter."},
+	CmdCFDel:              {"cf", "Deletes an item from a Cuckoo Filter."},
+	CmdCFCount:            {"cf", "Return the number of times an item might be in a Cuckoo Filter."},
+	CmdCFInfo:             {"cf", "Returns information about a Cuckoo Filter."},
+	CmdTopKReserve:        {"topk", "Initializes a TopK with specified parameters."},
+	CmdTopKAdd:            {"topk", "Increases the count of one or more items by increment."},
+	CmdTopKIncrBy:         {"topk", "Increases the count of one or more items by increment."},
+	CmdTopKQuery:          {"topk", "Checks whether one or more items are in a sketch."},
+	CmdTopKCount:          {"topk", "Return the count for one or more items are in a sketch."},
+	CmdTopKList:           {"topk", "Return full list of items in Top K list."},
+	CmdTopKInfo:           {"topk", "Returns information about a sketch."},
+	CmdPFAdd:              {"hyperloglog", "Adds elements to a HyperLogLog key. Creates the key if it doesn't exist."},
+	CmdPFCount:            {"hyperloglog", "Returns the approximated cardinality of the set(s) observed by the HyperLogLog key(s)."},
+	CmdPFMerge:            {"hyperloglog", "Merges one or more HyperLogLog values into a single key."},
+	CmdTDigestCreate:      {"tdigest", "Allocates memory and initializes a new t-digest sketch."},
+	CmdTDigestAdd:         {"tdigest", "Adds one or more observations to a t-digest sketch."},
+	CmdTDigestQuantile:    {"tdigest", "Returns, for each input fraction, an estimation of the value smaller than the given fraction of observations."},
+	CmdTDigestCDF:         {"tdigest", "Returns, for each input value, an estimation of the fraction of observations smaller than the given value."},
+	CmdTDigestRank:        {"tdigest", "Returns, for each input value, an estimation of the number of observations smaller than the given value."},
+	CmdTDigestMin:         {"tdigest", "Returns the minimum observation value from a t-digest sketch."},
+	CmdTDigestMax:         {"tdigest", "Returns the maximum observation value from a t-digest sketch."},
+	CmdTDigestTrimmedMean: {"tdigest", "Returns an estimation of the mean value from the sketch, excluding observation values outside the low and high cutoff quantiles."},
+	CmdTDigestMerge:       {"tdigest", "Merges multiple t-digest sketches into a single sketch."},
+	CmdTDigestReset:       {"tdigest", "Resets a t-digest sketch: empty the sketch and re-initializes it."},
+	CmdTSCreate:           {"timeseries", "Create a new time series."},
+	CmdTSAdd:              {"timeseries", "Append a sample to a time series."},
+	CmdTSMAdd:             {"timeseries", "Append new samples to one or more time series."},
+	CmdTSRange:            {"timeseries", "Query a range in forward direction."},
+	CmdTSRevRange:         {"timeseries", "Query a range in reverse direction."},
+	CmdTSMRange:           {"timeseries", "Query a range across multiple time series by filters in forward direction."},
+	CmdTSCreateRule:       {"timeseries", "Create a compaction rule."},
+	CmdXAdd:               {"stream", "Appends a new message to a stream. Creates the key if it doesn't exist."},
+	CmdXTrim:              {"stream", "Deletes messages from the beginning of a stream."},
+	CmdXLen:               {"stream", "Return the number of messages in a stream."},
+	CmdXDel:               {"stream", "Returns the number of messages after removing them from a stream."},
+	CmdXRange:             {"stream", "Returns the messages from a stream within a range of IDs."},
+	CmdXRevRange:          {"stream", "Returns the messages from a stream within a range of IDs in reverse order."},
+	CmdXRead:              {"stream", "Returns messages from multiple streams with IDs greater than the ones requested. Blocks until a message is available otherwise."},
+	CmdXReadGroup:         {"stream", "Returns new or historical messages from a stream for a consumer in a group. Blocks until a message is available otherwise."},
+	CmdXGroup:             {"stream", "A container for consumer groups commands."},
+	CmdXAck:               {"stream", "Returns the number of messages that were successfully acknowledged by the consumer group member of a stream."},
+	CmdXPending:           {"stream", "Returns the information and entries from a stream consumer group's pending entries list."},
+	CmdXClaim:             {"stream", "Changes, or acquires, ownership of a message in a consumer group, as if the message was delivered a consumer group member."},
+	CmdXAutoClaim:         {"stream", "Changes, or acquires, ownership of messages in a consumer group, as if the messages were delivered to as consumer group member."},
+	CmdXInfo:              {"stream", "A container for stream introspection commands."},
+	CmdGeoAdd:             {"geo", "Adds one or more members to a geospatial index. The key is created if it doesn't exist."},
+	CmdGeoPos:             {"geo", "Returns the longitude and latitude of members from a geospatial index."},
+	CmdGeoDist:            {"geo", "Returns the distance between two members of a geospatial index."},
+	CmdGeoHash:            {"geo", "Returns members from a geospatial index as geohash strings."},
+	CmdGeoSearch:          {"geo", "Queries a geospatial index for members inside an area of a box or a circle."},
+	CmdGeoSearchStore:     {"geo", "Queries a geospatial index for members inside an area of a box or a circle, optionally stores the result."},
+	CmdPublish:            {"pubsub", "Posts a message to a channel."},
+	CmdSPublish:           {"pubsub", "Post a message to a shard channel"},
+	CmdPubSub:             {"pubsub", "A container for Pub/Sub commands."},
+	CmdConfig:             {"server", "A container for server configuration commands."},
+	CmdEval:               {"scripting", "Executes a server-side Lua script."},
+	CmdEvalSha:            {"scripting", "Executes a server-side Lua script by SHA1 digest."},
+	CmdScript:             {"scripting", "A container for Lua scripts management commands."},
+	CmdInfo:               {"server", "Returns information and statistics about the server."},
+	CmdObject:             {"generic", "A container for object introspection commands."},
+	CmdCommand:            {"server", "Returns detailed information about all commands."},
+	CmdSubscribe:          {"pubsub", "Listens for messages published to channels."},
+	CmdPSubscribe:         {"pubsub", "Listens for messages published to channels that match one or more patterns."},
+	CmdSSubscribe:         {"pubsub", "Listens for messages published to shard channels."},
+	CmdUnsubscribe:        {"pubsub", "Stops listening to messages posted to channels."},
+	CmdPUnsubscribe:       {"pubsub", "Stops listening to messages published to channels that match one or more patterns."},
+	CmdSUnsubscribe:       {"pubsub", "Stops listening to messages posted to shard channels."},
+	CmdMulti:              {"transactions", "Starts a transaction."},
+	CmdExec:               {"transactions", "Executes all commands in a transaction."},
+	CmdDiscard:            {"transactions", "Discards a transaction."},
+	CmdWatch:              {"transactions", "Monitors changes to keys to determine the execution of a transaction."},
+	CmdUnwatch:            {"transactions", "Forgets about watched keys of a transaction."},
+	CmdQuit:               {"connection", "Closes the connection."},
+	CmdReset:              {"connection", "Resets the connection."},
+	CmdSelect:             {"connection", "Changes the selected database."},
+	CmdDBSize:             {"server", "Returns the number of keys in the database."},
+	CmdFlushDB:            {"server", "Remove all keys from the current database."},
+	CmdFlushAll:           {"server", "Removes all keys from all databases."},
+	CmdMove:               {"generic", "Moves a key to another database."},
+	CmdSwapDB:             {"server", "Swaps two Redis databases."},
+	CmdCopy:               {"generic", "Copies the value of a key to a new key."},
+	CmdKeys:               {"generic", "Returns all key names that match a pattern."},
+	CmdScan:               {"generic", "Iterates over the key names in the database."},
+	CmdRename:             {"generic", "Renames a key and overwrites the destination."},
+	CmdRenameNX:           {"generic", "Renames a key only when the target key name doesn't exist."},
+	CmdRandomKey:          {"generic", "Returns a random key name from the database."},
+	CmdTouch:              {"generic", "Returns the number of existing keys out of those specified after updating the time they were last accessed."},
+	CmdUnlink:             {"generic", "Asynchronously deletes one or more keys."},
+}
+
+/*
+ACL category of the commands of each group
+*/
+var groupCategories = map[string]string{
+	"generic":      "keyspace",
+	"string":       "string",
+	"sorted-set":   "sortedset",
+	"hyperloglog":  "hyperloglog",
+	"stream":       "stream",
+	"geo":          "geo",
+	"pubsub":       "pubsub",
+	"scripting":    "scripting",
+	"transactions": "transaction",
+	"connection":   "connection",
+	"bf":           "bloom",
+	"cf":           "cuckoo",
+	"cms":          "cms",
+	"topk":         "topk",
+	"tdigest":      "tdigest",
+	"timeseries":   "timeseries",
+}
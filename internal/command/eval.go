@@ -0,0 +1,431 @@
+package command
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"tcp-server.com/m/internal/config"
+	"tcp-server.com/m/internal/protocol"
+	"tcp-server.com/m/internal/script"
+)
+
+/*
+Script cache and the script being run, shared by every Executor view
+*/
+type scripting struct {
+	mu sync.Mutex
+	// Compiled scripts by lowercase SHA1 of their source
+	cache   map[string]*script.Chunk
+	running atomic.Pointer[scriptRun]
+}
+
+type scriptRun struct {
+	start time.Time
+	// Storage.Dirty when the script started, a script that wrote cannot
+	// be killed
+	dirty  uint64
+	killed atomic.Bool
+}
+
+var errScriptKilled = errors.New("ERR Script killed by user with SCRIPT KILL...")
+
+var errBusy = errors.New("BUSY Redis is busy running a script. You can only call SCRIPT KILL or SHUTDOWN NOSAVE.")
+
+func newScripting() *scripting {
+	return &scripting{cache: make(map[string]*script.Chunk)}
+}
+
+/*
+Once a script runs longer than lua-time-limit other clients get a BUSY
+error, except for SCRIPT KILL
+*/
+func (s *scripting) busy(cmd *Command) error {
+	run := s.running.Load()
+	if run == nil || time.Since(run.start) < time.Duration(config.ScriptTimeLimitMs.Load())*time.Millisecond {
+		return nil
+	}
+	if cmd.Name == CmdScript && len(cmd.Args) > 0 && strings.EqualFold(cmd.Args[0], "KILL") {
+		return nil
+	}
+	return errBusy
+}
+
+func sha1hex(s string) string {
+	sum := sha1.Sum([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+/*
+Compile `src` and add it to the cache, returns its SHA1
+*/
+func (s *scripting) load(src string) (string, *script.Chunk, error) {
+	sha := sha1hex(src)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if chunk, ok := s.cache[sha]; ok {
+		return sha, chunk, nil
+	}
+	chunk, err := script.Compile(src)
+	if err != nil {
+		return "", nil, fmt.Errorf("ERR Error compiling script (new function): %v", err)
+	}
+	s.cache[sha] = chunk
+	return sha, chunk, nil
+}
+
+func (s *scripting) lookup(sha string) *script.Chunk {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.cache[strings.ToLower(sha)]
+}
+
+/*
+EVAL script numkeys [key ...] [arg ...]
+*/
+func (e *Executor) CmdEval(args []string) []byte {
+	en := protocol.Encoder{}
+	keys, argv, err := scriptArgs(args[1:])
+	if err != nil {
+		return en.Encode(err, false)
+	}
+	sha, chunk, err := e.scripts.load(args[0])
+	if err != nil {
+		return en.Encode(err, false)
+	}
+	return e.runScript(sha, chunk, keys, argv)
+}
+
+/*
+EVALSHA sha1 numkeys [key ...] [arg ...]
+*/
+func (e *Executor) CmdEvalSha(args []string) []byte {
+	en := protocol.Encoder{}
+	keys, argv, err := scriptArgs(args[1:])
+	if err != nil {
+		return en.Encode(err, false)
+	}
+	chunk := e.scripts.lookup(args[0])
+	if chunk == nil {
+		return en.Encode(errors.New("NOSCRIPT No matching script. Please use EVAL."), false)
+	}
+	return e.runScript(strings.ToLower(args[0]), chunk, keys, argv)
+}
+
+/*
+Split `numkeys key... arg...` in KEYS and ARGV
+*/
+func scriptArgs(args []string) ([]string, []string, error) {
+	numkeys, err := strconv.Atoi(args[0])
+	if err != nil {
+		return nil, nil, errors.New("ERR value is not an integer or out of range")
+	}
+	if numkeys < 0 {
+		return nil, nil, errors.New("ERR Number of keys can't be negative")
+	}
+	if numkeys > len(args)-1 {
+		return nil, nil, errors.New("ERR Number of keys can't be greater than number of args")
+	}
+	return args[1 : 1+numkeys], args[1+numkeys:], nil
+}
+
+/*
+SCRIPT LOAD script
+SCRIPT EXISTS sha1 [sha1 ...]
+SCRIPT FLUSH [ASYNC|SYNC]
+SCRIPT KILL
+*/
+func (e *Executor) CmdScript(args []string) []byte {
+	en := protocol.Encoder{}
+	sub := strings.ToUpper(args[0])
+	switch {
+	case sub == "LOAD" && len(args) == 2:
+		sha, _, err := e.scripts.load(args[1])
+		if err != nil {
+			return en.Encode(err, false)
+		}
+		return en.Encode(sha, false)
+	case sub == "EXISTS" && len(args) >= 2:
+		res := make([]int, len(args)-1)
+		for i, sha := range args[1:] {
+			if e.scripts.lookup(sha) != nil {
+				res[i] = 1
+			}
+		}
+		return en.Encode(res, false)
+	case sub == "FLUSH" && len(args) <= 2:
+		if len(args) == 2 && !strings.EqualFold(args[1], "ASYNC") && !strings.EqualFold(args[1], "SYNC") {
+			return en.Encode(errors.New("ERR SCRIPT FLUSH only support SYNC|ASYNC option"), false)
+		}
+		e.scripts.mu.Lock()
+		e.scripts.cache = make(map[string]*script.Chunk)
+		e.scripts.mu.Unlock()
+		return en.Encode("OK", true)
+	case sub == "KILL" && len(args) == 1:
+		run := e.scripts.running.Load()
+		if run == nil {
+			return en.Encode(errors.New("NOTBUSY No scripts in execution right now."), false)
+		}
+		if e.dirty() != run.dirty {
+			return en.Encode(errors.New("UNKILLABLE Sorry the script already executed write commands against the dataset. You can either wait the script termination or kill the server in a hard way using the SHUTDOWN NOSAVE command."), false)
+		}
+		run.killed.Store(true)
+		return en.Encode("OK", true)
+	case sub == "LOAD" || sub == "EXISTS" || sub == "FLUSH" || sub == "KILL":
+		return en.Encode(errors.New("ERR wrong number of arguments for 'script|"+strings.ToLower(sub)+"' command"), false)
+	}
+	return en.Encode(errors.New("ERR unknown subcommand '"+args[0]+"'. Try SCRIPT HELP."), false)
+}
+
+/*
+Run a script holding the lock exclusively, other clients wait until it is
+done. A SELECT in the script does not change the database of the caller
+*/
+func (e *Executor) runScript(sha string, chunk *script.Chunk, keys []string, argv []string) []byte {
+	en := protocol.Encoder{}
+	if !e.exclusive {
+		e.lock.Lock()
+		defer e.lock.Unlock()
+	}
+	ex := e.exclusiveView()
+	run := &scriptRun{start: time.Now(), dirty: e.dirty()}
+	e.scripts.running.Store(run)
+	defer e.scripts.running.Store(nil)
+
+	it := script.New()
+	it.Hook = func() error {
+		if run.killed.Load() {
+			return errScriptKilled
+		}
+		return nil
+	}
+	it.SetGlobal("KEYS", stringsToTable(keys))
+	it.SetGlobal("ARGV", stringsToTable(argv))
+	it.SetGlobal("redis", ex.redisLib())
+	res, err := it.Run(chunk)
+	if err != nil {
+		var scriptErr *script.Error
+		if !errors.As(err, &scriptErr) {
+			return en.Encode(err, false)
+		}
+		if t, ok := scriptErr.Value.(*script.Table); ok {
+			if msg, ok := t.Get("err").(string); ok {
+				// Error replies raised by redis.call or error_reply go
+				// through as they are
+				return en.Encode(errors.New(msg), false)
+			}
+		}
+		return en.Encode(fmt.Errorf("ERR %v script: %s", err, sha), false)
+	}
+	var v script.Value
+	if len(res) > 0 {
+		v = res[0]
+	}
+	return en.Encode(scriptToReply(v), false)
+}
+
+func stringsToTable(items []string) *script.Table {
+	values := make([]script.Value, len(items))
+	for i, item := range items {
+		values[i] = item
+	}
+	return script.NewArray(values)
+}
+
+/*
+The redis table of scripts
+*/
+func (e *Executor) redisLib() *script.Table {
+	lib := script.NewTable()
+	lib.Set("call", &script.GoFunction{Name: "call", Fn: func(it *script.Interp, args []script.Value) ([]script.Value, error) {
+		return e.scriptCall(it, args, true)
+	}})
+	lib.Set("pcall", &script.GoFunction{Name: "pcall", Fn: func(it *script.Interp, args []script.Value) ([]script.Value, error) {
+		return e.scriptCall(it, args, false)
+	}})
+	lib.Set("error_reply", &script.GoFunction{Name: "error_reply", Fn: func(it *script.Interp, args []script.Value) ([]script.Value, error) {
+		return replyTable(it, args, "err")
+	}})
+	lib.Set("status_reply", &script.GoFunction{Name: "status_reply", Fn: func(it *script.Interp, args []script.Value) ([]script.Value, error) {
+		return replyTable(it, args, "ok")
+	}})
+	lib.Set("sha1hex", &script.GoFunction{Name: "sha1hex", Fn: func(it *script.Interp, args []script.Value) ([]script.Value, error) {
+		s, ok := firstString(args)
+		if !ok {
+			return nil, it.Errorf("wrong number of arguments")
+		}
+		return []script.Value{sha1hex(s)}, nil
+	}})
+	lib.Set("log", &script.GoFunction{Name: "log", Fn: scriptLog})
+	for i, name := range []string{"LOG_DEBUG", "LOG_VERBOSE", "LOG_NOTICE", "LOG_WARNING"} {
+		lib.Set(name, float64(i))
+	}
+	lib.Freeze()
+	return lib
+}
+
+func firstString(args []script.Value) (string, bool) {
+	if len(args) == 0 {
+		return "", false
+	}
+	switch v := args[0].(type) {
+	case string:
+		return v, true
+	case float64:
+		return script.ToString(v), true
+	}
+	return "", false
+}
+
+/*
+redis.error_reply(msg) and redis.status_reply(msg): a table with a single
+`field`
+*/
+func replyTable(it *script.Interp, args []script.Value, field string) ([]script.Value, error) {
+	msg, ok := firstString(args)
+	if len(args) != 1 || !ok {
+		return nil, it.Errorf("wrong number or type of arguments")
+	}
+	t := script.NewTable()
+	t.Set(field, msg)
+	return []script.Value{t}, nil
+}
+
+/*
+redis.log(level, message ...)
+*/
+func scriptLog(it *script.Interp, args []script.Value) ([]script.Value, error) {
+	if len(args) < 2 {
+		return nil, it.Errorf("redis.log() requires two arguments or more.")
+	}
+	if _, ok := args[0].(float64); !ok {
+		return nil, it.Errorf("First argument must be a number (log level).")
+	}
+	parts := make([]string, 0, len(args)-1)
+	for _, arg := range args[1:] {
+		parts = append(parts, script.ToString(arg))
+	}
+	log.Printf("Script: %s\n", strings.Join(parts, " "))
+	return nil, nil
+}
+
+/*
+redis.call and redis.pcall: run a command from a script. Error replies are
+raised by call and returned as {err=...} by pcall
+*/
+func (e *Executor) scriptCall(it *script.Interp, args []script.Value, raise bool) ([]script.Value, error) {
+	if len(args) == 0 {
+		return nil, it.Errorf("Please specify at least one argument for this redis lib call")
+	}
+	strs := make([]string, len(args))
+	for i, arg := range args {
+		switch v := arg.(type) {
+		case string:
+			strs[i] = v
+		case float64:
+			strs[i] = script.ToString(v)
+		default:
+			return nil, it.Errorf("Lua redis lib command arguments must be strings or integers")
+		}
+	}
+	cmd, err := e.CmdParser(strs)
+	if err != nil {
+		return nil, it.Errorf("%v", err)
+	}
+
+	var reply any
+	spec := Lookup(cmd.Name)
+	switch {
+	case spec != nil && spec.Flags&FlagNoScript != 0:
+		reply = errors.New("ERR This Redis command is not allowed from script")
+	case e.Validate(cmd) != nil:
+		if spec == nil {
+			reply = errors.New("ERR Unknown Redis command called from script")
+		} else {
+			reply = errors.New("ERR Wrong number of args calling Redis command from script")
+		}
+	default:
+		if reply, err = protocol.DecodeReply(e.execute(cmd)); err != nil {
+			return nil, it.Errorf("%v", err)
+		}
+	}
+	v := replyToScript(reply)
+	if _, ok := reply.(error); ok && raise {
+		return nil, &script.Error{Value: v}
+	}
+	return []script.Value{v}, nil
+}
+
+/*
+RESP reply to a script value: integers become numbers, bulk strings
+strings, nil false, arrays tables, status replies {ok=...} and errors
+{err=...}
+*/
+func replyToScript(reply any) script.Value {
+	switch r := reply.(type) {
+	case int64:
+		return float64(r)
+	case float64:
+		return strconv.FormatFloat(r, 'f', -1, 64)
+	case string:
+		return r
+	case protocol.Status:
+		t := script.NewTable()
+		t.Set("ok", string(r))
+		return t
+	case error:
+		t := script.NewTable()
+		t.Set("err", r.Error())
+		return t
+	case []any:
+		values := make([]script.Value, len(r))
+		for i, item := range r {
+			values[i] = replyToScript(item)
+		}
+		return script.NewArray(values)
+	}
+	return false
+}
+
+/*
+Script value to a reply: numbers are truncated to integers, true is 1,
+false and nil are nil, tables with an err or ok field are error and status
+replies and other tables arrays stopping at the first nil
+*/
+func scriptToReply(v script.Value) any {
+	en := protocol.Encoder{}
+	switch x := v.(type) {
+	case bool:
+		if x {
+			return int64(1)
+		}
+		return nil
+	case float64:
+		return int64(x)
+	case string:
+		return x
+	case *script.Table:
+		if msg, ok := x.Get("err").(string); ok {
+			return errors.New(msg)
+		}
+		if msg, ok := x.Get("ok").(string); ok {
+			return protocol.Raw(en.Encode(msg, true))
+		}
+		res := make([]any, 0, x.Len())
+		for i := 1; ; i++ {
+			item := x.Get(float64(i))
+			if item == nil {
+				return res
+			}
+			res = append(res, scriptToReply(item))
+		}
+	}
+	return nil
+}
@@ -4,16 +4,30 @@ import (
 	"bytes"
 	"errors"
 	"fmt"
+	"slices"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
+	"tcp-server.com/m/internal/config"
 	"tcp-server.com/m/internal/datastructure"
 	"tcp-server.com/m/internal/protocol"
+	"tcp-server.com/m/internal/pubsub"
 )
 
 type Executor struct {
-	store *datastructure.Storage
+	// Database selected by the client, one of `dbs`
+	store  *datastructure.Storage
+	dbs    []*datastructure.Storage
+	broker *pubsub.Broker
+	// Held shared by every command and exclusively by a transaction or a
+	// script, so that no other client runs a command in the middle of it
+	lock *sync.RWMutex
+	// Set while the lock is held exclusively: blocking commands return
+	// right away instead of waiting, like Redis does
+	exclusive bool
+	scripts   *scripting
 }
 
 type Command struct {
@@ -21,22 +35,54 @@ type Command struct {
 	Args []string
 }
 
-func NewExecutor(store *datastructure.Storage) *Executor {
+func NewExecutor(dbs []*datastructure.Storage, broker *pubsub.Broker) *Executor {
 	return &Executor{
-		store: store,
+		store:   dbs[0],
+		dbs:     dbs,
+		broker:  broker,
+		lock:    &sync.RWMutex{},
+		scripts: newScripting(),
 	}
 }
 
+/*
+Keyspace the commands run on
+*/
+func (e *Executor) Store() *datastructure.Storage {
+	return e.store
+}
+
+/*
+Executor of a client connection, starting on database 0. SELECT only
+changes the database of this copy
+*/
+func (e *Executor) Session() *Executor {
+	session := *e
+	session.store = e.dbs[0]
+	return &session
+}
+
+/*
+Changes made to every database, see Storage.Dirty
+*/
+func (e *Executor) dirty() uint64 {
+	var res uint64
+	for _, db := range e.dbs {
+		res += db.Dirty()
+	}
+	return res
+}
+
 func (e *Executor) CmdParser(data []string) (*Command, error) {
 	if len(data) == 0 {
 		return nil, fmt.Errorf("empty input")
 	}
 
+	// Only the command name is case insensitive, arguments are kept byte for
+	// byte since they may be values or binary payloads
 	cmd := strings.ToUpper(data[0])
 	args := make([]string, len(data)-1)
-	for i := 1; i < len(data); i++ {
-		args[i-1] = strings.ToUpper(data[i])
-	}
+	copy(args, data[1:])
 
 	return &Command{
 		Name: cmd,
@@ -45,65 +91,348 @@ func (e *Executor) CmdParser(data []string) (*Command, error) {
 }
 
 const (
-	CmdPing      = "PING"
-	CmdSet       = "SET"
-	CmdGet       = "GET"
-	CmdTtl       = "TTL"
-	CmdDel       = "DEL"
-	CmdExist     = "EXIST"
-	CmdExpire    = "EXPIRE"
-	CmdZadd      = "ZADD"
-	CmdZScore    = "ZSCORE"
-	CmdZrank     = "ZRANK"
-	CmdCMSINIT   = "CMS.INITBYPROB"
-	CmdCMSIncrBy = "CMS.INCRBY"
-	CmdCMSQuery  = "CMS.QUERY"
-	CmdBFReverse = "BF.RESERVE"
-	CmdBFMAdd    = "BF.ADD"
-	CmdBFExist   = "BF.EXISTS"
-	CmdInfo      = "INFO"
+	CmdPing               = "PING"
+	CmdSet                = "SET"
+	CmdGet                = "GET"
+	CmdTtl                = "TTL"
+	CmdDel                = "DEL"
+	CmdExist              = "EXIST"
+	CmdExpire             = "EXPIRE"
+	CmdZadd               = "ZADD"
+	CmdZScore             = "ZSCORE"
+	CmdZrank              = "ZRANK"
+	CmdZrevrank           = "ZREVRANK"
+	CmdZrem               = "ZREM"
+	CmdZcard              = "ZCARD"
+	CmdZcount             = "ZCOUNT"
+	CmdZincrby            = "ZINCRBY"
+	CmdZmscore            = "ZMSCORE"
+	CmdZrange             = "ZRANGE"
+	CmdZrangeStore        = "ZRANGESTORE"
+	CmdZremRangeByRank    = "ZREMRANGEBYRANK"
+	CmdZremRangeByScore   = "ZREMRANGEBYSCORE"
+	CmdZremRangeByLex     = "ZREMRANGEBYLEX"
+	CmdZpopMin            = "ZPOPMIN"
+	CmdZpopMax            = "ZPOPMAX"
+	CmdZrandMember        = "ZRANDMEMBER"
+	CmdZlexcount          = "ZLEXCOUNT"
+	CmdZunion             = "ZUNION"
+	CmdZinter             = "ZINTER"
+	CmdZdiff              = "ZDIFF"
+	CmdZunionStore        = "ZUNIONSTORE"
+	CmdZinterStore        = "ZINTERSTORE"
+	CmdZdiffStore         = "ZDIFFSTORE"
+	CmdZinterCard         = "ZINTERCARD"
+	CmdCMSINIT            = "CMS.INITBYPROB"
+	CmdCMSInitByDim       = "CMS.INITBYDIM"
+	CmdCMSIncrBy          = "CMS.INCRBY"
+	CmdCMSQuery           = "CMS.QUERY"
+	CmdCMSMerge           = "CMS.MERGE"
+	CmdCMSInfo            = "CMS.INFO"
+	CmdCMSScanDump        = "CMS.SCANDUMP"
+	CmdCMSLoadChunk       = "CMS.LOADCHUNK"
+	CmdBFReverse          = "BF.RESERVE"
+	CmdBFAdd              = "BF.ADD"
+	CmdBFMAdd             = "BF.MADD"
+	CmdBFExist            = "BF.EXISTS"
+	CmdBFMExist           = "BF.MEXISTS"
+	CmdBFInsert           = "BF.INSERT"
+	CmdBFInfo             = "BF.INFO"
+	CmdBFCard             = "BF.CARD"
+	CmdBFScanDump         = "BF.SCANDUMP"
+	CmdBFLoadChunk        = "BF.LOADCHUNK"
+	CmdCFReserve          = "CF.RESERVE"
+	CmdCFAdd              = "CF.ADD"
+	CmdCFAddNX            = "CF.ADDNX"
+	CmdCFInsert           = "CF.INSERT"
+	CmdCFExists           = "CF.EXISTS"
+	CmdCFMExists          = "CF.MEXISTS"
+	CmdCFDel              = "CF.DEL"
+	CmdCFCount            = "CF.COUNT"
+	CmdCFInfo             = "CF.INFO"
+	CmdTopKReserve        = "TOPK.RESERVE"
+	CmdTopKAdd            = "TOPK.ADD"
+	CmdTopKIncrBy         = "TOPK.INCRBY"
+	CmdTopKQuery          = "TOPK.QUERY"
+	CmdTopKCount          = "TOPK.COUNT"
+	CmdTopKList           = "TOPK.LIST"
+	CmdTopKInfo           = "TOPK.INFO"
+	CmdPFAdd              = "PFADD"
+	CmdPFCount            = "PFCOUNT"
+	CmdPFMerge            = "PFMERGE"
+	CmdTDigestCreate      = "TDIGEST.CREATE"
+	CmdTDigestAdd         = "TDIGEST.ADD"
+	CmdTDigestQuantile    = "TDIGEST.QUANTILE"
+	CmdTDigestCDF         = "TDIGEST.CDF"
+	CmdTDigestRank        = "TDIGEST.RANK"
+	CmdTDigestMin         = "TDIGEST.MIN"
+	CmdTDigestMax         = "TDIGEST.MAX"
+	CmdTDigestTrimmedMean = "TDIGEST.TRIMMED_MEAN"
+	CmdTDigestMerge       = "TDIGEST.MERGE"
+	CmdTDigestReset       = "TDIGEST.RESET"
+	CmdTSCreate           = "TS.CREATE"
+	CmdTSAdd              = "TS.ADD"
+	CmdTSMAdd             = "TS.MADD"
+	CmdTSRange            = "TS.RANGE"
+	CmdTSRevRange         = "TS.REVRANGE"
+	CmdTSMRange           = "TS.MRANGE"
+	CmdTSCreateRule       = "TS.CREATERULE"
+	CmdXAdd               = "XADD"
+	CmdXTrim              = "XTRIM"
+	CmdXLen               = "XLEN"
+	CmdXDel               = "XDEL"
+	CmdXRange             = "XRANGE"
+	CmdXRevRange          = "XREVRANGE"
+	CmdXRead              = "XREAD"
+	CmdXReadGroup         = "XREADGROUP"
+	CmdXGroup             = "XGROUP"
+	CmdXAck               = "XACK"
+	CmdXPending           = "XPENDING"
+	CmdXClaim             = "XCLAIM"
+	CmdXAutoClaim         = "XAUTOCLAIM"
+	CmdXInfo              = "XINFO"
+	CmdGeoAdd             = "GEOADD"
+	CmdGeoPos             = "GEOPOS"
+	CmdGeoDist            = "GEODIST"
+	CmdGeoHash            = "GEOHASH"
+	CmdGeoSearch          = "GEOSEARCH"
+	CmdGeoSearchStore     = "GEOSEARCHSTORE"
+	CmdPublish            = "PUBLISH"
+	CmdSPublish           = "SPUBLISH"
+	CmdPubSub             = "PUBSUB"
+	CmdConfig             = "CONFIG"
+	CmdEval               = "EVAL"
+	CmdEvalSha            = "EVALSHA"
+	CmdScript             = "SCRIPT"
+	CmdInfo               = "INFO"
+	CmdObject             = "OBJECT"
+	CmdCommand            = "COMMAND"
+	CmdSubscribe          = "SUBSCRIBE"
+	CmdPSubscribe         = "PSUBSCRIBE"
+	CmdSSubscribe         = "SSUBSCRIBE"
+	CmdUnsubscribe        = "UNSUBSCRIBE"
+	CmdPUnsubscribe       = "PUNSUBSCRIBE"
+	CmdSUnsubscribe       = "SUNSUBSCRIBE"
+	CmdMulti              = "MULTI"
+	CmdExec               = "EXEC"
+	CmdDiscard            = "DISCARD"
+	CmdWatch              = "WATCH"
+	CmdUnwatch            = "UNWATCH"
+	CmdQuit               = "QUIT"
+	CmdReset              = "RESET"
+	CmdSelect             = "SELECT"
+	CmdDBSize             = "DBSIZE"
+	CmdFlushDB            = "FLUSHDB"
+	CmdFlushAll           = "FLUSHALL"
+	CmdMove               = "MOVE"
+	CmdSwapDB             = "SWAPDB"
+	CmdCopy               = "COPY"
+	CmdKeys               = "KEYS"
+	CmdScan               = "SCAN"
+	CmdRename             = "RENAME"
+	CmdRenameNX           = "RENAMENX"
+	CmdRandomKey          = "RANDOMKEY"
+	CmdTouch              = "TOUCH"
+	CmdUnlink             = "UNLINK"
 )
 
+/*
+Commands built into the server, registered at startup
+*/
+var builtinCommands = []*Spec{
+	{Name: CmdPing, Arity: -1, Flags: FlagFast, Handler: (*Executor).cmdPING},
+	{Name: CmdSet, Arity: -3, Flags: FlagWrite, FirstKey: 1, LastKey: 1, Step: 1, Handler: (*Executor).cmdSET},
+	{Name: CmdGet, Arity: 2, Flags: FlagReadonly | FlagFast, FirstKey: 1, LastKey: 1, Step: 1, Handler: (*Executor).cmdGET},
+	{Name: CmdTtl, Arity: 2, Flags: FlagReadonly | FlagFast, FirstKey: 1, LastKey: 1, Step: 1, Handler: (*Executor).cmdTTL},
+	{Name: CmdExpire, Arity: -3, Flags: FlagWrite | FlagFast, FirstKey: 1, LastKey: 1, Step: 1, Handler: (*Executor).cmdExpr},
+	{Name: CmdExist, Arity: -2, Flags: FlagReadonly | FlagFast, FirstKey: 1, LastKey: -1, Step: 1, Handler: (*Executor).cmdExist},
+	{Name: CmdDel, Arity: -2, Flags: FlagWrite, FirstKey: 1, LastKey: -1, Step: 1, Handler: (*Executor).cmdDel},
+	{Name: CmdZadd, Arity: -4, Flags: FlagWrite | FlagFast, FirstKey: 1, LastKey: 1, Step: 1, Handler: (*Executor).CmdZadd},
+	{Name: CmdZrank, Arity: 3, Flags: FlagReadonly | FlagFast, FirstKey: 1, LastKey: 1, Step: 1, Handler: (*Executor).CmdZrank},
+	{Name: CmdZScore, Arity: 3, Flags: FlagReadonly | FlagFast, FirstKey: 1, LastKey: 1, Step: 1, Handler: (*Executor).CmdZScore},
+	{Name: CmdZrevrank, Arity: 3, Flags: FlagReadonly | FlagFast, FirstKey: 1, LastKey: 1, Step: 1, Handler: (*Executor).CmdZrevrank},
+	{Name: CmdZrem, Arity: -3, Flags: FlagWrite | FlagFast, FirstKey: 1, LastKey: 1, Step: 1, Handler: (*Executor).CmdZrem},
+	{Name: CmdZcard, Arity: 2, Flags: FlagReadonly | FlagFast, FirstKey: 1, LastKey: 1, Step: 1, Handler: (*Executor).CmdZcard},
+	{Name: CmdZcount, Arity: 4, Flags: FlagReadonly | FlagFast, FirstKey: 1, LastKey: 1, Step: 1, Handler: (*Executor).CmdZcount},
+	{Name: CmdZincrby, Arity: 4, Flags: FlagWrite | FlagFast, FirstKey: 1, LastKey: 1, Step: 1, Handler: (*Executor).CmdZincrby},
+	{Name: CmdZmscore, Arity: -3, Flags: FlagReadonly | FlagFast, FirstKey: 1, LastKey: 1, Step: 1, Handler: (*Executor).CmdZmscore},
+	{Name: CmdZrange, Arity: -4, Flags: FlagReadonly, FirstKey: 1, LastKey: 1, Step: 1, Handler: (*Executor).CmdZrange},
+	{Name: CmdZrangeStore, Arity: -5, Flags: FlagWrite, FirstKey: 1, LastKey: 2, Step: 1, Handler: (*Executor).CmdZrangeStore},
+	{Name: CmdZremRangeByRank, Arity: 4, Flags: FlagWrite, FirstKey: 1, LastKey: 1, Step: 1, Handler: (*Executor).CmdZremRangeByRank},
+	{Name: CmdZremRangeByScore, Arity: 4, Flags: FlagWrite, FirstKey: 1, LastKey: 1, Step: 1, Handler: (*Executor).CmdZremRangeByScore},
+	{Name: CmdZremRangeByLex, Arity: 4, Flags: FlagWrite, FirstKey: 1, LastKey: 1, Step: 1, Handler: (*Executor).CmdZremRangeByLex},
+	{Name: CmdZpopMin, Arity: -2, Flags: FlagWrite | FlagFast, FirstKey: 1, LastKey: 1, Step: 1, Handler: (*Executor).CmdZpopMin},
+	{Name: CmdZpopMax, Arity: -2, Flags: FlagWrite | FlagFast, FirstKey: 1, LastKey: 1, Step: 1, Handler: (*Executor).CmdZpopMax},
+	{Name: CmdZrandMember, Arity: -2, Flags: FlagReadonly, FirstKey: 1, LastKey: 1, Step: 1, Handler: (*Executor).CmdZrandMember},
+	{Name: CmdZlexcount, Arity: 4, Flags: FlagReadonly | FlagFast, FirstKey: 1, LastKey: 1, Step: 1, Handler: (*Executor).CmdZlexcount},
+	{Name: CmdZunion, Arity: -3, Flags: FlagReadonly, Keys: numKeysAt(0, false), Handler: (*Executor).CmdZunion},
+	{Name: CmdZinter, Arity: -3, Flags: FlagReadonly, Keys: numKeysAt(0, false), Handler: (*Executor).CmdZinter},
+	{Name: CmdZdiff, Arity: -3, Flags: FlagReadonly, Keys: numKeysAt(0, false), Handler: (*Executor).CmdZdiff},
+	{Name: CmdZunionStore, Arity: -4, Flags: FlagWrite, FirstKey: 1, LastKey: 1, Step: 1, Keys: numKeysAt(1, true), Handler: (*Executor).CmdZunionStore},
+	{Name: CmdZinterStore, Arity: -4, Flags: FlagWrite, FirstKey: 1, LastKey: 1, Step: 1, Keys: numKeysAt(1, true), Handler: (*Executor).CmdZinterStore},
+	{Name: CmdZdiffStore, Arity: -4, Flags: FlagWrite, FirstKey: 1, LastKey: 1, Step: 1, Keys: numKeysAt(1, true), Handler: (*Executor).CmdZdiffStore},
+	{Name: CmdZinterCard, Arity: -3, Flags: FlagReadonly, Keys: numKeysAt(0, false), Handler: (*Executor).CmdZinterCard},
+	{Name: CmdCMSINIT, Arity: 4, Flags: FlagWrite | FlagFast, FirstKey: 1, LastKey: 1, Step: 1, Handler: (*Executor).CmdInitCMS},
+	{Name: CmdCMSIncrBy, Arity: -4, Flags: FlagWrite | FlagFast, FirstKey: 1, LastKey: 1, Step: 1, Handler: (*Executor).CmdIncrBy},
+	{Name: CmdCMSInitByDim, Arity: 4, Flags: FlagWrite | FlagFast, FirstKey: 1, LastKey: 1, Step: 1, Handler: (*Executor).CmdInitCMSByDim},
+	{Name: CmdCMSQuery, Arity: -3, Flags: FlagReadonly | FlagFast, FirstKey: 1, LastKey: 1, Step: 1, Handler: (*Executor).CmdCMSQuery},
+	{Name: CmdCMSMerge, Arity: -4, Flags: FlagWrite, FirstKey: 1, LastKey: 1, Step: 1, Keys: numKeysAt(1, true), Handler: (*Executor).CmdCMSMerge},
+	{Name: CmdCMSInfo, Arity: 2, Flags: FlagReadonly | FlagFast, FirstKey: 1, LastKey: 1, Step: 1, Handler: (*Executor).CmdCMSInfo},
+	{Name: CmdCMSScanDump, Arity: 3, Flags: FlagReadonly, FirstKey: 1, LastKey: 1, Step: 1, Handler: (*Executor).CmdCMSScanDump},
+	{Name: CmdCMSLoadChunk, Arity: 4, Flags: FlagWrite, FirstKey: 1, LastKey: 1, Step: 1, Handler: (*Executor).CmdCMSLoadChunk},
+	{Name: CmdBFReverse, Arity: -4, Flags: FlagWrite | FlagFast, FirstKey: 1, LastKey: 1, Step: 1, Handler: (*Executor).CmdBFReverse},
+	{Name: CmdBFAdd, Arity: 3, Flags: FlagWrite | FlagFast, FirstKey: 1, LastKey: 1, Step: 1, Handler: (*Executor).CmdBFAdd},
+	{Name: CmdBFMAdd, Arity: -3, Flags: FlagWrite | FlagFast, FirstKey: 1, LastKey: 1, Step: 1, Handler: (*Executor).CmdBFMAdd},
+	{Name: CmdBFExist, Arity: 3, Flags: FlagReadonly | FlagFast, FirstKey: 1, LastKey: 1, Step: 1, Handler: (*Executor).CmdBFExist},
+	{Name: CmdBFMExist, Arity: -3, Flags: FlagReadonly | FlagFast, FirstKey: 1, LastKey: 1, Step: 1, Handler: (*Executor).CmdBFMExist},
+	{Name: CmdBFInsert, Arity: -4, Flags: FlagWrite, FirstKey: 1, LastKey: 1, Step: 1, Handler: (*Executor).CmdBFInsert},
+	{Name: CmdBFInfo, Arity: -2, Flags: FlagReadonly | FlagFast, FirstKey: 1, LastKey: 1, Step: 1, Handler: (*Executor).CmdBFInfo},
+	{Name: CmdBFCard, Arity: 2, Flags: FlagReadonly | FlagFast, FirstKey: 1, LastKey: 1, Step: 1, Handler: (*Executor).CmdBFCard},
+	{Name: CmdBFScanDump, Arity: 3, Flags: FlagReadonly, FirstKey: 1, LastKey: 1, Step: 1, Handler: (*Executor).CmdBFScanDump},
+	{Name: CmdBFLoadChunk, Arity: 4, Flags: FlagWrite, FirstKey: 1, LastKey: 1, Step: 1, Handler: (*Executor).CmdBFLoadChunk},
+	{Name: CmdCFReserve, Arity: -3, Flags: FlagWrite | FlagFast, FirstKey: 1, LastKey: 1, Step: 1, Handler: (*Executor).CmdCFReserve},
+	{Name: CmdCFAdd, Arity: 3, Flags: FlagWrite | FlagFast, FirstKey: 1, LastKey: 1, Step: 1, Handler: (*Executor).CmdCFAdd},
+	{Name: CmdCFAddNX, Arity: 3, Flags: FlagWrite | FlagFast, FirstKey: 1, LastKey: 1, Step: 1, Handler: (*Executor).CmdCFAddNX},
+	{Name: CmdCFInsert, Arity: -4, Flags: FlagWrite, FirstKey: 1, LastKey: 1, Step: 1, Handler: (*Executor).CmdCFInsert},
+	{Name: CmdCFExists, Arity: 3, Flags: FlagReadonly | FlagFast, FirstKey: 1, LastKey: 1, Step: 1, Handler: (*Executor).CmdCFExists},
+	{Name: CmdCFMExists, Arity: -3, Flags: FlagReadonly | FlagFast, FirstKey: 1, LastKey: 1, Step: 1, Handler: (*Executor).CmdCFMExists},
+	{Name: CmdCFDel, Arity: 3, Flags: FlagWrite | FlagFast, FirstKey: 1, LastKey: 1, Step: 1, Handler: (*Executor).CmdCFDel},
+	{Name: CmdCFCount, Arity: 3, Flags: FlagReadonly | FlagFast, FirstKey: 1, LastKey: 1, Step: 1, Handler: (*Executor).CmdCFCount},
+	{Name: CmdCFInfo, Arity: 2, Flags: FlagReadonly | FlagFast, FirstKey: 1, LastKey: 1, Step: 1, Handler: (*Executor).CmdCFInfo},
+	{Name: CmdTopKReserve, Arity: -3, Flags: FlagWrite, FirstKey: 1, LastKey: 1, Step: 1, Handler: (*Executor).CmdTopKReserve},
+	{Name: CmdTopKAdd, Arity: -3, Flags: FlagWrite, FirstKey: 1, LastKey: 1, Step: 1, Handler: (*Executor).CmdTopKAdd},
+	{Name: CmdTopKIncrBy, Arity: -4, Flags: FlagWrite, FirstKey: 1, LastKey: 1, Step: 1, Handler: (*Executor).CmdTopKIncrBy},
+	{Name: CmdTopKQuery, Arity: -3, Flags: FlagReadonly, FirstKey: 1, LastKey: 1, Step: 1, Handler: (*Executor).CmdTopKQuery},
+	{Name: CmdTopKCount, Arity: -3, Flags: FlagReadonly, FirstKey: 1, LastKey: 1, Step: 1, Handler: (*Executor).CmdTopKCount},
+	{Name: CmdTopKList, Arity: -2, Flags: FlagReadonly, FirstKey: 1, LastKey: 1, Step: 1, Handler: (*Executor).CmdTopKList},
+	{Name: CmdTopKInfo, Arity: 2, Flags: FlagReadonly, FirstKey: 1, LastKey: 1, Step: 1, Handler: (*Executor).CmdTopKInfo},
+	{Name: CmdPFAdd, Arity: -2, Flags: FlagWrite | FlagFast, FirstKey: 1, LastKey: 1, Step: 1, Handler: (*Executor).CmdPFAdd},
+	{Name: CmdPFCount, Arity: -2, Flags: FlagReadonly, FirstKey: 1, LastKey: -1, Step: 1, Handler: (*Executor).CmdPFCount},
+	{Name: CmdPFMerge, Arity: -2, Flags: FlagWrite, FirstKey: 1, LastKey: -1, Step: 1, Handler: (*Executor).CmdPFMerge},
+	{Name: CmdTDigestCreate, Arity: -2, Flags: FlagWrite, FirstKey: 1, LastKey: 1, Step: 1, Handler: (*Executor).CmdTDigestCreate},
+	{Name: CmdTDigestAdd, Arity: -3, Flags: FlagWrite, FirstKey: 1, LastKey: 1, Step: 1, Handler: (*Executor).CmdTDigestAdd},
+	{Name: CmdTDigestQuantile, Arity: -3, Flags: FlagReadonly, FirstKey: 1, LastKey: 1, Step: 1, Handler: (*Executor).CmdTDigestQuantile},
+	{Name: CmdTDigestCDF, Arity: -3, Flags: FlagReadonly, FirstKey: 1, LastKey: 1, Step: 1, Handler: (*Executor).CmdTDigestCDF},
+	{Name: CmdTDigestRank, Arity: -3, Flags: FlagReadonly, FirstKey: 1, LastKey: 1, Step: 1, Handler: (*Executor).CmdTDigestRank},
+	{Name: CmdTDigestMin, Arity: 2, Flags: FlagReadonly, FirstKey: 1, LastKey: 1, Step: 1, Handler: (*Executor).CmdTDigestMin},
+	{Name: CmdTDigestMax, Arity: 2, Flags: FlagReadonly, FirstKey: 1, LastKey: 1, Step: 1, Handler: (*Executor).CmdTDigestMax},
+	{Name: CmdTDigestTrimmedMean, Arity: 4, Flags: FlagReadonly, FirstKey: 1, LastKey: 1, Step: 1, Handler: (*Executor).CmdTDigestTrimmedMean},
+	{Name: CmdTDigestMerge, Arity: -4, Flags: FlagWrite, FirstKey: 1, LastKey: 1, Step: 1, Keys: numKeysAt(1, true), Handler: (*Executor).CmdTDigestMerge},
+	{Name: CmdTDigestReset, Arity: 2, Flags: FlagWrite, FirstKey: 1, LastKey: 1, Step: 1, Handler: (*Executor).CmdTDigestReset},
+	{Name: CmdTSCreate, Arity: -2, Flags: FlagWrite, FirstKey: 1, LastKey: 1, Step: 1, Handler: (*Executor).CmdTSCreate},
+	{Name: CmdTSAdd, Arity: -4, Flags: FlagWrite, FirstKey: 1, LastKey: 1, Step: 1, Handler: (*Executor).CmdTSAdd},
+	{Name: CmdTSMAdd, Arity: -4, Flags: FlagWrite, FirstKey: 1, LastKey: -1, Step: 3, Handler: (*Executor).CmdTSMAdd},
+	{Name: CmdTSRange, Arity: -4, Flags: FlagReadonly, FirstKey: 1, LastKey: 1, Step: 1, Handler: (*Executor).CmdTSRange},
+	{Name: CmdTSRevRange, Arity: -4, Flags: FlagReadonly, FirstKey: 1, LastKey: 1, Step: 1, Handler: (*Executor).CmdTSRevRange},
+	{Name: CmdTSMRange, Arity: -5, Flags: FlagReadonly, Handler: (*Executor).CmdTSMRange},
+	{Name: CmdTSCreateRule, Arity: 6, Flags: FlagWrite, FirstKey: 1, LastKey: 2, Step: 1, Handler: (*Executor).CmdTSCreateRule},
+	{Name: CmdXAdd, Arity: -5, Flags: FlagWrite | FlagFast, FirstKey: 1, LastKey: 1, Step: 1, Handler: (*Executor).CmdXAdd},
+	{Name: CmdXTrim, Arity: -4, Flags: FlagWrite, FirstKey: 1, LastKey: 1, Step: 1, Handler: (*Executor).CmdXTrim},
+	{Name: CmdXLen, Arity: 2, Flags: FlagReadonly | FlagFast, FirstKey: 1, LastKey: 1, Step: 1, Handler: (*Executor).CmdXLen},
+	{Name: CmdXDel, Arity: -3, Flags: FlagWrite | FlagFast, FirstKey: 1, LastKey: 1, Step: 1, Handler: (*Executor).CmdXDel},
+	{Name: CmdXRange, Arity: -4, Flags: FlagReadonly, FirstKey: 1, LastKey: 1, Step: 1, Handler: (*Executor).CmdXRange},
+	{Name: CmdXRevRange, Arity: -4, Flags: FlagReadonly, FirstKey: 1, LastKey: 1, Step: 1, Handler: (*Executor).CmdXRevRange},
+	{Name: CmdXRead, Arity: -4, Flags: FlagReadonly | FlagBlocking, Keys: xreadKeys(false), Handler: (*Executor).CmdXRead, selfLocking: true},
+	{Name: CmdXReadGroup, Arity: -7, Flags: FlagWrite | FlagBlocking, Keys: xreadKeys(true), Handler: (*Executor).CmdXReadGroup, selfLocking: true},
+	{Name: CmdXGroup, Arity: -2, Flags: FlagWrite, FirstKey: 2, LastKey: 2, Step: 1, Handler: (*Executor).CmdXGroup},
+	{Name: CmdXAck, Arity: -4, Flags: FlagWrite | FlagFast, FirstKey: 1, LastKey: 1, Step: 1, Handler: (*Executor).CmdXAck},
+	{Name: CmdXPending, Arity: -3, Flags: FlagReadonly, FirstKey: 1, LastKey: 1, Step: 1, Handler: (*Executor).CmdXPending},
+	{Name: CmdXClaim, Arity: -6, Flags: FlagWrite | FlagFast, FirstKey: 1, LastKey: 1, Step: 1, Handler: (*Executor).CmdXClaim},
+	{Name: CmdXAutoClaim, Arity: -6, Flags: FlagWrite | FlagFast, FirstKey: 1, LastKey: 1, Step: 1, Handler: (*Executor).CmdXAutoClaim},
+	{Name: CmdXInfo, Arity: -3, Flags: FlagReadonly, FirstKey: 2, LastKey: 2, Step: 1, Handler: (*Executor).CmdXInfo},
+	{Name: CmdGeoAdd, Arity: -5, Flags: FlagWrite, FirstKey: 1, LastKey: 1, Step: 1, Handler: (*Executor).CmdGeoAdd},
+	{Name: CmdGeoPos, Arity: -2, Flags: FlagReadonly, FirstKey: 1, LastKey: 1, Step: 1, Handler: (*Executor).CmdGeoPos},
+	{Name: CmdGeoDist, Arity: -4, Flags: FlagReadonly, FirstKey: 1, LastKey: 1, Step: 1, Handler: (*Executor).CmdGeoDist},
+	{Name: CmdGeoHash, Arity: -2, Flags: FlagReadonly, FirstKey: 1, LastKey: 1, Step: 1, Handler: (*Executor).CmdGeoHash},
+	{Name: CmdGeoSearch, Arity: -6, Flags: FlagReadonly, FirstKey: 1, LastKey: 1, Step: 1, Handler: (*Executor).CmdGeoSearch},
+	{Name: CmdGeoSearchStore, Arity: -7, Flags: FlagWrite, FirstKey: 1, LastKey: 2, Step: 1, Handler: (*Executor).CmdGeoSearchStore},
+	{Name: CmdPublish, Arity: 3, Flags: FlagPubSub | FlagFast, Handler: (*Executor).CmdPublish},
+	{Name: CmdSPublish, Arity: 3, Flags: FlagPubSub | FlagFast, FirstKey: 1, LastKey: 1, Step: 1, Handler: (*Executor).CmdSPublish},
+	{Name: CmdPubSub, Arity: -2, Flags: FlagPubSub, Handler: (*Executor).CmdPubSub},
+	{Name: CmdConfig, Arity: -2, Flags: FlagAdmin | FlagNoScript, Handler: (*Executor).CmdConfig},
+	{Name: CmdEval, Arity: -3, Flags: FlagNoScript, Keys: numKeysAt(1, false), Handler: (*Executor).CmdEval, selfLocking: true},
+	{Name: CmdEvalSha, Arity: -3, Flags: FlagNoScript, Keys: numKeysAt(1, false), Handler: (*Executor).CmdEvalSha, selfLocking: true},
+	{Name: CmdScript, Arity: -2, Flags: FlagNoScript, Handler: (*Executor).CmdScript, selfLocking: true},
+	{Name: CmdInfo, Arity: -1, Handler: (*Executor).CmdInfo},
+	{Name: CmdObject, Arity: 3, Flags: FlagReadonly, FirstKey: 2, LastKey: 2, Step: 1, Handler: (*Executor).CmdObject},
+	{Name: CmdCommand, Arity: -1, Handler: (*Executor).CmdCommand},
+	{Name: CmdSelect, Arity: 2, Flags: FlagFast, Handler: (*Executor).CmdSelect},
+	{Name: CmdDBSize, Arity: 1, Flags: FlagReadonly | FlagFast, Handler: (*Executor).CmdDBSize},
+	{Name: CmdFlushDB, Arity: -1, Flags: FlagWrite, Handler: (*Executor).CmdFlushDB},
+	{Name: CmdFlushAll, Arity: -1, Flags: FlagWrite, Handler: (*Executor).CmdFlushAll},
+	{Name: CmdMove, Arity: 3, Flags: FlagWrite | FlagFast, FirstKey: 1, LastKey: 1, Step: 1, Handler: (*Executor).CmdMove},
+	{Name: CmdSwapDB, Arity: 3, Flags: FlagWrite | FlagFast, Handler: (*Executor).CmdSwapDB},
+	{Name: CmdCopy, Arity: -3, Flags: FlagWrite, FirstKey: 1, LastKey: 2, Step: 1, Handler: (*Executor).CmdCopy},
+	{Name: CmdKeys, Arity: 2, Flags: FlagReadonly, Handler: (*Executor).CmdKeys},
+	{Name: CmdScan, Arity: -2, Flags: FlagReadonly, Handler: (*Executor).CmdScan},
+	{Name: CmdRename, Arity: 3, Flags: FlagWrite, FirstKey: 1, LastKey: 2, Step: 1, Handler: (*Executor).CmdRename},
+	{Name: CmdRenameNX, Arity: 3, Flags: FlagWrite | FlagFast, FirstKey: 1, LastKey: 2, Step: 1, Handler: (*Executor).CmdRenameNX},
+	{Name: CmdRandomKey, Arity: 1, Flags: FlagReadonly, Handler: (*Executor).CmdRandomKey},
+	{Name: CmdTouch, Arity: -2, Flags: FlagReadonly | FlagFast, FirstKey: 1, LastKey: -1, Step: 1, Handler: (*Executor).CmdTouch},
+	{Name: CmdUnlink, Arity: -2, Flags: FlagWrite | FlagFast, FirstKey: 1, LastKey: -1, Step: 1, Handler: (*Executor).CmdUnlink},
+	// Run by the connection itself, registered so that they are validated
+	// and reported like the others
+	{Name: CmdSubscribe, Arity: -2, Flags: FlagPubSub | FlagNoScript, Handler: (*Executor).cmdConnection},
+	{Name: CmdPSubscribe, Arity: -2, Flags: FlagPubSub | FlagNoScript, Handler: (*Executor).cmdConnection},
+	{Name: CmdSSubscribe, Arity: -2, Flags: FlagPubSub | FlagNoScript, FirstKey: 1, LastKey: -1, Step: 1, Handler: (*Executor).cmdConnection},
+	{Name: CmdUnsubscribe, Arity: -1, Flags: FlagPubSub | FlagNoScript, Handler: (*Executor).cmdConnection},
+	{Name: CmdPUnsubscribe, Arity: -1, Flags: FlagPubSub | FlagNoScript, Handler: (*Executor).cmdConnection},
+	{Name: CmdSUnsubscribe, Arity: -1, Flags: FlagPubSub | FlagNoScript, FirstKey: 1, LastKey: -1, Step: 1, Handler: (*Executor).cmdConnection},
+	{Name: CmdMulti, Arity: 1, Flags: FlagFast | FlagNoScript, Handler: (*Executor).cmdConnection},
+	{Name: CmdExec, Arity: 1, Flags: FlagNoScript, Handler: (*Executor).cmdConnection},
+	{Name: CmdDiscard, Arity: 1, Flags: FlagFast | FlagNoScript, Handler: (*Executor).cmdConnection},
+	{Name: CmdWatch, Arity: -2, Flags: FlagFast | FlagNoScript, FirstKey: 1, LastKey: -1, Step: 1, Handler: (*Executor).cmdConnection},
+	{Name: CmdUnwatch, Arity: 1, Flags: FlagFast | FlagNoScript, Handler: (*Executor).cmdConnection},
+	{Name: CmdQuit, Arity: -1, Flags: FlagFast | FlagNoScript, Handler: (*Executor).cmdConnection},
+	{Name: CmdReset, Arity: 1, Flags: FlagFast | FlagNoScript, Handler: (*Executor).cmdConnection},
+}
+
 func (e *Executor) Execute(cmd *Command) []byte {
-	en := protocol.Encoder{}
-	switch cmd.Name {
-	case CmdPing:
-		return e.cmdPING(cmd.Args)
-	case CmdSet:
-		return e.cmdSET(cmd.Args)
-	case CmdGet:
-		return e.cmdGET(cmd.Args)
-	case CmdTtl:
-		return e.cmdTTL(cmd.Args)
-	case CmdExpire:
-		return e.cmdExpr(cmd.Args)
-	case CmdExist:
-		return e.cmdExist(cmd.Args)
-	case CmdDel:
-		return e.cmdDel(cmd.Args)
-	case CmdZadd:
-		return e.CmdZadd(cmd.Args)
-	case CmdZrank:
-		return e.CmdZrank(cmd.Args)
-	case CmdZScore:
-		return e.CmdZScore(cmd.Args)
-	case CmdCMSINIT:
-		return e.CmdInitCMS(cmd.Args)
-	case CmdCMSIncrBy:
-		return e.CmdIncrBy(cmd.Args)
-	case CmdCMSQuery:
-		return e.CmdCMSQuery(cmd.Args)
-	case CmdBFReverse:
-		return e.CmdBFReverse(cmd.Args)
-	case CmdBFMAdd:
-		return e.CmdBFMADD(cmd.Args)
-	case CmdBFExist:
-		return e.CmdBFExist(cmd.Args)
-	case CmdInfo:
-		return e.CmdInfo(cmd.Args)
-	default:
-		return en.Encode(errors.New("ERR unsupported CMD detected"), false)
+	if err := e.scripts.busy(cmd); err != nil {
+		en := protocol.Encoder{}
+		return en.Encode(err, false)
+	}
+	if spec := Lookup(cmd.Name); spec == nil || !spec.selfLocking {
+		e.lock.RLock()
+		defer e.lock.RUnlock()
 	}
+	return e.execute(cmd)
+}
+
+func (e *Executor) execute(cmd *Command) []byte {
+	if err := e.Validate(cmd); err != nil {
+		en := protocol.Encoder{}
+		return en.Encode(err, false)
+	}
+	return Lookup(cmd.Name).Handler(e, cmd.Args)
+}
+
+/*
+Check that `cmd` exists and gets the right number of arguments, before it
+runs or when it is queued inside MULTI
+*/
+func (e *Executor) Validate(cmd *Command) error {
+	spec := Lookup(cmd.Name)
+	if spec == nil {
+		args := ""
+		for _, arg := range cmd.Args {
+			args += "'" + arg + "' "
+		}
+		return fmt.Errorf("ERR unknown command '%s', with args beginning with: %s", strings.ToLower(cmd.Name), args)
+	}
+	if !spec.arityOK(len(cmd.Args)) {
+		return fmt.Errorf("ERR wrong number of arguments for '%s' command", strings.ToLower(cmd.Name))
+	}
+	return nil
+}
+
+/*
+Handler of the commands run by the connection, they only reach the executor
+when it is used without a server
+*/
+func (e *Executor) cmdConnection(args []string) []byte {
+	en := protocol.Encoder{}
+	return en.Encode(errors.New("ERR command only available on a client connection"), false)
 }
 
 func (e *Executor) cmdPING(args []string) []byte {
@@ -122,25 +451,19 @@ func (e *Executor) cmdPING(args []string) []byte {
 
 func (e *Executor) cmdSET(args []string) []byte {
 	en := protocol.Encoder{}
-	if len(args) < 2 {
-		return en.Encode(errors.New("ERR wrong number of arguments for 'set' command"), false)
-	}
 	key, val := args[0], args[1]
-	var ttl uint64 = 0
+	// 0 keeps the key until it is deleted
+	var expr uint64 = 0
 	if len(args) == 4 {
 		parsed, _ := strconv.ParseInt(args[3], 10, 64)
-		ttl = uint64(parsed)
+		expr = uint64(parsed) + uint64(time.Now().UnixMilli())
 	}
-	expr := ttl + uint64(time.Now().UnixMilli())
 	e.store.Set(key, val, expr)
 	return en.Encode("OK", true)
 }
 
 func (e *Executor) cmdGET(args []string) []byte {
 	en := protocol.Encoder{}
-	if len(args) > 1 || len(args) < 1 {
-		return en.Encode(errors.New("ERR wrong number of arguments for 'get' command"), false)
-	}
 	key := args[0]
 	obj, ok := e.store.Get(key)
 	if !ok {
@@ -151,9 +474,6 @@ func (e *Executor) cmdGET(args []string) []byte {
 
 func (e *Executor) cmdTTL(args []string) []byte {
 	en := protocol.Encoder{}
-	if len(args) != 1 {
-		return en.Encode(errors.New("ERR wrong number of arguments for 'TTL' command"), false)
-	}
 	key := args[0]
 	ttl, ok := e.store.Ttl(key)
 	if !ok {
@@ -164,9 +484,6 @@ func (e *Executor) cmdTTL(args []string) []byte {
 
 func (e *Executor) cmdExpr(args []string) []byte {
 	en := protocol.Encoder{}
-	if len(args) < 2 {
-		return en.Encode(errors.New("ERR wrong number of arguments for 'EXPIRE' command"), false)
-	}
 	key := args[0]
 	expr, _ := strconv.ParseUint(args[1], 10, 64)
 	expr += uint64(time.Now().UnixMilli())
@@ -176,131 +493,86 @@ func (e *Executor) cmdExpr(args []string) []byte {
 
 func (e *Executor) cmdDel(args []string) []byte {
 	en := protocol.Encoder{}
-	if len(args) < 1 {
-		return en.Encode(errors.New("ERR wrong number of arguments for 'DEL' command"), false)
-	}
 	res, _ := e.store.Del(args)
 	return en.Encode(res, false)
 }
 
 func (e *Executor) cmdExist(args []string) []byte {
 	en := protocol.Encoder{}
-	if len(args) < 1 {
-		return en.Encode(errors.New("ERR wrong number of arguments for 'EXIST' command"), false)
-	}
 	res, _ := e.store.Exist(args)
 	return en.Encode(res, false)
 }
 
-func (e *Executor) CmdZadd(args []string) []byte {
-	en := protocol.Encoder{}
-	if len(args) < 3 {
-		return en.Encode(errors.New("ERR wrong number of arguments for 'ZADD' command, currently only support single [key, element, score] ZADD"), false)
-	}
-	res := e.store.Zadd(args[0], args[1:])
-	if res == -1 {
-		return en.Encode(errors.New("ERR failed to execute command 'ZADD'"), false)
-	}
-	return en.Encode(res, false)
-}
-
 func (e *Executor) CmdZrank(args []string) []byte {
 	en := protocol.Encoder{}
-	if len(args) != 2 {
-		return en.Encode(errors.New("ERR wrong number of arguments for 'ZRANK' command"), false)
-	}
 	res := e.store.Zrank(args[0], args[1])
 	if res == -1 {
-		return en.Encode(errors.New("ERR failed to execute command 'ZRANK'"), false)
+		return en.Encode(nil, false)
 	}
 	return en.Encode(res, false)
 }
 
 func (e *Executor) CmdZScore(args []string) []byte {
 	en := protocol.Encoder{}
-	if len(args) != 2 {
-		return en.Encode(errors.New("ERR wrong number of arguments for 'ZSCORE' command"), false)
-	}
-	res := e.store.Zscore(args[0], args[1])
-	if res == -1 {
-		return en.Encode(errors.New("ERR failed to execute command 'ZSCORE'"), false)
+	res, ok := e.store.Zscore(args[0], args[1])
+	if !ok {
+		return en.Encode(nil, false)
 	}
 	return en.Encode(res, false)
 }
 
-func (e *Executor) CmdInitCMS(args []string) []byte {
-	en := protocol.Encoder{}
-	if len(args) != 3 {
-		return en.Encode(errors.New("ERR wrong number of arguments for 'CMS.INITBYPROB' command"), false)
-	}
-	errRate, _ := strconv.ParseFloat(args[1], 64)
-	errProb, _ := strconv.ParseFloat(args[2], 64)
-	res := e.store.NewCMS(args[0], errRate, errProb)
-	if res == -1 {
-		return en.Encode(errors.New("ERR count min sketch with the same key already existed"), false)
-	}
-	return en.Encode("OK", true)
-}
-
-func (e *Executor) CmdIncrBy(args []string) []byte {
+/*
+INFO [section], keyspace being the only section. Databases without keys are
+left out
+*/
+func (e *Executor) CmdInfo(args []string) []byte {
 	en := protocol.Encoder{}
-	if len(args) != 3 {
-		return en.Encode(errors.New("ERR wrong number of arguments for 'CMS.INCRBY' command"), false)
+	var buf bytes.Buffer
+	known := func(section string) bool {
+		return slices.Contains([]string{"keyspace", "default", "all", "everything"}, strings.ToLower(section))
 	}
-	value, _ := strconv.ParseUint(args[2], 10, 32)
-	res := e.store.CMSIncrBy(args[0], args[1], uint32(value))
-	return en.Encode(res, false)
-}
-
-func (e *Executor) CmdCMSQuery(args []string) []byte {
-	en := protocol.Encoder{}
-	if len(args) != 2 {
-		return en.Encode(errors.New("ERR wrong number of arguments for 'CMS.QUERY' command"), false)
+	if len(args) > 0 && !slices.ContainsFunc(args, known) {
+		return en.Encode("", false)
 	}
-	res := e.store.CMSQuery(args[0], args[1])
-	return en.Encode(res, false)
-}
-
-func (e *Executor) CmdBFReverse(args []string) []byte {
-	en := protocol.Encoder{}
-	if len(args) != 3 {
-		return en.Encode(errors.New("ERR wrong number of arguments for 'BF.RESERVE' command"), false)
+	buf.WriteString("# Keyspace\r\n")
+	for _, db := range e.dbs {
+		stat := db.KeySpace()
+		if stat.Key > 0 {
+			buf.WriteString(fmt.Sprintf("db%d:keys=%d,expires=%d,avg_ttl=0\r\n", db.ID(), stat.Key, stat.Expires))
+		}
 	}
-	errRate, _ := strconv.ParseFloat(args[1], 64)
-	entries, _ := strconv.ParseUint(args[2], 10, 64)
-	e.store.NewBF(args[0], errRate, entries)
-	return en.Encode("OK", true)
+	return en.Encode(buf.String(), false)
 }
 
-func (e *Executor) CmdBFMADD(args []string) []byte {
+/*
+OBJECT ENCODING | IDLETIME | REFCOUNT | FREQ key
+*/
+func (e *Executor) CmdObject(args []string) []byte {
 	en := protocol.Encoder{}
-	if len(args) < 2 {
-		return en.Encode(errors.New("ERR wrong number of arguments for 'BF.MADD' command"), false)
+	sub := strings.ToUpper(args[0])
+	if !slices.Contains([]string{"ENCODING", "IDLETIME", "REFCOUNT", "FREQ"}, sub) {
+		return en.Encode(fmt.Errorf("ERR unknown subcommand '%s'. Try OBJECT HELP.", args[0]), false)
 	}
-	res := e.store.BFAdd(args[0], args[1])
-	if res == -1 {
-		return en.Encode(errors.New("ERR bloom filter at the specified key does not exist"), false)
+	info, ok := e.store.Object(args[1])
+	if !ok {
+		return en.Encode(nil, false)
 	}
-	return en.Encode(res, false)
-}
-
-func (e *Executor) CmdBFExist(args []string) []byte {
-	en := protocol.Encoder{}
-	if len(args) < 2 {
-		return en.Encode(errors.New("ERR wrong number of arguments for 'BF.MADD' command"), false)
+	// The eviction policy decides which of the access time and frequency
+	// Redis tracks
+	lfu := strings.HasSuffix(config.EvictionPolicy.Load().(string), "-lfu")
+	switch sub {
+	case "ENCODING":
+		return en.Encode(info.Encoding, false)
+	case "IDLETIME":
+		if lfu {
+			return en.Encode(errors.New("ERR An LFU maxmemory policy is selected, idle time not tracked. Please note that when switching between policies at runtime LRU and LFU data will take some time to adjust."), false)
+		}
+		return en.Encode(info.IdleTime, false)
+	case "REFCOUNT":
+		return en.Encode(info.RefCount, false)
 	}
-	res := e.store.BFQuery(args[0], args[1])
-	if res == -1 {
-		return en.Encode(errors.New("ERR bloom filter at the specified key does not exist"), false)
+	if !lfu {
+		return en.Encode(errors.New("ERR An LFU maxmemory policy is not selected, access frequency not tracked. Please note that when switching between policies at runtime LRU and LFU data will take some time to adjust."), false)
 	}
-	return en.Encode(res, false)
-}
-
-func (e *Executor) CmdInfo(args []string) []byte {
-	en := protocol.Encoder{}
-	var info []byte
-	buf := bytes.NewBuffer(info)
-	buf.WriteString("# Keyspace\r\n")
-	buf.WriteString(fmt.Sprintf("db0:keys=%d, expires=%d\r\n", datastructure.HashKeySpace.Key, datastructure.HashKeySpace.Expires))
-	return en.Encode(buf, false)
+	return en.Encode(info.Freq, false)
 }
@@ -0,0 +1,324 @@
+package command
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"tcp-server.com/m/internal/datastructure"
+	"tcp-server.com/m/internal/protocol"
+)
+
+var (
+	errNotFloat = errors.New("ERR value is not a valid float")
+	errGeoUnit  = errors.New("ERR unsupported unit provided. please use M, KM, FT, MI")
+)
+
+/*
+Meters per unit of distance
+*/
+func parseGeoUnit(arg string) (float64, error) {
+	switch strings.ToLower(arg) {
+	case "m":
+		return 1, nil
+	case "km":
+		return 1000, nil
+	case "ft":
+		return 0.3048, nil
+	case "mi":
+		return 1609.34, nil
+	}
+	return 0, errGeoUnit
+}
+
+func parseLonLat(lonArg string, latArg string) (float64, float64, error) {
+	lon, err := strconv.ParseFloat(lonArg, 64)
+	if err != nil {
+		return 0, 0, errNotFloat
+	}
+	lat, err := strconv.ParseFloat(latArg, 64)
+	if err != nil {
+		return 0, 0, errNotFloat
+	}
+	if lon < datastructure.GeoLonMin || lon > datastructure.GeoLonMax || lat < datastructure.GeoLatMin || lat > datastructure.GeoLatMax {
+		return 0, 0, fmt.Errorf("ERR invalid longitude,latitude pair %f,%f", lon, lat)
+	}
+	return lon, lat, nil
+}
+
+func formatGeoDist(meters float64, unit float64) string {
+	return strconv.FormatFloat(meters/unit, 'f', 4, 64)
+}
+
+/*
+GEOADD key [NX|XX] [CH] longitude latitude member [longitude latitude member ...]
+*/
+func (e *Executor) CmdGeoAdd(args []string) []byte {
+	en := protocol.Encoder{}
+
+	flags, i := 0, 1
+flagLoop:
+	for ; i < len(args); i++ {
+		switch strings.ToUpper(args[i]) {
+		case "NX":
+			flags |= datastructure.ZaddNX
+		case "XX":
+			flags |= datastructure.ZaddXX
+		case "CH":
+			flags |= datastructure.ZaddCH
+		default:
+			break flagLoop
+		}
+	}
+	if flags&datastructure.ZaddNX != 0 && flags&datastructure.ZaddXX != 0 {
+		return en.Encode(errors.New("ERR XX and NX options at the same time are not compatible"), false)
+	}
+	triples := args[i:]
+	if len(triples) == 0 || len(triples)%3 != 0 {
+		return en.Encode(errSyntax, false)
+	}
+
+	elements := make([]datastructure.ZElement, 0, len(triples)/3)
+	for j := 0; j < len(triples); j += 3 {
+		lon, lat, err := parseLonLat(triples[j], triples[j+1])
+		if err != nil {
+			return en.Encode(err, false)
+		}
+		elements = append(elements, datastructure.ZElement{Member: triples[j+2], Score: datastructure.GeoHashScore(lon, lat)})
+	}
+	res, err := e.store.Zadd(args[0], flags, elements)
+	if err != nil {
+		return en.Encode(err, false)
+	}
+	return en.Encode(res, false)
+}
+
+/*
+GEOPOS key [member ...]
+*/
+func (e *Executor) CmdGeoPos(args []string) []byte {
+	en := protocol.Encoder{}
+	scores := e.store.Zmscore(args[0], args[1:])
+	res := make([]any, len(scores))
+	for i, score := range scores {
+		if score == nil {
+			continue
+		}
+		lon, lat := datastructure.GeoDecodeScore(score.(float64))
+		res[i] = []string{formatScore(lon), formatScore(lat)}
+	}
+	return en.Encode(res, false)
+}
+
+/*
+GEODIST key member1 member2 [M|KM|FT|MI]
+*/
+func (e *Executor) CmdGeoDist(args []string) []byte {
+	en := protocol.Encoder{}
+	if len(args) != 3 && len(args) != 4 {
+		return en.Encode(errors.New("ERR wrong number of arguments for 'GEODIST' command"), false)
+	}
+	unit := 1.0
+	if len(args) == 4 {
+		var err error
+		if unit, err = parseGeoUnit(args[3]); err != nil {
+			return en.Encode(err, false)
+		}
+	}
+	scores := e.store.Zmscore(args[0], args[1:3])
+	if scores[0] == nil || scores[1] == nil {
+		return en.Encode(nil, false)
+	}
+	lon1, lat1 := datastructure.GeoDecodeScore(scores[0].(float64))
+	lon2, lat2 := datastructure.GeoDecodeScore(scores[1].(float64))
+	return en.Encode(formatGeoDist(datastructure.GeoDistance(lon1, lat1, lon2, lat2), unit), false)
+}
+
+/*
+GEOHASH key [member ...]
+*/
+func (e *Executor) CmdGeoHash(args []string) []byte {
+	en := protocol.Encoder{}
+	scores := e.store.Zmscore(args[0], args[1:])
+	res := make([]any, len(scores))
+	for i, score := range scores {
+		if score != nil {
+			res[i] = datastructure.GeoHashString(score.(float64))
+		}
+	}
+	return en.Encode(res, false)
+}
+
+type geoSearchArgs struct {
+	query     datastructure.GeoQuery
+	unit      float64
+	withCoord bool
+	withDist  bool
+	withHash  bool
+	storeDist bool
+}
+
+/*
+Parse `FROMMEMBER member|FROMLONLAT longitude latitude BYRADIUS radius unit|
+BYBOX width height unit [ASC|DESC] [COUNT count [ANY]]`, followed by
+`[WITHCOORD] [WITHDIST] [WITHHASH]` for GEOSEARCH or `[STOREDIST]` for
+GEOSEARCHSTORE
+*/
+func parseGeoSearchArgs(args []string, store bool) (*geoSearchArgs, error) {
+	res := &geoSearchArgs{}
+	q := &res.query
+	hasFrom, hasShape := false, false
+	for i := 0; i < len(args); i++ {
+		opt := strings.ToUpper(args[i])
+		switch {
+		case opt == "FROMMEMBER" && i+1 < len(args):
+			if hasFrom {
+				return nil, errors.New("ERR exactly one of FROMMEMBER or FROMLONLAT can be specified for GEOSEARCH")
+			}
+			q.FromMember, q.Member = true, args[i+1]
+			hasFrom = true
+			i++
+		case opt == "FROMLONLAT" && i+2 < len(args):
+			if hasFrom {
+				return nil, errors.New("ERR exactly one of FROMMEMBER or FROMLONLAT can be specified for GEOSEARCH")
+			}
+			lon, lat, err := parseLonLat(args[i+1], args[i+2])
+			if err != nil {
+				return nil, err
+			}
+			q.Shape.Lon, q.Shape.Lat = lon, lat
+			hasFrom = true
+			i += 2
+		case opt == "BYRADIUS" && i+2 < len(args):
+			if hasShape {
+				return nil, errors.New("ERR exactly one of BYRADIUS and BYBOX can be specified for GEOSEARCH")
+			}
+			radius, err := strconv.ParseFloat(args[i+1], 64)
+			if err != nil {
+				return nil, errNotFloat
+			}
+			if radius < 0 {
+				return nil, errors.New("ERR radius cannot be negative")
+			}
+			if res.unit, err = parseGeoUnit(args[i+2]); err != nil {
+				return nil, err
+			}
+			q.Shape.Radius = radius * res.unit
+			hasShape = true
+			i += 2
+		case opt == "BYBOX" && i+3 < len(args):
+			if hasShape {
+				return nil, errors.New("ERR exactly one of BYRADIUS and BYBOX can be specified for GEOSEARCH")
+			}
+			width, err1 := strconv.ParseFloat(args[i+1], 64)
+			height, err2 := strconv.ParseFloat(args[i+2], 64)
+			if err1 != nil || err2 != nil {
+				return nil, errNotFloat
+			}
+			if width < 0 || height < 0 {
+				return nil, errors.New("ERR height or width cannot be negative")
+			}
+			var err error
+			if res.unit, err = parseGeoUnit(args[i+3]); err != nil {
+				return nil, err
+			}
+			q.Shape.Box = true
+			q.Shape.Width, q.Shape.Height = width*res.unit, height*res.unit
+			hasShape = true
+			i += 3
+		case opt == "ASC":
+			q.Sort = datastructure.GeoSortAsc
+		case opt == "DESC":
+			q.Sort = datastructure.GeoSortDesc
+		case opt == "COUNT" && i+1 < len(args):
+			count, err := strconv.Atoi(args[i+1])
+			if err != nil {
+				return nil, errNotInteger
+			}
+			if count <= 0 {
+				return nil, errors.New("ERR COUNT must be > 0")
+			}
+			q.Count = count
+			i++
+			if i+1 < len(args) && strings.ToUpper(args[i+1]) == "ANY" {
+				q.Any = true
+				i++
+			}
+		case opt == "ANY":
+			return nil, errors.New("ERR the ANY argument requires COUNT argument")
+		case opt == "WITHCOORD" && !store:
+			res.withCoord = true
+		case opt == "WITHDIST" && !store:
+			res.withDist = true
+		case opt == "WITHHASH" && !store:
+			res.withHash = true
+		case opt == "STOREDIST" && store:
+			res.storeDist = true
+		default:
+			return nil, errSyntax
+		}
+	}
+	if !hasFrom {
+		return nil, errors.New("ERR exactly one of FROMMEMBER or FROMLONLAT can be specified for GEOSEARCH")
+	}
+	if !hasShape {
+		return nil, errors.New("ERR exactly one of BYRADIUS and BYBOX can be specified for GEOSEARCH")
+	}
+	return res, nil
+}
+
+/*
+GEOSEARCH key FROMMEMBER member|FROMLONLAT longitude latitude
+BYRADIUS radius unit|BYBOX width height unit [ASC|DESC] [COUNT count [ANY]]
+[WITHCOORD] [WITHDIST] [WITHHASH]
+*/
+func (e *Executor) CmdGeoSearch(args []string) []byte {
+	en := protocol.Encoder{}
+	r, err := parseGeoSearchArgs(args[1:], false)
+	if err != nil {
+		return en.Encode(err, false)
+	}
+	points, err := e.store.GeoSearch(args[0], &r.query)
+	if err != nil {
+		return en.Encode(err, false)
+	}
+
+	res := make([]any, len(points))
+	for i, p := range points {
+		if !r.withDist && !r.withHash && !r.withCoord {
+			res[i] = p.Member
+			continue
+		}
+		item := []any{p.Member}
+		if r.withDist {
+			item = append(item, formatGeoDist(p.Dist, r.unit))
+		}
+		if r.withHash {
+			item = append(item, int64(p.Score))
+		}
+		if r.withCoord {
+			item = append(item, []string{formatScore(p.Lon), formatScore(p.Lat)})
+		}
+		res[i] = item
+	}
+	return en.Encode(res, false)
+}
+
+/*
+GEOSEARCHSTORE destination source FROMMEMBER member|FROMLONLAT longitude
+latitude BYRADIUS radius unit|BYBOX width height unit [ASC|DESC]
+[COUNT count [ANY]] [STOREDIST]
+*/
+func (e *Executor) CmdGeoSearchStore(args []string) []byte {
+	en := protocol.Encoder{}
+	r, err := parseGeoSearchArgs(args[2:], true)
+	if err != nil {
+		return en.Encode(err, false)
+	}
+	res, err := e.store.GeoSearchStore(args[0], args[1], &r.query, r.storeDist, r.unit)
+	if err != nil {
+		return en.Encode(err, false)
+	}
+	return en.Encode(res, false)
+}
@@ -0,0 +1,40 @@
+package command
+
+import (
+	"tcp-server.com/m/internal/protocol"
+)
+
+/*
+PFADD key [element [element ...]]
+*/
+func (e *Executor) CmdPFAdd(args []string) []byte {
+	en := protocol.Encoder{}
+	res, err := e.store.PFAdd(args[0], args[1:])
+	if err != nil {
+		return en.Encode(err, false)
+	}
+	return en.Encode(res, false)
+}
+
+/*
+PFCOUNT key [key ...]
+*/
+func (e *Executor) CmdPFCount(args []string) []byte {
+	en := protocol.Encoder{}
+	res, err := e.store.PFCount(args)
+	if err != nil {
+		return en.Encode(err, false)
+	}
+	return en.Encode(res, false)
+}
+
+/*
+PFMERGE destkey [sourcekey [sourcekey ...]]
+*/
+func (e *Executor) CmdPFMerge(args []string) []byte {
+	en := protocol.Encoder{}
+	if err := e.store.PFMerge(args[0], args[1:]); err != nil {
+		return en.Encode(err, false)
+	}
+	return en.Encode("OK", true)
+}
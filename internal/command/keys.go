@@ -0,0 +1,109 @@
+package command
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+
+	"tcp-server.com/m/internal/protocol"
+)
+
+var errInvalidCursor = errors.New("ERR invalid cursor")
+
+/*
+KEYS pattern
+*/
+func (e *Executor) CmdKeys(args []string) []byte {
+	en := protocol.Encoder{}
+	return en.Encode(e.store.Keys(args[0]), false)
+}
+
+/*
+SCAN cursor [MATCH pattern] [COUNT count] [TYPE type]
+*/
+func (e *Executor) CmdScan(args []string) []byte {
+	en := protocol.Encoder{}
+	cursor, err := strconv.ParseUint(args[0], 10, 64)
+	if err != nil {
+		return en.Encode(errInvalidCursor, false)
+	}
+	pattern, count, typ := "", 10, ""
+	for i := 1; i < len(args); i += 2 {
+		if i+1 == len(args) {
+			return en.Encode(errSyntax, false)
+		}
+		switch strings.ToUpper(args[i]) {
+		case "MATCH":
+			pattern = args[i+1]
+		case "COUNT":
+			count, err = strconv.Atoi(args[i+1])
+			if err != nil {
+				return en.Encode(errNotInteger, false)
+			}
+			if count < 1 {
+				return en.Encode(errSyntax, false)
+			}
+		case "TYPE":
+			typ = args[i+1]
+		default:
+			return en.Encode(errSyntax, false)
+		}
+	}
+	next, keys := e.store.Scan(cursor, pattern, count, typ)
+	return en.Encode([]any{strconv.FormatUint(next, 10), keys}, false)
+}
+
+/*
+RENAME key newkey
+*/
+func (e *Executor) CmdRename(args []string) []byte {
+	en := protocol.Encoder{}
+	if _, err := e.store.Rename(args[0], args[1], false); err != nil {
+		return en.Encode(err, false)
+	}
+	return en.Encode("OK", true)
+}
+
+/*
+RENAMENX key newkey
+*/
+func (e *Executor) CmdRenameNX(args []string) []byte {
+	en := protocol.Encoder{}
+	renamed, err := e.store.Rename(args[0], args[1], true)
+	if err != nil {
+		return en.Encode(err, false)
+	}
+	if renamed {
+		return en.Encode(1, false)
+	}
+	return en.Encode(0, false)
+}
+
+/*
+RANDOMKEY
+*/
+func (e *Executor) CmdRandomKey(args []string) []byte {
+	en := protocol.Encoder{}
+	key, ok := e.store.RandomKey()
+	if !ok {
+		return en.Encode(nil, false)
+	}
+	return en.Encode(key, false)
+}
+
+/*
+TOUCH key [key ...]
+*/
+func (e *Executor) CmdTouch(args []string) []byte {
+	en := protocol.Encoder{}
+	return en.Encode(e.store.Touch(args), false)
+}
+
+/*
+UNLINK key [key ...], which is DEL: the Go values are reclaimed by the
+garbage collector in the background anyway
+*/
+func (e *Executor) CmdUnlink(args []string) []byte {
+	en := protocol.Encoder{}
+	return en.Encode(e.store.Delete(args), false)
+}
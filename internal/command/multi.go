@@ -0,0 +1,33 @@
+package command
+
+import "tcp-server.com/m/internal/datastructure"
+
+/*
+Run the commands of a transaction with no other command in between. Returns
+nil without running anything when a key of `watched`, the versions returned
+by Storage.Watch for each database, was modified since. A SELECT in the
+transaction stays in effect after it
+*/
+func (e *Executor) Exec(cmds []*Command, watched map[*datastructure.Storage]map[string]uint64) [][]byte {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	for db, versions := range watched {
+		if db.WatchedChanged(versions) {
+			return nil
+		}
+	}
+	tx := e.exclusiveView()
+	res := make([][]byte, len(cmds))
+	for i, cmd := range cmds {
+		res[i] = tx.execute(cmd)
+	}
+	e.store = tx.store
+	return res
+}
+
+/*
+Executor for commands run while `e.lock` is already held exclusively
+*/
+func (e *Executor) exclusiveView() *Executor {
+	return &Executor{store: e.store, dbs: e.dbs, broker: e.broker, lock: e.lock, exclusive: true, scripts: e.scripts}
+}
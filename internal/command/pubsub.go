@@ -0,0 +1,51 @@
+package command
+
+import (
+	"errors"
+	"strings"
+
+	"tcp-server.com/m/internal/protocol"
+)
+
+/*
+PUBLISH channel message, returns the number of clients that received it
+*/
+func (e *Executor) CmdPublish(args []string) []byte {
+	en := protocol.Encoder{}
+	return en.Encode(e.broker.Publish(args[0], args[1]), false)
+}
+
+/*
+SPUBLISH shardchannel message
+*/
+func (e *Executor) CmdSPublish(args []string) []byte {
+	en := protocol.Encoder{}
+	return en.Encode(e.broker.SPublish(args[0], args[1]), false)
+}
+
+/*
+PUBSUB CHANNELS [pattern]
+PUBSUB NUMSUB [channel ...]
+PUBSUB NUMPAT
+PUBSUB SHARDCHANNELS [pattern]
+PUBSUB SHARDNUMSUB [shardchannel ...]
+*/
+func (e *Executor) CmdPubSub(args []string) []byte {
+	en := protocol.Encoder{}
+	sub := strings.ToUpper(args[0])
+	switch {
+	case sub == "CHANNELS" && len(args) <= 2:
+		return en.Encode(e.broker.Channels(strings.Join(args[1:], "")), false)
+	case sub == "SHARDCHANNELS" && len(args) <= 2:
+		return en.Encode(e.broker.ShardChannels(strings.Join(args[1:], "")), false)
+	case sub == "NUMSUB":
+		return en.Encode(e.broker.NumSub(args[1:]), false)
+	case sub == "SHARDNUMSUB":
+		return en.Encode(e.broker.ShardNumSub(args[1:]), false)
+	case sub == "NUMPAT" && len(args) == 1:
+		return en.Encode(e.broker.NumPat(), false)
+	case sub == "CHANNELS" || sub == "SHARDCHANNELS" || sub == "NUMPAT":
+		return en.Encode(errors.New("ERR wrong number of arguments for 'PUBSUB|"+strings.ToLower(sub)+"' command"), false)
+	}
+	return en.Encode(errors.New("ERR unknown subcommand '"+args[0]+"'. Try PUBSUB HELP."), false)
+}
@@ -0,0 +1,256 @@
+package command
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+/*
+Properties of a command, as reported by COMMAND INFO
+*/
+type Flag int
+
+const (
+	// May modify the keyspace
+	FlagWrite Flag = 1 << iota
+	// Only reads data
+	FlagReadonly
+	// Runs in constant or log time
+	FlagFast
+	// May wait for other clients
+	FlagBlocking
+	// Cannot be called from scripts
+	FlagNoScript
+	// Server administration
+	FlagAdmin
+	// Pub/Sub related
+	FlagPubSub
+)
+
+var flagNames = []struct {
+	flag Flag
+	name string
+}{
+	{FlagWrite, "write"},
+	{FlagReadonly, "readonly"},
+	{FlagFast, "fast"},
+	{FlagBlocking, "blocking"},
+	{FlagNoScript, "noscript"},
+	{FlagAdmin, "admin"},
+	{FlagPubSub, "pubsub"},
+}
+
+/*
+Flags from their names separated by spaces, such as "write fast"
+*/
+func ParseFlags(s string) (Flag, error) {
+	var res Flag
+	for _, word := range strings.Fields(s) {
+		found := false
+		for _, f := range flagNames {
+			if strings.EqualFold(word, f.name) {
+				res |= f.flag
+				found = true
+				break
+			}
+		}
+		if !found {
+			return 0, fmt.Errorf("unknown command flag '%s'", word)
+		}
+	}
+	return res, nil
+}
+
+/*
+Names of the flags set in `flags`
+*/
+func (flags Flag) Names() []string {
+	res := make([]string, 0)
+	for _, f := range flagNames {
+		if flags&f.flag != 0 {
+			res = append(res, f.name)
+		}
+	}
+	return res
+}
+
+/*
+Handler of a command, returns the encoded reply
+*/
+type Handler func(e *Executor, args []string) []byte
+
+/*
+Command definition. Arity counts the command name, negative means at least
+that many arguments. Keys are at positions FirstKey to LastKey every Step,
+LastKey -1 is the last argument and 0 means the command takes no key at a
+fixed position
+*/
+type Spec struct {
+	Name     string
+	Arity    int
+	Flags    Flag
+	FirstKey int
+	LastKey  int
+	Step     int
+	Handler  Handler
+	// Keys of commands whose key positions depend on their arguments, such
+	// as ZUNION numkeys key [key ...]. Returns every key of the command, nil
+	// when the arguments cannot be parsed
+	Keys func(args []string) []string
+	// Reported by COMMAND DOCS, Group is the Redis command group such as
+	// "sorted-set" and Module the name of the module adding the command
+	Group   string
+	Summary string
+	Module  string
+	// Takes the lock itself: blocking commands must not hold the shared
+	// lock while they wait, scripts hold it exclusively and SCRIPT KILL
+	// must get through while a script runs
+	selfLocking bool
+}
+
+var registry = struct {
+	sync.RWMutex
+	specs map[string]*Spec
+}{specs: make(map[string]*Spec)}
+
+func init() {
+	for _, spec := range builtinCommands {
+		if doc, ok := builtinDocs[spec.Name]; ok {
+			spec.Group, spec.Summary = doc.group, doc.summary
+		}
+		if err := Register(spec); err != nil {
+			panic(err)
+		}
+	}
+}
+
+/*
+Add a command, names are case insensitive and cannot be registered twice
+*/
+func Register(spec *Spec) error {
+	if spec.Name == "" || strings.ContainsAny(spec.Name, " \r\n") {
+		return fmt.Errorf("invalid command name '%s'", spec.Name)
+	}
+	if spec.Arity == 0 {
+		return fmt.Errorf("invalid arity for command '%s'", spec.Name)
+	}
+	if spec.Handler == nil {
+		return fmt.Errorf("command '%s' has no handler", spec.Name)
+	}
+	if spec.FirstKey < 0 || (spec.FirstKey > 0 && spec.Step <= 0) {
+		return fmt.Errorf("invalid key positions for command '%s'", spec.Name)
+	}
+	if spec.Flags&FlagWrite != 0 && spec.Flags&FlagReadonly != 0 {
+		return errors.New("a command cannot be both write and readonly")
+	}
+	name := strings.ToUpper(spec.Name)
+	registry.Lock()
+	defer registry.Unlock()
+	if _, ok := registry.specs[name]; ok {
+		return fmt.Errorf("command '%s' is already registered", name)
+	}
+	spec.Name = name
+	registry.specs[name] = spec
+	return nil
+}
+
+/*
+Command named `name` (uppercase), nil when there is none
+*/
+func Lookup(name string) *Spec {
+	registry.RLock()
+	defer registry.RUnlock()
+	return registry.specs[name]
+}
+
+/*
+Every registered command sorted by name
+*/
+func Specs() []*Spec {
+	registry.RLock()
+	defer registry.RUnlock()
+	res := make([]*Spec, 0, len(registry.specs))
+	for _, spec := range registry.specs {
+		res = append(res, spec)
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Name < res[j].Name })
+	return res
+}
+
+/*
+Add a command whose handler runs with no other command in between, for
+handlers not safe for concurrent use such as the ones of modules
+*/
+func RegisterExclusive(spec *Spec) error {
+	handler := spec.Handler
+	wrapped := *spec
+	wrapped.selfLocking = true
+	if handler != nil {
+		wrapped.Handler = func(e *Executor, args []string) []byte {
+			if !e.exclusive {
+				e.lock.Lock()
+				defer e.lock.Unlock()
+				e = e.exclusiveView()
+			}
+			return handler(e, args)
+		}
+	}
+	return Register(&wrapped)
+}
+
+/*
+Whether `argc` arguments, not counting the command name, match the arity
+*/
+func (spec *Spec) arityOK(argc int) bool {
+	argc++
+	if spec.Arity > 0 {
+		return argc == spec.Arity
+	}
+	return argc >= -spec.Arity
+}
+
+/*
+Keys in `args`, nil when they cannot be found
+*/
+func (spec *Spec) keys(args []string) []string {
+	if spec.Keys != nil {
+		return spec.Keys(args)
+	}
+	res := make([]string, 0)
+	if spec.FirstKey == 0 {
+		return res
+	}
+	last := spec.LastKey
+	if last < 0 {
+		last += len(args) + 1
+	}
+	for pos := spec.FirstKey; pos <= last && pos <= len(args); pos += spec.Step {
+		res = append(res, args[pos-1])
+	}
+	return res
+}
+
+/*
+Keys of `numkeys key [key ...]` starting at args[pos], preceded by the
+destination key args[0] when `dest` is set
+*/
+func numKeysAt(pos int, dest bool) func(args []string) []string {
+	return func(args []string) []string {
+		if pos >= len(args) {
+			return nil
+		}
+		n, err := strconv.Atoi(args[pos])
+		if err != nil || n < 0 || n > len(args)-pos-1 {
+			return nil
+		}
+		res := make([]string, 0, n+1)
+		if dest {
+			res = append(res, args[0])
+		}
+		return append(res, args[pos+1:pos+1+n]...)
+	}
+}
@@ -0,0 +1,493 @@
+package command
+
+import (
+	"errors"
+	"math"
+	"strconv"
+	"strings"
+
+	"tcp-server.com/m/internal/datastructure"
+	"tcp-server.com/m/internal/protocol"
+)
+
+var (
+	errNotInteger  = errors.New("ERR value is not an integer or out of range")
+	errSyntax      = errors.New("ERR syntax error")
+	errNotPositive = errors.New("ERR value is out of range, must be positive")
+	errOutOfRange  = errors.New("ERR value is out of range")
+)
+
+// Largest number of members ZRANDMEMBER returns for a negative count, the
+// reply is built in memory under the storage lock
+const zrandMaxRepeated = 1 << 20
+
+/*
+Format a score the way Redis replies with it inside arrays
+*/
+func formatScore(score float64) string {
+	switch {
+	case math.IsInf(score, 1):
+		return "inf"
+	case math.IsInf(score, -1):
+		return "-inf"
+	case math.IsNaN(score):
+		return "nan"
+	}
+	return strconv.FormatFloat(score, 'f', -1, 64)
+}
+
+func encodeZElements(elements []datastructure.ZElement, withScores bool) []byte {
+	en := protocol.Encoder{}
+	res := make([]string, 0, len(elements))
+	for _, e := range elements {
+		res = append(res, e.Member)
+		if withScores {
+			res = append(res, formatScore(e.Score))
+		}
+	}
+	return en.Encode(res, false)
+}
+
+/*
+Parse `start stop [BYSCORE|BYLEX] [REV] [LIMIT offset count]` of ZRANGE and
+ZRANGESTORE. WITHSCORES is only accepted when `allowWithScores` is set.
+*/
+func parseZRangeSpec(args []string, allowWithScores bool) (*datastructure.ZRangeSpec, bool, error) {
+	spec := &datastructure.ZRangeSpec{By: datastructure.ZRangeByRank, Count: -1}
+	withScores, hasLimit := false, false
+
+	for i := 2; i < len(args); i++ {
+		switch strings.ToUpper(args[i]) {
+		case "BYSCORE":
+			spec.By = datastructure.ZRangeByScore
+		case "BYLEX":
+			spec.By = datastructure.ZRangeByLex
+		case "REV":
+			spec.Rev = true
+		case "WITHSCORES":
+			if !allowWithScores {
+				return nil, false, errSyntax
+			}
+			withScores = true
+		case "LIMIT":
+			if i+2 >= len(args) {
+				return nil, false, errSyntax
+			}
+			offset, err1 := strconv.Atoi(args[i+1])
+			count, err2 := strconv.Atoi(args[i+2])
+			if err1 != nil || err2 != nil {
+				return nil, false, errNotInteger
+			}
+			spec.Offset, spec.Count = offset, count
+			hasLimit = true
+			i += 2
+		default:
+			return nil, false, errSyntax
+		}
+	}
+
+	if hasLimit && spec.By == datastructure.ZRangeByRank {
+		return nil, false, errors.New("ERR syntax error, LIMIT is only supported in combination with either BYSCORE or BYLEX")
+	}
+	if withScores && spec.By == datastructure.ZRangeByLex {
+		return nil, false, errors.New("ERR syntax error, WITHSCORES not supported in combination with BYLEX")
+	}
+
+	min, max := args[0], args[1]
+	if spec.Rev && spec.By != datastructure.ZRangeByRank {
+		min, max = max, min
+	}
+
+	var err error
+	switch spec.By {
+	case datastructure.ZRangeByScore:
+		spec.Score, err = datastructure.ParseScoreRange(min, max)
+	case datastructure.ZRangeByLex:
+		spec.Lex, err = datastructure.ParseLexRange(min, max)
+	default:
+		start, err1 := strconv.Atoi(min)
+		stop, err2 := strconv.Atoi(max)
+		if err1 != nil || err2 != nil {
+			err = errNotInteger
+		}
+		spec.Start, spec.Stop = start, stop
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	return spec, withScores, nil
+}
+
+/*
+ZADD key [NX|XX] [GT|LT] [CH] [INCR] score member [score member ...]
+*/
+func (e *Executor) CmdZadd(args []string) []byte {
+	en := protocol.Encoder{}
+
+	flags, i := 0, 1
+flagLoop:
+	for ; i < len(args); i++ {
+		switch strings.ToUpper(args[i]) {
+		case "NX":
+			flags |= datastructure.ZaddNX
+		case "XX":
+			flags |= datastructure.ZaddXX
+		case "GT":
+			flags |= datastructure.ZaddGT
+		case "LT":
+			flags |= datastructure.ZaddLT
+		case "CH":
+			flags |= datastructure.ZaddCH
+		case "INCR":
+			flags |= datastructure.ZaddINCR
+		default:
+			break flagLoop
+		}
+	}
+
+	pairs := args[i:]
+	if len(pairs) == 0 || len(pairs)%2 != 0 {
+		return en.Encode(errSyntax, false)
+	}
+	if flags&datastructure.ZaddNX != 0 && flags&datastructure.ZaddXX != 0 {
+		return en.Encode(errors.New("ERR XX and NX options at the same time are not compatible"), false)
+	}
+	gtlt := flags & (datastructure.ZaddGT | datastructure.ZaddLT)
+	if gtlt == datastructure.ZaddGT|datastructure.ZaddLT || (gtlt != 0 && flags&datastructure.ZaddNX != 0) {
+		return en.Encode(errors.New("ERR GT, LT, and/or NX options at the same time are not compatible"), false)
+	}
+	if flags&datastructure.ZaddINCR != 0 && len(pairs) > 2 {
+		return en.Encode(errors.New("ERR INCR option supports a single increment-element pair"), false)
+	}
+
+	elements := make([]datastructure.ZElement, 0, len(pairs)/2)
+	for j := 0; j < len(pairs); j += 2 {
+		score, err := datastructure.ParseScore(pairs[j])
+		if err != nil {
+			return en.Encode(err, false)
+		}
+		elements = append(elements, datastructure.ZElement{Member: pairs[j+1], Score: score})
+	}
+
+	if flags&datastructure.ZaddINCR != 0 {
+		score, ok, err := e.store.ZaddIncr(args[0], flags, elements[0].Member, elements[0].Score)
+		if err != nil {
+			return en.Encode(err, false)
+		}
+		if !ok {
+			return en.Encode(nil, false)
+		}
+		return en.Encode(score, false)
+	}
+
+	res, err := e.store.Zadd(args[0], flags, elements)
+	if err != nil {
+		return en.Encode(err, false)
+	}
+	return en.Encode(res, false)
+}
+
+func (e *Executor) CmdZrem(args []string) []byte {
+	en := protocol.Encoder{}
+	return en.Encode(e.store.Zrem(args[0], args[1:]), false)
+}
+
+func (e *Executor) CmdZcard(args []string) []byte {
+	en := protocol.Encoder{}
+	return en.Encode(e.store.Zcard(args[0]), false)
+}
+
+func (e *Executor) CmdZcount(args []string) []byte {
+	en := protocol.Encoder{}
+	r, err := datastructure.ParseScoreRange(args[1], args[2])
+	if err != nil {
+		return en.Encode(err, false)
+	}
+	return en.Encode(e.store.Zcount(args[0], r), false)
+}
+
+func (e *Executor) CmdZlexcount(args []string) []byte {
+	en := protocol.Encoder{}
+	r, err := datastructure.ParseLexRange(args[1], args[2])
+	if err != nil {
+		return en.Encode(err, false)
+	}
+	return en.Encode(e.store.Zlexcount(args[0], r), false)
+}
+
+func (e *Executor) CmdZincrby(args []string) []byte {
+	en := protocol.Encoder{}
+	incr, err := datastructure.ParseScore(args[1])
+	if err != nil {
+		return en.Encode(err, false)
+	}
+	res, err := e.store.Zincrby(args[0], incr, args[2])
+	if err != nil {
+		return en.Encode(err, false)
+	}
+	return en.Encode(res, false)
+}
+
+func (e *Executor) CmdZrevrank(args []string) []byte {
+	en := protocol.Encoder{}
+	res := e.store.Zrevrank(args[0], args[1])
+	if res == -1 {
+		return en.Encode(nil, false)
+	}
+	return en.Encode(res, false)
+}
+
+func (e *Executor) CmdZmscore(args []string) []byte {
+	en := protocol.Encoder{}
+	return en.Encode(e.store.Zmscore(args[0], args[1:]), false)
+}
+
+func (e *Executor) CmdZrange(args []string) []byte {
+	en := protocol.Encoder{}
+	spec, withScores, err := parseZRangeSpec(args[1:], true)
+	if err != nil {
+		return en.Encode(err, false)
+	}
+	return encodeZElements(e.store.Zrange(args[0], spec), withScores)
+}
+
+func (e *Executor) CmdZrangeStore(args []string) []byte {
+	en := protocol.Encoder{}
+	spec, _, err := parseZRangeSpec(args[2:], false)
+	if err != nil {
+		return en.Encode(err, false)
+	}
+	return en.Encode(e.store.ZrangeStore(args[0], args[1], spec), false)
+}
+
+func (e *Executor) CmdZremRangeByRank(args []string) []byte {
+	en := protocol.Encoder{}
+	start, err1 := strconv.Atoi(args[1])
+	stop, err2 := strconv.Atoi(args[2])
+	if err1 != nil || err2 != nil {
+		return en.Encode(errNotInteger, false)
+	}
+	return en.Encode(e.store.ZremRangeByRank(args[0], start, stop), false)
+}
+
+func (e *Executor) CmdZremRangeByScore(args []string) []byte {
+	en := protocol.Encoder{}
+	r, err := datastructure.ParseScoreRange(args[1], args[2])
+	if err != nil {
+		return en.Encode(err, false)
+	}
+	return en.Encode(e.store.ZremRangeByScore(args[0], r), false)
+}
+
+func (e *Executor) CmdZremRangeByLex(args []string) []byte {
+	en := protocol.Encoder{}
+	r, err := datastructure.ParseLexRange(args[1], args[2])
+	if err != nil {
+		return en.Encode(err, false)
+	}
+	return en.Encode(e.store.ZremRangeByLex(args[0], r), false)
+}
+
+func (e *Executor) cmdZpop(args []string, max bool, name string) []byte {
+	en := protocol.Encoder{}
+	if len(args) > 2 {
+		return en.Encode(errors.New("ERR wrong number of arguments for '"+name+"' command"), false)
+	}
+	count := 1
+	if len(args) == 2 {
+		var err error
+		if count, err = strconv.Atoi(args[1]); err != nil {
+			return en.Encode(errNotInteger, false)
+		}
+		if count < 0 {
+			return en.Encode(errNotPositive, false)
+		}
+	}
+	return encodeZElements(e.store.Zpop(args[0], count, max), true)
+}
+
+func (e *Executor) CmdZpopMin(args []string) []byte {
+	return e.cmdZpop(args, false, CmdZpopMin)
+}
+
+func (e *Executor) CmdZpopMax(args []string) []byte {
+	return e.cmdZpop(args, true, CmdZpopMax)
+}
+
+func (e *Executor) CmdZrandMember(args []string) []byte {
+	en := protocol.Encoder{}
+	if len(args) > 3 {
+		return en.Encode(errors.New("ERR wrong number of arguments for 'ZRANDMEMBER' command"), false)
+	}
+	if len(args) == 1 {
+		res, ok := e.store.ZrandMember(args[0], 1)
+		if !ok {
+			return en.Encode(nil, false)
+		}
+		return en.Encode(res[0].Member, false)
+	}
+
+	count, err := strconv.Atoi(args[1])
+	if err != nil {
+		return en.Encode(errNotInteger, false)
+	}
+	// The range Redis accepts, then what this server is willing to build
+	if count < -math.MaxInt64/2 || count > math.MaxInt64/2 || count < -zrandMaxRepeated {
+		return en.Encode(errOutOfRange, false)
+	}
+	withScores := false
+	if len(args) == 3 {
+		if strings.ToUpper(args[2]) != "WITHSCORES" {
+			return en.Encode(errSyntax, false)
+		}
+		withScores = true
+	}
+	res, _ := e.store.ZrandMember(args[0], count)
+	return encodeZElements(res, withScores)
+}
+
+type zsetOpArgs struct {
+	keys       []string
+	weights    []float64
+	agg        int
+	withScores bool
+}
+
+/*
+Parse `numkeys key [key ...]` and return the keys with the remaining args
+*/
+func parseNumKeys(args []string, name string) ([]string, []string, error) {
+	numKeys, err := strconv.Atoi(args[0])
+	if err != nil {
+		return nil, nil, errNotInteger
+	}
+	if numKeys <= 0 {
+		return nil, nil, errors.New("ERR at least 1 input key is needed for '" + strings.ToLower(name) + "' command")
+	}
+	if numKeys > len(args)-1 {
+		return nil, nil, errors.New("ERR Number of keys can't be greater than number of args")
+	}
+	return args[1 : numKeys+1], args[numKeys+1:], nil
+}
+
+/*
+Parse `numkeys key [key ...] [WEIGHTS weight ...] [AGGREGATE SUM|MIN|MAX]
+[WITHSCORES]`. ZDIFF takes no WEIGHTS/AGGREGATE and the STORE variants take
+no WITHSCORES
+*/
+func parseZsetOpArgs(args []string, name string, op int, store bool) (*zsetOpArgs, error) {
+	keys, opts, err := parseNumKeys(args, name)
+	if err != nil {
+		return nil, err
+	}
+
+	res := &zsetOpArgs{keys: keys, agg: datastructure.ZAggregateSum}
+	res.weights = make([]float64, len(keys))
+	for i := range res.weights {
+		res.weights[i] = 1
+	}
+
+	for i := 0; i < len(opts); i++ {
+		switch opt := strings.ToUpper(opts[i]); {
+		case opt == "WEIGHTS" && op != datastructure.ZsetOpDiff:
+			if i+len(keys) >= len(opts) {
+				return nil, errSyntax
+			}
+			for j := range keys {
+				w, err := datastructure.ParseScore(opts[i+1+j])
+				if err != nil {
+					return nil, errors.New("ERR weight value is not a float")
+				}
+				res.weights[j] = w
+			}
+			i += len(keys)
+		case opt == "AGGREGATE" && op != datastructure.ZsetOpDiff:
+			if i+1 >= len(opts) {
+				return nil, errSyntax
+			}
+			switch strings.ToUpper(opts[i+1]) {
+			case "SUM":
+				res.agg = datastructure.ZAggregateSum
+			case "MIN":
+				res.agg = datastructure.ZAggregateMin
+			case "MAX":
+				res.agg = datastructure.ZAggregateMax
+			default:
+				return nil, errSyntax
+			}
+			i++
+		case opt == "WITHSCORES" && !store:
+			res.withScores = true
+		default:
+			return nil, errSyntax
+		}
+	}
+	return res, nil
+}
+
+func (e *Executor) cmdZsetOp(args []string, op int, name string) []byte {
+	en := protocol.Encoder{}
+	parsed, err := parseZsetOpArgs(args, name, op, false)
+	if err != nil {
+		return en.Encode(err, false)
+	}
+	res := e.store.ZsetOp(op, parsed.keys, parsed.weights, parsed.agg)
+	return encodeZElements(res, parsed.withScores)
+}
+
+func (e *Executor) cmdZsetOpStore(args []string, op int, name string) []byte {
+	en := protocol.Encoder{}
+	parsed, err := parseZsetOpArgs(args[1:], name, op, true)
+	if err != nil {
+		return en.Encode(err, false)
+	}
+	return en.Encode(e.store.ZsetOpStore(args[0], op, parsed.keys, parsed.weights, parsed.agg), false)
+}
+
+func (e *Executor) CmdZunion(args []string) []byte {
+	return e.cmdZsetOp(args, datastructure.ZsetOpUnion, CmdZunion)
+}
+
+func (e *Executor) CmdZinter(args []string) []byte {
+	return e.cmdZsetOp(args, datastructure.ZsetOpInter, CmdZinter)
+}
+
+func (e *Executor) CmdZdiff(args []string) []byte {
+	return e.cmdZsetOp(args, datastructure.ZsetOpDiff, CmdZdiff)
+}
+
+func (e *Executor) CmdZunionStore(args []string) []byte {
+	return e.cmdZsetOpStore(args, datastructure.ZsetOpUnion, CmdZunionStore)
+}
+
+func (e *Executor) CmdZinterStore(args []string) []byte {
+	return e.cmdZsetOpStore(args, datastructure.ZsetOpInter, CmdZinterStore)
+}
+
+func (e *Executor) CmdZdiffStore(args []string) []byte {
+	return e.cmdZsetOpStore(args, datastructure.ZsetOpDiff, CmdZdiffStore)
+}
+
+/*
+ZINTERCARD numkeys key [key ...] [LIMIT limit]
+*/
+func (e *Executor) CmdZinterCard(args []string) []byte {
+	en := protocol.Encoder{}
+	keys, opts, err := parseNumKeys(args, CmdZinterCard)
+	if err != nil {
+		return en.Encode(err, false)
+	}
+	limit := 0
+	if len(opts) > 0 {
+		if len(opts) != 2 || strings.ToUpper(opts[0]) != "LIMIT" {
+			return en.Encode(errSyntax, false)
+		}
+		if limit, err = strconv.Atoi(opts[1]); err != nil {
+			return en.Encode(errNotInteger, false)
+		}
+		if limit < 0 {
+			return en.Encode(errors.New("ERR LIMIT can't be negative"), false)
+		}
+	}
+	return en.Encode(e.store.Zintercard(keys, limit), false)
+}
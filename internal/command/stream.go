@@ -0,0 +1,760 @@
+package command
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"tcp-server.com/m/internal/datastructure"
+	"tcp-server.com/m/internal/protocol"
+)
+
+var errStreamNoKey = errors.New("ERR no such key")
+
+func encodeStreamEntry(entry datastructure.StreamEntry) []any {
+	if entry.Fields == nil {
+		return []any{entry.ID.String(), nil}
+	}
+	return []any{entry.ID.String(), entry.Fields}
+}
+
+func encodeStreamEntries(entries []datastructure.StreamEntry) []any {
+	res := make([]any, len(entries))
+	for i, entry := range entries {
+		res[i] = encodeStreamEntry(entry)
+	}
+	return res
+}
+
+/*
+Reply of XREAD and XREADGROUP, a null array when BLOCK timed out
+*/
+func encodeStreamReadResults(results []datastructure.StreamReadResult) any {
+	if results == nil {
+		return protocol.NullArray
+	}
+	res := make([]any, len(results))
+	for i, r := range results {
+		res[i] = []any{r.Key, encodeStreamEntries(r.Entries)}
+	}
+	return res
+}
+
+func parseStreamIDs(args []string) ([]datastructure.StreamID, error) {
+	ids := make([]datastructure.StreamID, len(args))
+	for i, arg := range args {
+		id, err := datastructure.ParseStreamID(arg, 0)
+		if err != nil {
+			return nil, err
+		}
+		ids[i] = id
+	}
+	return ids, nil
+}
+
+/*
+Parse `MAXLEN|MINID [=|~] threshold [LIMIT count]` at the start of `args`,
+returns the number of arguments consumed
+*/
+func parseStreamTrim(args []string) (datastructure.StreamTrim, int, error) {
+	var trim datastructure.StreamTrim
+	if len(args) < 2 {
+		return trim, 0, errSyntax
+	}
+	switch strings.ToUpper(args[0]) {
+	case "MAXLEN":
+		trim.Strategy = datastructure.StreamTrimMaxLen
+	case "MINID":
+		trim.Strategy = datastructure.StreamTrimMinID
+	default:
+		return trim, 0, errSyntax
+	}
+
+	i := 1
+	if args[i] == "~" || args[i] == "=" {
+		trim.Approx = args[i] == "~"
+		i++
+	}
+	if i >= len(args) {
+		return trim, 0, errSyntax
+	}
+	if trim.Strategy == datastructure.StreamTrimMaxLen {
+		maxLen, err := strconv.Atoi(args[i])
+		if err != nil {
+			return trim, 0, errNotInteger
+		}
+		if maxLen < 0 {
+			return trim, 0, errors.New("ERR The MAXLEN argument must be >= 0.")
+		}
+		trim.MaxLen = maxLen
+	} else {
+		minID, err := datastructure.ParseStreamID(args[i], 0)
+		if err != nil {
+			return trim, 0, err
+		}
+		trim.MinID = minID
+	}
+	i++
+
+	if i+1 < len(args) && strings.ToUpper(args[i]) == "LIMIT" {
+		if !trim.Approx {
+			return trim, 0, errors.New("ERR syntax error, LIMIT cannot be used without the special ~ option")
+		}
+		limit, err := strconv.Atoi(args[i+1])
+		if err != nil || limit < 0 {
+			return trim, 0, errors.New("ERR The LIMIT argument must be >= 0.")
+		}
+		trim.Limit = limit
+		i += 2
+	}
+	return trim, i, nil
+}
+
+/*
+XADD key [NOMKSTREAM] [MAXLEN|MINID [=|~] threshold [LIMIT count]]
+*|id field value [field value ...]
+*/
+func (e *Executor) CmdXAdd(args []string) []byte {
+	en := protocol.Encoder{}
+	noMkStream := false
+	var trim *datastructure.StreamTrim
+	i := 1
+	for ; i < len(args); i++ {
+		switch strings.ToUpper(args[i]) {
+		case "NOMKSTREAM":
+			noMkStream = true
+			continue
+		case "MAXLEN", "MINID":
+			t, n, err := parseStreamTrim(args[i:])
+			if err != nil {
+				return en.Encode(err, false)
+			}
+			trim = &t
+			i += n - 1
+			continue
+		}
+		break
+	}
+	fields := args[min(i+1, len(args)):]
+	if len(fields) == 0 || len(fields)%2 != 0 {
+		return en.Encode(errors.New("ERR wrong number of arguments for 'XADD' command"), false)
+	}
+
+	id, ok, err := e.store.XAdd(args[0], args[i], fields, noMkStream, trim)
+	if err != nil {
+		return en.Encode(err, false)
+	}
+	if !ok {
+		return en.Encode(nil, false)
+	}
+	return en.Encode(id.String(), false)
+}
+
+/*
+XTRIM key MAXLEN|MINID [=|~] threshold [LIMIT count]
+*/
+func (e *Executor) CmdXTrim(args []string) []byte {
+	en := protocol.Encoder{}
+	trim, n, err := parseStreamTrim(args[1:])
+	if err != nil {
+		return en.Encode(err, false)
+	}
+	if n != len(args)-1 {
+		return en.Encode(errSyntax, false)
+	}
+	return en.Encode(e.store.XTrim(args[0], trim), false)
+}
+
+func (e *Executor) CmdXLen(args []string) []byte {
+	en := protocol.Encoder{}
+	return en.Encode(e.store.XLen(args[0]), false)
+}
+
+/*
+XDEL key id [id ...]
+*/
+func (e *Executor) CmdXDel(args []string) []byte {
+	en := protocol.Encoder{}
+	ids, err := parseStreamIDs(args[1:])
+	if err != nil {
+		return en.Encode(err, false)
+	}
+	return en.Encode(e.store.XDel(args[0], ids), false)
+}
+
+func (e *Executor) xrange(args []string, rev bool, name string) []byte {
+	en := protocol.Encoder{}
+	if len(args) != 3 && len(args) != 5 {
+		return en.Encode(errors.New("ERR wrong number of arguments for '"+name+"' command"), false)
+	}
+	startArg, endArg := args[1], args[2]
+	if rev {
+		startArg, endArg = endArg, startArg
+	}
+	start, err := datastructure.ParseStreamRangeID(startArg, false)
+	if err != nil {
+		return en.Encode(err, false)
+	}
+	end, err := datastructure.ParseStreamRangeID(endArg, true)
+	if err != nil {
+		return en.Encode(err, false)
+	}
+	count := -1
+	if len(args) == 5 {
+		if strings.ToUpper(args[3]) != "COUNT" {
+			return en.Encode(errSyntax, false)
+		}
+		if count, err = strconv.Atoi(args[4]); err != nil {
+			return en.Encode(errNotInteger, false)
+		}
+		if count <= 0 {
+			return en.Encode([]any{}, false)
+		}
+	}
+	return en.Encode(encodeStreamEntries(e.store.XRange(args[0], start, end, count, rev)), false)
+}
+
+/*
+XRANGE key start end [COUNT count]
+*/
+func (e *Executor) CmdXRange(args []string) []byte {
+	return e.xrange(args, false, CmdXRange)
+}
+
+/*
+XREVRANGE key end start [COUNT count]
+*/
+func (e *Executor) CmdXRevRange(args []string) []byte {
+	return e.xrange(args, true, CmdXRevRange)
+}
+
+type xreadArgs struct {
+	count int
+	// Negative when the client does not block
+	block time.Duration
+	noAck bool
+	keys  []string
+	ids   []string
+}
+
+/*
+Parse `[COUNT count] [BLOCK milliseconds] [NOACK] STREAMS key [key ...]
+id [id ...]`, NOACK only being accepted by XREADGROUP
+*/
+func parseXReadArgs(args []string, group bool, name string) (*xreadArgs, error) {
+	res := &xreadArgs{block: -1}
+	for i := 0; i < len(args); i++ {
+		switch opt := strings.ToUpper(args[i]); {
+		case opt == "COUNT" && i+1 < len(args):
+			count, err := strconv.Atoi(args[i+1])
+			if err != nil {
+				return nil, errNotInteger
+			}
+			res.count = max(count, 0)
+			i++
+		case opt == "BLOCK" && i+1 < len(args):
+			ms, err := strconv.ParseInt(args[i+1], 10, 64)
+			if err != nil {
+				return nil, errors.New("ERR timeout is not an integer or out of range")
+			}
+			if ms < 0 {
+				return nil, errors.New("ERR timeout is negative")
+			}
+			res.block = time.Duration(ms) * time.Millisecond
+			i++
+		case opt == "NOACK" && group:
+			res.noAck = true
+		case opt == "STREAMS":
+			rest := args[i+1:]
+			if len(rest) == 0 || len(rest)%2 != 0 {
+				return nil, errors.New("ERR Unbalanced '" + strings.ToLower(name) + "' list of streams: for each stream key an ID or '$' must be specified.")
+			}
+			res.keys, res.ids = rest[:len(rest)/2], rest[len(rest)/2:]
+			return res, nil
+		default:
+			return nil, errSyntax
+		}
+	}
+	return nil, errSyntax
+}
+
+/*
+Keys of XREAD, or of XREADGROUP past GROUP group consumer when `group` is
+set
+*/
+func xreadKeys(group bool) func(args []string) []string {
+	return func(args []string) []string {
+		if group {
+			if len(args) < 3 || strings.ToUpper(args[0]) != "GROUP" {
+				return nil
+			}
+			args = args[3:]
+		}
+		r, err := parseXReadArgs(args, group, CmdXRead)
+		if err != nil {
+			return nil
+		}
+		return r.keys
+	}
+}
+
+/*
+XREAD [COUNT count] [BLOCK milliseconds] STREAMS key [key ...] id [id ...]
+*/
+func (e *Executor) CmdXRead(args []string) []byte {
+	en := protocol.Encoder{}
+	r, err := parseXReadArgs(args, false, CmdXRead)
+	if err != nil {
+		return en.Encode(err, false)
+	}
+	if e.exclusive {
+		r.block = -1
+	}
+	after := make([]*datastructure.StreamID, len(r.ids))
+	for i, arg := range r.ids {
+		switch arg {
+		case "$":
+			continue
+		case ">":
+			return en.Encode(errors.New("ERR The > ID can be specified only when calling XREADGROUP using the GROUP <group> <consumer> option."), false)
+		}
+		id, err := datastructure.ParseStreamID(arg, 0)
+		if err != nil {
+			return en.Encode(err, false)
+		}
+		after[i] = &id
+	}
+	return en.Encode(encodeStreamReadResults(e.store.XRead(r.keys, after, r.count, r.block)), false)
+}
+
+/*
+XREADGROUP GROUP group consumer [COUNT count] [BLOCK milliseconds] [NOACK]
+STREAMS key [key ...] id [id ...]
+*/
+func (e *Executor) CmdXReadGroup(args []string) []byte {
+	en := protocol.Encoder{}
+	if strings.ToUpper(args[0]) != "GROUP" {
+		return en.Encode(errSyntax, false)
+	}
+	r, err := parseXReadArgs(args[3:], true, CmdXReadGroup)
+	if err != nil {
+		return en.Encode(err, false)
+	}
+	if e.exclusive {
+		r.block = -1
+	}
+	after := make([]*datastructure.StreamID, len(r.ids))
+	for i, arg := range r.ids {
+		switch arg {
+		case ">":
+			continue
+		case "$":
+			return en.Encode(errors.New("ERR The $ ID is meaningless in the context of XREADGROUP: you want to read the history of this consumer by specifying a proper ID, or use the > ID to get new messages. The $ ID would just return an empty result set."), false)
+		}
+		id, err := datastructure.ParseStreamID(arg, 0)
+		if err != nil {
+			return en.Encode(err, false)
+		}
+		after[i] = &id
+	}
+
+	res, err := e.store.XReadGroup(args[1], args[2], r.keys, after, r.count, r.noAck, r.block)
+	if err != nil {
+		return en.Encode(err, false)
+	}
+	return en.Encode(encodeStreamReadResults(res), false)
+}
+
+/*
+ID argument of XGROUP CREATE and SETID, nil for `$`
+*/
+func parseStreamGroupID(arg string) (*datastructure.StreamID, error) {
+	if arg == "$" {
+		return nil, nil
+	}
+	id, err := datastructure.ParseStreamID(arg, 0)
+	if err != nil {
+		return nil, err
+	}
+	return &id, nil
+}
+
+/*
+XGROUP CREATE key group id|$ [MKSTREAM]
+XGROUP SETID key group id|$
+XGROUP DESTROY key group
+XGROUP CREATECONSUMER key group consumer
+XGROUP DELCONSUMER key group consumer
+*/
+func (e *Executor) CmdXGroup(args []string) []byte {
+	en := protocol.Encoder{}
+	sub := strings.ToUpper(args[0])
+	arity := map[string]int{"CREATE": 4, "SETID": 4, "DESTROY": 3, "CREATECONSUMER": 4, "DELCONSUMER": 4}
+	n, ok := arity[sub]
+	if !ok {
+		return en.Encode(errors.New("ERR unknown subcommand '"+args[0]+"'. Try XGROUP HELP."), false)
+	}
+	if len(args) != n && !(sub == "CREATE" && len(args) == n+1) {
+		return en.Encode(errors.New("ERR wrong number of arguments for 'XGROUP|"+strings.ToLower(sub)+"' command"), false)
+	}
+	key, group := args[1], args[2]
+
+	if sub == "CREATE" {
+		mkStream := false
+		if len(args) == n+1 {
+			if strings.ToUpper(args[n]) != "MKSTREAM" {
+				return en.Encode(errSyntax, false)
+			}
+			mkStream = true
+		}
+		id, err := parseStreamGroupID(args[3])
+		if err != nil {
+			return en.Encode(err, false)
+		}
+		if err := e.store.XGroupCreate(key, group, id, mkStream); err != nil {
+			return en.Encode(err, false)
+		}
+		return en.Encode("OK", true)
+	}
+
+	var id *datastructure.StreamID
+	if sub == "SETID" {
+		var err error
+		if id, err = parseStreamGroupID(args[3]); err != nil {
+			return en.Encode(err, false)
+		}
+	}
+	var res any
+	found := e.store.XStreamQuery(key, func(st *datastructure.Stream) {
+		if sub == "DESTROY" {
+			res = 0
+			if st.DestroyGroup(group) {
+				res = 1
+			}
+			return
+		}
+		g, ok := st.Group(group)
+		if !ok {
+			res = datastructure.NoGroupError(key, group)
+			return
+		}
+		switch sub {
+		case "SETID":
+			if id == nil {
+				g.SetID(st.LastID())
+			} else {
+				g.SetID(*id)
+			}
+			res = "OK"
+		case "CREATECONSUMER":
+			res = 0
+			if g.CreateConsumer(args[3]) {
+				res = 1
+			}
+		case "DELCONSUMER":
+			res = g.DelConsumer(args[3])
+		}
+	})
+	if !found {
+		return en.Encode(datastructure.ErrStreamKeyRequired, false)
+	}
+	return en.Encode(res, res == "OK")
+}
+
+/*
+XACK key group id [id ...]
+*/
+func (e *Executor) CmdXAck(args []string) []byte {
+	en := protocol.Encoder{}
+	ids, err := parseStreamIDs(args[2:])
+	if err != nil {
+		return en.Encode(err, false)
+	}
+	return en.Encode(e.store.XAck(args[0], args[1], ids), false)
+}
+
+/*
+XPENDING key group [[IDLE min-idle-time] start end count [consumer]]
+*/
+func (e *Executor) CmdXPending(args []string) []byte {
+	en := protocol.Encoder{}
+	key, group := args[0], args[1]
+
+	if len(args) == 2 {
+		var summary datastructure.PendingSummary
+		err := e.store.XGroupQuery(key, group, func(_ *datastructure.Stream, g *datastructure.ConsumerGroup) {
+			summary = g.PendingSummary()
+		})
+		if err != nil {
+			return en.Encode(err, false)
+		}
+		if summary.Count == 0 {
+			return en.Encode([]any{0, nil, nil, nil}, false)
+		}
+		consumers := make([]any, len(summary.Consumers))
+		for i, c := range summary.Consumers {
+			consumers[i] = []string{c.Name, strconv.Itoa(c.Count)}
+		}
+		return en.Encode([]any{summary.Count, summary.Min.String(), summary.Max.String(), consumers}, false)
+	}
+
+	rest := args[2:]
+	var minIdle int64
+	if strings.ToUpper(rest[0]) == "IDLE" {
+		if len(rest) < 2 {
+			return en.Encode(errSyntax, false)
+		}
+		var err error
+		if minIdle, err = strconv.ParseInt(rest[1], 10, 64); err != nil {
+			return en.Encode(errNotInteger, false)
+		}
+		rest = rest[2:]
+	}
+	if len(rest) != 3 && len(rest) != 4 {
+		return en.Encode(errSyntax, false)
+	}
+	start, err := datastructure.ParseStreamRangeID(rest[0], false)
+	if err != nil {
+		return en.Encode(err, false)
+	}
+	end, err := datastructure.ParseStreamRangeID(rest[1], true)
+	if err != nil {
+		return en.Encode(err, false)
+	}
+	count, err := strconv.Atoi(rest[2])
+	if err != nil {
+		return en.Encode(errNotInteger, false)
+	}
+	consumer := ""
+	if len(rest) == 4 {
+		consumer = rest[3]
+	}
+
+	var pending []datastructure.PendingInfo
+	err = e.store.XGroupQuery(key, group, func(_ *datastructure.Stream, g *datastructure.ConsumerGroup) {
+		pending = g.PendingRange(minIdle, start, end, max(count, 0), consumer)
+	})
+	if err != nil {
+		return en.Encode(err, false)
+	}
+	res := make([]any, len(pending))
+	for i, p := range pending {
+		res[i] = []any{p.ID.String(), p.Consumer, p.Idle, p.DeliveryCount}
+	}
+	return en.Encode(res, false)
+}
+
+func parseMinIdle(arg string) (int64, error) {
+	minIdle, err := strconv.ParseInt(arg, 10, 64)
+	if err != nil {
+		return 0, errors.New("ERR Invalid min-idle-time argument for XCLAIM")
+	}
+	return max(minIdle, 0), nil
+}
+
+/*
+XCLAIM key group consumer min-idle-time id [id ...] [IDLE ms]
+[TIME unix-time-milliseconds] [RETRYCOUNT count] [FORCE] [JUSTID]
+[LASTID lastid]
+*/
+func (e *Executor) CmdXClaim(args []string) []byte {
+	en := protocol.Encoder{}
+	minIdle, err := parseMinIdle(args[3])
+	if err != nil {
+		return en.Encode(err, false)
+	}
+
+	var ids []datastructure.StreamID
+	i := 4
+	for ; i < len(args); i++ {
+		id, err := datastructure.ParseStreamID(args[i], 0)
+		if err != nil {
+			break
+		}
+		ids = append(ids, id)
+	}
+	opts := datastructure.ClaimOpts{Idle: -1, Time: -1, RetryCount: -1}
+	for ; i < len(args); i++ {
+		opt := strings.ToUpper(args[i])
+		switch opt {
+		case "FORCE":
+			opts.Force = true
+			continue
+		case "JUSTID":
+			opts.JustID = true
+			continue
+		}
+		if i+1 >= len(args) {
+			return en.Encode(errSyntax, false)
+		}
+		switch opt {
+		case "IDLE", "TIME":
+			v, err := strconv.ParseInt(args[i+1], 10, 64)
+			if err != nil {
+				return en.Encode(errNotInteger, false)
+			}
+			if opt == "IDLE" {
+				opts.Idle = max(v, 0)
+			} else {
+				opts.Time = max(v, 0)
+			}
+		case "RETRYCOUNT":
+			if opts.RetryCount, err = strconv.Atoi(args[i+1]); err != nil || opts.RetryCount < 0 {
+				return en.Encode(errNotInteger, false)
+			}
+		case "LASTID":
+			id, err := datastructure.ParseStreamID(args[i+1], 0)
+			if err != nil {
+				return en.Encode(err, false)
+			}
+			opts.LastID = &id
+		default:
+			return en.Encode(errSyntax, false)
+		}
+		i++
+	}
+	if len(ids) == 0 {
+		return en.Encode(datastructure.ErrStreamID, false)
+	}
+
+	var claimed []datastructure.StreamEntry
+	err = e.store.XGroupQuery(args[0], args[1], func(st *datastructure.Stream, g *datastructure.ConsumerGroup) {
+		claimed = st.Claim(g, args[2], minIdle, ids, opts)
+	})
+	if err != nil {
+		return en.Encode(err, false)
+	}
+	if opts.JustID {
+		res := make([]string, len(claimed))
+		for i, entry := range claimed {
+			res[i] = entry.ID.String()
+		}
+		return en.Encode(res, false)
+	}
+	return en.Encode(encodeStreamEntries(claimed), false)
+}
+
+/*
+XAUTOCLAIM key group consumer min-idle-time start [COUNT count] [JUSTID]
+*/
+func (e *Executor) CmdXAutoClaim(args []string) []byte {
+	en := protocol.Encoder{}
+	minIdle, err := parseMinIdle(args[3])
+	if err != nil {
+		return en.Encode(err, false)
+	}
+	start, err := datastructure.ParseStreamRangeID(args[4], false)
+	if err != nil {
+		return en.Encode(err, false)
+	}
+	count, justID := 100, false
+	for i := 5; i < len(args); i++ {
+		switch opt := strings.ToUpper(args[i]); {
+		case opt == "COUNT" && i+1 < len(args):
+			count, err = strconv.Atoi(args[i+1])
+			if err != nil || count < 1 {
+				return en.Encode(errors.New("ERR COUNT must be > 0"), false)
+			}
+			i++
+		case opt == "JUSTID":
+			justID = true
+		default:
+			return en.Encode(errSyntax, false)
+		}
+	}
+
+	var next datastructure.StreamID
+	var claimed []datastructure.StreamEntry
+	var deleted []datastructure.StreamID
+	err = e.store.XGroupQuery(args[0], args[1], func(st *datastructure.Stream, g *datastructure.ConsumerGroup) {
+		next, claimed, deleted = st.AutoClaim(g, args[2], minIdle, start, count, justID)
+	})
+	if err != nil {
+		return en.Encode(err, false)
+	}
+
+	deletedIDs := make([]string, len(deleted))
+	for i, id := range deleted {
+		deletedIDs[i] = id.String()
+	}
+	if justID {
+		ids := make([]string, len(claimed))
+		for i, entry := range claimed {
+			ids[i] = entry.ID.String()
+		}
+		return en.Encode([]any{next.String(), ids, deletedIDs}, false)
+	}
+	return en.Encode([]any{next.String(), encodeStreamEntries(claimed), deletedIDs}, false)
+}
+
+/*
+XINFO STREAM key
+XINFO GROUPS key
+XINFO CONSUMERS key group
+*/
+func (e *Executor) CmdXInfo(args []string) []byte {
+	en := protocol.Encoder{}
+	sub := strings.ToUpper(args[0])
+	switch {
+	case sub == "STREAM" && len(args) == 2:
+		var info datastructure.StreamInfo
+		if !e.store.XStreamQuery(args[1], func(st *datastructure.Stream) { info = st.Info() }) {
+			return en.Encode(errStreamNoKey, false)
+		}
+		var first, last any
+		if info.First != nil {
+			first = encodeStreamEntry(*info.First)
+		}
+		if info.Last != nil {
+			last = encodeStreamEntry(*info.Last)
+		}
+		return en.Encode([]any{
+			"length", info.Length,
+			"radix-tree-keys", info.RaxKeys,
+			"radix-tree-nodes", info.RaxNodes,
+			"last-generated-id", info.LastID.String(),
+			"max-deleted-entry-id", info.MaxDeletedID.String(),
+			"entries-added", info.EntriesAdded,
+			"groups", info.Groups,
+			"first-entry", first,
+			"last-entry", last,
+		}, false)
+	case sub == "GROUPS" && len(args) == 2:
+		var groups []datastructure.GroupInfo
+		if !e.store.XStreamQuery(args[1], func(st *datastructure.Stream) { groups = st.GroupsInfo() }) {
+			return en.Encode(errStreamNoKey, false)
+		}
+		res := make([]any, len(groups))
+		for i, g := range groups {
+			res[i] = []any{
+				"name", g.Name,
+				"consumers", g.Consumers,
+				"pending", g.Pending,
+				"last-delivered-id", g.LastDeliveredID.String(),
+			}
+		}
+		return en.Encode(res, false)
+	case sub == "CONSUMERS" && len(args) == 3:
+		var consumers []datastructure.ConsumerInfo
+		err := e.store.XGroupQuery(args[1], args[2], func(_ *datastructure.Stream, g *datastructure.ConsumerGroup) {
+			consumers = g.ConsumersInfo()
+		})
+		if err != nil {
+			return en.Encode(err, false)
+		}
+		res := make([]any, len(consumers))
+		for i, c := range consumers {
+			res[i] = []any{
+				"name", c.Name,
+				"pending", c.Pending,
+				"idle", c.Idle,
+				"inactive", c.Inactive,
+			}
+		}
+		return en.Encode(res, false)
+	case sub == "STREAM" || sub == "GROUPS" || sub == "CONSUMERS":
+		return en.Encode(errors.New("ERR wrong number of arguments for 'XINFO|"+strings.ToLower(sub)+"' command"), false)
+	}
+	return en.Encode(errors.New("ERR unknown subcommand '"+args[0]+"'. Try XINFO HELP."), false)
+}
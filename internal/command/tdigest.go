@@ -0,0 +1,241 @@
+package command
+
+import (
+	"errors"
+	"math"
+	"strconv"
+	"strings"
+
+	"tcp-server.com/m/internal/config"
+	"tcp-server.com/m/internal/datastructure"
+	"tcp-server.com/m/internal/protocol"
+)
+
+var (
+	errTDigestNotFound    = errors.New("ERR T-Digest: key does not exist")
+	errTDigestCompression = errors.New("ERR T-Digest: error parsing compression parameter")
+)
+
+func parseTDigestValues(args []string, name string) ([]float64, error) {
+	res := make([]float64, len(args))
+	for i, arg := range args {
+		v, err := strconv.ParseFloat(arg, 64)
+		if err != nil || math.IsNaN(v) {
+			return nil, errors.New("ERR T-Digest: error parsing " + name)
+		}
+		res[i] = v
+	}
+	return res, nil
+}
+
+func parseTDigestCompression(arg string) (float64, error) {
+	v, err := strconv.ParseUint(arg, 10, 32)
+	if err != nil || v == 0 {
+		return 0, errTDigestCompression
+	}
+	return float64(v), nil
+}
+
+func formatScores(values []float64) []string {
+	res := make([]string, len(values))
+	for i, v := range values {
+		res[i] = formatScore(v)
+	}
+	return res
+}
+
+/*
+TDIGEST.CREATE key [COMPRESSION compression]
+*/
+func (e *Executor) CmdTDigestCreate(args []string) []byte {
+	en := protocol.Encoder{}
+	if len(args) != 1 && len(args) != 3 {
+		return en.Encode(errors.New("ERR wrong number of arguments for 'TDIGEST.CREATE' command"), false)
+	}
+	compression := config.TDigestDefaultCompression
+	if len(args) == 3 {
+		if strings.ToUpper(args[1]) != "COMPRESSION" {
+			return en.Encode(errSyntax, false)
+		}
+		var err error
+		if compression, err = parseTDigestCompression(args[2]); err != nil {
+			return en.Encode(err, false)
+		}
+	}
+	if e.store.NewTDigest(args[0], compression) == -1 {
+		return en.Encode(errors.New("ERR T-Digest: key already exists"), false)
+	}
+	return en.Encode("OK", true)
+}
+
+/*
+TDIGEST.ADD key value [value ...]
+*/
+func (e *Executor) CmdTDigestAdd(args []string) []byte {
+	en := protocol.Encoder{}
+	values, err := parseTDigestValues(args[1:], "val parameter")
+	if err != nil {
+		return en.Encode(err, false)
+	}
+	if !e.store.TDigestAdd(args[0], values) {
+		return en.Encode(errTDigestNotFound, false)
+	}
+	return en.Encode("OK", true)
+}
+
+func (e *Executor) CmdTDigestReset(args []string) []byte {
+	en := protocol.Encoder{}
+	if !e.store.TDigestReset(args[0]) {
+		return en.Encode(errTDigestNotFound, false)
+	}
+	return en.Encode("OK", true)
+}
+
+/*
+TDIGEST.QUANTILE key quantile [quantile ...]
+*/
+func (e *Executor) CmdTDigestQuantile(args []string) []byte {
+	en := protocol.Encoder{}
+	quantiles, err := parseTDigestValues(args[1:], "quantile")
+	if err != nil {
+		return en.Encode(err, false)
+	}
+	for _, q := range quantiles {
+		if q < 0 || q > 1 {
+			return en.Encode(errors.New("ERR T-Digest: quantile should be in [0,1]"), false)
+		}
+	}
+
+	res := make([]float64, len(quantiles))
+	ok := e.store.TDigestQuery(args[0], func(td *datastructure.TDigest) {
+		for i, q := range quantiles {
+			res[i] = td.Quantile(q)
+		}
+	})
+	if !ok {
+		return en.Encode(errTDigestNotFound, false)
+	}
+	return en.Encode(formatScores(res), false)
+}
+
+/*
+TDIGEST.CDF key value [value ...]
+*/
+func (e *Executor) CmdTDigestCDF(args []string) []byte {
+	en := protocol.Encoder{}
+	values, err := parseTDigestValues(args[1:], "value")
+	if err != nil {
+		return en.Encode(err, false)
+	}
+
+	res := make([]float64, len(values))
+	ok := e.store.TDigestQuery(args[0], func(td *datastructure.TDigest) {
+		for i, v := range values {
+			res[i] = td.CDF(v)
+		}
+	})
+	if !ok {
+		return en.Encode(errTDigestNotFound, false)
+	}
+	return en.Encode(formatScores(res), false)
+}
+
+/*
+TDIGEST.RANK key value [value ...]
+*/
+func (e *Executor) CmdTDigestRank(args []string) []byte {
+	en := protocol.Encoder{}
+	values, err := parseTDigestValues(args[1:], "value")
+	if err != nil {
+		return en.Encode(err, false)
+	}
+
+	res := make([]int, len(values))
+	ok := e.store.TDigestQuery(args[0], func(td *datastructure.TDigest) {
+		for i, v := range values {
+			res[i] = td.Rank(v)
+		}
+	})
+	if !ok {
+		return en.Encode(errTDigestNotFound, false)
+	}
+	return en.Encode(res, false)
+}
+
+func (e *Executor) CmdTDigestMin(args []string) []byte {
+	en := protocol.Encoder{}
+	var res float64
+	if !e.store.TDigestQuery(args[0], func(td *datastructure.TDigest) { res = td.Min() }) {
+		return en.Encode(errTDigestNotFound, false)
+	}
+	return en.Encode(formatScore(res), false)
+}
+
+func (e *Executor) CmdTDigestMax(args []string) []byte {
+	en := protocol.Encoder{}
+	var res float64
+	if !e.store.TDigestQuery(args[0], func(td *datastructure.TDigest) { res = td.Max() }) {
+		return en.Encode(errTDigestNotFound, false)
+	}
+	return en.Encode(formatScore(res), false)
+}
+
+/*
+TDIGEST.TRIMMED_MEAN key low_cut_quantile high_cut_quantile
+*/
+func (e *Executor) CmdTDigestTrimmedMean(args []string) []byte {
+	en := protocol.Encoder{}
+	cuts, err := parseTDigestValues(args[1:], "low_cut_percentile or high_cut_percentile")
+	if err != nil {
+		return en.Encode(err, false)
+	}
+	low, high := cuts[0], cuts[1]
+	if low < 0 || low > 1 || high < 0 || high > 1 {
+		return en.Encode(errors.New("ERR T-Digest: low_cut_percentile and high_cut_percentile should be in [0,1]"), false)
+	}
+	if low >= high {
+		return en.Encode(errors.New("ERR T-Digest: low_cut_percentile should be lower than high_cut_percentile"), false)
+	}
+
+	var res float64
+	if !e.store.TDigestQuery(args[0], func(td *datastructure.TDigest) { res = td.TrimmedMean(low, high) }) {
+		return en.Encode(errTDigestNotFound, false)
+	}
+	return en.Encode(formatScore(res), false)
+}
+
+/*
+TDIGEST.MERGE destination numkeys source [source ...] [COMPRESSION compression]
+[OVERRIDE]
+*/
+func (e *Executor) CmdTDigestMerge(args []string) []byte {
+	en := protocol.Encoder{}
+	srcs, opts, err := parseNumKeys(args[1:], CmdTDigestMerge)
+	if err != nil {
+		return en.Encode(err, false)
+	}
+
+	var compression float64
+	override := false
+	for i := 0; i < len(opts); i++ {
+		switch strings.ToUpper(opts[i]) {
+		case "COMPRESSION":
+			if i+1 >= len(opts) {
+				return en.Encode(errSyntax, false)
+			}
+			if compression, err = parseTDigestCompression(opts[i+1]); err != nil {
+				return en.Encode(err, false)
+			}
+			i++
+		case "OVERRIDE":
+			override = true
+		default:
+			return en.Encode(errSyntax, false)
+		}
+	}
+
+	if !e.store.TDigestMerge(args[0], srcs, compression, override) {
+		return en.Encode(errTDigestNotFound, false)
+	}
+	return en.Encode("OK", true)
+}
@@ -0,0 +1,356 @@
+package command
+
+import (
+	"errors"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"tcp-server.com/m/internal/config"
+	"tcp-server.com/m/internal/datastructure"
+	"tcp-server.com/m/internal/protocol"
+)
+
+var (
+	errTSTimestamp = errors.New("ERR TSDB: invalid timestamp")
+	errTSValue     = errors.New("ERR TSDB: invalid value")
+)
+
+/*
+Timestamp of TS.ADD, `*` being the current time
+*/
+func parseTSTimestamp(arg string) (int64, error) {
+	if arg == "*" {
+		return time.Now().UnixMilli(), nil
+	}
+	ts, err := strconv.ParseInt(arg, 10, 64)
+	if err != nil || ts < 0 {
+		return 0, errTSTimestamp
+	}
+	return ts, nil
+}
+
+/*
+Range bound of TS.RANGE, `-` and `+` being the earliest and latest samples
+*/
+func parseTSRangeBound(arg string) (int64, error) {
+	switch arg {
+	case "-":
+		return math.MinInt64, nil
+	case "+":
+		return math.MaxInt64, nil
+	}
+	ts, err := strconv.ParseInt(arg, 10, 64)
+	if err != nil {
+		return 0, errors.New("ERR TSDB: invalid fromTimestamp or toTimestamp")
+	}
+	return ts, nil
+}
+
+func parseTSValue(arg string) (float64, error) {
+	v, err := strconv.ParseFloat(arg, 64)
+	if err != nil || math.IsNaN(v) {
+		return 0, errTSValue
+	}
+	return v, nil
+}
+
+func parseTSDuplicatePolicy(arg string) (string, error) {
+	policy := strings.ToUpper(arg)
+	if !datastructure.IsTSDuplicatePolicy(policy) {
+		return "", errors.New("ERR TSDB: Unknown DUPLICATE_POLICY")
+	}
+	return policy, nil
+}
+
+/*
+Parse `agg bucketDuration` following an AGGREGATION keyword
+*/
+func parseTSAggregation(args []string) (string, int64, error) {
+	if len(args) < 2 {
+		return "", 0, errSyntax
+	}
+	agg := strings.ToUpper(args[0])
+	if !datastructure.IsTSAggregation(agg) {
+		return "", 0, errors.New("ERR TSDB: Unknown aggregation type")
+	}
+	bucket, err := strconv.ParseInt(args[1], 10, 64)
+	if err != nil || bucket <= 0 {
+		return "", 0, errors.New("ERR TSDB: bucketDuration must be greater than zero")
+	}
+	return agg, bucket, nil
+}
+
+/*
+Parse the `[RETENTION retentionPeriod] [DUPLICATE_POLICY policy]
+[ON_DUPLICATE policy] [LABELS label value ...]` options of TS.CREATE and
+TS.ADD. ON_DUPLICATE is only accepted when `onDuplicate` is not nil
+*/
+func parseTSCreateOpts(args []string, onDuplicate *string) (datastructure.TSCreateOpts, error) {
+	opts := datastructure.TSCreateOpts{DuplicatePolicy: config.TSDefaultDuplicatePolicy}
+	var err error
+	for i := 0; i < len(args); i++ {
+		opt := strings.ToUpper(args[i])
+		if opt == "LABELS" {
+			rest := args[i+1:]
+			if len(rest) == 0 || len(rest)%2 != 0 {
+				return opts, errSyntax
+			}
+			for j := 0; j < len(rest); j += 2 {
+				opts.Labels = append(opts.Labels, datastructure.TSLabel{Name: rest[j], Value: rest[j+1]})
+			}
+			break
+		}
+		if i+1 >= len(args) {
+			return opts, errSyntax
+		}
+		switch {
+		case opt == "RETENTION":
+			opts.Retention, err = strconv.ParseInt(args[i+1], 10, 64)
+			if err != nil || opts.Retention < 0 {
+				return opts, errors.New("ERR TSDB: invalid RETENTION value")
+			}
+		case opt == "DUPLICATE_POLICY":
+			if opts.DuplicatePolicy, err = parseTSDuplicatePolicy(args[i+1]); err != nil {
+				return opts, err
+			}
+		case opt == "ON_DUPLICATE" && onDuplicate != nil:
+			if *onDuplicate, err = parseTSDuplicatePolicy(args[i+1]); err != nil {
+				return opts, err
+			}
+		default:
+			return opts, errSyntax
+		}
+		i++
+	}
+	return opts, nil
+}
+
+func encodeTSSamples(samples []datastructure.Sample) []any {
+	res := make([]any, len(samples))
+	for i, s := range samples {
+		res[i] = []any{s.Timestamp, formatScore(s.Value)}
+	}
+	return res
+}
+
+/*
+TS.CREATE key [RETENTION retentionPeriod] [DUPLICATE_POLICY policy]
+[LABELS label value ...]
+*/
+func (e *Executor) CmdTSCreate(args []string) []byte {
+	en := protocol.Encoder{}
+	opts, err := parseTSCreateOpts(args[1:], nil)
+	if err != nil {
+		return en.Encode(err, false)
+	}
+	if err := e.store.TSCreate(args[0], opts); err != nil {
+		return en.Encode(err, false)
+	}
+	return en.Encode("OK", true)
+}
+
+/*
+TS.ADD key timestamp value [RETENTION retentionPeriod]
+[DUPLICATE_POLICY policy] [ON_DUPLICATE policy] [LABELS label value ...]
+*/
+func (e *Executor) CmdTSAdd(args []string) []byte {
+	en := protocol.Encoder{}
+	ts, err := parseTSTimestamp(args[1])
+	if err != nil {
+		return en.Encode(err, false)
+	}
+	value, err := parseTSValue(args[2])
+	if err != nil {
+		return en.Encode(err, false)
+	}
+	var onDuplicate string
+	opts, err := parseTSCreateOpts(args[3:], &onDuplicate)
+	if err != nil {
+		return en.Encode(err, false)
+	}
+
+	if err := e.store.TSAdd(args[0], ts, value, onDuplicate, &opts); err != nil {
+		return en.Encode(err, false)
+	}
+	return en.Encode(ts, false)
+}
+
+/*
+TS.MADD key timestamp value [key timestamp value ...], every series must
+already exist
+*/
+func (e *Executor) CmdTSMAdd(args []string) []byte {
+	en := protocol.Encoder{}
+	if len(args)%3 != 0 {
+		return en.Encode(errors.New("ERR wrong number of arguments for 'TS.MADD' command"), false)
+	}
+	res := make([]any, 0, len(args)/3)
+	for i := 0; i < len(args); i += 3 {
+		ts, err := parseTSTimestamp(args[i+1])
+		if err != nil {
+			res = append(res, err)
+			continue
+		}
+		value, err := parseTSValue(args[i+2])
+		if err != nil {
+			res = append(res, err)
+			continue
+		}
+		if err := e.store.TSAdd(args[i], ts, value, "", nil); err != nil {
+			res = append(res, err)
+			continue
+		}
+		res = append(res, ts)
+	}
+	return en.Encode(res, false)
+}
+
+type tsRangeArgs struct {
+	from, to int64
+	count    int
+	agg      string
+	bucket   int64
+	filters  []datastructure.TSFilter
+	labels   bool
+}
+
+/*
+Parse `fromTimestamp toTimestamp [COUNT count] [AGGREGATION agg
+bucketDuration]`, plus `[WITHLABELS] FILTER filter ...` when `multi` is set
+*/
+func parseTSRangeArgs(args []string, multi bool) (*tsRangeArgs, error) {
+	if len(args) < 2 {
+		return nil, errSyntax
+	}
+	res := &tsRangeArgs{count: -1}
+	var err error
+	if res.from, err = parseTSRangeBound(args[0]); err != nil {
+		return nil, err
+	}
+	if res.to, err = parseTSRangeBound(args[1]); err != nil {
+		return nil, err
+	}
+
+	for i := 2; i < len(args); i++ {
+		switch opt := strings.ToUpper(args[i]); {
+		case opt == "COUNT":
+			if i+1 >= len(args) {
+				return nil, errSyntax
+			}
+			if res.count, err = strconv.Atoi(args[i+1]); err != nil || res.count < 0 {
+				return nil, errors.New("ERR TSDB: Invalid COUNT value")
+			}
+			i++
+		case opt == "AGGREGATION":
+			if res.agg, res.bucket, err = parseTSAggregation(args[i+1:]); err != nil {
+				return nil, err
+			}
+			i += 2
+		case opt == "WITHLABELS" && multi:
+			res.labels = true
+		case opt == "FILTER" && multi:
+			for _, expr := range args[i+1:] {
+				f, ok := datastructure.ParseTSFilter(expr)
+				if !ok {
+					return nil, errors.New("ERR TSDB: failed parsing labels")
+				}
+				res.filters = append(res.filters, f)
+			}
+			i = len(args)
+		default:
+			return nil, errSyntax
+		}
+	}
+	if multi && len(res.filters) == 0 {
+		return nil, errors.New("ERR TSDB: missing FILTER argument")
+	}
+	return res, nil
+}
+
+/*
+Aggregate, order and cut `samples` as requested by the range arguments
+*/
+func (r *tsRangeArgs) apply(samples []datastructure.Sample, rev bool) []datastructure.Sample {
+	if r.agg != "" {
+		samples = datastructure.TSAggregate(samples, r.agg, r.bucket)
+	}
+	if rev {
+		for i, j := 0, len(samples)-1; i < j; i, j = i+1, j-1 {
+			samples[i], samples[j] = samples[j], samples[i]
+		}
+	}
+	if r.count >= 0 && r.count < len(samples) {
+		samples = samples[:r.count]
+	}
+	return samples
+}
+
+func (e *Executor) tsRange(args []string, rev bool, name string) []byte {
+	en := protocol.Encoder{}
+	r, err := parseTSRangeArgs(args[1:], false)
+	if err != nil {
+		return en.Encode(err, false)
+	}
+	samples, err := e.store.TSRange(args[0], r.from, r.to)
+	if err != nil {
+		return en.Encode(err, false)
+	}
+	return en.Encode(encodeTSSamples(r.apply(samples, rev)), false)
+}
+
+/*
+TS.RANGE key fromTimestamp toTimestamp [COUNT count]
+[AGGREGATION agg bucketDuration]
+*/
+func (e *Executor) CmdTSRange(args []string) []byte {
+	return e.tsRange(args, false, CmdTSRange)
+}
+
+func (e *Executor) CmdTSRevRange(args []string) []byte {
+	return e.tsRange(args, true, CmdTSRevRange)
+}
+
+/*
+TS.MRANGE fromTimestamp toTimestamp [COUNT count]
+[AGGREGATION agg bucketDuration] [WITHLABELS] FILTER filter ...
+*/
+func (e *Executor) CmdTSMRange(args []string) []byte {
+	en := protocol.Encoder{}
+	r, err := parseTSRangeArgs(args, true)
+	if err != nil {
+		return en.Encode(err, false)
+	}
+
+	series := e.store.TSMRange(r.from, r.to, r.filters)
+	res := make([]any, len(series))
+	for i, s := range series {
+		labels := make([]any, 0)
+		if r.labels {
+			for _, l := range s.Labels {
+				labels = append(labels, []any{l.Name, l.Value})
+			}
+		}
+		res[i] = []any{s.Key, labels, encodeTSSamples(r.apply(s.Samples, false))}
+	}
+	return en.Encode(res, false)
+}
+
+/*
+TS.CREATERULE sourceKey destKey AGGREGATION agg bucketDuration
+*/
+func (e *Executor) CmdTSCreateRule(args []string) []byte {
+	en := protocol.Encoder{}
+	if strings.ToUpper(args[2]) != "AGGREGATION" {
+		return en.Encode(errSyntax, false)
+	}
+	agg, bucket, err := parseTSAggregation(args[3:])
+	if err != nil {
+		return en.Encode(err, false)
+	}
+	if err := e.store.TSCreateRule(args[0], args[1], agg, bucket); err != nil {
+		return en.Encode(err, false)
+	}
+	return en.Encode("OK", true)
+}
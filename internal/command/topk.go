@@ -0,0 +1,166 @@
+package command
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+
+	"tcp-server.com/m/internal/config"
+	"tcp-server.com/m/internal/protocol"
+)
+
+var errTopKNotFound = errors.New("ERR TOPK: key does not exist")
+
+// The heap of the k items and the counters are allocated upfront by
+// TOPK.RESERVE, these bound what a client can make it allocate
+const (
+	topkMaxK       = 1 << 20
+	topkMaxBuckets = 1 << 26
+)
+
+func parseTopKDim(arg string, name string) (uint32, error) {
+	v, err := strconv.ParseUint(arg, 10, 32)
+	if err != nil || v == 0 {
+		return 0, errors.New("ERR TOPK: invalid " + name)
+	}
+	return uint32(v), nil
+}
+
+/*
+TOPK.RESERVE key topk [width depth decay]
+*/
+func (e *Executor) CmdTopKReserve(args []string) []byte {
+	en := protocol.Encoder{}
+	if len(args) != 2 && len(args) != 5 {
+		return en.Encode(errors.New("ERR wrong number of arguments for 'TOPK.RESERVE' command"), false)
+	}
+	k, err := parseTopKDim(args[1], "k")
+	if err != nil {
+		return en.Encode(err, false)
+	}
+	if k > topkMaxK {
+		return en.Encode(errors.New("ERR TOPK: k is too large"), false)
+	}
+
+	width, depth, decay := config.TopKDefaultWidth, config.TopKDefaultDepth, config.TopKDefaultDecay
+	if len(args) == 5 {
+		if width, err = parseTopKDim(args[2], "width"); err != nil {
+			return en.Encode(err, false)
+		}
+		if depth, err = parseTopKDim(args[3], "depth"); err != nil {
+			return en.Encode(err, false)
+		}
+		decay, err = strconv.ParseFloat(args[4], 64)
+		if err != nil || decay <= 0 || decay > 1 {
+			return en.Encode(errors.New("ERR TOPK: invalid decay value. must be '<= 1' & '> 0'"), false)
+		}
+	}
+	if uint64(width)*uint64(depth) > topkMaxBuckets {
+		return en.Encode(errors.New("ERR TOPK: width * depth is too large"), false)
+	}
+
+	if e.store.NewTopK(args[0], k, width, depth, decay) == -1 {
+		return en.Encode(errors.New("ERR TOPK: key already exists"), false)
+	}
+	return en.Encode("OK", true)
+}
+
+/*
+TOPK.ADD key item [item ...]
+*/
+func (e *Executor) CmdTopKAdd(args []string) []byte {
+	en := protocol.Encoder{}
+	values := make([]uint32, len(args)-1)
+	for i := range values {
+		values[i] = 1
+	}
+	res, ok := e.store.TopKIncrBy(args[0], args[1:], values)
+	if !ok {
+		return en.Encode(errTopKNotFound, false)
+	}
+	return en.Encode(res, false)
+}
+
+/*
+TOPK.INCRBY key item increment [item increment ...]
+*/
+func (e *Executor) CmdTopKIncrBy(args []string) []byte {
+	en := protocol.Encoder{}
+	if len(args)%2 != 1 {
+		return en.Encode(errors.New("ERR wrong number of arguments for 'TOPK.INCRBY' command"), false)
+	}
+	items := make([]string, 0, len(args)/2)
+	values := make([]uint32, 0, len(args)/2)
+	for i := 1; i < len(args); i += 2 {
+		value, err := strconv.ParseUint(args[i+1], 10, 32)
+		if err != nil || value == 0 || value > 100000 {
+			return en.Encode(errors.New("ERR TOPK: increment must be an integer greater or equal to 1 and less than or equal to 100000"), false)
+		}
+		items = append(items, args[i])
+		values = append(values, uint32(value))
+	}
+	res, ok := e.store.TopKIncrBy(args[0], items, values)
+	if !ok {
+		return en.Encode(errTopKNotFound, false)
+	}
+	return en.Encode(res, false)
+}
+
+func (e *Executor) CmdTopKQuery(args []string) []byte {
+	en := protocol.Encoder{}
+	res, ok := e.store.TopKQuery(args[0], args[1:])
+	if !ok {
+		return en.Encode(errTopKNotFound, false)
+	}
+	return en.Encode(res, false)
+}
+
+func (e *Executor) CmdTopKCount(args []string) []byte {
+	en := protocol.Encoder{}
+	res, ok := e.store.TopKCount(args[0], args[1:])
+	if !ok {
+		return en.Encode(errTopKNotFound, false)
+	}
+	return en.Encode(res, false)
+}
+
+/*
+TOPK.LIST key [WITHCOUNT]
+*/
+func (e *Executor) CmdTopKList(args []string) []byte {
+	en := protocol.Encoder{}
+	if len(args) != 1 && len(args) != 2 {
+		return en.Encode(errors.New("ERR wrong number of arguments for 'TOPK.LIST' command"), false)
+	}
+	withCount := len(args) == 2
+	if withCount && strings.ToUpper(args[1]) != "WITHCOUNT" {
+		return en.Encode(errSyntax, false)
+	}
+
+	items, ok := e.store.TopKList(args[0])
+	if !ok {
+		return en.Encode(errTopKNotFound, false)
+	}
+	res := make([]any, 0, len(items)*2)
+	for _, item := range items {
+		res = append(res, item.Item)
+		if withCount {
+			res = append(res, int(item.Count))
+		}
+	}
+	return en.Encode(res, false)
+}
+
+func (e *Executor) CmdTopKInfo(args []string) []byte {
+	en := protocol.Encoder{}
+	info, ok := e.store.TopKInfo(args[0])
+	if !ok {
+		return en.Encode(errTopKNotFound, false)
+	}
+	return en.Encode([]any{
+		"k", int(info.K),
+		"width", int(info.Width),
+		"depth", int(info.Depth),
+		"decay", info.Decay,
+	}, false)
+}
@@ -1,8 +1,85 @@
 package config
 
+import "sync/atomic"
+
 var Protocol = "tcp"
 var Port = ":3000"
 
+// Number of logical databases, selected with SELECT
+var Databases = 16
+
 var MaxKeyNum int = 1000000
 var EvictionRatio = 0.1
-var EvictionPolicy string = "allkeys-lru"
+
+// Set by CONFIG SET while other clients run commands, a string held in an
+// atomic.Value
+var EvictionPolicy atomic.Value
+
+// Access counters of the LFU policies grow logarithmically, slower with a
+// larger LFULogFactor, and lose one every LFUDecayTime minutes
+var LFULogFactor = 10
+var LFUDecayTime = 1
+
+// Sorted sets stay listpack encoded up to these many members and member
+// bytes. Atomic as CONFIG SET changes them
+var ZsetMaxListpackEntries atomic.Int64
+var ZsetMaxListpackValue atomic.Int64
+
+var BFDefaultErrorRate = 0.01
+var BFDefaultCapacity uint64 = 100
+var BFDefaultExpansion uint64 = 2
+
+var CFDefaultCapacity uint64 = 1024
+var CFDefaultBucketSize uint64 = 2
+var CFDefaultMaxIterations = 20
+var CFDefaultExpansion uint64 = 1
+
+// Sparse HyperLogLogs larger than this (header included) become dense
+var HLLSparseMaxBytes = 3000
+
+var TDigestDefaultCompression = 100.0
+
+// Size in bytes after which a time series starts a new compressed chunk
+var TSChunkSizeBytes = 4096
+var TSDefaultDuplicatePolicy = "BLOCK"
+
+// Limits of a single packed stream node
+var StreamNodeMaxEntries = 100
+var StreamNodeMaxBytes = 4096
+
+var TopKDefaultWidth uint32 = 8
+var TopKDefaultDepth uint32 = 7
+var TopKDefaultDecay = 0.9
+
+// Output buffered for a Pub/Sub subscriber before it gets disconnected
+var PubSubOutputBufferLimit = 32 * 1024 * 1024
+
+// Upper bound of a single BF.SCANDUMP/CMS.SCANDUMP chunk in bytes
+var DumpChunkSize = 1024 * 1024
+
+// Classes of keyspace events published over Pub/Sub, empty disables them.
+// A string in an atomic.Value, CONFIG SET changes it
+var NotifyKeyspaceEvents atomic.Value
+
+// Active expiry runs ActiveExpireHz times per second, sampling
+// ActiveExpireSamples keys with a TTL per round
+var ActiveExpireHz = 10
+var ActiveExpireSamples = 20
+var ActiveExpireMaxRounds = 16
+
+// Finish the incremental rehash of the databases from the active expiry
+// runs rather than only on writes
+var ActiveRehashing = true
+
+// Scripts running longer than this get other clients a BUSY error and can
+// be stopped with SCRIPT KILL. Read by clients waiting on a running script
+// while CONFIG SET may change it
+var ScriptTimeLimitMs atomic.Int64
+
+func init() {
+	EvictionPolicy.Store("allkeys-lru")
+	NotifyKeyspaceEvents.Store("")
+	ScriptTimeLimitMs.Store(5000)
+	ZsetMaxListpackEntries.Store(128)
+	ZsetMaxListpackValue.Store(64)
+}
@@ -1,7 +1,9 @@
 package datastructure
 
 import (
+	"errors"
 	"math"
+	"slices"
 
 	"github.com/spaolacci/murmur3"
 )
@@ -18,12 +20,21 @@ type Bloom struct {
 	bf            []byte
 	bits          uint64
 	bytes         uint64
+	items         uint64
 }
 
 type HashVal struct {
 	a, b uint64
 }
 
+type BloomInfo struct {
+	Capacity  uint64
+	Size      uint64
+	Filters   int
+	Items     uint64
+	Expansion uint64
+}
+
 func calBitsPerEntries(errorRate float64) float64 {
 	num := math.Log(errorRate)
 	return math.Abs(-(num / LogSquare))
@@ -35,18 +46,24 @@ func NewBloom(errorRate float64, entries uint64) *Bloom {
 		errorRate: errorRate,
 	}
 	bloom.bitPerEntries = calBitsPerEntries(errorRate)
-	bits := entries * uint64(bloom.bitPerEntries)
-	if bits%64 != 0 {
-		bloom.bytes = ((bits / 64) + 1) * 8
-	} else {
-		bloom.bytes = bits / 8
-	}
+	bloom.bytes, bloom.hashes = bloomLayout(entries, bloom.bitPerEntries)
 	bloom.bits = bloom.bytes * 8
-	bloom.hashes = int(math.Ceil(math.Log(2) * bloom.bitPerEntries))
 	bloom.bf = make([]byte, bloom.bytes)
 	return &bloom
 }
 
+/*
+Size in bytes, rounded up to 64 bit words, and number of hashes of a layer
+*/
+func bloomLayout(entries uint64, bitPerEntries float64) (uint64, int) {
+	bits := uint64(math.Ceil(float64(entries) * bitPerEntries))
+	bytes := bits / 8
+	if bits%64 != 0 {
+		bytes = ((bits / 64) + 1) * 8
+	}
+	return bytes, int(math.Ceil(math.Log(2) * bitPerEntries))
+}
+
 func calHash(entry string) HashVal {
 	hasher := murmur3.New128WithSeed(SEED)
 	hasher.Write([]byte(entry))
@@ -57,21 +74,131 @@ func calHash(entry string) HashVal {
 	}
 }
 
-func (b *Bloom) Add(entry string) {
+/*
+Bit position of the i-th hash of an entry (Kirsch-Mitzenmacher double
+hashing), spread over every bit of the filter
+*/
+func (b *Bloom) bitPos(h HashVal, i int) (uint64, byte) {
+	hash := (h.a + h.b*uint64(i)) % b.bits
+	return hash / 8, 1 << (hash % 8)
+}
+
+/*
+Add `entry`, returns false when all its bits were already set (the entry
+was probably added before)
+*/
+func (b *Bloom) Add(entry string) bool {
 	initHash := calHash(entry)
+	added := false
 	for i := range b.hashes {
-		hash := (initHash.a + initHash.b*uint64(i)) % 8
-		b.bf[hash/8] |= 1 << (hash / 8)
+		idx, mask := b.bitPos(initHash, i)
+		if b.bf[idx]&mask == 0 {
+			b.bf[idx] |= mask
+			added = true
+		}
+	}
+	if added {
+		b.items++
 	}
+	return added
 }
 
 func (b *Bloom) Exist(entry string) bool {
 	initHash := calHash(entry)
 	for i := range b.hashes {
-		hash := (initHash.a + initHash.b*uint64(i)) % 8
-		if b.bf[hash/8]&1<<(hash/8) == 0 {
+		idx, mask := b.bitPos(initHash, i)
+		if b.bf[idx]&mask == 0 {
 			return false
 		}
 	}
 	return true
 }
+
+func (b *Bloom) Info() BloomInfo {
+	return BloomInfo{
+		Capacity: b.entries,
+		Size:     b.bytes,
+		Filters:  1,
+		Items:    b.items,
+	}
+}
+
+/*
+Every new layer of a scalable filter gets this fraction of the previous
+layer's error rate so the compound false positive rate stays under
+errorRate / (1 - BloomTighteningRatio)
+*/
+const BloomTighteningRatio = 0.5
+
+var ErrBloomFull = errors.New("ERR non scaling filter is full")
+
+/*
+Scalable bloom filter: a stack of filters where a new, `expansion` times
+larger layer is allocated whenever the newest one reaches its capacity.
+Items are only ever added to the newest layer but looked up in all of them.
+A NONSCALING filter has `expansion` 0 and never grows.
+*/
+type ScalableBloom struct {
+	filters   []*Bloom
+	expansion uint64
+	access
+}
+
+func NewScalableBloom(errorRate float64, entries uint64, expansion uint64) *ScalableBloom {
+	return &ScalableBloom{
+		filters:   []*Bloom{NewBloom(errorRate, entries)},
+		expansion: expansion,
+	}
+}
+
+func (sb *ScalableBloom) Exist(entry string) bool {
+	for i := len(sb.filters) - 1; i >= 0; i-- {
+		if sb.filters[i].Exist(entry) {
+			return true
+		}
+	}
+	return false
+}
+
+/*
+Add `entry` growing the filter when needed. Returns false when `entry` is
+(probably) already present
+*/
+func (sb *ScalableBloom) Add(entry string) (bool, error) {
+	if sb.Exist(entry) {
+		return false, nil
+	}
+	last := sb.filters[len(sb.filters)-1]
+	if last.items >= last.entries {
+		if sb.expansion == 0 {
+			return false, ErrBloomFull
+		}
+		last = NewBloom(last.errorRate*BloomTighteningRatio, last.entries*sb.expansion)
+		sb.filters = append(sb.filters, last)
+	}
+	return last.Add(entry), nil
+}
+
+func (sb *ScalableBloom) Expansion() uint64 {
+	return sb.expansion
+}
+
+func (sb *ScalableBloom) Info() BloomInfo {
+	info := BloomInfo{Filters: len(sb.filters), Expansion: sb.expansion}
+	for _, b := range sb.filters {
+		info.Capacity += b.entries
+		info.Size += b.bytes
+		info.Items += b.items
+	}
+	return info
+}
+
+func (sb *ScalableBloom) clone() *ScalableBloom {
+	res := &ScalableBloom{filters: make([]*Bloom, len(sb.filters)), expansion: sb.expansion}
+	for i, b := range sb.filters {
+		filter := *b
+		filter.bf = slices.Clone(b.bf)
+		res.filters[i] = &filter
+	}
+	return res
+}
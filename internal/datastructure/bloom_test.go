@@ -88,3 +88,118 @@ func BenchmarkExist(b *testing.B) {
 		bloom.Exist(fmt.Sprintf("item_%d", i%10000))
 	}
 }
+
+func TestBloomFalsePositiveRate(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping false positive rate test in short mode")
+	}
+
+	for _, errorRate := range []float64{0.05, 0.01, 0.001} {
+		entries := uint64(20000)
+		bloom := NewBloom(errorRate, entries)
+		for i := range int(entries) {
+			bloom.Add(fmt.Sprintf("member:%d", i))
+		}
+
+		trials, falsePositives := 200000, 0
+		for i := range trials {
+			if bloom.Exist(fmt.Sprintf("stranger:%d", i)) {
+				falsePositives++
+			}
+		}
+
+		rate := float64(falsePositives) / float64(trials)
+		t.Logf("errorRate %v: measured false positive rate %v", errorRate, rate)
+		if rate > errorRate*1.5 {
+			t.Errorf("errorRate %v: measured false positive rate %v is too high", errorRate, rate)
+		}
+	}
+}
+
+func TestBloomBitDistribution(t *testing.T) {
+	entries := uint64(10000)
+	bloom := NewBloom(0.01, entries)
+	for i := range int(entries) {
+		bloom.Add(fmt.Sprintf("member:%d", i))
+	}
+
+	// At full capacity an optimally sized filter has about half of its bits set,
+	// evenly across the whole array
+	quarter := len(bloom.bf) / 4
+	for q := range 4 {
+		set := 0
+		for _, b := range bloom.bf[q*quarter : (q+1)*quarter] {
+			for ; b != 0; b &= b - 1 {
+				set++
+			}
+		}
+		ratio := float64(set) / float64(quarter*8)
+		if ratio < 0.4 || ratio > 0.6 {
+			t.Errorf("quarter %d of the filter has %.2f of its bits set, want about 0.5", q, ratio)
+		}
+	}
+}
+
+func TestBloomAddReportsNewItems(t *testing.T) {
+	bloom := NewBloom(0.001, 1000)
+	if !bloom.Add("apple") {
+		t.Errorf("first Add of apple should report a new item")
+	}
+	if bloom.Add("apple") {
+		t.Errorf("second Add of apple should not report a new item")
+	}
+	if info := bloom.Info(); info.Items != 1 || info.Capacity != 1000 {
+		t.Errorf("unexpected info %+v", info)
+	}
+}
+
+func TestScalableBloomGrows(t *testing.T) {
+	errorRate := 0.01
+	sb := NewScalableBloom(errorRate, 1000, 2)
+	n := 20000
+	for i := range n {
+		if _, err := sb.Add(fmt.Sprintf("member:%d", i)); err != nil {
+			t.Fatalf("Add failed on a scaling filter: %v", err)
+		}
+	}
+
+	info := sb.Info()
+	if info.Filters < 4 || info.Capacity < uint64(n) {
+		t.Errorf("filter did not grow enough: %+v", info)
+	}
+	for i := range n {
+		if !sb.Exist(fmt.Sprintf("member:%d", i)) {
+			t.Fatalf("Lost member:%d after growing", i)
+		}
+	}
+
+	trials, falsePositives := 100000, 0
+	for i := range trials {
+		if sb.Exist(fmt.Sprintf("stranger:%d", i)) {
+			falsePositives++
+		}
+	}
+	// Tightening keeps the compound rate under errorRate / (1 - ratio)
+	rate := float64(falsePositives) / float64(trials)
+	if bound := errorRate / (1 - BloomTighteningRatio); rate > bound {
+		t.Errorf("measured false positive rate %v exceeds bound %v", rate, bound)
+	}
+}
+
+func TestScalableBloomNonScaling(t *testing.T) {
+	sb := NewScalableBloom(0.01, 10, 0)
+	for i := range 10 {
+		if _, err := sb.Add(fmt.Sprintf("member:%d", i)); err != nil {
+			t.Fatalf("Add failed before reaching capacity: %v", err)
+		}
+	}
+	if _, err := sb.Add("one-too-many"); err != ErrBloomFull {
+		t.Errorf("expected ErrBloomFull on a full non scaling filter, got %v", err)
+	}
+	if added, err := sb.Add("member:3"); added || err != nil {
+		t.Errorf("re-adding an existing member should be a no-op, got %v, %v", added, err)
+	}
+	if info := sb.Info(); info.Filters != 1 || info.Expansion != 0 {
+		t.Errorf("non scaling filter should keep a single layer: %+v", info)
+	}
+}
@@ -1,16 +1,31 @@
 package datastructure
 
 import (
+	"errors"
 	"math"
+	"math/bits"
+	"slices"
 
 	"github.com/spaolacci/murmur3"
 )
 
 const Log10PointFive = -0.30102999566
 
+var (
+	ErrCMSNotFound    = errors.New("ERR CMS: key does not exist")
+	ErrCMSDimMismatch = errors.New("ERR CMS: width/depth is not equal")
+)
+
 type CMS struct {
 	w, d    uint32
+	count   uint64
 	counter [][]uint32
+	access
+}
+
+type CMSInfo struct {
+	Width, Depth uint32
+	Count        uint64
 }
 
 /*
@@ -32,6 +47,10 @@ func (c *CMS) hashfunc(item string, seed uint32) uint32 {
 
 func NewCMS(errRate float64, errProb float64) *CMS {
 	w, d := CalcCMSDim(errRate, errProb)
+	return NewCMSByDim(w, d)
+}
+
+func NewCMSByDim(w uint32, d uint32) *CMS {
 	counter := make([][]uint32, d)
 	for i := uint32(0); i < d; i++ {
 		counter[i] = make([]uint32, w)
@@ -45,6 +64,7 @@ func NewCMS(errRate float64, errProb float64) *CMS {
 
 func (c *CMS) IncrBy(item string, value uint32) uint32 {
 	var minCount uint32 = math.MaxUint32
+	c.count += uint64(value)
 
 	for i := uint32(0); i < c.d; i++ {
 		hash := c.hashfunc(item, i)
@@ -77,3 +97,75 @@ func (c *CMS) Query(item string) uint32 {
 	}
 	return minCount
 }
+
+/*
+Overwrite the sketch with the weighted sum of `srcs`, which must all share its
+width and depth. Counters saturate at 0 and math.MaxUint32
+*/
+func (c *CMS) Merge(srcs []*CMS, weights []int64) error {
+	for _, src := range srcs {
+		if src.w != c.w || src.d != c.d {
+			return ErrCMSDimMismatch
+		}
+	}
+
+	// Sum into a scratch row first, `c` itself may be one of the sources
+	row := make([]int64, c.w)
+	for i := uint32(0); i < c.d; i++ {
+		clear(row)
+		for k, src := range srcs {
+			for j, v := range src.counter[i] {
+				row[j] = mulAddSaturated(row[j], uint64(v), weights[k])
+			}
+		}
+		for j, v := range row {
+			c.counter[i][j] = uint32(max(0, min(v, math.MaxUint32)))
+		}
+	}
+
+	var count int64
+	for k, src := range srcs {
+		count = mulAddSaturated(count, src.count, weights[k])
+	}
+	c.count = uint64(max(0, count))
+	return nil
+}
+
+/*
+`acc` + `v` * `w`, saturated at the int64 bounds instead of wrapping, for
+weights as large as a client sends
+*/
+func mulAddSaturated(acc int64, v uint64, w int64) int64 {
+	// Two's complement negation also gives the magnitude of math.MinInt64
+	mag := uint64(w)
+	if w < 0 {
+		mag = -mag
+	}
+	hi, p := bits.Mul64(v, mag)
+	if hi != 0 || p > math.MaxInt64 {
+		p = math.MaxInt64
+	}
+	if w < 0 {
+		if acc < math.MinInt64+int64(p) {
+			return math.MinInt64
+		}
+		return acc - int64(p)
+	}
+	if acc > math.MaxInt64-int64(p) {
+		return math.MaxInt64
+	}
+	return acc + int64(p)
+}
+
+func (c *CMS) Info() CMSInfo {
+	return CMSInfo{Width: c.w, Depth: c.d, Count: c.count}
+}
+
+func (c *CMS) clone() *CMS {
+	res := *c
+	res.counter = make([][]uint32, len(c.counter))
+	for i, row := range c.counter {
+		res.counter[i] = slices.Clone(row)
+	}
+	return &res
+}
@@ -0,0 +1,70 @@
+package datastructure
+
+import (
+	"fmt"
+	"math"
+	"testing"
+)
+
+func TestCMSIncrByCount(t *testing.T) {
+	cms := NewCMSByDim(1000, 5)
+	cms.IncrBy("a", 3)
+	cms.IncrBy("b", 4)
+	cms.IncrBy("a", 2)
+
+	if got := cms.Query("a"); got != 5 {
+		t.Errorf("Query(a) = %d, want 5", got)
+	}
+	if info := cms.Info(); info.Width != 1000 || info.Depth != 5 || info.Count != 9 {
+		t.Errorf("Info() = %+v, want width 1000 depth 5 count 9", info)
+	}
+}
+
+func TestCMSMerge(t *testing.T) {
+	a, b := NewCMSByDim(500, 4), NewCMSByDim(500, 4)
+	for i := 0; i < 50; i++ {
+		a.IncrBy(fmt.Sprintf("item:%d", i), 1)
+		b.IncrBy(fmt.Sprintf("item:%d", i), 2)
+	}
+
+	// `a` is both the destination and a source
+	if err := a.Merge([]*CMS{a, b}, []int64{3, 1}); err != nil {
+		t.Fatalf("Merge failed: %v", err)
+	}
+	for i := 0; i < 50; i++ {
+		if got := a.Query(fmt.Sprintf("item:%d", i)); got < 5 {
+			t.Errorf("Query(item:%d) = %d, want at least 5", i, got)
+		}
+	}
+	if got := a.Info().Count; got != 250 {
+		t.Errorf("merged count = %d, want 250", got)
+	}
+
+	if err := a.Merge([]*CMS{b}, []int64{-1}); err != nil {
+		t.Fatalf("Merge failed: %v", err)
+	}
+	if got := a.Query("item:0"); got != 0 {
+		t.Errorf("negative weight should saturate at 0, got %d", got)
+	}
+
+	// Huge weights saturate the counters instead of wrapping around
+	if err := a.Merge([]*CMS{b, b}, []int64{math.MaxInt64, math.MaxInt64}); err != nil {
+		t.Fatalf("Merge failed: %v", err)
+	}
+	if got := a.Query("item:0"); got != math.MaxUint32 {
+		t.Errorf("Query after a huge weight = %d, want MaxUint32", got)
+	}
+	if got := a.Info().Count; got != math.MaxInt64 {
+		t.Errorf("count after a huge weight = %d, want MaxInt64", got)
+	}
+	if err := a.Merge([]*CMS{b}, []int64{math.MinInt64}); err != nil {
+		t.Fatalf("Merge failed: %v", err)
+	}
+	if got := a.Query("item:0"); got != 0 {
+		t.Errorf("Query after a huge negative weight = %d, want 0", got)
+	}
+
+	if err := a.Merge([]*CMS{NewCMSByDim(100, 4)}, []int64{1}); err != ErrCMSDimMismatch {
+		t.Errorf("expected ErrCMSDimMismatch, got %v", err)
+	}
+}
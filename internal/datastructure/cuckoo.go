@@ -0,0 +1,272 @@
+package datastructure
+
+import (
+	"errors"
+	"math/bits"
+	"math/rand"
+	"slices"
+)
+
+var ErrCuckooFull = errors.New("ERR Filter is full")
+
+/*
+One cuckoo hash table: `numBuckets` (a power of two) buckets of `bucketSize`
+one byte fingerprints, 0 marking an empty slot
+*/
+type cuckooLayer struct {
+	numBuckets uint64
+	buckets    []byte
+}
+
+/*
+Cuckoo filter: like a bloom filter but storing fingerprints, so items can be
+deleted and counted. Every item has two candidate buckets, the second one
+derived from the first and the fingerprint alone so entries can be moved
+around (kicked) without knowing the original item. When `maxIterations`
+kicks cannot make room, a layer `expansion` times larger is added; an
+`expansion` of 0 makes the filter fixed size.
+*/
+type Cuckoo struct {
+	layers        []*cuckooLayer
+	bucketSize    uint64
+	maxIterations int
+	expansion     uint64
+	items         uint64
+	deleted       uint64
+	access
+}
+
+type CuckooInfo struct {
+	Size          uint64
+	Buckets       uint64
+	Filters       int
+	Items         uint64
+	Deleted       uint64
+	BucketSize    uint64
+	Expansion     uint64
+	MaxIterations int
+}
+
+func nextPow2(n uint64) uint64 {
+	if n <= 1 {
+		return 1
+	}
+	return 1 << bits.Len64(n-1)
+}
+
+func newCuckooLayer(numBuckets uint64, bucketSize uint64) *cuckooLayer {
+	return &cuckooLayer{
+		numBuckets: numBuckets,
+		buckets:    make([]byte, numBuckets*bucketSize),
+	}
+}
+
+func NewCuckoo(capacity uint64, bucketSize uint64, maxIterations int, expansion uint64) *Cuckoo {
+	numBuckets := nextPow2((capacity + bucketSize - 1) / bucketSize)
+	return &Cuckoo{
+		layers:        []*cuckooLayer{newCuckooLayer(numBuckets, bucketSize)},
+		bucketSize:    bucketSize,
+		maxIterations: maxIterations,
+		expansion:     expansion,
+	}
+}
+
+/*
+Fingerprint in [1, 255] and the hash used for the first bucket
+*/
+func cuckooHash(item string) (byte, uint64) {
+	h := calHash(item)
+	return byte(h.b%255 + 1), h.a
+}
+
+func (l *cuckooLayer) index(hash uint64) uint64 {
+	return hash & (l.numBuckets - 1)
+}
+
+/*
+The other bucket of a fingerprint, alt(alt(i)) == i for power of two sizes
+*/
+func (l *cuckooLayer) alt(idx uint64, fp byte) uint64 {
+	return (idx ^ (uint64(fp) * 0x5bd1e995)) & (l.numBuckets - 1)
+}
+
+func (c *Cuckoo) bucket(l *cuckooLayer, idx uint64) []byte {
+	return l.buckets[idx*c.bucketSize : (idx+1)*c.bucketSize]
+}
+
+/*
+Put `fp` in a free slot of bucket `idx`
+*/
+func (c *Cuckoo) place(l *cuckooLayer, idx uint64, fp byte) bool {
+	b := c.bucket(l, idx)
+	for i := range b {
+		if b[i] == 0 {
+			b[i] = fp
+			return true
+		}
+	}
+	return false
+}
+
+/*
+Make room by moving fingerprints to their other bucket. On failure every
+swap is undone so the layer is left untouched
+*/
+func (c *Cuckoo) kick(l *cuckooLayer, idx uint64, fp byte) bool {
+	type move struct{ idx, slot uint64 }
+	path := make([]move, 0, c.maxIterations)
+	for range c.maxIterations {
+		slot := uint64(rand.Intn(int(c.bucketSize)))
+		b := c.bucket(l, idx)
+		b[slot], fp = fp, b[slot]
+		path = append(path, move{idx, slot})
+
+		idx = l.alt(idx, fp)
+		if c.place(l, idx, fp) {
+			return true
+		}
+	}
+
+	for i := len(path) - 1; i >= 0; i-- {
+		b := c.bucket(l, path[i].idx)
+		b[path[i].slot], fp = fp, b[path[i].slot]
+	}
+	return false
+}
+
+func (c *Cuckoo) insert(fp byte, hash uint64) error {
+	for i := len(c.layers) - 1; i >= 0; i-- {
+		l := c.layers[i]
+		i1 := l.index(hash)
+		if c.place(l, i1, fp) || c.place(l, l.alt(i1, fp), fp) {
+			c.items++
+			return nil
+		}
+	}
+
+	last := c.layers[len(c.layers)-1]
+	i1 := last.index(hash)
+	if rand.Intn(2) == 1 {
+		i1 = last.alt(i1, fp)
+	}
+	if c.kick(last, i1, fp) {
+		c.items++
+		return nil
+	}
+
+	if c.expansion == 0 {
+		return ErrCuckooFull
+	}
+	last = newCuckooLayer(last.numBuckets*nextPow2(c.expansion), c.bucketSize)
+	c.layers = append(c.layers, last)
+	c.place(last, last.index(hash), fp)
+	c.items++
+	return nil
+}
+
+/*
+Add `item`, duplicates are stored again (CF.ADD)
+*/
+func (c *Cuckoo) Add(item string) error {
+	fp, hash := cuckooHash(item)
+	return c.insert(fp, hash)
+}
+
+/*
+Add `item` unless it (probably) exists already (CF.ADDNX)
+*/
+func (c *Cuckoo) AddNX(item string) (bool, error) {
+	if c.Exist(item) {
+		return false, nil
+	}
+	return true, c.Add(item)
+}
+
+/*
+Call fn on the two buckets of `item` in every layer, newest first, until it
+returns false
+*/
+func (c *Cuckoo) eachBucket(item string, fn func(b []byte) bool) {
+	fp, hash := cuckooHash(item)
+	for i := len(c.layers) - 1; i >= 0; i-- {
+		l := c.layers[i]
+		i1 := l.index(hash)
+		if !fn(c.bucket(l, i1)) {
+			return
+		}
+		if i2 := l.alt(i1, fp); i2 != i1 && !fn(c.bucket(l, i2)) {
+			return
+		}
+	}
+}
+
+func (c *Cuckoo) Exist(item string) bool {
+	return c.Count(item) > 0
+}
+
+/*
+Number of times the fingerprint of `item` is stored, an upper bound of how
+many times it was added
+*/
+func (c *Cuckoo) Count(item string) int {
+	fp, _ := cuckooHash(item)
+	cnt := 0
+	c.eachBucket(item, func(b []byte) bool {
+		for _, f := range b {
+			if f == fp {
+				cnt++
+			}
+		}
+		return true
+	})
+	return cnt
+}
+
+/*
+Remove one occurrence of `item`. Deleting an item that was never added may
+remove another item sharing its fingerprint and buckets
+*/
+func (c *Cuckoo) Del(item string) bool {
+	fp, _ := cuckooHash(item)
+	found := false
+	c.eachBucket(item, func(b []byte) bool {
+		for i := range b {
+			if b[i] == fp {
+				b[i] = 0
+				found = true
+				return false
+			}
+		}
+		return true
+	})
+	if found {
+		c.items--
+		c.deleted++
+	}
+	return found
+}
+
+func (c *Cuckoo) Info() CuckooInfo {
+	info := CuckooInfo{
+		Filters:       len(c.layers),
+		Items:         c.items,
+		Deleted:       c.deleted,
+		BucketSize:    c.bucketSize,
+		Expansion:     c.expansion,
+		MaxIterations: c.maxIterations,
+	}
+	for _, l := range c.layers {
+		info.Buckets += l.numBuckets
+		info.Size += uint64(len(l.buckets))
+	}
+	return info
+}
+
+func (c *Cuckoo) clone() *Cuckoo {
+	res := *c
+	res.layers = make([]*cuckooLayer, len(c.layers))
+	for i, l := range c.layers {
+		res.layers[i] = &cuckooLayer{numBuckets: l.numBuckets, buckets: slices.Clone(l.buckets)}
+	}
+	return &res
+}
@@ -0,0 +1,107 @@
+package datastructure
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestCuckooAddExistDel(t *testing.T) {
+	cf := NewCuckoo(1024, 2, 20, 1)
+	for _, item := range []string{"apple", "banana", "banana"} {
+		if err := cf.Add(item); err != nil {
+			t.Fatalf("Add(%q) failed: %v", item, err)
+		}
+	}
+
+	if !cf.Exist("apple") || !cf.Exist("banana") {
+		t.Errorf("Exist returned false for an added item")
+	}
+	if got := cf.Count("banana"); got != 2 {
+		t.Errorf("Count(banana) = %d, want 2", got)
+	}
+	if ok, _ := cf.AddNX("apple"); ok {
+		t.Errorf("AddNX added an existing item")
+	}
+
+	if !cf.Del("banana") {
+		t.Fatalf("Del(banana) returned false")
+	}
+	if got := cf.Count("banana"); got != 1 {
+		t.Errorf("Count(banana) after Del = %d, want 1", got)
+	}
+	cf.Del("banana")
+	if cf.Exist("banana") {
+		t.Errorf("banana still exists after deleting both copies")
+	}
+	if cf.Del("banana") {
+		t.Errorf("Del of a missing item returned true")
+	}
+
+	info := cf.Info()
+	if info.Items != 1 || info.Deleted != 2 {
+		t.Errorf("Info items=%d deleted=%d, want 1 and 2", info.Items, info.Deleted)
+	}
+}
+
+func TestCuckooExpansion(t *testing.T) {
+	cf := NewCuckoo(64, 2, 20, 1)
+	n := 1000
+	for i := 0; i < n; i++ {
+		if err := cf.Add(fmt.Sprintf("item-%d", i)); err != nil {
+			t.Fatalf("Add #%d failed: %v", i, err)
+		}
+	}
+
+	if info := cf.Info(); info.Filters < 2 {
+		t.Errorf("expected filter to grow beyond one layer, got %d", info.Filters)
+	}
+	for i := 0; i < n; i++ {
+		if !cf.Exist(fmt.Sprintf("item-%d", i)) {
+			t.Fatalf("false negative for item-%d", i)
+		}
+	}
+}
+
+func TestCuckooFullWithoutExpansion(t *testing.T) {
+	cf := NewCuckoo(8, 2, 10, 0)
+	var added []string
+	var err error
+	for i := 0; i < 100 && err == nil; i++ {
+		item := fmt.Sprintf("item-%d", i)
+		if err = cf.Add(item); err == nil {
+			added = append(added, item)
+		}
+	}
+
+	if err != ErrCuckooFull {
+		t.Fatalf("expected ErrCuckooFull, got %v", err)
+	}
+	if info := cf.Info(); info.Filters != 1 || info.Items != uint64(len(added)) {
+		t.Errorf("Info filters=%d items=%d, want 1 and %d", info.Filters, info.Items, len(added))
+	}
+	// A failed insert must not evict anything already stored.
+	for _, item := range added {
+		if !cf.Exist(item) {
+			t.Errorf("%q lost after failed insert", item)
+		}
+	}
+}
+
+func TestCuckooFalsePositiveRate(t *testing.T) {
+	cf := NewCuckoo(10000, 2, 20, 1)
+	for i := 0; i < 5000; i++ {
+		cf.Add(fmt.Sprintf("in-%d", i))
+	}
+
+	fp := 0
+	trials := 10000
+	for i := 0; i < trials; i++ {
+		if cf.Exist(fmt.Sprintf("out-%d", i)) {
+			fp++
+		}
+	}
+	// Two buckets of two 8-bit fingerprints give roughly 4/255 per layer.
+	if rate := float64(fp) / float64(trials); rate > 0.03 {
+		t.Errorf("false positive rate %.4f too high", rate)
+	}
+}
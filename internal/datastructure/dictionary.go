@@ -4,40 +4,104 @@ import "time"
 
 type Obj struct {
 	Value interface{}
+	access
 }
 
 type Dict struct {
-	dictStore        map[string]*Obj
-	expiredDictStore map[string]uint64
+	// Index of the keyspace, which strings are added to and removed from
+	index            *hashTable[uint16]
+	dictStore        *hashTable[*Obj]
+	expiredDictStore *hashTable[uint64]
+	// Called on every change of a key, with its keyspace event
+	modified func(class int, event string, key string)
 }
 
 func (d *Dict) Set(key string, value interface{}, expir uint64) {
-	v := d.dictStore[key]
-	if v == nil {
-		HashKeySpace.Key++
+	if d.set(key, value, expir) {
+		d.modified(NotifyNew, "new", key)
 	}
-	d.dictStore[key] = &Obj{Value: value}
-	d.expiredDictStore[key] = expir
+	d.modified(NotifyString, "set", key)
+	if expir != 0 {
+		d.modified(NotifyGeneric, "expire", key)
+	}
+}
+
+/*
+Store `value` without publishing any event, returns true when `key` is new
+*/
+func (d *Dict) set(key string, value interface{}, expir uint64) bool {
+	obj := &Obj{Value: value}
+	// Like Redis, an overwrite keeps the access statistics of the key
+	if old, ok := d.lookup(key); ok {
+		obj.access = old.access
+	} else {
+		obj.init(time.Now())
+	}
+	added := d.dictStore.Set(key, obj)
+	if added {
+		indexAdd(d.index, key, typeString)
+	}
+	if expir == 0 {
+		d.expiredDictStore.Delete(key)
+	} else {
+		d.expiredDictStore.Set(key, expir)
+	}
+	return added
+}
+
+/*
+Replace the value of an existing `key`, keeping its expiry. Callers publish
+their own event
+*/
+func (d *Dict) SetKeepTTL(key string, value interface{}) {
+	if obj, ok := d.lookup(key); ok {
+		obj.Value = value
+		return
+	}
+	if d.set(key, value, 0) {
+		d.modified(NotifyNew, "new", key)
+	}
+}
+
+/*
+Delete `key` when its expiry is in the past, returns true when it did
+*/
+func (d *Dict) expireIfNeeded(key string, now uint64) bool {
+	expiredAt, ok := d.expiredDictStore.Get(key)
+	if !ok || now <= expiredAt {
+		return false
+	}
+	d.dictStore.Delete(key)
+	indexRemove(d.index, key, typeString)
+	d.expiredDictStore.Delete(key)
+	d.modified(NotifyExpired, "expired", key)
+	return true
+}
+
+/*
+Object of `key`, which counts as an access
+*/
+func (d *Dict) lookup(key string) (*Obj, bool) {
+	obj, ok := d.dictStore.Get(key)
+	if ok {
+		obj.touch(time.Now())
+	}
+	return obj, ok
 }
 
 func (d *Dict) Get(key string) (Obj, bool) {
-	obj, exist := d.dictStore[key]
+	obj, exist := d.lookup(key)
 	if !exist {
 		return Obj{}, false
 	}
-
-	if expiredAt, hasExpired := d.expiredDictStore[key]; hasExpired {
-		if uint64(time.Now().UnixMilli()) > expiredAt {
-			delete(d.dictStore, key)
-			delete(d.expiredDictStore, key)
-			return Obj{}, false
-		}
+	if d.expireIfNeeded(key, uint64(time.Now().UnixMilli())) {
+		return Obj{}, false
 	}
 	return *obj, true
 }
 
 func (d *Dict) Ttl(key string) (uint64, bool) {
-	expir, exist := d.expiredDictStore[key]
+	expir, exist := d.expiredDictStore.Get(key)
 	if !exist {
 		return 0, false
 	}
@@ -45,41 +109,43 @@ func (d *Dict) Ttl(key string) (uint64, bool) {
 }
 
 func (d *Dict) Expire(key string, expr uint64) (int, bool) {
-	_, ok := d.expiredDictStore[key]
+	_, ok := d.lookup(key)
 	if !ok {
 		return 0, false
 	}
-	d.expiredDictStore[key] = expr
+	d.expiredDictStore.Set(key, expr)
+	d.modified(NotifyGeneric, "expire", key)
 	return 1, true
 }
 
-func (d *Dict) Del(keys []string) (int, bool) {
+func (d *Dict) Exist(keys []string) (int, bool) {
 	cnt := 0
+	now := uint64(time.Now().UnixMilli())
 	for _, k := range keys {
-		if _, ok := d.dictStore[k]; !ok {
+		if _, ok := d.dictStore.Get(k); !ok {
+			continue
+		}
+		if d.expireIfNeeded(k, now) {
 			continue
 		}
-		delete(d.dictStore, k)
-		delete(d.expiredDictStore, k)
-		HashKeySpace.Key--
 		cnt++
 	}
 	return cnt, true
 }
 
-func (d *Dict) Exist(keys []string) (int, bool) {
-	cnt := 0
-	expiredList := make([]string, 0)
-	for _, k := range keys {
-		if _, ok := d.dictStore[k]; !ok {
-			continue
+/*
+One round of active expiry: look at up to `samples` keys with a TTL and
+delete the expired ones. Returns the number of keys sampled and expired so
+the caller can decide whether another round is worth it
+*/
+func (d *Dict) activeExpire(samples int) (int, int) {
+	now := uint64(time.Now().UnixMilli())
+	checked, expired := 0, 0
+	for _, key := range d.expiredDictStore.SampleKeys(samples) {
+		checked++
+		if d.expireIfNeeded(key, now) {
+			expired++
 		}
-		if hadExpr, ok := d.expiredDictStore[k]; ok && hadExpr < uint64(time.Now().UnixMilli()) {
-			expiredList = append(expiredList, k)
-			continue
-		}
-		cnt++
 	}
-	d.Del(expiredList)
-	return cnt, true
+	return checked, expired
 }
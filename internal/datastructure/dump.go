@@ -0,0 +1,299 @@
+package datastructure
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+
+	"tcp-server.com/m/internal/config"
+)
+
+/*
+Chunked dump/restore for the probabilistic types (BF.SCANDUMP/BF.LOADCHUNK
+and the CMS equivalents).
+
+The iterator handed out by SCANDUMP walks a virtual byte stream:
+
+	iterator 0      -> reply (1, header)
+	iterator i >= 1 -> reply (i + len(chunk), chunk) where chunk starts at
+	                   offset i - 1 of the type's data bytes
+	past the end    -> reply (0, "")
+
+LOADCHUNK takes the exact pairs SCANDUMP returned: iterator 1 carries the
+header and creates the value, any other iterator carries the chunk ending
+at offset iterator - 1.
+
+Headers start with a 4 byte magic and a version byte so dumps can be
+rejected when the layout changes.
+*/
+const DumpVersion byte = 1
+
+const (
+	bloomDumpMagic = "SBF\x00"
+	cmsDumpMagic   = "CMS\x00"
+)
+
+// Largest data a LOADCHUNK header may allocate, the header comes from a
+// client and is checked before anything is allocated
+const maxDumpDataLen uint64 = 512 << 20
+
+var (
+	ErrDumpHeader   = errors.New("ERR received bad data")
+	ErrDumpVersion  = errors.New("ERR unsupported dump version")
+	ErrDumpOffset   = errors.New("ERR invalid offset - no link found")
+	ErrDumpIterator = errors.New("ERR Invalid iterator")
+)
+
+/*
+A value whose data bytes can be streamed in chunks
+*/
+type chunkable interface {
+	dumpHeader() []byte
+	dataLen() uint64
+	readAt(off uint64, buf []byte)
+	writeAt(off uint64, data []byte)
+}
+
+func scanDump(c chunkable, iter int64) (int64, []byte) {
+	if iter == 0 {
+		return 1, c.dumpHeader()
+	}
+	off := uint64(iter - 1)
+	if off >= c.dataLen() {
+		return 0, []byte{}
+	}
+	size := min(uint64(config.DumpChunkSize), c.dataLen()-off)
+	chunk := make([]byte, size)
+	c.readAt(off, chunk)
+	return iter + int64(size), chunk
+}
+
+func loadChunk(c chunkable, iter int64, data []byte) error {
+	end := iter - 1
+	if end < int64(len(data)) {
+		return ErrDumpIterator
+	}
+	off := uint64(end) - uint64(len(data))
+	if off+uint64(len(data)) > c.dataLen() {
+		return ErrDumpOffset
+	}
+	c.writeAt(off, data)
+	return nil
+}
+
+/*
+Check magic and version, returning the header body
+*/
+func checkDumpHeader(header []byte, magic string) ([]byte, error) {
+	if len(header) < len(magic)+1 || string(header[:len(magic)]) != magic {
+		return nil, ErrDumpHeader
+	}
+	if header[len(magic)] != DumpVersion {
+		return nil, ErrDumpVersion
+	}
+	return header[len(magic)+1:], nil
+}
+
+/*
+Reader over a header body that remembers whether it ran out of bytes
+*/
+type headerReader struct {
+	buf []byte
+	bad bool
+}
+
+func (r *headerReader) uint64() uint64 {
+	if len(r.buf) < 8 {
+		r.bad = true
+		return 0
+	}
+	v := binary.BigEndian.Uint64(r.buf)
+	r.buf = r.buf[8:]
+	return v
+}
+
+func (r *headerReader) float64() float64 {
+	return math.Float64frombits(r.uint64())
+}
+
+/*
+Bloom header: expansion, number of layers, then per layer entries, error
+rate, hashes, bytes, items and bits per entry. The data bytes are the bit
+arrays of every layer back to back
+*/
+func (sb *ScalableBloom) dumpHeader() []byte {
+	buf := append([]byte(bloomDumpMagic), DumpVersion)
+	buf = binary.BigEndian.AppendUint64(buf, sb.expansion)
+	buf = binary.BigEndian.AppendUint64(buf, uint64(len(sb.filters)))
+	for _, b := range sb.filters {
+		buf = binary.BigEndian.AppendUint64(buf, b.entries)
+		buf = binary.BigEndian.AppendUint64(buf, math.Float64bits(b.errorRate))
+		buf = binary.BigEndian.AppendUint64(buf, uint64(b.hashes))
+		buf = binary.BigEndian.AppendUint64(buf, b.bytes)
+		buf = binary.BigEndian.AppendUint64(buf, b.items)
+		buf = binary.BigEndian.AppendUint64(buf, math.Float64bits(b.bitPerEntries))
+	}
+	return buf
+}
+
+/*
+Rebuild an empty scalable bloom filter (all bits cleared) from a header
+*/
+func scalableBloomFromHeader(header []byte) (*ScalableBloom, error) {
+	body, err := checkDumpHeader(header, bloomDumpMagic)
+	if err != nil {
+		return nil, err
+	}
+	r := &headerReader{buf: body}
+	sb := &ScalableBloom{expansion: r.uint64()}
+	layers := r.uint64()
+	if r.bad || layers == 0 || layers*48 != uint64(len(r.buf)) {
+		return nil, ErrDumpHeader
+	}
+	total := uint64(0)
+	for range layers {
+		b := &Bloom{
+			entries:   r.uint64(),
+			errorRate: r.float64(),
+			hashes:    int(r.uint64()),
+			bytes:     r.uint64(),
+			items:     r.uint64(),
+		}
+		b.bitPerEntries = r.float64()
+		if !validBloomLayer(b) || b.bytes > maxDumpDataLen-total {
+			return nil, ErrDumpHeader
+		}
+		total += b.bytes
+		sb.filters = append(sb.filters, b)
+	}
+	// Allocated once every layer is known to fit
+	for _, b := range sb.filters {
+		b.bits = b.bytes * 8
+		b.bf = make([]byte, b.bytes)
+	}
+	return sb, nil
+}
+
+/*
+Whether the size and hashes of a layer read from a header are the ones its
+entries and error rate give
+*/
+func validBloomLayer(b *Bloom) bool {
+	if !(b.errorRate > 0 && b.errorRate < 1) || b.bitPerEntries != calBitsPerEntries(b.errorRate) {
+		return false
+	}
+	if b.entries == 0 || float64(b.entries)*b.bitPerEntries > float64(maxDumpDataLen*8) {
+		return false
+	}
+	bytes, hashes := bloomLayout(b.entries, b.bitPerEntries)
+	return b.bytes == bytes && b.hashes == hashes
+}
+
+func (sb *ScalableBloom) dataLen() uint64 {
+	total := uint64(0)
+	for _, b := range sb.filters {
+		total += b.bytes
+	}
+	return total
+}
+
+/*
+Call fn for every part of [off, off+size) that falls inside a layer
+*/
+func (sb *ScalableBloom) spans(off uint64, size uint64, fn func(b *Bloom, inner uint64, pos uint64, n uint64)) {
+	start := uint64(0)
+	pos := uint64(0)
+	for _, b := range sb.filters {
+		if pos == size {
+			return
+		}
+		end := start + b.bytes
+		if off+pos < end {
+			inner := off + pos - start
+			n := min(b.bytes-inner, size-pos)
+			fn(b, inner, pos, n)
+			pos += n
+		}
+		start = end
+	}
+}
+
+func (sb *ScalableBloom) readAt(off uint64, buf []byte) {
+	sb.spans(off, uint64(len(buf)), func(b *Bloom, inner uint64, pos uint64, n uint64) {
+		copy(buf[pos:pos+n], b.bf[inner:inner+n])
+	})
+}
+
+func (sb *ScalableBloom) writeAt(off uint64, data []byte) {
+	sb.spans(off, uint64(len(data)), func(b *Bloom, inner uint64, pos uint64, n uint64) {
+		copy(b.bf[inner:inner+n], data[pos:pos+n])
+	})
+}
+
+func (sb *ScalableBloom) ScanDump(iter int64) (int64, []byte) {
+	return scanDump(sb, iter)
+}
+
+func (sb *ScalableBloom) LoadChunk(iter int64, data []byte) error {
+	return loadChunk(sb, iter, data)
+}
+
+/*
+CMS header: width, depth and total count. The data bytes are the counters, row by row,
+4 bytes little endian each
+*/
+func (c *CMS) dumpHeader() []byte {
+	buf := append([]byte(cmsDumpMagic), DumpVersion)
+	buf = binary.BigEndian.AppendUint64(buf, uint64(c.w))
+	buf = binary.BigEndian.AppendUint64(buf, uint64(c.d))
+	buf = binary.BigEndian.AppendUint64(buf, c.count)
+	return buf
+}
+
+func cmsFromHeader(header []byte) (*CMS, error) {
+	body, err := checkDumpHeader(header, cmsDumpMagic)
+	if err != nil {
+		return nil, err
+	}
+	r := &headerReader{buf: body}
+	w, d, count := r.uint64(), r.uint64(), r.uint64()
+	if r.bad || len(r.buf) != 0 || w == 0 || d == 0 || w > math.MaxUint32 || d > math.MaxUint32 ||
+		w*d > maxDumpDataLen/4 {
+		return nil, ErrDumpHeader
+	}
+	cms := NewCMSByDim(uint32(w), uint32(d))
+	cms.count = count
+	return cms, nil
+}
+
+func (c *CMS) dataLen() uint64 {
+	return uint64(c.w) * uint64(c.d) * 4
+}
+
+func (c *CMS) counterAt(idx uint64) *uint32 {
+	return &c.counter[idx/uint64(c.w)][idx%uint64(c.w)]
+}
+
+func (c *CMS) readAt(off uint64, buf []byte) {
+	for i := range buf {
+		pos := off + uint64(i)
+		buf[i] = byte(*c.counterAt(pos / 4) >> (8 * (pos % 4)))
+	}
+}
+
+func (c *CMS) writeAt(off uint64, data []byte) {
+	for i, b := range data {
+		pos := off + uint64(i)
+		shift := 8 * (pos % 4)
+		counter := c.counterAt(pos / 4)
+		*counter = *counter&^(0xff<<shift) | uint32(b)<<shift
+	}
+}
+
+func (c *CMS) ScanDump(iter int64) (int64, []byte) {
+	return scanDump(c, iter)
+}
+
+func (c *CMS) LoadChunk(iter int64, data []byte) error {
+	return loadChunk(c, iter, data)
+}
@@ -0,0 +1,142 @@
+package datastructure
+
+import (
+	"encoding/binary"
+	"fmt"
+	"testing"
+
+	"tcp-server.com/m/internal/config"
+)
+
+type dumper interface {
+	ScanDump(iter int64) (int64, []byte)
+}
+
+type chunk struct {
+	iter int64
+	data []byte
+}
+
+func dumpAll(t *testing.T, d dumper) []chunk {
+	t.Helper()
+	var res []chunk
+	for iter := int64(0); ; {
+		next, data := d.ScanDump(iter)
+		if next == 0 {
+			return res
+		}
+		if len(data) > config.DumpChunkSize && iter != 0 {
+			t.Fatalf("chunk of %d bytes exceeds DumpChunkSize", len(data))
+		}
+		res = append(res, chunk{iter: next, data: data})
+		iter = next
+	}
+}
+
+func TestBloomDumpRestore(t *testing.T) {
+	defer func(size int) { config.DumpChunkSize = size }(config.DumpChunkSize)
+	config.DumpChunkSize = 7
+
+	sb := NewScalableBloom(0.01, 20, 2)
+	for i := range 100 {
+		sb.Add(fmt.Sprintf("member:%d", i))
+	}
+	chunks := dumpAll(t, sb)
+
+	storage := NewStorage()
+	for _, c := range chunks {
+		if err := storage.BFLoadChunk("copy", c.iter, c.data); err != nil {
+			t.Fatalf("BFLoadChunk(%d): %v", c.iter, err)
+		}
+	}
+	restored := storage.bf["copy"]
+	if restored.Info() != sb.Info() {
+		t.Errorf("restored info %+v, want %+v", restored.Info(), sb.Info())
+	}
+	for i := range 100 {
+		if !restored.Exist(fmt.Sprintf("member:%d", i)) {
+			t.Fatalf("restored filter lost member:%d", i)
+		}
+	}
+	for i := range sb.filters {
+		if string(sb.filters[i].bf) != string(restored.filters[i].bf) {
+			t.Errorf("layer %d differs after restore", i)
+		}
+	}
+
+	if err := storage.BFLoadChunk("copy", 1, chunks[0].data); err == nil {
+		t.Errorf("loading a header over an existing filter should fail")
+	}
+	if err := storage.BFLoadChunk("other", 1, []byte("garbage")); err != ErrDumpHeader {
+		t.Errorf("expected ErrDumpHeader for a bad header, got %v", err)
+	}
+	header := append([]byte{}, chunks[0].data...)
+	header[len(bloomDumpMagic)] = DumpVersion + 1
+	if err := storage.BFLoadChunk("other", 1, header); err != ErrDumpVersion {
+		t.Errorf("expected ErrDumpVersion for a newer dump, got %v", err)
+	}
+	if err := storage.BFLoadChunk("copy", 1<<40, []byte("x")); err != ErrDumpOffset {
+		t.Errorf("expected ErrDumpOffset past the end, got %v", err)
+	}
+}
+
+func TestCMSDumpRestore(t *testing.T) {
+	defer func(size int) { config.DumpChunkSize = size }(config.DumpChunkSize)
+	config.DumpChunkSize = 5
+
+	cms := NewCMS(0.01, 0.01)
+	for i := range 500 {
+		cms.IncrBy(fmt.Sprintf("item:%d", i%37), uint32(i))
+	}
+
+	storage := NewStorage()
+	for _, c := range dumpAll(t, cms) {
+		if err := storage.CMSLoadChunk("copy", c.iter, c.data); err != nil {
+			t.Fatalf("CMSLoadChunk(%d): %v", c.iter, err)
+		}
+	}
+	restored := storage.cms["copy"]
+	for i := range 37 {
+		item := fmt.Sprintf("item:%d", i)
+		if got, want := restored.Query(item), cms.Query(item); got != want {
+			t.Errorf("Query(%s) = %d after restore, want %d", item, got, want)
+		}
+	}
+}
+
+/*
+Headers sizing a value beyond what they describe or beyond maxDumpDataLen
+are rejected before anything is allocated
+*/
+func TestDumpHeaderLimits(t *testing.T) {
+	storage := NewStorage()
+	header := NewScalableBloom(0.01, 100, 2).dumpHeader()
+	// Offsets of the entries and bytes of the first layer
+	entriesAt := len(bloomDumpMagic) + 1 + 16
+	bytesAt := entriesAt + 24
+	for _, patch := range []struct {
+		at    int
+		value uint64
+	}{
+		{bytesAt, 1 << 62},
+		{bytesAt, 1 << 20},
+		{entriesAt, 1 << 60},
+	} {
+		bad := append([]byte{}, header...)
+		binary.BigEndian.PutUint64(bad[patch.at:], patch.value)
+		if err := storage.BFLoadChunk("bf", 1, bad); err != ErrDumpHeader {
+			t.Errorf("got %v for a layer field of %d at %d, want ErrDumpHeader", err, patch.value, patch.at)
+		}
+	}
+
+	cms := append([]byte(cmsDumpMagic), DumpVersion)
+	cms = binary.BigEndian.AppendUint64(cms, 1<<31)
+	cms = binary.BigEndian.AppendUint64(cms, 1<<31)
+	cms = binary.BigEndian.AppendUint64(cms, 0)
+	if err := storage.CMSLoadChunk("cms", 1, cms); err != ErrDumpHeader {
+		t.Errorf("got %v for a 2^31 x 2^31 sketch, want ErrDumpHeader", err)
+	}
+	if storage.KeySpace().Key != 0 {
+		t.Error("rejected header created a key")
+	}
+}
@@ -0,0 +1,362 @@
+package datastructure
+
+import (
+	"errors"
+	"math"
+	"slices"
+)
+
+/*
+Geo indexes are plain zsets: every member is scored with the 52 bit geohash
+of its position, longitude and latitude bits interleaved. Members of one
+geohash cell are therefore a contiguous score range of the zset
+*/
+const (
+	GeoLonMin = -180.0
+	GeoLonMax = 180.0
+	// Limits of the Web Mercator projection
+	GeoLatMin = -85.05112878
+	GeoLatMax = 85.05112878
+
+	geoStepMax        = 26
+	earthRadiusMeters = 6372797.560856
+	mercatorMax       = 20037726.37
+)
+
+const (
+	GeoSortNone = iota
+	GeoSortAsc
+	GeoSortDesc
+)
+
+var ErrGeoMember = errors.New("ERR could not decode requested zset member")
+
+type geoHash struct {
+	bits uint64
+	step uint
+}
+
+type geoArea struct {
+	lonMin, lonMax float64
+	latMin, latMax float64
+}
+
+/*
+Spread the bits of `x` over the even positions and those of `y` over the odd
+ones
+*/
+func interleave(x uint32, y uint32) uint64 {
+	var res uint64
+	for i := 0; i < 32; i++ {
+		res |= uint64(x>>i&1)<<(2*i) | uint64(y>>i&1)<<(2*i+1)
+	}
+	return res
+}
+
+func deinterleave(v uint64) (uint32, uint32) {
+	var x, y uint32
+	for i := 0; i < 32; i++ {
+		x |= uint32(v>>(2*i)&1) << i
+		y |= uint32(v>>(2*i+1)&1) << i
+	}
+	return x, y
+}
+
+func geoEncode(lon float64, lat float64, latMin float64, latMax float64, step uint) geoHash {
+	cells := float64(uint64(1) << step)
+	latOffset := min(uint32((lat-latMin)/(latMax-latMin)*cells), uint32(cells)-1)
+	lonOffset := min(uint32((lon-GeoLonMin)/(GeoLonMax-GeoLonMin)*cells), uint32(cells)-1)
+	return geoHash{bits: interleave(latOffset, lonOffset), step: step}
+}
+
+func (h geoHash) decode() geoArea {
+	latOffset, lonOffset := deinterleave(h.bits)
+	cells := float64(uint64(1) << h.step)
+	latScale, lonScale := GeoLatMax-GeoLatMin, GeoLonMax-GeoLonMin
+	return geoArea{
+		lonMin: GeoLonMin + float64(lonOffset)/cells*lonScale,
+		lonMax: GeoLonMin + float64(lonOffset+1)/cells*lonScale,
+		latMin: GeoLatMin + float64(latOffset)/cells*latScale,
+		latMax: GeoLatMin + float64(latOffset+1)/cells*latScale,
+	}
+}
+
+/*
+Score of the position, the longitude and latitude must be within the limits
+*/
+func GeoHashScore(lon float64, lat float64) float64 {
+	return float64(geoEncode(lon, lat, GeoLatMin, GeoLatMax, geoStepMax).bits)
+}
+
+/*
+Center of the cell a score points at
+*/
+func GeoDecodeScore(score float64) (float64, float64) {
+	area := geoHash{bits: uint64(score), step: geoStepMax}.decode()
+	lon := min(max((area.lonMin+area.lonMax)/2, GeoLonMin), GeoLonMax)
+	lat := min(max((area.latMin+area.latMax)/2, GeoLatMin), GeoLatMax)
+	return lon, lat
+}
+
+/*
+Standard 11 characters base32 geohash of a score. Redis re-encodes the
+position with a [-90, 90] latitude range, the last character is always 0
+since only 52 bits are stored
+*/
+func GeoHashString(score float64) string {
+	const alphabet = "0123456789bcdefghjkmnpqrstuvwxyz"
+	lon, lat := GeoDecodeScore(score)
+	bits := geoEncode(lon, lat, -90, 90, geoStepMax).bits
+	buf := make([]byte, 11)
+	for i := range buf {
+		idx := uint64(0)
+		if i < 10 {
+			idx = bits >> (52 - (i+1)*5) & 0x1f
+		}
+		buf[i] = alphabet[idx]
+	}
+	return string(buf)
+}
+
+func degToRad(deg float64) float64 {
+	return deg * math.Pi / 180
+}
+
+func radToDeg(rad float64) float64 {
+	return rad * 180 / math.Pi
+}
+
+func geoLatDistance(lat1 float64, lat2 float64) float64 {
+	return earthRadiusMeters * math.Abs(degToRad(lat2)-degToRad(lat1))
+}
+
+/*
+Haversine distance in meters
+*/
+func GeoDistance(lon1 float64, lat1 float64, lon2 float64, lat2 float64) float64 {
+	lat1r, lat2r := degToRad(lat1), degToRad(lat2)
+	v := math.Sin((degToRad(lon2) - degToRad(lon1)) / 2)
+	if v == 0 {
+		return geoLatDistance(lat1, lat2)
+	}
+	u := math.Sin((lat2r - lat1r) / 2)
+	a := u*u + math.Cos(lat1r)*math.Cos(lat2r)*v*v
+	return 2 * earthRadiusMeters * math.Asin(math.Sqrt(a))
+}
+
+/*
+Area searched by GEOSEARCH, around Lon/Lat: a circle of Radius or, with
+Box, a Width x Height rectangle, in meters
+*/
+type GeoShape struct {
+	Lon, Lat      float64
+	Box           bool
+	Radius        float64
+	Width, Height float64
+}
+
+/*
+Distance from the center when the point is inside the shape
+*/
+func (s *GeoShape) contains(lon float64, lat float64) (float64, bool) {
+	if !s.Box {
+		dist := GeoDistance(s.Lon, s.Lat, lon, lat)
+		return dist, dist <= s.Radius
+	}
+	if geoLatDistance(lat, s.Lat) > s.Height/2 {
+		return 0, false
+	}
+	if GeoDistance(lon, lat, s.Lon, lat) > s.Width/2 {
+		return 0, false
+	}
+	return GeoDistance(s.Lon, s.Lat, lon, lat), true
+}
+
+func (s *GeoShape) boundingBox() geoArea {
+	height, width := s.Radius, s.Radius
+	if s.Box {
+		height, width = s.Height/2, s.Width/2
+	}
+	latDelta := radToDeg(height / earthRadiusMeters)
+	lonDeltaTop := radToDeg(width / earthRadiusMeters / math.Cos(degToRad(s.Lat+latDelta)))
+	lonDeltaBottom := radToDeg(width / earthRadiusMeters / math.Cos(degToRad(s.Lat-latDelta)))
+	// The widest side of the box is the one closer to the equator
+	lonDelta := lonDeltaTop
+	if s.Lat < 0 {
+		lonDelta = lonDeltaBottom
+	}
+	return geoArea{
+		lonMin: s.Lon - lonDelta,
+		lonMax: s.Lon + lonDelta,
+		latMin: s.Lat - latDelta,
+		latMax: s.Lat + latDelta,
+	}
+}
+
+/*
+Coarsest step whose cells are still about as large as `radius`
+*/
+func geoStepsByRadius(radius float64, lat float64) uint {
+	if radius == 0 {
+		return geoStepMax
+	}
+	step := 1
+	for radius < mercatorMax {
+		radius *= 2
+		step++
+	}
+	// Make sure the radius fits in most cases
+	step -= 2
+	if lat > 66 || lat < -66 {
+		step--
+		if lat > 80 || lat < -80 {
+			step--
+		}
+	}
+	return uint(min(max(step, 1), geoStepMax))
+}
+
+/*
+Neighbor cell `dx` columns east and `dy` rows north, adding to the bits of
+one coordinate while keeping the other untouched
+*/
+func (h geoHash) move(dx int, dy int) geoHash {
+	const even, odd = 0x5555555555555555, 0xaaaaaaaaaaaaaaaa
+	shift := 64 - h.step*2
+	step := func(bits uint64, mask uint64, d int) uint64 {
+		zz := (^mask) >> shift
+		switch {
+		case d > 0:
+			bits += zz + 1
+		case d < 0:
+			bits = (bits | zz) - (zz + 1)
+		}
+		return bits & (mask >> shift)
+	}
+	lon := step(h.bits&odd, odd, dx)
+	lat := step(h.bits&even, even, dy)
+	return geoHash{bits: lon | lat, step: h.step}
+}
+
+/*
+Cells to scan so that the whole shape is covered: the cell of the center and
+its 8 neighbors, at a step where one cell is about the size of the shape.
+Neighbors lying entirely outside of the bounding box are skipped
+*/
+func (s *GeoShape) cells() []geoHash {
+	radius := s.Radius
+	if s.Box {
+		radius = math.Hypot(s.Width/2, s.Height/2)
+	}
+	bounds := s.boundingBox()
+	step := geoStepsByRadius(radius, s.Lat)
+
+	center := geoEncode(s.Lon, s.Lat, GeoLatMin, GeoLatMax, step)
+	north, south := center.move(0, 1).decode(), center.move(0, -1).decode()
+	east, west := center.move(1, 0).decode(), center.move(-1, 0).decode()
+	if step > 1 && (north.latMax < bounds.latMax || south.latMin > bounds.latMin ||
+		east.lonMax < bounds.lonMax || west.lonMin > bounds.lonMin) {
+		step--
+		center = geoEncode(s.Lon, s.Lat, GeoLatMin, GeoLatMax, step)
+	}
+	area := center.decode()
+
+	res := make([]geoHash, 0, 9)
+	for dy := -1; dy <= 1; dy++ {
+		for dx := -1; dx <= 1; dx++ {
+			if step >= 2 && ((dy < 0 && area.latMin < bounds.latMin) || (dy > 0 && area.latMax > bounds.latMax) ||
+				(dx < 0 && area.lonMin < bounds.lonMin) || (dx > 0 && area.lonMax > bounds.lonMax)) {
+				continue
+			}
+			cell := center.move(dx, dy)
+			// Around the poles and the antimeridian neighbors may wrap onto the
+			// same cell
+			if !slices.Contains(res, cell) {
+				res = append(res, cell)
+			}
+		}
+	}
+	return res
+}
+
+type GeoPoint struct {
+	Member   string
+	Dist     float64
+	Score    float64
+	Lon, Lat float64
+}
+
+type GeoQuery struct {
+	// Center at the position of Member when set, Shape.Lon/Lat otherwise
+	FromMember bool
+	Member     string
+	Shape      GeoShape
+	Sort       int
+	// Maximum number of results when positive, with Any the scan stops as
+	// soon as Count points are found instead of returning the closest ones
+	Count int
+	Any   bool
+}
+
+/*
+Members of the geo index inside the query shape
+*/
+func (z *ZSet) GeoSearch(q *GeoQuery) ([]GeoPoint, error) {
+	shape := q.Shape
+	if q.FromMember {
+		score, ok := z.score(q.Member)
+		if !ok {
+			return nil, ErrGeoMember
+		}
+		shape.Lon, shape.Lat = GeoDecodeScore(score)
+	}
+
+	res := make([]GeoPoint, 0)
+	for _, cell := range shape.cells() {
+		shift := 52 - cell.step*2
+		spec := &ZRangeSpec{
+			By:    ZRangeByScore,
+			Score: ScoreRange{Min: float64(cell.bits << shift), Max: float64((cell.bits + 1) << shift), MaxEx: true},
+			Count: -1,
+		}
+		for _, e := range z.Range(spec) {
+			lon, lat := GeoDecodeScore(e.Score)
+			dist, ok := shape.contains(lon, lat)
+			if !ok {
+				continue
+			}
+			res = append(res, GeoPoint{Member: e.Member, Dist: dist, Score: e.Score, Lon: lon, Lat: lat})
+			if q.Any && len(res) == q.Count {
+				break
+			}
+		}
+		if q.Any && len(res) == q.Count {
+			break
+		}
+	}
+
+	sort := q.Sort
+	if sort == GeoSortNone && q.Count > 0 && !q.Any {
+		sort = GeoSortAsc
+	}
+	switch sort {
+	case GeoSortAsc:
+		slices.SortStableFunc(res, func(a, b GeoPoint) int { return compareFloat(a.Dist, b.Dist) })
+	case GeoSortDesc:
+		slices.SortStableFunc(res, func(a, b GeoPoint) int { return compareFloat(b.Dist, a.Dist) })
+	}
+	if q.Count > 0 && len(res) > q.Count {
+		res = res[:q.Count]
+	}
+	return res, nil
+}
+
+func compareFloat(a float64, b float64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
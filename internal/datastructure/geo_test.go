@@ -0,0 +1,91 @@
+package datastructure
+
+import (
+	"math"
+	"math/rand"
+	"sort"
+	"strconv"
+	"testing"
+)
+
+func TestGeoHashKnownValues(t *testing.T) {
+	// Values taken from the Redis GEOADD/GEOHASH documentation
+	score := GeoHashScore(15.087269, 37.502669)
+	if score != 3479447370796909 {
+		t.Fatalf("score of Catania = %.0f", score)
+	}
+	if h := GeoHashString(score); h != "sqdtr74hyu0" {
+		t.Fatalf("geohash of Catania = %s", h)
+	}
+	lon, lat := GeoDecodeScore(GeoHashScore(13.361389, 38.115556))
+	if math.Abs(lon-13.361389) > 1e-5 || math.Abs(lat-38.115556) > 1e-5 {
+		t.Fatalf("decoded Palermo at %f,%f", lon, lat)
+	}
+	if d := GeoDistance(13.361389, 38.115556, 15.087269, 37.502669); math.Abs(d-166274.1516) > 1 {
+		t.Fatalf("Palermo-Catania distance = %f", d)
+	}
+}
+
+func TestGeoHashNeighbors(t *testing.T) {
+	h := geoEncode(10, 20, GeoLatMin, GeoLatMax, 10)
+	area := h.decode()
+	east, north := h.move(1, 0).decode(), h.move(0, 1).decode()
+	if east.lonMin != area.lonMax || east.latMin != area.latMin {
+		t.Fatalf("east neighbor %+v of %+v", east, area)
+	}
+	if north.latMin != area.latMax || north.lonMin != area.lonMin {
+		t.Fatalf("north neighbor %+v of %+v", north, area)
+	}
+	if back := h.move(1, 1).move(-1, -1); back != h {
+		t.Fatalf("moving back and forth ended on %+v, want %+v", back, h)
+	}
+}
+
+func TestGeoSearchAgainstBruteForce(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	z := NewZset()
+	type pos struct{ lon, lat float64 }
+	points := make(map[string]pos)
+	for i := 0; i < 3000; i++ {
+		p := pos{lon: 2 + r.Float64()*2, lat: 48 + r.Float64()*2}
+		member := "p" + strconv.Itoa(i)
+		points[member] = p
+		z.Zadd(member, GeoHashScore(p.lon, p.lat))
+	}
+
+	shapes := []GeoShape{
+		{Lon: 3, Lat: 49, Radius: 20000},
+		{Lon: 2.5, Lat: 48.5, Radius: 150},
+		{Lon: 3.5, Lat: 49.5, Box: true, Width: 30000, Height: 10000},
+	}
+	for _, shape := range shapes {
+		got, err := z.GeoSearch(&GeoQuery{Shape: shape, Sort: GeoSortAsc})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var want []string
+		for member, p := range points {
+			lon, lat := GeoDecodeScore(GeoHashScore(p.lon, p.lat))
+			if _, ok := shape.contains(lon, lat); ok {
+				want = append(want, member)
+			}
+		}
+		if len(got) != len(want) {
+			t.Fatalf("search %+v found %d points, want %d", shape, len(got), len(want))
+		}
+		if !sort.SliceIsSorted(got, func(i, j int) bool { return got[i].Dist < got[j].Dist }) {
+			t.Fatalf("search %+v is not sorted by distance", shape)
+		}
+	}
+
+	limited, _ := z.GeoSearch(&GeoQuery{Shape: shapes[0], Count: 5})
+	all, _ := z.GeoSearch(&GeoQuery{Shape: shapes[0], Sort: GeoSortAsc})
+	for i := range limited {
+		if limited[i].Member != all[i].Member {
+			t.Fatalf("COUNT without ANY did not return the closest points")
+		}
+	}
+	if _, err := z.GeoSearch(&GeoQuery{FromMember: true, Member: "missing", Shape: shapes[0]}); err != ErrGeoMember {
+		t.Fatalf("missing member error = %v", err)
+	}
+}
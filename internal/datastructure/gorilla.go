@@ -0,0 +1,209 @@
+package datastructure
+
+import (
+	"math"
+	"math/bits"
+)
+
+/*
+Append only bit stream, bits are written MSB first
+*/
+type bstream struct {
+	buf  []byte
+	free uint8 // unused bits in the last byte
+}
+
+func (b *bstream) writeBit(bit bool) {
+	if b.free == 0 {
+		b.buf = append(b.buf, 0)
+		b.free = 8
+	}
+	if bit {
+		b.buf[len(b.buf)-1] |= 1 << (b.free - 1)
+	}
+	b.free--
+}
+
+/*
+Write the `n` low bits of `v`
+*/
+func (b *bstream) writeBits(v uint64, n int) {
+	for n > 0 {
+		n--
+		b.writeBit(v>>n&1 == 1)
+	}
+}
+
+type bstreamReader struct {
+	buf []byte
+	pos uint64
+}
+
+func (r *bstreamReader) readBit() bool {
+	bit := r.buf[r.pos/8]>>(7-r.pos%8)&1 == 1
+	r.pos++
+	return bit
+}
+
+func (r *bstreamReader) readBits(n int) uint64 {
+	var v uint64
+	for ; n > 0; n-- {
+		v <<= 1
+		if r.readBit() {
+			v |= 1
+		}
+	}
+	return v
+}
+
+/*
+Delta-of-delta buckets for timestamps: the control prefix ('0', '10', '110',
+'1110', '1111') and the width of the signed value that follows it
+*/
+var dodBuckets = []struct {
+	prefix, prefixLen uint64
+	bits              int
+}{
+	{prefix: 0b10, prefixLen: 2, bits: 7},
+	{prefix: 0b110, prefixLen: 3, bits: 9},
+	{prefix: 0b1110, prefixLen: 4, bits: 12},
+}
+
+/*
+Gorilla compressed chunk: timestamps stored as delta-of-delta and values as
+the XOR with the previous value, keeping only its meaningful bits. The first
+sample is stored raw
+*/
+type tsChunk struct {
+	bs          bstream
+	count       int
+	first, last int64
+
+	// Append state
+	prevDelta         int64
+	prevValue         float64
+	leading, trailing uint8
+}
+
+func (c *tsChunk) size() int {
+	return len(c.bs.buf)
+}
+
+func (c *tsChunk) append(ts int64, value float64) {
+	if c.count == 0 {
+		c.bs.writeBits(uint64(ts), 64)
+		c.bs.writeBits(math.Float64bits(value), 64)
+		c.first, c.last, c.prevValue = ts, ts, value
+		c.leading = 0xff
+		c.count++
+		return
+	}
+
+	delta := ts - c.last
+	c.writeDod(delta - c.prevDelta)
+	c.writeXor(value)
+	c.prevDelta, c.last, c.prevValue = delta, ts, value
+	c.count++
+}
+
+func (c *tsChunk) writeDod(dod int64) {
+	if dod == 0 {
+		c.bs.writeBit(false)
+		return
+	}
+	for _, b := range dodBuckets {
+		if -(1<<(b.bits-1))+1 <= dod && dod <= 1<<(b.bits-1) {
+			c.bs.writeBits(b.prefix, int(b.prefixLen))
+			c.bs.writeBits(uint64(dod), b.bits)
+			return
+		}
+	}
+	c.bs.writeBits(0b1111, 4)
+	c.bs.writeBits(uint64(dod), 64)
+}
+
+func (c *tsChunk) writeXor(value float64) {
+	xor := math.Float64bits(value) ^ math.Float64bits(c.prevValue)
+	if xor == 0 {
+		c.bs.writeBit(false)
+		return
+	}
+	c.bs.writeBit(true)
+
+	leading := uint8(min(bits.LeadingZeros64(xor), 31))
+	trailing := uint8(bits.TrailingZeros64(xor))
+	if c.leading != 0xff && leading >= c.leading && trailing >= c.trailing {
+		// Reuse the previous meaningful window
+		c.bs.writeBit(false)
+		c.bs.writeBits(xor>>c.trailing, 64-int(c.leading)-int(c.trailing))
+		return
+	}
+
+	c.leading, c.trailing = leading, trailing
+	sigbits := 64 - int(leading) - int(trailing)
+	c.bs.writeBit(true)
+	c.bs.writeBits(uint64(leading), 5)
+	// 64 significant bits do not fit 6 bits, 0 stands for it
+	c.bs.writeBits(uint64(sigbits&63), 6)
+	c.bs.writeBits(xor>>trailing, sigbits)
+}
+
+/*
+Decode every sample of the chunk
+*/
+func (c *tsChunk) samples() []Sample {
+	res := make([]Sample, 0, c.count)
+	if c.count == 0 {
+		return res
+	}
+	r := &bstreamReader{buf: c.bs.buf}
+	ts := int64(r.readBits(64))
+	valueBits := r.readBits(64)
+	res = append(res, Sample{Timestamp: ts, Value: math.Float64frombits(valueBits)})
+
+	var delta int64
+	var leading, trailing int
+	for i := 1; i < c.count; i++ {
+		delta += readDod(r)
+		ts += delta
+
+		if r.readBit() {
+			if r.readBit() {
+				leading = int(r.readBits(5))
+				sigbits := int(r.readBits(6))
+				if sigbits == 0 {
+					sigbits = 64
+				}
+				trailing = 64 - leading - sigbits
+			}
+			valueBits ^= r.readBits(64-leading-trailing) << trailing
+		}
+		res = append(res, Sample{Timestamp: ts, Value: math.Float64frombits(valueBits)})
+	}
+	return res
+}
+
+func readDod(r *bstreamReader) int64 {
+	if !r.readBit() {
+		return 0
+	}
+	for _, b := range dodBuckets {
+		if !r.readBit() {
+			v := r.readBits(b.bits)
+			// Sign extend, the range is (-2^(bits-1), 2^(bits-1)]
+			if v > 1<<(b.bits-1) {
+				v -= 1 << b.bits
+			}
+			return int64(v)
+		}
+	}
+	return int64(r.readBits(64))
+}
+
+func newChunkFromSamples(samples []Sample) *tsChunk {
+	c := &tsChunk{}
+	for _, s := range samples {
+		c.append(s.Timestamp, s.Value)
+	}
+	return c
+}
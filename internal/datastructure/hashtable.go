@@ -0,0 +1,394 @@
+package datastructure
+
+import (
+	"hash/maphash"
+	"math/bits"
+	"math/rand/v2"
+	"time"
+)
+
+const htInitialSize = 4
+
+var htSeed = maphash.MakeSeed()
+
+func hashKey(key string) uint64 {
+	return maphash.String(htSeed, key)
+}
+
+/*
+Chained hash table with a power of two number of buckets. A key lives in the
+bucket given by the low bits of its hash, which lets SCAN walk the table
+with a cursor that stays valid across resizes.
+Like the Redis dict it resizes incrementally: a second table is allocated
+and the buckets move to it a few at a time, on each write and from the
+active rehashing of idle databases, instead of all at once
+*/
+type hashTable[V any] struct {
+	tables [2]htTable[V]
+	// Next bucket of tables[0] to move to tables[1], -1 when not rehashing
+	rehashIdx int
+	// Iterations in progress, buckets do not move until they are done
+	iterators int
+}
+
+type htTable[V any] struct {
+	buckets []*htEntry[V]
+	used    int
+}
+
+type htEntry[V any] struct {
+	key   string
+	hash  uint64
+	value V
+	next  *htEntry[V]
+}
+
+func newHashTable[V any]() *hashTable[V] {
+	return newHashTableSize[V](htInitialSize)
+}
+
+/*
+Table with room for `size` entries before its first resize
+*/
+func newHashTableSize[V any](size int) *hashTable[V] {
+	return &hashTable[V]{
+		tables:    [2]htTable[V]{{buckets: make([]*htEntry[V], tableSize(size))}},
+		rehashIdx: -1,
+	}
+}
+
+/*
+Smallest power of two holding `size`, at least htInitialSize
+*/
+func tableSize(size int) int {
+	n := htInitialSize
+	for n < size {
+		n *= 2
+	}
+	return n
+}
+
+func (t *htTable[V]) mask() uint64 {
+	return uint64(len(t.buckets) - 1)
+}
+
+func (ht *hashTable[V]) rehashing() bool {
+	return ht.rehashIdx >= 0
+}
+
+/*
+Mask of the largest table
+*/
+func (ht *hashTable[V]) mask() uint64 {
+	if ht.rehashing() {
+		return max(ht.tables[0].mask(), ht.tables[1].mask())
+	}
+	return ht.tables[0].mask()
+}
+
+func (ht *hashTable[V]) Len() int {
+	return ht.tables[0].used + ht.tables[1].used
+}
+
+/*
+Entry of `key`. Lookups run under read locks shared by several clients, so
+unlike writes they never move buckets
+*/
+func (ht *hashTable[V]) find(key string, h uint64) *htEntry[V] {
+	for i := range ht.tables {
+		t := &ht.tables[i]
+		if len(t.buckets) == 0 {
+			break
+		}
+		for e := t.buckets[h&t.mask()]; e != nil; e = e.next {
+			if e.hash == h && e.key == key {
+				return e
+			}
+		}
+	}
+	return nil
+}
+
+func (ht *hashTable[V]) Get(key string) (V, bool) {
+	if e := ht.find(key, hashKey(key)); e != nil {
+		return e.value, true
+	}
+	var zero V
+	return zero, false
+}
+
+/*
+Store `value` at `key`, returns true when `key` is new
+*/
+func (ht *hashTable[V]) Set(key string, value V) bool {
+	h := hashKey(key)
+	if e := ht.find(key, h); e != nil {
+		e.value = value
+		return false
+	}
+	ht.rehashStep()
+	ht.resizeIfNeeded()
+	// New keys go to the table being filled
+	t := &ht.tables[0]
+	if ht.rehashing() {
+		t = &ht.tables[1]
+	}
+	idx := h & t.mask()
+	t.buckets[idx] = &htEntry[V]{key: key, hash: h, value: value, next: t.buckets[idx]}
+	t.used++
+	return true
+}
+
+/*
+Remove `key`, returns its value
+*/
+func (ht *hashTable[V]) Delete(key string) (V, bool) {
+	h := hashKey(key)
+	for i := range ht.tables {
+		t := &ht.tables[i]
+		if len(t.buckets) == 0 {
+			break
+		}
+		for p := &t.buckets[h&t.mask()]; *p != nil; p = &(*p).next {
+			if e := *p; e.hash == h && e.key == key {
+				*p = e.next
+				t.used--
+				ht.rehashStep()
+				ht.resizeIfNeeded()
+				return e.value, true
+			}
+		}
+	}
+	var zero V
+	return zero, false
+}
+
+/*
+Start doubling the table once it holds as many entries as buckets, or
+shrinking it to fit once less than 1/8 of its buckets are used
+*/
+func (ht *hashTable[V]) resizeIfNeeded() {
+	if ht.rehashing() {
+		return
+	}
+	t := &ht.tables[0]
+	switch {
+	case t.used >= len(t.buckets):
+		ht.startRehash(2 * len(t.buckets))
+	case len(t.buckets) > htInitialSize && t.used*8 < len(t.buckets):
+		ht.startRehash(t.used)
+	}
+}
+
+/*
+Allocate the table of `size` the buckets move to
+*/
+func (ht *hashTable[V]) startRehash(size int) {
+	n := tableSize(size)
+	if n == len(ht.tables[0].buckets) {
+		return
+	}
+	ht.tables[1] = htTable[V]{buckets: make([]*htEntry[V], n)}
+	ht.rehashIdx = 0
+}
+
+/*
+Move one bucket, unless an iteration is in progress
+*/
+func (ht *hashTable[V]) rehashStep() {
+	if ht.rehashing() && ht.iterators == 0 {
+		ht.rehash(1)
+	}
+}
+
+/*
+Move up to `n` buckets to the new table, visiting at most 10 empty buckets
+per bucket moved. Returns true while some are left
+*/
+func (ht *hashTable[V]) rehash(n int) bool {
+	if !ht.rehashing() {
+		return false
+	}
+	src, dst := &ht.tables[0], &ht.tables[1]
+	emptyVisits := 10 * n
+	for ; n > 0 && src.used > 0; n-- {
+		for src.buckets[ht.rehashIdx] == nil {
+			ht.rehashIdx++
+			if emptyVisits--; emptyVisits == 0 {
+				return true
+			}
+		}
+		for e := src.buckets[ht.rehashIdx]; e != nil; {
+			next := e.next
+			idx := e.hash & dst.mask()
+			e.next = dst.buckets[idx]
+			dst.buckets[idx] = e
+			src.used--
+			dst.used++
+			e = next
+		}
+		src.buckets[ht.rehashIdx] = nil
+		ht.rehashIdx++
+	}
+	if src.used > 0 {
+		return true
+	}
+	ht.tables[0] = ht.tables[1]
+	ht.tables[1] = htTable[V]{}
+	ht.rehashIdx = -1
+	return false
+}
+
+/*
+Rehash 100 buckets at a time for about `limit`, starting a resize first
+when one is due. Returns true while some buckets are left
+*/
+func (ht *hashTable[V]) rehashFor(limit time.Duration) bool {
+	if ht.iterators > 0 {
+		return ht.rehashing()
+	}
+	ht.resizeIfNeeded()
+	start := time.Now()
+	for ht.rehash(100) {
+		if time.Since(start) > limit {
+			return true
+		}
+	}
+	return false
+}
+
+/*
+Call `fn` for every entry until it returns false. Buckets do not move
+meanwhile, so every entry present for the whole iteration is seen exactly
+once even when `fn` deletes the current key or adds new ones
+*/
+func (ht *hashTable[V]) Range(fn func(key string, value V) bool) {
+	ht.iterators++
+	defer func() { ht.iterators-- }()
+	for i := range ht.tables {
+		t := &ht.tables[i]
+		for b := 0; b < len(t.buckets); b++ {
+			for e := t.buckets[b]; e != nil; {
+				next := e.next
+				if !fn(e.key, e.value) {
+					return
+				}
+				e = next
+			}
+		}
+	}
+}
+
+/*
+Random key, false when the table is empty. A bucket is picked first then an
+entry of its chain, which is what Redis does too
+*/
+func (ht *hashTable[V]) RandomKey() (string, V, bool) {
+	if ht.Len() == 0 {
+		var zero V
+		return "", zero, false
+	}
+	t0, t1 := &ht.tables[0], &ht.tables[1]
+	for {
+		var e *htEntry[V]
+		if ht.rehashing() {
+			// The buckets of tables[0] before rehashIdx are empty
+			n := len(t0.buckets) - ht.rehashIdx
+			if i := rand.IntN(n + len(t1.buckets)); i < n {
+				e = t0.buckets[ht.rehashIdx+i]
+			} else {
+				e = t1.buckets[i-n]
+			}
+		} else {
+			e = t0.buckets[rand.IntN(len(t0.buckets))]
+		}
+		if e == nil {
+			continue
+		}
+		length := 0
+		for c := e; c != nil; c = c.next {
+			length++
+		}
+		for i := rand.IntN(length); i > 0; i-- {
+			e = e.next
+		}
+		return e.key, e.value, true
+	}
+}
+
+/*
+Up to `n` keys found from a random bucket on, in at most 10*n buckets. Much
+cheaper than `n` calls to RandomKey but not as evenly distributed, it is
+meant for sampling like eviction does
+*/
+func (ht *hashTable[V]) SampleKeys(n int) []string {
+	n = min(n, ht.Len())
+	res := make([]string, 0, n)
+	if n == 0 {
+		return res
+	}
+	mask := ht.mask()
+	cursor := rand.Uint64() & mask
+	for steps := 0; len(res) < n && steps < 10*n; steps++ {
+		for i := range ht.tables {
+			t := &ht.tables[i]
+			if cursor >= uint64(len(t.buckets)) {
+				continue
+			}
+			for e := t.buckets[cursor]; e != nil && len(res) < n; e = e.next {
+				res = append(res, e.key)
+			}
+		}
+		cursor = (cursor + 1) & mask
+	}
+	return res
+}
+
+/*
+Copy sharing no entry with `ht`
+*/
+func (ht *hashTable[V]) clone() *hashTable[V] {
+	res := newHashTableSize[V](ht.Len())
+	t := &res.tables[0]
+	ht.Range(func(key string, value V) bool {
+		h := hashKey(key)
+		t.buckets[h&t.mask()] = &htEntry[V]{key: key, hash: h, value: value, next: t.buckets[h&t.mask()]}
+		t.used++
+		return true
+	})
+	return res
+}
+
+/*
+Call `fn` for the entries of the bucket `cursor` of the largest table, and
+of the buckets of the smaller one mapping to it, then return the next
+cursor, 0 once every bucket was visited
+*/
+func (ht *hashTable[V]) Scan(cursor uint64, fn func(key string, value V)) uint64 {
+	mask := ht.mask()
+	for i := range ht.tables {
+		t := &ht.tables[i]
+		if len(t.buckets) == 0 {
+			break
+		}
+		for e := t.buckets[cursor&t.mask()]; e != nil; e = e.next {
+			if e.hash&mask == cursor&mask {
+				fn(e.key, e.value)
+			}
+		}
+	}
+	return nextCursor(cursor, mask)
+}
+
+/*
+Cursor following `cursor` in a table of `mask`, 0 once every bucket was
+visited. The reversed bits of the cursor are incremented, so that the
+buckets already visited map to buckets already visited when the table
+grows, and at worst are visited twice when it shrinks
+*/
+func nextCursor(cursor uint64, mask uint64) uint64 {
+	cursor |= ^mask
+	cursor = bits.Reverse64(cursor)
+	cursor++
+	return bits.Reverse64(cursor)
+}
@@ -0,0 +1,174 @@
+package datastructure
+
+import (
+	"math"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestHashTable(t *testing.T) {
+	ht := newHashTable[int]()
+	for i := range 1000 {
+		if !ht.Set(strconv.Itoa(i), i) {
+			t.Fatalf("key %d reported as existing", i)
+		}
+		// Every key stays reachable while the buckets move
+		if v, ok := ht.Get(strconv.Itoa(i / 2)); !ok || v != i/2 {
+			t.Fatalf("got %d %v for key %d while rehashing", v, ok, i/2)
+		}
+	}
+	if ht.Set("10", -10) {
+		t.Error("overwrite reported as a new key")
+	}
+	ht.rehashFor(time.Second)
+	if ht.rehashing() || ht.Len() != 1000 || len(ht.tables[0].buckets) != 1024 {
+		t.Errorf("got %d entries in %d buckets, want 1000 in 1024", ht.Len(), len(ht.tables[0].buckets))
+	}
+	if v, ok := ht.Get("10"); !ok || v != -10 {
+		t.Errorf("got %d %v, want -10", v, ok)
+	}
+	for i := range 990 {
+		if _, ok := ht.Delete(strconv.Itoa(i)); !ok {
+			t.Fatalf("key %d not found", i)
+		}
+	}
+	if _, ok := ht.Delete("0"); ok {
+		t.Error("deleted key found again")
+	}
+	// The shrink started by the deletes is followed by another one from
+	// the active rehashing, like the Redis cron does
+	for ht.rehashFor(time.Second) || ht.rehashFor(time.Second) {
+	}
+	if ht.Len() != 10 || len(ht.tables[0].buckets) > 64 {
+		t.Errorf("got %d entries in %d buckets, want 10 in a shrunk table", ht.Len(), len(ht.tables[0].buckets))
+	}
+	for i := 990; i < 1000; i++ {
+		if v, ok := ht.Get(strconv.Itoa(i)); !ok || v != i {
+			t.Errorf("got %d %v for key %d after shrinking", v, ok, i)
+		}
+	}
+}
+
+/*
+Range sees every key once while deleting the current one and adding others,
+which would move buckets if rehashing were not paused
+*/
+func TestHashTableRange(t *testing.T) {
+	ht := newHashTable[int]()
+	for i := range 600 {
+		ht.Set(strconv.Itoa(i), i)
+	}
+	if !ht.rehashing() {
+		t.Fatal("test needs a rehash in progress")
+	}
+	seen := make(map[string]int)
+	ht.Range(func(key string, value int) bool {
+		seen[key]++
+		ht.Delete(key)
+		ht.Set("new"+key, value)
+		return true
+	})
+	for i := range 600 {
+		if n := seen[strconv.Itoa(i)]; n != 1 {
+			t.Errorf("key %d seen %d times", i, n)
+		}
+	}
+	if ht.Len() != 600 {
+		t.Errorf("got %d entries, want 600", ht.Len())
+	}
+}
+
+func TestHashTableSampling(t *testing.T) {
+	ht := newHashTable[int]()
+	if _, _, ok := ht.RandomKey(); ok {
+		t.Error("random key of an empty table")
+	}
+	for i := range 100 {
+		ht.Set(strconv.Itoa(i), i)
+	}
+	picked := make(map[string]bool)
+	for range 1000 {
+		key, value, ok := ht.RandomKey()
+		if !ok || key != strconv.Itoa(value) {
+			t.Fatalf("got %q %d %v", key, value, ok)
+		}
+		picked[key] = true
+	}
+	if len(picked) < 50 {
+		t.Errorf("only %d distinct keys in 1000 draws", len(picked))
+	}
+	keys := ht.SampleKeys(20)
+	if len(keys) != 20 {
+		t.Errorf("got %d sampled keys, want 20", len(keys))
+	}
+	for _, key := range keys {
+		if _, ok := ht.Get(key); !ok {
+			t.Errorf("sampled key %q not in the table", key)
+		}
+	}
+	if n := len(ht.SampleKeys(500)); n != 100 {
+		t.Errorf("got %d sampled keys, want the 100 of the table", n)
+	}
+}
+
+/*
+Every key present during the whole scan is returned, while the keyspace
+grows and shrinks between the steps
+*/
+func TestScanGuarantee(t *testing.T) {
+	s := NewStorage()
+	for i := range 500 {
+		s.Set("s"+strconv.Itoa(i), "v", 0)
+	}
+	for i := range 100 {
+		s.Zadd("z"+strconv.Itoa(i), 0, []ZElement{{Member: "a", Score: 1}})
+	}
+	seen := make(map[string]bool)
+	cursor, steps := uint64(0), 0
+	for {
+		next, keys := s.Scan(cursor, "", 10, "")
+		for _, key := range keys {
+			seen[key] = true
+		}
+		steps++
+		switch steps {
+		case 5:
+			for i := range 3000 {
+				s.Set("g"+strconv.Itoa(i), "v", 0)
+			}
+		case 20:
+			for i := range 3000 {
+				s.Del([]string{"g" + strconv.Itoa(i)})
+			}
+		}
+		if cursor = next; cursor == 0 {
+			break
+		}
+	}
+	for i := range 500 {
+		if !seen["s"+strconv.Itoa(i)] {
+			t.Errorf("string s%d not returned", i)
+		}
+	}
+	for i := range 100 {
+		if !seen["z"+strconv.Itoa(i)] {
+			t.Errorf("zset z%d not returned", i)
+		}
+	}
+
+	_, keys := s.Scan(0, "z1*", 1<<20, "zset")
+	if len(keys) != 11 {
+		t.Errorf("got %d keys matching z1* of type zset, want 11", len(keys))
+	}
+	// A huge COUNT is a budget of buckets, not an allocation
+	if next, keys := s.Scan(0, "", math.MaxInt, ""); next != 0 || len(keys) != 600 {
+		t.Errorf("got %d keys and cursor %d with a huge COUNT, want 600 and 0", len(keys), next)
+	}
+	if _, keys := s.Scan(0, "", 1<<20, "string"); len(keys) != 500 {
+		t.Errorf("got %d strings, want 500", len(keys))
+	}
+	if keys := s.Keys("s4?"); len(keys) != 10 {
+		t.Errorf("got %d keys matching s4?, want 10", len(keys))
+	}
+}
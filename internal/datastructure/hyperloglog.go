@@ -0,0 +1,410 @@
+package datastructure
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+
+	"tcp-server.com/m/internal/config"
+)
+
+/*
+HyperLogLog stored as a Redis compatible string, so GET/SET round-trips and
+values copied from a real Redis both work.
+
+Header (16 bytes): "HYLL", encoding (0 dense, 1 sparse), 3 unused bytes and
+the cached cardinality as 8 bytes little endian, the MSB of the last byte
+marking the cache as stale.
+
+Dense: 16384 registers of 6 bits packed LSB first.
+Sparse: run length opcodes over the registers
+  - ZERO  00xxxxxx          xxxxxx+1 zero registers (1..64)
+  - XZERO 01xxxxxx yyyyyyyy xxxxxxyyyyyyyy+1 zero registers (1..16384)
+  - VAL   1vvvvvxx          xx+1 registers (1..4) of value vvvvv+1 (1..32)
+*/
+const (
+	hllP         = 14
+	hllQ         = 64 - hllP
+	HLLRegisters = 1 << hllP
+	hllBits      = 6
+	hllRegMax    = 1<<hllBits - 1
+	hllHdrSize   = 16
+	hllDenseSize = hllHdrSize + (HLLRegisters*hllBits+7)/8
+	hllMagic     = "HYLL"
+	hllDense     = 0
+	hllSparse    = 1
+	hllAlphaInf  = 0.721347520444481703680
+
+	hllSparseValMax   = 32
+	hllSparseValLen   = 4
+	hllSparseZeroLen  = 64
+	hllSparseXZeroLen = 16384
+)
+
+var (
+	ErrHLLWrongType = errors.New("WRONGTYPE Key is not a valid HyperLogLog string value.")
+	ErrHLLCorrupt   = errors.New("INVALIDOBJ Corrupted HLL object detected")
+)
+
+type hllRegs [HLLRegisters]uint8
+
+type HLL struct {
+	buf []byte
+}
+
+/*
+Empty HyperLogLog, sparse with a single XZERO opcode
+*/
+func NewHLL() *HLL {
+	h := &HLL{buf: make([]byte, hllHdrSize, hllHdrSize+2)}
+	copy(h.buf, hllMagic)
+	h.buf[4] = hllSparse
+	h.buf = append(h.buf, 0x40|byte((HLLRegisters-1)>>8), byte((HLLRegisters-1)&0xff))
+	return h
+}
+
+/*
+Load a HyperLogLog from its string representation, the string is copied
+*/
+func HLLFromString(s string) (*HLL, error) {
+	if len(s) < hllHdrSize || s[:4] != hllMagic {
+		return nil, ErrHLLWrongType
+	}
+	h := &HLL{buf: []byte(s)}
+	switch h.buf[4] {
+	case hllDense:
+		if len(h.buf) != hllDenseSize {
+			return nil, ErrHLLWrongType
+		}
+	case hllSparse:
+		var regs hllRegs
+		if !h.decodeSparse(&regs) {
+			return nil, ErrHLLCorrupt
+		}
+	default:
+		return nil, ErrHLLWrongType
+	}
+	return h, nil
+}
+
+func (h *HLL) String() string {
+	return string(h.buf)
+}
+
+func (h *HLL) isDense() bool {
+	return h.buf[4] == hllDense
+}
+
+/*
+Redis' MurmurHash64A, so the same element lands on the same register
+*/
+func murmurHash64A(key []byte, seed uint64) uint64 {
+	const m = 0xc6a4a7935bd1e995
+	const r = 47
+	h := seed ^ (uint64(len(key)) * m)
+
+	for len(key) >= 8 {
+		k := binary.LittleEndian.Uint64(key)
+		k *= m
+		k ^= k >> r
+		k *= m
+		h ^= k
+		h *= m
+		key = key[8:]
+	}
+	if len(key) > 0 {
+		for i := len(key) - 1; i >= 0; i-- {
+			h ^= uint64(key[i]) << (8 * i)
+		}
+		h *= m
+	}
+
+	h ^= h >> r
+	h *= m
+	h ^= h >> r
+	return h
+}
+
+/*
+Register index of `item` and the length of the 000..1 pattern after it
+*/
+func hllPatLen(item string) (int, uint8) {
+	hash := murmurHash64A([]byte(item), 0xadc83b19)
+	index := int(hash & (HLLRegisters - 1))
+	hash >>= hllP
+	hash |= 1 << hllQ
+	count := uint8(1)
+	for bit := uint64(1); hash&bit == 0; bit <<= 1 {
+		count++
+	}
+	return index, count
+}
+
+func (h *HLL) denseGet(reg int) uint8 {
+	regs := h.buf[hllHdrSize:]
+	b, fb := reg*hllBits/8, uint(reg*hllBits&7)
+	v := uint(regs[b]) >> fb
+	if b+1 < len(regs) {
+		v |= uint(regs[b+1]) << (8 - fb)
+	}
+	return uint8(v & hllRegMax)
+}
+
+func (h *HLL) denseSet(reg int, val uint8) {
+	regs := h.buf[hllHdrSize:]
+	b, fb := reg*hllBits/8, uint(reg*hllBits&7)
+	regs[b] &^= byte(hllRegMax << fb)
+	regs[b] |= byte(uint(val) << fb)
+	if b+1 < len(regs) {
+		regs[b+1] &^= byte(hllRegMax >> (8 - fb))
+		regs[b+1] |= byte(uint(val) >> (8 - fb))
+	}
+}
+
+/*
+Expand the sparse opcodes into `regs`, false when the runs do not cover
+exactly every register
+*/
+func (h *HLL) decodeSparse(regs *hllRegs) bool {
+	idx := 0
+	p := h.buf[hllHdrSize:]
+	for i := 0; i < len(p); i++ {
+		op := p[i]
+		switch {
+		case op&0xc0 == 0x00:
+			idx += int(op&0x3f) + 1
+		case op&0xc0 == 0x40:
+			if i+1 >= len(p) {
+				return false
+			}
+			idx += (int(op&0x3f)<<8 | int(p[i+1])) + 1
+			i++
+		default:
+			val, runLen := (op>>2)&0x1f+1, int(op&0x3)+1
+			if idx+runLen > HLLRegisters {
+				return false
+			}
+			for j := 0; j < runLen; j++ {
+				regs[idx+j] = val
+			}
+			idx += runLen
+		}
+		if idx > HLLRegisters {
+			return false
+		}
+	}
+	return idx == HLLRegisters
+}
+
+func (h *HLL) registers(regs *hllRegs) {
+	if !h.isDense() {
+		h.decodeSparse(regs)
+		return
+	}
+	for i := range regs {
+		regs[i] = h.denseGet(i)
+	}
+}
+
+/*
+Rebuild the sparse opcodes from `regs`, false when a register does not fit
+the VAL opcode or the result exceeds config.HLLSparseMaxBytes
+*/
+func (h *HLL) encodeSparse(regs *hllRegs) bool {
+	out := h.buf[:hllHdrSize:hllHdrSize]
+	for i := 0; i < HLLRegisters; {
+		val, runLen := regs[i], 1
+		for i+runLen < HLLRegisters && regs[i+runLen] == val {
+			runLen++
+		}
+		i += runLen
+
+		if val > hllSparseValMax {
+			return false
+		}
+		for runLen > 0 {
+			switch {
+			case val != 0:
+				n := min(runLen, hllSparseValLen)
+				out = append(out, 0x80|(val-1)<<2|byte(n-1))
+				runLen -= n
+			case runLen > hllSparseZeroLen:
+				n := min(runLen, hllSparseXZeroLen)
+				out = append(out, 0x40|byte((n-1)>>8), byte((n-1)&0xff))
+				runLen -= n
+			default:
+				out = append(out, byte(runLen-1))
+				runLen = 0
+			}
+		}
+		if len(out) > config.HLLSparseMaxBytes {
+			return false
+		}
+	}
+	h.buf = out
+	h.buf[4] = hllSparse
+	return true
+}
+
+func (h *HLL) encodeDense(regs *hllRegs) {
+	buf := make([]byte, hllDenseSize)
+	copy(buf, h.buf[:hllHdrSize])
+	h.buf = buf
+	h.buf[4] = hllDense
+	for i, v := range regs {
+		h.denseSet(i, v)
+	}
+}
+
+/*
+Store `regs`, staying sparse when possible unless the HLL is already dense
+*/
+func (h *HLL) setRegisters(regs *hllRegs) {
+	if h.isDense() || !h.encodeSparse(regs) {
+		h.encodeDense(regs)
+	}
+	h.invalidateCache()
+}
+
+func (h *HLL) invalidateCache() {
+	h.buf[15] |= 0x80
+}
+
+/*
+Add `items`, returns true when at least one register changed
+*/
+func (h *HLL) Add(items ...string) bool {
+	changed := false
+	if h.isDense() {
+		for _, item := range items {
+			reg, count := hllPatLen(item)
+			if count > h.denseGet(reg) {
+				h.denseSet(reg, count)
+				changed = true
+			}
+		}
+		if changed {
+			h.invalidateCache()
+		}
+		return changed
+	}
+
+	var regs hllRegs
+	h.decodeSparse(&regs)
+	for _, item := range items {
+		reg, count := hllPatLen(item)
+		if count > regs[reg] {
+			regs[reg] = count
+			changed = true
+		}
+	}
+	if changed {
+		h.setRegisters(&regs)
+	}
+	return changed
+}
+
+/*
+Fold the registers of `h` into `regs` keeping the maximum of each
+*/
+func (h *HLL) mergeInto(regs *hllRegs) {
+	var other hllRegs
+	h.registers(&other)
+	for i, v := range other {
+		regs[i] = max(regs[i], v)
+	}
+}
+
+/*
+Estimated cardinality, served from the header cache when it is still valid
+*/
+func (h *HLL) Count() uint64 {
+	if h.buf[15]&0x80 == 0 {
+		return binary.LittleEndian.Uint64(h.buf[8:16])
+	}
+	var regs hllRegs
+	h.registers(&regs)
+	card := hllCount(&regs)
+	binary.LittleEndian.PutUint64(h.buf[8:16], card)
+	return card
+}
+
+func hllSigma(x float64) float64 {
+	if x == 1 {
+		return math.Inf(1)
+	}
+	y, z := 1.0, x
+	for {
+		x *= x
+		zPrime := z
+		z += x * y
+		y += y
+		if zPrime == z {
+			return z
+		}
+	}
+}
+
+func hllTau(x float64) float64 {
+	if x == 0 || x == 1 {
+		return 0
+	}
+	y, z := 1.0, 1-x
+	for {
+		x = math.Sqrt(x)
+		zPrime := z
+		y *= 0.5
+		z -= math.Pow(1-x, 2) * y
+		if zPrime == z {
+			return z / 3
+		}
+	}
+}
+
+/*
+Cardinality estimator from Otmar Ertl's "New cardinality estimation
+algorithms for HyperLogLog sketches", as used by Redis
+*/
+func hllCount(regs *hllRegs) uint64 {
+	var histo [hllRegMax + 1]int
+	for _, v := range regs {
+		histo[v]++
+	}
+
+	m := float64(HLLRegisters)
+	z := m * hllTau((m-float64(histo[hllQ+1]))/m)
+	for j := hllQ; j >= 1; j-- {
+		z += float64(histo[j])
+		z *= 0.5
+	}
+	z += m * hllSigma(float64(histo[0])/m)
+	return uint64(math.Round(hllAlphaInf * m * m / z))
+}
+
+/*
+Cardinality of the union of `hlls` without modifying any of them
+*/
+func HLLUnionCount(hlls []*HLL) uint64 {
+	var regs hllRegs
+	for _, h := range hlls {
+		h.mergeInto(&regs)
+	}
+	return hllCount(&regs)
+}
+
+/*
+Merge `srcs` into `h`. The result stays sparse only when every input is
+*/
+func (h *HLL) Merge(srcs []*HLL) {
+	var regs hllRegs
+	h.registers(&regs)
+	dense := h.isDense()
+	for _, src := range srcs {
+		src.mergeInto(&regs)
+		dense = dense || src.isDense()
+	}
+	if dense {
+		h.encodeDense(&regs)
+	}
+	h.setRegisters(&regs)
+}
@@ -0,0 +1,108 @@
+package datastructure
+
+import (
+	"fmt"
+	"math"
+	"testing"
+)
+
+func TestHLLAccuracy(t *testing.T) {
+	for _, n := range []int{10, 1000, 100000} {
+		h := NewHLL()
+		for i := 0; i < n; i++ {
+			h.Add(fmt.Sprintf("item:%d", i))
+		}
+		got := float64(h.Count())
+		// Standard error is 0.81%, allow a few of them
+		if math.Abs(got-float64(n))/float64(n) > 0.03 {
+			t.Errorf("Count() = %v for %d distinct items", got, n)
+		}
+	}
+}
+
+func TestHLLSparseToDense(t *testing.T) {
+	h := NewHLL()
+	if h.isDense() {
+		t.Fatalf("new HLL should be sparse")
+	}
+	h.Add("a", "b", "c")
+	if h.isDense() {
+		t.Fatalf("HLL with 3 items should still be sparse")
+	}
+
+	sparse := h.Count()
+	var regs hllRegs
+	h.registers(&regs)
+	dense := &HLL{buf: append([]byte(nil), h.buf...)}
+	dense.encodeDense(&regs)
+	dense.invalidateCache()
+	if got := dense.Count(); got != sparse {
+		t.Errorf("dense count %d differs from sparse count %d", got, sparse)
+	}
+
+	for i := 0; i < 10000; i++ {
+		h.Add(fmt.Sprintf("item:%d", i))
+	}
+	if !h.isDense() || len(h.buf) != hllDenseSize {
+		t.Errorf("HLL with 10000 items should be dense, got %d bytes", len(h.buf))
+	}
+}
+
+func TestHLLStringRoundTrip(t *testing.T) {
+	h := NewHLL()
+	h.Add("x", "y", "z")
+	loaded, err := HLLFromString(h.String())
+	if err != nil {
+		t.Fatalf("HLLFromString failed: %v", err)
+	}
+	if loaded.Count() != 3 {
+		t.Errorf("Count() after round trip = %d, want 3", loaded.Count())
+	}
+
+	if _, err := HLLFromString("hello"); err != ErrHLLWrongType {
+		t.Errorf("expected ErrHLLWrongType, got %v", err)
+	}
+	corrupt := []byte(h.String())
+	corrupt = corrupt[:len(corrupt)-1]
+	if _, err := HLLFromString(string(corrupt)); err != ErrHLLCorrupt {
+		t.Errorf("expected ErrHLLCorrupt, got %v", err)
+	}
+}
+
+func TestHLLMerge(t *testing.T) {
+	a, b := NewHLL(), NewHLL()
+	for i := 0; i < 5000; i++ {
+		a.Add(fmt.Sprintf("item:%d", i))
+		b.Add(fmt.Sprintf("item:%d", i+2500))
+	}
+
+	union := HLLUnionCount([]*HLL{a, b})
+	a.Merge([]*HLL{b})
+	if got := a.Count(); got != union {
+		t.Errorf("merged count %d differs from union count %d", got, union)
+	}
+	if math.Abs(float64(union)-7500)/7500 > 0.03 {
+		t.Errorf("union count %d, want about 7500", union)
+	}
+}
+
+func TestPFAddGetSet(t *testing.T) {
+	storage := NewStorage()
+	if res, err := storage.PFAdd("hll", []string{"a", "b"}); err != nil || res != 1 {
+		t.Fatalf("PFAdd = %d, %v", res, err)
+	}
+
+	obj, ok := storage.Get("hll")
+	if !ok {
+		t.Fatalf("HyperLogLog not readable with GET")
+	}
+	storage.Set("copy", obj.Value, 0)
+	if res, err := storage.PFCount([]string{"copy"}); err != nil || res != 2 {
+		t.Errorf("PFCount of copied value = %d, %v, want 2", res, err)
+	}
+
+	storage.Set("str", "hello", 0)
+	if _, err := storage.PFAdd("str", []string{"a"}); err != ErrHLLWrongType {
+		t.Errorf("expected ErrHLLWrongType, got %v", err)
+	}
+}
@@ -0,0 +1,410 @@
+package datastructure
+
+import (
+	"errors"
+	"time"
+)
+
+/*
+Values of a database, one map per type
+*/
+type keyspace struct {
+	// Every key with the types it holds, walked by SCAN
+	index     *hashTable[uint16]
+	dict      Dict
+	sortedSet map[string]*ZSet
+	cms       map[string]*CMS
+	bf        map[string]*ScalableBloom
+	cf        map[string]*Cuckoo
+	topk      map[string]*TopK
+	tdigest   map[string]*TDigest
+	tseries   map[string]*TimeSeries
+	streams   map[string]*Stream
+	modules   map[string]*ModuleValue
+}
+
+/*
+Bits of the types a key of the index holds
+*/
+const (
+	typeString uint16 = 1 << iota
+	typeZSet
+	typeCMS
+	typeBloom
+	typeCuckoo
+	typeTopK
+	typeTDigest
+	typeTimeSeries
+	typeStream
+	typeModule
+)
+
+func newKeyspace() keyspace {
+	index := newHashTable[uint16]()
+	return keyspace{
+		index: index,
+		dict: Dict{
+			index:            index,
+			dictStore:        newHashTable[*Obj](),
+			expiredDictStore: newHashTable[uint64](),
+		},
+		sortedSet: make(map[string]*ZSet),
+		cms:       make(map[string]*CMS),
+		bf:        make(map[string]*ScalableBloom),
+		cf:        make(map[string]*Cuckoo),
+		topk:      make(map[string]*TopK),
+		tdigest:   make(map[string]*TDigest),
+		tseries:   make(map[string]*TimeSeries),
+		streams:   make(map[string]*Stream),
+		modules:   make(map[string]*ModuleValue),
+	}
+}
+
+func (ks *keyspace) stat() KeySpaceStat {
+	return KeySpaceStat{Key: int64(ks.index.Len()), Expires: int64(ks.dict.expiredDictStore.Len())}
+}
+
+/*
+Type bit of a value returned by values
+*/
+func valueType(value any) uint16 {
+	switch value.(type) {
+	case *Obj:
+		return typeString
+	case *ZSet:
+		return typeZSet
+	case *CMS:
+		return typeCMS
+	case *ScalableBloom:
+		return typeBloom
+	case *Cuckoo:
+		return typeCuckoo
+	case *TopK:
+		return typeTopK
+	case *TDigest:
+		return typeTDigest
+	case *TimeSeries:
+		return typeTimeSeries
+	case *Stream:
+		return typeStream
+	case *ModuleValue:
+		return typeModule
+	}
+	return 0
+}
+
+func indexAdd(index *hashTable[uint16], key string, typ uint16) {
+	types, _ := index.Get(key)
+	index.Set(key, types|typ)
+}
+
+/*
+Take `typ` off `key`, which leaves the index with its last type
+*/
+func indexRemove(index *hashTable[uint16], key string, typ uint16) {
+	types, ok := index.Get(key)
+	if !ok {
+		return
+	}
+	if types &^= typ; types == 0 {
+		index.Delete(key)
+	} else {
+		index.Set(key, types)
+	}
+}
+
+/*
+Delete `key` from `m`, the map of one type
+*/
+func dropKey[V any](ks *keyspace, m map[string]V, key string) {
+	if v, ok := m[key]; ok {
+		delete(m, key)
+		indexRemove(ks.index, key, valueType(v))
+	}
+}
+
+/*
+Values stored at `key`, each type having its own namespace. Strings come as
+their *Obj
+*/
+func (ks *keyspace) values(key string) []any {
+	res := make([]any, 0, 1)
+	if obj, ok := ks.dict.dictStore.Get(key); ok {
+		res = append(res, obj)
+	}
+	add := func(v any, ok bool) {
+		if ok {
+			res = append(res, v)
+		}
+	}
+	z, ok := ks.sortedSet[key]
+	add(z, ok)
+	c, ok := ks.cms[key]
+	add(c, ok)
+	b, ok := ks.bf[key]
+	add(b, ok)
+	cf, ok := ks.cf[key]
+	add(cf, ok)
+	t, ok := ks.topk[key]
+	add(t, ok)
+	td, ok := ks.tdigest[key]
+	add(td, ok)
+	ts, ok := ks.tseries[key]
+	add(ts, ok)
+	st, ok := ks.streams[key]
+	add(st, ok)
+	mv, ok := ks.modules[key]
+	add(mv, ok)
+	return res
+}
+
+func (ks *keyspace) has(key string) bool {
+	return len(ks.values(key)) > 0
+}
+
+/*
+Remove `key` from every namespace without publishing events, returns the
+values removed
+*/
+func (ks *keyspace) remove(key string) []any {
+	res := ks.values(key)
+	ks.index.Delete(key)
+	ks.dict.dictStore.Delete(key)
+	ks.dict.expiredDictStore.Delete(key)
+	delete(ks.sortedSet, key)
+	delete(ks.cms, key)
+	delete(ks.bf, key)
+	delete(ks.cf, key)
+	delete(ks.topk, key)
+	delete(ks.tdigest, key)
+	delete(ks.tseries, key)
+	delete(ks.streams, key)
+	delete(ks.modules, key)
+	return res
+}
+
+/*
+Store `value`, as returned by values, at `key`. `expire` only applies to
+strings
+*/
+func (ks *keyspace) put(key string, value any, expire uint64) {
+	indexAdd(ks.index, key, valueType(value))
+	value.(tracked).stats().init(time.Now())
+	switch v := value.(type) {
+	case *Obj:
+		ks.dict.dictStore.Set(key, v)
+		if expire != 0 {
+			ks.dict.expiredDictStore.Set(key, expire)
+		}
+	case *ZSet:
+		ks.sortedSet[key] = v
+	case *CMS:
+		ks.cms[key] = v
+	case *ScalableBloom:
+		ks.bf[key] = v
+	case *Cuckoo:
+		ks.cf[key] = v
+	case *TopK:
+		ks.topk[key] = v
+	case *TDigest:
+		ks.tdigest[key] = v
+	case *TimeSeries:
+		ks.tseries[key] = v
+	case *Stream:
+		ks.streams[key] = v
+	case *ModuleValue:
+		ks.modules[key] = v
+	}
+}
+
+/*
+Release the values, module ones through their Free callback
+*/
+func (ks *keyspace) free() {
+	for _, mv := range ks.modules {
+		mv.Type.Free(mv.Value)
+	}
+}
+
+/*
+Deep copy of a value returned by values
+*/
+func cloneValue(value any) (any, error) {
+	switch v := value.(type) {
+	case *Obj:
+		// Strings are immutable
+		return &Obj{Value: v.Value}, nil
+	case *ZSet:
+		return v.clone(), nil
+	case *CMS:
+		return v.clone(), nil
+	case *ScalableBloom:
+		return v.clone(), nil
+	case *Cuckoo:
+		return v.clone(), nil
+	case *TopK:
+		return v.clone(), nil
+	case *TDigest:
+		return v.clone(), nil
+	case *TimeSeries:
+		return v.clone(), nil
+	case *Stream:
+		return v.clone(), nil
+	case *ModuleValue:
+		return v.clone()
+	}
+	return nil, errors.New("value cannot be copied")
+}
+
+/*
+Lock `a` and `b` in database order, so that two commands using the same
+pair cannot deadlock. Returns the unlock function
+*/
+func lockPair(a *Storage, b *Storage) func() {
+	if a == b {
+		a.mu.Lock()
+		return a.mu.Unlock
+	}
+	if a.id > b.id {
+		a, b = b, a
+	}
+	a.mu.Lock()
+	b.mu.Lock()
+	return func() {
+		b.mu.Unlock()
+		a.mu.Unlock()
+	}
+}
+
+/*
+Invalidate the transactions watching a key present in any of `spaces`,
+called when they are flushed or swapped
+*/
+func (s *Storage) touchWatched(spaces ...*keyspace) {
+	for key, w := range s.watched {
+		for _, ks := range spaces {
+			if ks.has(key) {
+				w.version++
+				break
+			}
+		}
+	}
+}
+
+/*
+Number of keys and of keys with an expiry
+*/
+func (s *Storage) KeySpace() KeySpaceStat {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.stat()
+}
+
+/*
+Delete every key. Module values are freed once the lock is released
+*/
+func (s *Storage) Flush() {
+	s.mu.Lock()
+	old := s.keyspace
+	s.keyspace = newKeyspace()
+	s.dict.modified = s.notify
+	s.touchWatched(&old)
+	s.dirty.Add(uint64(old.stat().Key))
+	s.mu.Unlock()
+	old.free()
+}
+
+/*
+Exchange the keys of two databases. Clients connected to one database see
+the keys of the other from now on
+*/
+func (s *Storage) Swap(other *Storage) {
+	unlock := lockPair(s, other)
+	defer unlock()
+	if s == other {
+		return
+	}
+	s.touchWatched(&s.keyspace, &other.keyspace)
+	other.touchWatched(&s.keyspace, &other.keyspace)
+	s.keyspace, other.keyspace = other.keyspace, s.keyspace
+	s.dict.modified = s.notify
+	other.dict.modified = other.notify
+	s.dirty.Add(1)
+	// Clients blocked on a stream check again against the new keys
+	for _, st := range []*Storage{s, other} {
+		for key := range st.streamWaiters {
+			st.signalStream(key)
+		}
+	}
+}
+
+/*
+Live values at `key`, an expired string is deleted on the way
+*/
+func (s *Storage) liveValues(key string) []any {
+	s.dict.expireIfNeeded(key, uint64(time.Now().UnixMilli()))
+	return s.values(key)
+}
+
+/*
+Add `values` at `key` of `s`, which has none left, and publish `event`
+*/
+func (s *Storage) addValues(key string, values []any, expire uint64, event string, created bool) {
+	for _, v := range values {
+		s.put(key, v, expire)
+		if _, ok := v.(*Stream); ok {
+			s.signalStream(key)
+		}
+	}
+	if created {
+		s.notify(NotifyNew, "new", key)
+	}
+	s.notify(NotifyGeneric, event, key)
+}
+
+/*
+Move `key` with its expiry to `dst`. False when it does not exist or `dst`
+already has it
+*/
+func (s *Storage) Move(key string, dst *Storage) bool {
+	unlock := lockPair(s, dst)
+	defer unlock()
+	if s == dst || len(s.liveValues(key)) == 0 || len(dst.liveValues(key)) > 0 {
+		return false
+	}
+	expire, _ := s.dict.expiredDictStore.Get(key)
+	values := s.remove(key)
+	s.notify(NotifyGeneric, "move_from", key)
+	dst.addValues(key, values, expire, "move_to", true)
+	return true
+}
+
+/*
+Copy the value at `src` to `dstKey` of `dst`, which may be `s`, with its
+expiry. False when `src` does not exist or `dstKey` does and `replace` is
+not set
+*/
+func (s *Storage) Copy(src string, dst *Storage, dstKey string, replace bool) (bool, error) {
+	unlock := lockPair(s, dst)
+	defer unlock()
+	values := s.liveValues(src)
+	if len(values) == 0 {
+		return false, nil
+	}
+	existed := len(dst.liveValues(dstKey)) > 0
+	if existed && !replace {
+		return false, nil
+	}
+	copies := make([]any, len(values))
+	for i, v := range values {
+		c, err := cloneValue(v)
+		if err != nil {
+			return false, err
+		}
+		copies[i] = c
+	}
+	expire, _ := s.dict.expiredDictStore.Get(src)
+	releaseValues(dst.remove(dstKey))
+	dst.addValues(dstKey, copies, expire, "copy_to", !existed)
+	return true, nil
+}
@@ -0,0 +1,95 @@
+package datastructure
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMoveAndCopy(t *testing.T) {
+	dbs := NewDatabases(2)
+	src, dst := dbs[0], dbs[1]
+	src.Set("k", "v", 0)
+	if _, err := src.Zadd("z", 0, []ZElement{{Member: "a", Score: 1}}); err != nil {
+		t.Fatal(err)
+	}
+
+	if !src.Move("k", dst) {
+		t.Fatal("move of an existing key failed")
+	}
+	if _, ok := src.Get("k"); ok {
+		t.Error("moved key still in the source database")
+	}
+	if obj, ok := dst.Get("k"); !ok || obj.Value != "v" {
+		t.Errorf("got %v %v in the destination, want v", obj.Value, ok)
+	}
+	src.Set("k", "other", 0)
+	if src.Move("k", dst) {
+		t.Error("move over an existing key succeeded")
+	}
+
+	if ok, _ := src.Copy("z", dst, "z", false); !ok {
+		t.Fatal("copy of an existing key failed")
+	}
+	src.Zrem("z", []string{"a"})
+	if got := dst.Zcard("z"); got != 1 {
+		t.Errorf("copy shares its value with the source, got card %d", got)
+	}
+	if ok, _ := src.Copy("k", dst, "k", false); ok {
+		t.Error("copy over an existing key succeeded without REPLACE")
+	}
+	if ok, _ := src.Copy("k", dst, "k", true); !ok {
+		t.Error("copy with REPLACE failed")
+	}
+	if obj, _ := dst.Get("k"); obj.Value != "other" {
+		t.Errorf("got %v after REPLACE, want other", obj.Value)
+	}
+}
+
+func TestSwapAndFlush(t *testing.T) {
+	dbs := NewDatabases(2)
+	dbs[0].Set("a", "1", 0)
+	versions := dbs[0].Watch([]string{"a"})
+
+	dbs[0].Swap(dbs[1])
+	if _, ok := dbs[1].Get("a"); !ok {
+		t.Fatal("key not swapped")
+	}
+	if dbs[0].KeySpace().Key != 0 {
+		t.Error("swapped database still has keys")
+	}
+	if !dbs[0].WatchedChanged(map[string]uint64{"a": versions[0]}) {
+		t.Error("swap did not touch the watched key")
+	}
+
+	dbs[1].Flush()
+	if dbs[1].KeySpace().Key != 0 {
+		t.Error("flushed database still has keys")
+	}
+}
+
+/*
+The key index follows every way a key comes and goes
+*/
+func TestKeyIndex(t *testing.T) {
+	dbs := NewDatabases(2)
+	s := dbs[0]
+	s.Set("a", "1", 0)
+	s.Set("b", "2", uint64(time.Now().Add(-time.Second).UnixMilli()))
+	s.Zadd("a", 0, []ZElement{{Member: "x", Score: 1}})
+	s.Zadd("z", 0, []ZElement{{Member: "x", Score: 1}})
+	s.Zrem("z", []string{"x"})
+	s.Rename("a", "c", false)
+	s.Move("c", dbs[1])
+	s.Get("b")
+
+	if n := s.index.Len(); n != 0 {
+		t.Errorf("got %d keys indexed, want 0", n)
+	}
+	if types, _ := dbs[1].index.Get("c"); types != typeString|typeZSet {
+		t.Errorf("got types %b for c, want a string and a zset", types)
+	}
+	dbs[1].Del([]string{"c"})
+	if n := dbs[1].index.Len(); n != 0 {
+		t.Errorf("got %d keys indexed after DEL, want 0", n)
+	}
+}
@@ -0,0 +1,153 @@
+package datastructure
+
+import (
+	"encoding/binary"
+	"math"
+	"slices"
+	"sort"
+)
+
+/*
+Compact encoding for small zsets: every `member score` pair is packed back
+to back into one byte slice, ordered by (score, member)
+
+	entry: uvarint(len(member)) | member | 8 bytes big endian float64 score
+
+Lookups are linear scans, which beats pointer chasing for a handful of
+entries and costs no per-element allocation
+*/
+type listpack struct {
+	buf []byte
+	n   int
+}
+
+func newListpack() *listpack {
+	return &listpack{}
+}
+
+/*
+Decode the entry starting at `pos`, also returning where the next one starts
+*/
+func (lp *listpack) entry(pos int) (ZElement, int) {
+	size, w := binary.Uvarint(lp.buf[pos:])
+	pos += w
+	ele := string(lp.buf[pos : pos+int(size)])
+	pos += int(size)
+	score := math.Float64frombits(binary.BigEndian.Uint64(lp.buf[pos:]))
+	return ZElement{Member: ele, Score: score}, pos + 8
+}
+
+func appendEntry(buf []byte, ele string, score float64) []byte {
+	buf = binary.AppendUvarint(buf, uint64(len(ele)))
+	buf = append(buf, ele...)
+	return binary.BigEndian.AppendUint64(buf, math.Float64bits(score))
+}
+
+/*
+Position of the entry for `ele`, its index and score
+*/
+func (lp *listpack) find(ele string) (int, int, float64, bool) {
+	for pos, i := 0, 0; pos < len(lp.buf); i++ {
+		e, next := lp.entry(pos)
+		if e.Member == ele {
+			return pos, i, e.Score, true
+		}
+		pos = next
+	}
+	return 0, 0, 0, false
+}
+
+func (lp *listpack) deleteAt(pos int) {
+	_, next := lp.entry(pos)
+	lp.buf = slices.Delete(lp.buf, pos, next)
+	lp.n--
+}
+
+/*
+Insert a member that is not in the listpack yet at its ordered position
+*/
+func (lp *listpack) insert(ele string, score float64) {
+	pos := 0
+	for pos < len(lp.buf) {
+		e, next := lp.entry(pos)
+		if e.Score > score || (e.Score == score && e.Member > ele) {
+			break
+		}
+		pos = next
+	}
+	lp.buf = slices.Insert(lp.buf, pos, appendEntry(nil, ele, score)...)
+	lp.n++
+}
+
+func (lp *listpack) elements() []ZElement {
+	res := make([]ZElement, 0, lp.n)
+	for pos := 0; pos < len(lp.buf); {
+		var e ZElement
+		e, pos = lp.entry(pos)
+		res = append(res, e)
+	}
+	return res
+}
+
+func listpackFromSorted(elements []ZElement) *listpack {
+	lp := newListpack()
+	for _, e := range elements {
+		lp.buf = appendEntry(lp.buf, e.Member, e.Score)
+	}
+	lp.n = len(elements)
+	return lp
+}
+
+/*
+Index bounds [first, last] of the elements of sorted `elements` inside `r`
+*/
+func sortedBounds(elements []ZElement, r zrange) (int, int, bool) {
+	if r.isEmpty() {
+		return 0, 0, false
+	}
+	first := sort.Search(len(elements), func(i int) bool {
+		return r.gteMin(elements[i].Score, elements[i].Member)
+	})
+	last := sort.Search(len(elements), func(i int) bool {
+		return !r.lteMax(elements[i].Score, elements[i].Member)
+	}) - 1
+	return first, last, first <= last
+}
+
+/*
+ZRANGE over elements sorted by (score, member)
+*/
+func rangeSorted(elements []ZElement, spec *ZRangeSpec) []ZElement {
+	var res []ZElement
+	if spec.By == ZRangeByRank {
+		start, stop, ok := normalizeRange(spec.Start, spec.Stop, len(elements))
+		if !ok {
+			return []ZElement{}
+		}
+		if spec.Rev {
+			start, stop = len(elements)-1-stop, len(elements)-1-start
+		}
+		res = slices.Clone(elements[start : stop+1])
+		if spec.Rev {
+			slices.Reverse(res)
+		}
+		return res
+	}
+
+	first, last, ok := sortedBounds(elements, spec.zrange())
+	if !ok || spec.Offset < 0 {
+		return []ZElement{}
+	}
+	res = slices.Clone(elements[first : last+1])
+	if spec.Rev {
+		slices.Reverse(res)
+	}
+	if spec.Offset >= len(res) {
+		return []ZElement{}
+	}
+	res = res[spec.Offset:]
+	if spec.Count >= 0 && spec.Count < len(res) {
+		res = res[:spec.Count]
+	}
+	return res
+}
@@ -0,0 +1,84 @@
+package datastructure
+
+/*
+Data type registered by a module, implemented by the public module package
+*/
+type ModuleType interface {
+	TypeName() string
+	// Serialize a value and build it back, used to persist and copy keys
+	Save(value any) ([]byte, error)
+	Load(data []byte) (any, error)
+	// Release the resources of a value deleted or overwritten
+	Free(value any)
+}
+
+type ModuleValue struct {
+	Type  ModuleType
+	Value any
+	access
+}
+
+/*
+Copy made through the persistence callbacks
+*/
+func (mv *ModuleValue) clone() (*ModuleValue, error) {
+	data, err := mv.Type.Save(mv.Value)
+	if err != nil {
+		return nil, err
+	}
+	value, err := mv.Type.Load(data)
+	if err != nil {
+		return nil, err
+	}
+	return &ModuleValue{Type: mv.Type, Value: value}, nil
+}
+
+func (s *Storage) ModuleGet(key string) (*ModuleValue, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return lookup(s.modules, key)
+}
+
+/*
+Store `value` at `key` and publish `event`, a value already there is freed
+*/
+func (s *Storage) ModuleSet(key string, t ModuleType, value any, event string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	old, ok := lookup(s.modules, key)
+	mv := &ModuleValue{Type: t, Value: value}
+	if ok {
+		mv.access = old.access
+	}
+	s.put(key, mv, 0)
+	if ok {
+		if old.Value != value {
+			old.Type.Free(old.Value)
+		}
+	} else {
+		s.notify(NotifyNew, "new", key)
+	}
+	s.notify(NotifyModule, event, key)
+}
+
+func (s *Storage) ModuleDel(key string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	mv, ok := s.modules[key]
+	if !ok {
+		return false
+	}
+	dropKey(&s.keyspace, s.modules, key)
+	mv.Type.Free(mv.Value)
+	s.notify(NotifyGeneric, "del", key)
+	return true
+}
+
+/*
+Publish `event` for `key`, for modules changing a value in place
+*/
+func (s *Storage) ModuleNotify(event string, key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.notify(NotifyModule, event, key)
+}
@@ -0,0 +1,130 @@
+package datastructure
+
+import (
+	"strconv"
+	"strings"
+	"sync/atomic"
+)
+
+/*
+Event classes of notify-keyspace-events. K and E select the channels, the
+others the events published on them: nothing is sent unless at least one of
+each group is enabled
+*/
+const (
+	NotifyKeyspace = 1 << iota // K
+	NotifyKeyevent             // E
+	NotifyGeneric              // g
+	NotifyString               // $
+	NotifyList                 // l
+	NotifySet                  // s
+	NotifyHash                 // h
+	NotifyZset                 // z
+	NotifyExpired              // x
+	NotifyEvicted              // e
+	NotifyStream               // t
+	NotifyKeyMiss              // m
+	NotifyModule               // d
+	NotifyNew                  // n
+
+	// A, key miss and new key events are left out like in Redis
+	NotifyAll = NotifyGeneric | NotifyString | NotifyList | NotifySet | NotifyHash |
+		NotifyZset | NotifyExpired | NotifyEvicted | NotifyStream | NotifyModule
+)
+
+/*
+Flag characters in the order Redis prints them back
+*/
+var notifyClasses = []struct {
+	flag int
+	char byte
+}{
+	{NotifyGeneric, 'g'},
+	{NotifyString, '$'},
+	{NotifyList, 'l'},
+	{NotifySet, 's'},
+	{NotifyHash, 'h'},
+	{NotifyZset, 'z'},
+	{NotifyExpired, 'x'},
+	{NotifyEvicted, 'e'},
+	{NotifyStream, 't'},
+	{NotifyModule, 'd'},
+	{NotifyKeyspace, 'K'},
+	{NotifyKeyevent, 'E'},
+	{NotifyKeyMiss, 'm'},
+	{NotifyNew, 'n'},
+}
+
+/*
+Parse a notify-keyspace-events value, false on an unknown class character
+*/
+func ParseNotifyFlags(s string) (int, bool) {
+	flags := 0
+	for i := 0; i < len(s); i++ {
+		if s[i] == 'A' {
+			flags |= NotifyAll
+			continue
+		}
+		found := false
+		for _, c := range notifyClasses {
+			if c.char == s[i] {
+				flags |= c.flag
+				found = true
+				break
+			}
+		}
+		if !found {
+			return 0, false
+		}
+	}
+	return flags, true
+}
+
+/*
+Canonical notify-keyspace-events value of `flags`, as CONFIG GET shows it
+*/
+func NotifyFlagsString(flags int) string {
+	var sb strings.Builder
+	if flags&NotifyAll == NotifyAll {
+		sb.WriteByte('A')
+	}
+	for _, c := range notifyClasses {
+		if c.flag&NotifyAll != 0 && flags&NotifyAll == NotifyAll {
+			continue
+		}
+		if flags&c.flag != 0 {
+			sb.WriteByte(c.char)
+		}
+	}
+	return sb.String()
+}
+
+/*
+Destination of keyspace events, satisfied by the Pub/Sub broker
+*/
+type Publisher interface {
+	Publish(channel string, message string) int
+}
+
+type notifier struct {
+	pub   Publisher
+	flags atomic.Int64
+}
+
+/*
+Publish `event` on `key` of database `db` to `__keyspace@<db>__:<key>` and
+the key name to `__keyevent@<db>__:<event>`, depending on the enabled
+classes
+*/
+func (n *notifier) notify(db int, class int, event string, key string) {
+	flags := int(n.flags.Load())
+	if n.pub == nil || flags&class == 0 {
+		return
+	}
+	if flags&NotifyKeyspace != 0 {
+		n.pub.Publish("__keyspace@"+strconv.Itoa(db)+"__:"+key, event)
+	}
+	if flags&NotifyKeyevent != 0 {
+		n.pub.Publish("__keyevent@"+strconv.Itoa(db)+"__:"+event, key)
+	}
+}
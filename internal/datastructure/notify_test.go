@@ -0,0 +1,127 @@
+package datastructure
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+type recordingPublisher struct {
+	messages []string
+}
+
+func (p *recordingPublisher) Publish(channel string, message string) int {
+	p.messages = append(p.messages, channel+" "+message)
+	return 0
+}
+
+func newNotifyingStorage(t *testing.T, flags string) (*Storage, *recordingPublisher) {
+	parsed, ok := ParseNotifyFlags(flags)
+	if !ok {
+		t.Fatalf("cannot parse %q", flags)
+	}
+	s := NewStorage()
+	pub := &recordingPublisher{}
+	s.SetPublisher(pub)
+	s.SetNotifyFlags(parsed)
+	return s, pub
+}
+
+func TestNotifyFlags(t *testing.T) {
+	cases := map[string]string{
+		"":            "",
+		"KEA":         "AKE",
+		"Ex":          "xE",
+		"Kg$zxm":      "g$zxKm",
+		"AKEmn":       "AKEmn",
+		"g$lshzxetdK": "AK",
+	}
+	for in, want := range cases {
+		flags, ok := ParseNotifyFlags(in)
+		if !ok {
+			t.Fatalf("cannot parse %q", in)
+		}
+		if got := NotifyFlagsString(flags); got != want {
+			t.Fatalf("flags %q printed as %q, want %q", in, got, want)
+		}
+	}
+	if _, ok := ParseNotifyFlags("KEq"); ok {
+		t.Fatalf("unknown class character accepted")
+	}
+}
+
+func TestNotifyKeyspaceEvents(t *testing.T) {
+	s, pub := newNotifyingStorage(t, "KEA")
+	s.Set("k", "v", 0)
+	s.Del([]string{"k", "missing"})
+	s.Zadd("z", 0, []ZElement{{Member: "a", Score: 1}})
+	s.Zadd("z", ZaddNX, []ZElement{{Member: "a", Score: 2}})
+	s.Zrem("z", []string{"a"})
+	want := []string{
+		"__keyspace@0__:k set", "__keyevent@0__:set k",
+		"__keyspace@0__:k del", "__keyevent@0__:del k",
+		"__keyspace@0__:z zadd", "__keyevent@0__:zadd z",
+		"__keyspace@0__:z zrem", "__keyevent@0__:zrem z",
+		"__keyspace@0__:z del", "__keyevent@0__:del z",
+	}
+	if !slices.Equal(pub.messages, want) {
+		t.Fatalf("published %q, want %q", pub.messages, want)
+	}
+}
+
+func TestNotifyClassFilter(t *testing.T) {
+	s, pub := newNotifyingStorage(t, "Ez")
+	s.Set("k", "v", 0)
+	s.Zadd("z", 0, []ZElement{{Member: "a", Score: 1}})
+	s.BFAdd("bf", []string{"x"})
+	if want := []string{"__keyevent@0__:zadd z"}; !slices.Equal(pub.messages, want) {
+		t.Fatalf("published %q, want %q", pub.messages, want)
+	}
+
+	s.SetNotifyFlags(0)
+	s.Zadd("z", 0, []ZElement{{Member: "b", Score: 1}})
+	if len(pub.messages) != 1 {
+		t.Fatalf("published %q with notifications disabled", pub.messages)
+	}
+}
+
+func TestNotifyExpired(t *testing.T) {
+	s, pub := newNotifyingStorage(t, "Kx")
+	past := uint64(time.Now().Add(-time.Second).UnixMilli())
+	s.Set("lazy", "v", past)
+	s.Set("active", "v", past)
+	if _, ok := s.Get("lazy"); ok {
+		t.Fatalf("expired key returned")
+	}
+	if n := s.ActiveExpireCycle(); n != 1 {
+		t.Fatalf("active expiry removed %d keys", n)
+	}
+	want := []string{"__keyspace@0__:lazy expired", "__keyspace@0__:active expired"}
+	if !slices.Equal(pub.messages, want) {
+		t.Fatalf("published %q, want %q", pub.messages, want)
+	}
+}
+
+func TestWatchVersions(t *testing.T) {
+	s := NewStorage()
+	s.Set("k", "v", 0)
+	versions := s.Watch([]string{"k", "z"})
+	watched := map[string]uint64{"k": versions[0], "z": versions[1]}
+	if s.WatchedChanged(watched) {
+		t.Fatalf("untouched keys reported as changed")
+	}
+	s.Get("k")
+	s.Zadd("other", 0, []ZElement{{Member: "a", Score: 1}})
+	if s.WatchedChanged(watched) {
+		t.Fatalf("reads and writes to other keys reported as changes")
+	}
+	s.Zadd("z", 0, []ZElement{{Member: "a", Score: 1}})
+	if !s.WatchedChanged(watched) {
+		t.Fatalf("ZADD on a watched key not detected")
+	}
+
+	s.Unwatch([]string{"k", "z"})
+	if len(s.watched) != 0 {
+		t.Fatalf("%d keys still watched", len(s.watched))
+	}
+}
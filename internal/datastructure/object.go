@@ -0,0 +1,247 @@
+package datastructure
+
+import (
+	"errors"
+	"math/rand/v2"
+	"sync/atomic"
+	"time"
+
+	"tcp-server.com/m/internal/config"
+)
+
+var ErrNoSuchKey = errors.New("ERR no such key")
+
+// Counter of a new value, so that it is not evicted before getting a chance
+// to be accessed again
+const lfuInitVal = 5
+
+/*
+Access statistics every value embeds, the LRU clock and the LFU counter
+Redis keeps in its object header. Lookups record accesses under the read
+lock, so the fields are only used atomically
+*/
+type access struct {
+	// Unix milliseconds of the last access, 0 until the value is stored
+	accessed int64
+	// Logarithmic access counter of the LFU policies in the low 8 bits, Unix
+	// minutes of its last update above, to decay it
+	lfu int64
+}
+
+func (a *access) stats() *access {
+	return a
+}
+
+/*
+Implemented by every value through its embedded access
+*/
+type tracked interface {
+	stats() *access
+}
+
+/*
+Value of `key` in `m`, which counts as an access like the lookups of Redis
+commands. Paths looking at a key for another reason read the map directly
+*/
+func lookup[V tracked](m map[string]V, key string) (V, bool) {
+	v, ok := m[key]
+	if ok {
+		v.stats().touch(time.Now())
+	}
+	return v, ok
+}
+
+/*
+Start the statistics of a new value, unless it is moved with its own
+*/
+func (a *access) init(now time.Time) {
+	if atomic.LoadInt64(&a.accessed) == 0 {
+		a.store(now, lfuInitVal)
+	}
+}
+
+func (a *access) touch(now time.Time) {
+	freq := a.decayedFreq(now)
+	if freq < 255 {
+		base := max(float64(freq)-lfuInitVal, 0)
+		if rand.Float64() < 1/(base*float64(config.LFULogFactor)+1) {
+			freq++
+		}
+	}
+	a.store(now, freq)
+}
+
+func (a *access) store(now time.Time, freq uint8) {
+	atomic.StoreInt64(&a.lfu, now.Unix()/60<<8|int64(freq))
+	atomic.StoreInt64(&a.accessed, now.UnixMilli())
+}
+
+/*
+Counter minus one for every LFUDecayTime minutes since its last update
+*/
+func (a *access) decayedFreq(now time.Time) uint8 {
+	lfu := atomic.LoadInt64(&a.lfu)
+	freq := uint8(lfu)
+	if config.LFUDecayTime <= 0 {
+		return freq
+	}
+	periods := (now.Unix()/60 - lfu>>8) / int64(config.LFUDecayTime)
+	if periods >= int64(freq) {
+		return 0
+	}
+	return freq - uint8(periods)
+}
+
+/*
+What OBJECT reports about a key
+*/
+type ObjectInfo struct {
+	Encoding string
+	// Seconds since the last access
+	IdleTime int64
+	// Values are never shared between keys
+	RefCount int
+	Freq     int
+}
+
+/*
+Internal encoding of a value returned by values. Like Redis, the types of
+the Redis Stack modules report raw and streams stream
+*/
+func encoding(value any) string {
+	switch v := value.(type) {
+	case *Obj:
+		return stringEncoding(v.Value)
+	case *ZSet:
+		return v.Encoding()
+	case *Stream:
+		return "stream"
+	case *ModuleValue:
+		return v.Type.TypeName()
+	}
+	return "raw"
+}
+
+/*
+OBJECT ENCODING, IDLETIME, REFCOUNT and FREQ of `key`, false when it does
+not exist. Looking does not count as an access
+*/
+func (s *Storage) Object(key string) (ObjectInfo, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	values := s.liveValues(key)
+	if len(values) == 0 {
+		return ObjectInfo{}, false
+	}
+	now := time.Now()
+	a := values[0].(tracked).stats()
+	return ObjectInfo{
+		Encoding: encoding(values[0]),
+		IdleTime: max(now.UnixMilli()-atomic.LoadInt64(&a.accessed), 0) / 1000,
+		RefCount: 1,
+		Freq:     int(a.decayedFreq(now)),
+	}, true
+}
+
+/*
+Record an access to each of `keys`, returns the number of keys existing
+*/
+func (s *Storage) Touch(keys []string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	cnt := 0
+	for _, key := range keys {
+		values := s.liveValues(key)
+		for _, v := range values {
+			v.(tracked).stats().touch(now)
+		}
+		if len(values) > 0 {
+			cnt++
+		}
+	}
+	return cnt
+}
+
+/*
+Random live key, false when the database is empty. Keys of every type are
+picked from the key index
+*/
+func (s *Storage) RandomKey() (string, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := uint64(time.Now().UnixMilli())
+	for {
+		key, _, ok := s.index.RandomKey()
+		if !ok {
+			return "", false
+		}
+		// Every round either returns or deletes an expired key
+		if !s.dict.expireIfNeeded(key, now) || s.has(key) {
+			return key, true
+		}
+	}
+}
+
+/*
+Give `newKey` the values and expiry of `key`, replacing the ones it has
+unless `nx` is set. False when `nx` is set and `newKey` exists
+*/
+func (s *Storage) Rename(key string, newKey string, nx bool) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	values := s.liveValues(key)
+	if len(values) == 0 {
+		return false, ErrNoSuchKey
+	}
+	if key == newKey {
+		return !nx, nil
+	}
+	existed := len(s.liveValues(newKey)) > 0
+	if existed {
+		if nx {
+			return false, nil
+		}
+		releaseValues(s.remove(newKey))
+	}
+	expire, _ := s.dict.expiredDictStore.Get(key)
+	s.remove(key)
+	s.notify(NotifyGeneric, "rename_from", key)
+	s.addValues(newKey, values, expire, "rename_to", !existed)
+	return true, nil
+}
+
+/*
+Delete `keys` of any type, returns the number deleted. Module values are
+freed once the lock of the database is released, still by the command so
+that no module command runs meanwhile
+*/
+func (s *Storage) Delete(keys []string) int {
+	s.mu.Lock()
+	cnt := 0
+	var removed []any
+	for _, key := range keys {
+		if len(s.liveValues(key)) == 0 {
+			continue
+		}
+		removed = append(removed, s.remove(key)...)
+		s.notify(NotifyGeneric, "del", key)
+		cnt++
+	}
+	s.mu.Unlock()
+	releaseValues(removed)
+	return cnt
+}
+
+/*
+Release values removed from the keyspace. Go values only need to be dropped
+for the garbage collector to reclaim them, what is left is the Free callback
+of module values, which can take a while
+*/
+func releaseValues(values []any) {
+	for _, v := range values {
+		if mv, ok := v.(*ModuleValue); ok {
+			mv.Type.Free(mv.Value)
+		}
+	}
+}
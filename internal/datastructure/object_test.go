@@ -0,0 +1,121 @@
+package datastructure
+
+import (
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+/*
+Module type recording the values freed
+*/
+type freeRecorder struct {
+	freed chan any
+}
+
+func (f *freeRecorder) TypeName() string               { return "recorder" }
+func (f *freeRecorder) Save(value any) ([]byte, error) { return []byte(value.(string)), nil }
+func (f *freeRecorder) Load(data []byte) (any, error)  { return string(data), nil }
+func (f *freeRecorder) Free(value any)                 { f.freed <- value }
+
+func TestRename(t *testing.T) {
+	s := NewStorage()
+	expire := uint64(time.Now().Add(time.Hour).UnixMilli())
+	s.Set("a", "1", expire)
+	s.Set("b", "2", 0)
+
+	if _, err := s.Rename("missing", "x", false); err != ErrNoSuchKey {
+		t.Errorf("got %v renaming a missing key, want ErrNoSuchKey", err)
+	}
+	if ok, _ := s.Rename("a", "b", true); ok {
+		t.Error("RENAMENX overwrote an existing key")
+	}
+	if ok, err := s.Rename("a", "b", false); !ok || err != nil {
+		t.Fatalf("got %v %v renaming a to b", ok, err)
+	}
+	if _, ok := s.Get("a"); ok {
+		t.Error("renamed key still exists")
+	}
+	if obj, _ := s.Get("b"); obj.Value != "1" {
+		t.Errorf("got %v at b, want 1", obj.Value)
+	}
+	if ttl, ok := s.Ttl("b"); !ok || ttl != expire {
+		t.Errorf("got TTL %d %v, want %d", ttl, ok, expire)
+	}
+}
+
+func TestUnlinkFreesModuleValues(t *testing.T) {
+	s := NewStorage()
+	rec := &freeRecorder{freed: make(chan any, 1)}
+	s.ModuleSet("m", rec, "value", "set")
+	s.Set("s", "v", 0)
+
+	if n := s.Delete([]string{"m", "s", "missing"}); n != 2 {
+		t.Errorf("got %d keys deleted, want 2", n)
+	}
+	// Freed by the command itself, not in the background
+	select {
+	case v := <-rec.freed:
+		if v != "value" {
+			t.Errorf("got %v freed, want value", v)
+		}
+	default:
+		t.Fatal("module value not freed by UNLINK")
+	}
+	if s.KeySpace().Key != 0 {
+		t.Error("keys left after UNLINK")
+	}
+}
+
+func TestObjectAccess(t *testing.T) {
+	s := NewStorage()
+	s.Zadd("z", 0, []ZElement{{Member: "a", Score: 1}})
+	if _, ok := s.Object("missing"); ok {
+		t.Error("info of a missing key")
+	}
+	if n := s.Touch([]string{"z", "missing"}); n != 1 {
+		t.Errorf("got %d keys touched, want 1", n)
+	}
+	info, _ := s.Object("z")
+	if info.Encoding != "listpack" || info.IdleTime != 0 || info.RefCount != 1 || info.Freq < lfuInitVal {
+		t.Errorf("got %+v", info)
+	}
+
+	// An access long ago shows as idle, with its counter decayed
+	z := s.sortedSet["z"]
+	z.store(time.Now().Add(-3*time.Minute), z.decayedFreq(time.Now()))
+	atomic.StoreInt64(&z.accessed, time.Now().Add(-10*time.Second).UnixMilli())
+	info, _ = s.Object("z")
+	if info.IdleTime != 10 {
+		t.Errorf("got idle time %d, want 10", info.IdleTime)
+	}
+	if info.Freq > lfuInitVal-2 {
+		t.Errorf("got freq %d, want it decayed", info.Freq)
+	}
+
+	// Reading the key under the shared lock is an access too
+	s.Zcard("z")
+	if info, _ = s.Object("z"); info.IdleTime != 0 {
+		t.Errorf("got idle time %d after ZCARD, want 0", info.IdleTime)
+	}
+}
+
+func TestRandomKey(t *testing.T) {
+	s := NewStorage()
+	s.Set("gone", "v", uint64(time.Now().Add(-time.Second).UnixMilli()))
+	if key, ok := s.RandomKey(); ok {
+		t.Errorf("got %q from a database of expired keys", key)
+	}
+	for i := range 20 {
+		s.Zadd("z"+strconv.Itoa(i), 0, []ZElement{{Member: "a", Score: 1}})
+	}
+	picked := make(map[string]bool)
+	for range 500 {
+		key, _ := s.RandomKey()
+		picked[key] = true
+	}
+	if len(picked) != 20 {
+		t.Errorf("got %d distinct keys in 500 draws, want the 20 zsets", len(picked))
+	}
+}
@@ -0,0 +1,236 @@
+package datastructure
+
+import (
+	"bytes"
+	"slices"
+)
+
+/*
+Compressed radix tree: every node holds the bytes of the edge leading to it,
+so chains of single child nodes are merged. Children are kept sorted by
+their first byte, walking the tree in order yields keys in lexicographic
+order
+*/
+type raxNode struct {
+	prefix   []byte
+	children []*raxNode
+	value    any
+	hasValue bool
+}
+
+type rax struct {
+	root raxNode
+	size int
+}
+
+func newRax() *rax {
+	return &rax{}
+}
+
+func commonPrefixLen(a []byte, b []byte) int {
+	n := 0
+	for n < len(a) && n < len(b) && a[n] == b[n] {
+		n++
+	}
+	return n
+}
+
+/*
+Index of the child starting with `b`, or where it would be inserted
+*/
+func (n *raxNode) childIndex(b byte) (int, bool) {
+	lo, hi := 0, len(n.children)
+	for lo < hi {
+		mid := (lo + hi) / 2
+		if n.children[mid].prefix[0] < b {
+			lo = mid + 1
+		} else {
+			hi = mid
+		}
+	}
+	return lo, lo < len(n.children) && n.children[lo].prefix[0] == b
+}
+
+func (n *raxNode) insertChild(i int, child *raxNode) {
+	n.children = append(n.children, nil)
+	copy(n.children[i+1:], n.children[i:])
+	n.children[i] = child
+}
+
+func (r *rax) Len() int {
+	return r.size
+}
+
+/*
+Insert or replace `key`, returns true when the key is new
+*/
+func (r *rax) Insert(key []byte, value any) bool {
+	n := &r.root
+	for len(key) > 0 {
+		i, ok := n.childIndex(key[0])
+		if !ok {
+			n.insertChild(i, &raxNode{prefix: bytes.Clone(key), value: value, hasValue: true})
+			r.size++
+			return true
+		}
+
+		c := n.children[i]
+		l := commonPrefixLen(c.prefix, key)
+		if l < len(c.prefix) {
+			// Split the edge at the first differing byte
+			mid := &raxNode{prefix: c.prefix[:l:l], children: []*raxNode{c}}
+			c.prefix = c.prefix[l:]
+			n.children[i] = mid
+			c = mid
+		}
+		n, key = c, key[l:]
+	}
+
+	isNew := !n.hasValue
+	n.value, n.hasValue = value, true
+	if isNew {
+		r.size++
+	}
+	return isNew
+}
+
+func (r *rax) Find(key []byte) (any, bool) {
+	n := &r.root
+	for len(key) > 0 {
+		i, ok := n.childIndex(key[0])
+		if !ok || !bytes.HasPrefix(key, n.children[i].prefix) {
+			return nil, false
+		}
+		n, key = n.children[i], key[len(n.children[i].prefix):]
+	}
+	return n.value, n.hasValue
+}
+
+/*
+Remove `key`, merging nodes left with a single child and no value back into
+one edge
+*/
+func (r *rax) Remove(key []byte) bool {
+	type step struct {
+		parent *raxNode
+		index  int
+	}
+	var path []step
+	n := &r.root
+	for len(key) > 0 {
+		i, ok := n.childIndex(key[0])
+		if !ok || !bytes.HasPrefix(key, n.children[i].prefix) {
+			return false
+		}
+		path = append(path, step{parent: n, index: i})
+		n, key = n.children[i], key[len(n.children[i].prefix):]
+	}
+	if !n.hasValue {
+		return false
+	}
+	n.value, n.hasValue = nil, false
+	r.size--
+
+	if len(n.children) == 0 && len(path) > 0 {
+		last := path[len(path)-1]
+		last.parent.children = append(last.parent.children[:last.index], last.parent.children[last.index+1:]...)
+		n = last.parent
+	}
+	if n != &r.root && !n.hasValue && len(n.children) == 1 {
+		child := n.children[0]
+		n.prefix = append(bytes.Clone(n.prefix), child.prefix...)
+		n.children, n.value, n.hasValue = child.children, child.value, child.hasValue
+	}
+	return true
+}
+
+/*
+Call `fn` on every key >= `from` in ascending order until it returns false
+*/
+func (r *rax) Ascend(from []byte, fn func(key []byte, value any) bool) {
+	r.root.ascend(nil, from, fn)
+}
+
+func (n *raxNode) ascend(path []byte, from []byte, fn func(key []byte, value any) bool) bool {
+	path = append(path, n.prefix...)
+	switch cmp := bytes.Compare(path, from[:min(len(path), len(from))]); {
+	case cmp < 0:
+		// The whole subtree sorts before `from`
+		return true
+	case cmp > 0:
+		from = nil
+	}
+	if n.hasValue && bytes.Compare(path, from) >= 0 && !fn(path, n.value) {
+		return false
+	}
+	for _, c := range n.children {
+		if !c.ascend(path, from, fn) {
+			return false
+		}
+	}
+	return true
+}
+
+/*
+Call `fn` on every key <= `from` in descending order until it returns false,
+a nil `from` starting at the largest key
+*/
+func (r *rax) Descend(from []byte, fn func(key []byte, value any) bool) {
+	r.root.descend(nil, from, from == nil, fn)
+}
+
+func (n *raxNode) descend(path []byte, from []byte, all bool, fn func(key []byte, value any) bool) bool {
+	path = append(path, n.prefix...)
+	if !all {
+		switch cmp := bytes.Compare(path, from[:min(len(path), len(from))]); {
+		case cmp > 0:
+			// The whole subtree sorts after `from`
+			return true
+		case cmp < 0:
+			all = true
+		}
+	}
+	for i := len(n.children) - 1; i >= 0; i-- {
+		if !n.children[i].descend(path, from, all, fn) {
+			return false
+		}
+	}
+	return !n.hasValue || (!all && bytes.Compare(path, from) > 0) || fn(path, n.value)
+}
+
+/*
+Number of nodes, reported by XINFO STREAM
+*/
+func (r *rax) Nodes() int {
+	var count func(n *raxNode) int
+	count = func(n *raxNode) int {
+		res := 1
+		for _, c := range n.children {
+			res += count(c)
+		}
+		return res
+	}
+	return count(&r.root)
+}
+
+/*
+Copy of the tree, values are passed through `fn`
+*/
+func (r *rax) clone(fn func(value any) any) *rax {
+	var cloneNode func(n *raxNode) raxNode
+	cloneNode = func(n *raxNode) raxNode {
+		res := raxNode{prefix: slices.Clone(n.prefix), hasValue: n.hasValue}
+		if n.hasValue {
+			res.value = fn(n.value)
+		}
+		if n.children != nil {
+			res.children = make([]*raxNode, len(n.children))
+			for i, c := range n.children {
+				child := cloneNode(c)
+				res.children[i] = &child
+			}
+		}
+		return res
+	}
+	return &rax{root: cloneNode(&r.root), size: r.size}
+}
@@ -0,0 +1,105 @@
+package datastructure
+
+import (
+	"strings"
+	"time"
+
+	"tcp-server.com/m/internal/glob"
+)
+
+/*
+Type of a value returned by values, as reported by SCAN TYPE. Sketches use
+the names of the Redis Stack modules
+*/
+func typeName(value any) string {
+	switch v := value.(type) {
+	case *Obj:
+		return "string"
+	case *ZSet:
+		return "zset"
+	case *CMS:
+		return "CMSk-TYPE"
+	case *ScalableBloom:
+		return "MBbloom--"
+	case *Cuckoo:
+		return "MBbloomCF"
+	case *TopK:
+		return "TopK-TYPE"
+	case *TDigest:
+		return "TDIS-TYPE"
+	case *TimeSeries:
+		return "TSDB-TYPE"
+	case *Stream:
+		return "stream"
+	case *ModuleValue:
+		return v.Type.TypeName()
+	}
+	return "none"
+}
+
+/*
+Every live key matching `pattern`
+*/
+func (s *Storage) Keys(pattern string) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	keys := make([]string, 0, s.index.Len())
+	s.index.Range(func(key string, _ uint16) bool {
+		keys = append(keys, key)
+		return true
+	})
+	return s.filterKeys(keys, pattern, "")
+}
+
+/*
+One step of SCAN: the keys of `count` buckets of the key index from
+`cursor`, filtered by `pattern` and by `typ` unless empty. Returns the next
+cursor, 0 once the scan is over.
+`count` comes from the client and is only a budget, it is capped by the
+number of buckets and nothing is allocated from it
+*/
+func (s *Storage) Scan(cursor uint64, pattern string, count int, typ string) (uint64, []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	count = int(min(uint64(count), s.index.mask()+1))
+	var keys []string
+	for range count {
+		cursor = s.index.Scan(cursor, func(key string, _ uint16) {
+			keys = append(keys, key)
+		})
+		if cursor == 0 {
+			break
+		}
+	}
+	return cursor, s.filterKeys(keys, pattern, typ)
+}
+
+/*
+Keys of `keys` still alive, matching `pattern` and of type `typ` unless
+empty
+*/
+func (s *Storage) filterKeys(keys []string, pattern string, typ string) []string {
+	now := uint64(time.Now().UnixMilli())
+	res := make([]string, 0, len(keys))
+	for _, key := range keys {
+		s.dict.expireIfNeeded(key, now)
+		values := s.values(key)
+		if len(values) == 0 || (pattern != "" && !glob.Match(pattern, key)) {
+			continue
+		}
+		if typ != "" && !hasType(values, typ) {
+			continue
+		}
+		res = append(res, key)
+	}
+	return res
+}
+
+func hasType(values []any, typ string) bool {
+	for _, v := range values {
+		if strings.EqualFold(typeName(v), typ) {
+			return true
+		}
+	}
+	return false
+}
@@ -2,14 +2,27 @@ package datastructure
 
 import (
 	"fmt"
+	"math"
 	"math/rand"
 	"testing"
+
+	"tcp-server.com/m/internal/config"
 )
 
 func seedRand() {
 	rand.Seed(42)
 }
 
+/*
+Zset forced to the skiplist encoding for tests poking at the skiplist
+*/
+func newZsetSkiplist() *ZSet {
+	return &ZSet{
+		zskiplist: NewSkiplist(32),
+		dict:      newHashTable[float64](),
+	}
+}
+
 func TestZrankEmptyZSet(t *testing.T) {
 	z := NewZset()
 	rank := z.Zrank("nonexistent")
@@ -99,7 +112,7 @@ func TestCoinFlip(t *testing.T) {
 }
 
 func TestZaddAndDel(t *testing.T) {
-	z := NewZset()
+	z := newZsetSkiplist()
 	s := z.zskiplist
 
 	z.Zadd("x", 10.0)
@@ -128,7 +141,7 @@ func TestZaddAndDel(t *testing.T) {
 }
 
 func TestBackwardLinks(t *testing.T) {
-	z := NewZset()
+	z := newZsetSkiplist()
 	s := z.zskiplist
 
 	z.Zadd("A", 1.0)
@@ -200,3 +213,323 @@ func TestZrank(t *testing.T) {
 		t.Errorf("Expected rank 2 for bob, got %v", rank)
 	}
 }
+
+func TestZrankLargeSet(t *testing.T) {
+	z := NewZset()
+	n := 2000
+	for i := range n {
+		v := (i * 7919) % n
+		z.Zadd(fmt.Sprintf("m%05d", v), float64(v))
+	}
+
+	for i := range n {
+		ele := fmt.Sprintf("m%05d", i)
+		if rank := z.Zrank(ele); rank != i {
+			t.Fatalf("Zrank(%s) = %d, want %d", ele, rank, i)
+		}
+		if rank := z.Zrevrank(ele); rank != n-1-i {
+			t.Fatalf("Zrevrank(%s) = %d, want %d", ele, rank, n-1-i)
+		}
+		if node := z.zskiplist.getNodeByRank(uint32(i + 1)); node == nil || node.ele != ele {
+			t.Fatalf("getNodeByRank(%d) = %v, want %s", i+1, node, ele)
+		}
+	}
+
+	for i := 0; i < n; i += 2 {
+		z.Zrem(fmt.Sprintf("m%05d", i))
+	}
+	for i := 1; i < n; i += 2 {
+		ele := fmt.Sprintf("m%05d", i)
+		if rank := z.Zrank(ele); rank != i/2 {
+			t.Fatalf("After removal: Zrank(%s) = %d, want %d", ele, rank, i/2)
+		}
+	}
+}
+
+func members(elements []ZElement) []string {
+	res := make([]string, len(elements))
+	for i, e := range elements {
+		res[i] = e.Member
+	}
+	return res
+}
+
+func TestZsetRange(t *testing.T) {
+	for _, z := range []*ZSet{NewZset(), newZsetSkiplist()} {
+		testZsetRange(t, z)
+	}
+}
+
+func testZsetRange(t *testing.T, z *ZSet) {
+	for i, ele := range []string{"a", "b", "c", "d", "e"} {
+		z.Zadd(ele, float64(i+1))
+	}
+	score := func(min, max string) ScoreRange {
+		r, err := ParseScoreRange(min, max)
+		if err != nil {
+			t.Fatalf("ParseScoreRange(%s, %s): %v", min, max, err)
+		}
+		return r
+	}
+	lex := func(min, max string) LexRange {
+		r, err := ParseLexRange(min, max)
+		if err != nil {
+			t.Fatalf("ParseLexRange(%s, %s): %v", min, max, err)
+		}
+		return r
+	}
+
+	tests := []struct {
+		name string
+		spec ZRangeSpec
+		want string
+	}{
+		{"rank all", ZRangeSpec{By: ZRangeByRank, Start: 0, Stop: -1}, "abcde"},
+		{"rank negative", ZRangeSpec{By: ZRangeByRank, Start: -2, Stop: -1}, "de"},
+		{"rank out of range", ZRangeSpec{By: ZRangeByRank, Start: 5, Stop: 10}, ""},
+		{"rank rev", ZRangeSpec{By: ZRangeByRank, Start: 0, Stop: 1, Rev: true}, "ed"},
+		{"score inclusive", ZRangeSpec{By: ZRangeByScore, Score: score("2", "4"), Count: -1}, "bcd"},
+		{"score exclusive", ZRangeSpec{By: ZRangeByScore, Score: score("(2", "(4"), Count: -1}, "c"},
+		{"score inf", ZRangeSpec{By: ZRangeByScore, Score: score("-inf", "+inf"), Count: -1}, "abcde"},
+		{"score limit", ZRangeSpec{By: ZRangeByScore, Score: score("-inf", "+inf"), Offset: 1, Count: 2}, "bc"},
+		{"score rev limit", ZRangeSpec{By: ZRangeByScore, Score: score("2", "5"), Rev: true, Offset: 1, Count: 2}, "dc"},
+		{"score empty", ZRangeSpec{By: ZRangeByScore, Score: score("(3", "3"), Count: -1}, ""},
+		{"lex", ZRangeSpec{By: ZRangeByLex, Lex: lex("[b", "(d"), Count: -1}, "bc"},
+		{"lex open", ZRangeSpec{By: ZRangeByLex, Lex: lex("-", "+"), Offset: 3, Count: -1}, "de"},
+		{"lex rev", ZRangeSpec{By: ZRangeByLex, Lex: lex("(a", "[c"), Rev: true, Count: -1}, "cb"},
+	}
+	for _, tt := range tests {
+		got := ""
+		for _, m := range members(z.Range(&tt.spec)) {
+			got += m
+		}
+		if got != tt.want {
+			t.Errorf("%s (%s): got %q, want %q", tt.name, z.Encoding(), got, tt.want)
+		}
+	}
+
+	r := score("(1", "5")
+	if cnt := z.Zcount(&r); cnt != 4 {
+		t.Errorf("Zcount = %d, want 4", cnt)
+	}
+	l := lex("[c", "+")
+	if cnt := z.Zlexcount(&l); cnt != 3 {
+		t.Errorf("Zlexcount = %d, want 3", cnt)
+	}
+}
+
+func TestZsetRemoveAndPop(t *testing.T) {
+	for _, z := range []*ZSet{NewZset(), newZsetSkiplist()} {
+		testZsetRemoveAndPop(t, z)
+	}
+}
+
+func testZsetRemoveAndPop(t *testing.T, z *ZSet) {
+	for i := range 10 {
+		z.Zadd(fmt.Sprintf("m%d", i), float64(i))
+	}
+
+	if n := z.ZremRangeByRank(0, 1); n != 2 {
+		t.Errorf("ZremRangeByRank removed %d, want 2", n)
+	}
+	r, _ := ParseScoreRange("(7", "+inf")
+	if n := z.ZremRangeByScore(&r); n != 2 {
+		t.Errorf("ZremRangeByScore removed %d, want 2", n)
+	}
+
+	if got := z.Pop(0, false); len(got) != 0 || z.Zcard() != 6 {
+		t.Errorf("Pop(0) = %v leaving %d members, want nothing popped", members(got), z.Zcard())
+	}
+	min := z.Pop(2, false)
+	if got := members(min); len(got) != 2 || got[0] != "m2" || got[1] != "m3" {
+		t.Errorf("Pop min = %v, want [m2 m3]", got)
+	}
+	max := z.Pop(1, true)
+	if got := members(max); len(got) != 1 || got[0] != "m7" {
+		t.Errorf("Pop max = %v, want [m7]", got)
+	}
+	if z.Zcard() != 3 {
+		t.Errorf("Zcard = %d, want 3", z.Zcard())
+	}
+	if z.zskiplist != nil && (z.zskiplist.tail.ele != "m6" || z.zskiplist.head.levels[0].forward.backward != nil) {
+		t.Errorf("skiplist links broken after pops")
+	}
+
+	score, err := z.Zincrby("m4", 10)
+	if err != nil || score != 14 || z.Zrank("m4") != 2 {
+		t.Errorf("Zincrby = %v, %v, rank %d", score, err, z.Zrank("m4"))
+	}
+	z.Zadd("inf", math.Inf(1))
+	if _, err := z.Zincrby("inf", math.Inf(-1)); err == nil {
+		t.Errorf("Zincrby to NaN should fail")
+	}
+}
+
+func TestZsetRandMember(t *testing.T) {
+	z := NewZset()
+	for i := range 20 {
+		z.Zadd(fmt.Sprintf("m%d", i), float64(i))
+	}
+
+	distinct := z.RandMember(10)
+	seen := make(map[string]bool)
+	for _, e := range distinct {
+		if seen[e.Member] {
+			t.Errorf("RandMember with positive count returned duplicate %s", e.Member)
+		}
+		seen[e.Member] = true
+	}
+	if len(distinct) != 10 {
+		t.Errorf("RandMember(10) returned %d members", len(distinct))
+	}
+	if len(z.RandMember(50)) != 20 {
+		t.Errorf("RandMember should cap positive count at zset size")
+	}
+	if len(z.RandMember(-50)) != 50 {
+		t.Errorf("RandMember with negative count should return exactly |count| members")
+	}
+}
+
+func TestZaddGenericFlags(t *testing.T) {
+	z := NewZset()
+	z.Zadd("a", 10)
+
+	tests := []struct {
+		name      string
+		ele       string
+		score     float64
+		flags     int
+		want      int
+		wantScore float64
+	}{
+		{"nx existing", "a", 1, ZaddNX, ZaddNop, 10},
+		{"nx new", "b", 1, ZaddNX, ZaddAdded, 1},
+		{"xx missing", "c", 1, ZaddXX, ZaddNop, 0},
+		{"xx existing", "b", 2, ZaddXX, ZaddUpdated, 2},
+		{"gt lower", "a", 5, ZaddGT, ZaddNop, 10},
+		{"gt higher", "a", 15, ZaddGT, ZaddUpdated, 15},
+		{"lt higher", "a", 20, ZaddLT, ZaddNop, 15},
+		{"gt adds new", "d", 3, ZaddGT, ZaddAdded, 3},
+		{"same score", "d", 3, 0, ZaddUnchanged, 3},
+		{"incr", "a", 5, ZaddINCR, ZaddUpdated, 20},
+		{"incr gt rejects", "a", -1, ZaddINCR | ZaddGT, ZaddNop, 20},
+	}
+	for _, tt := range tests {
+		res, score, err := z.ZaddGeneric(tt.ele, tt.score, tt.flags)
+		if err != nil || res != tt.want || score != tt.wantScore {
+			t.Errorf("%s: got (%d, %v, %v), want (%d, %v)", tt.name, res, score, err, tt.want, tt.wantScore)
+		}
+	}
+
+	if z.Zrank("b") != 0 || z.Zrank("d") != 1 || z.Zrank("a") != 2 {
+		t.Errorf("unexpected order after flagged adds: b=%d d=%d a=%d", z.Zrank("b"), z.Zrank("d"), z.Zrank("a"))
+	}
+}
+
+func TestNewZsetFromSorted(t *testing.T) {
+	n := 1000
+	elements := make([]ZElement, n)
+	for i := range n {
+		elements[i] = ZElement{Member: fmt.Sprintf("m%04d", i), Score: float64(i / 3)}
+	}
+	z := NewZsetFromSorted(elements)
+
+	for i, e := range elements {
+		if rank := z.Zrank(e.Member); rank != i {
+			t.Fatalf("Zrank(%s) = %d, want %d", e.Member, rank, i)
+		}
+	}
+	if z.zskiplist.tail.ele != "m0999" || z.zskiplist.tail.backward.ele != "m0998" {
+		t.Errorf("unexpected tail links: %v", z.zskiplist.tail)
+	}
+
+	// The bulk built list must stay consistent for regular updates
+	z.Zadd("first", -1)
+	z.Zadd("last", 1e9)
+	z.Zrem("m0500")
+	if z.Zrank("first") != 0 || z.Zrank("m0501") != 501 || z.Zrank("last") != n {
+		t.Errorf("ranks broken after updates: first=%d m0501=%d last=%d", z.Zrank("first"), z.Zrank("m0501"), z.Zrank("last"))
+	}
+}
+
+func TestZsetOps(t *testing.T) {
+	a, b := NewZset(), NewZset()
+	a.Zadd("x", 1)
+	a.Zadd("y", 2)
+	a.Zadd("z", 3)
+	b.Zadd("y", 10)
+	b.Zadd("z", math.Inf(1))
+	b.Zadd("w", 4)
+
+	union := ZUnion([]*ZSet{a, b, nil}, []float64{1, 2, 1}, ZAggregateSum)
+	want := []ZElement{{"x", 1}, {"w", 8}, {"y", 22}, {"z", math.Inf(1)}}
+	if fmt.Sprint(union) != fmt.Sprint(want) {
+		t.Errorf("ZUnion = %v, want %v", union, want)
+	}
+
+	inter := ZInter([]*ZSet{a, b}, []float64{1, 0}, ZAggregateMax)
+	want = []ZElement{{"y", 2}, {"z", 3}}
+	if fmt.Sprint(inter) != fmt.Sprint(want) {
+		t.Errorf("ZInter = %v, want %v", inter, want)
+	}
+	if cnt := ZInterCard([]*ZSet{a, b}, 1); cnt != 1 {
+		t.Errorf("ZInterCard with limit = %d, want 1", cnt)
+	}
+	if cnt := ZInterCard([]*ZSet{a, nil}, 0); cnt != 0 {
+		t.Errorf("ZInterCard with missing key = %d, want 0", cnt)
+	}
+
+	diff := ZDiff([]*ZSet{a, b})
+	if len(diff) != 1 || diff[0].Member != "x" {
+		t.Errorf("ZDiff = %v, want [x]", diff)
+	}
+}
+
+func TestZsetListpackConversion(t *testing.T) {
+	defer func(entries, value int64) {
+		config.ZsetMaxListpackEntries.Store(entries)
+		config.ZsetMaxListpackValue.Store(value)
+	}(config.ZsetMaxListpackEntries.Load(), config.ZsetMaxListpackValue.Load())
+	config.ZsetMaxListpackEntries.Store(4)
+	config.ZsetMaxListpackValue.Store(8)
+
+	z := NewZset()
+	for i, ele := range []string{"d", "b", "a", "c"} {
+		z.Zadd(ele, float64(i%2))
+	}
+	z.Zadd("b", 5)
+	if z.Encoding() != ZsetEncodingListpack {
+		t.Fatalf("Expected listpack encoding for 4 members, got %s", z.Encoding())
+	}
+	want := []string{"a", "d", "c", "b"}
+	for i, ele := range want {
+		if rank := z.Zrank(ele); rank != i {
+			t.Errorf("listpack Zrank(%s) = %d, want %d", ele, rank, i)
+		}
+	}
+	if z.Zrem("d", "nope") != 1 || z.Zcard() != 3 {
+		t.Errorf("listpack Zrem failed, card %d", z.Zcard())
+	}
+
+	z.Zadd("d", 0)
+	z.Zadd("e", 6)
+	if z.Encoding() != ZsetEncodingSkiplist {
+		t.Fatalf("Expected skiplist encoding above max entries, got %s", z.Encoding())
+	}
+	want = append(want, "e")
+	for i, ele := range want {
+		if rank := z.Zrank(ele); rank != i {
+			t.Errorf("converted Zrank(%s) = %d, want %d", ele, rank, i)
+		}
+	}
+
+	long := NewZset()
+	long.Zadd("short", 1)
+	long.Zadd("a-very-long-member", 2)
+	if long.Encoding() != ZsetEncodingSkiplist || long.Zrank("short") != 0 {
+		t.Errorf("Expected a long member to force the skiplist encoding")
+	}
+	if small := NewZsetFromSorted([]ZElement{{"a", 1}, {"b", 2}}); small.Encoding() != ZsetEncodingListpack {
+		t.Errorf("Expected bulk built small zset to use listpack, got %s", small.Encoding())
+	}
+}
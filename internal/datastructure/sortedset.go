@@ -1,8 +1,13 @@
 package datastructure
 
 import (
+	"errors"
+	"math"
 	"math/rand"
+	"slices"
 	"strings"
+
+	"tcp-server.com/m/internal/config"
 )
 
 type SkiplistNode struct {
@@ -25,15 +30,78 @@ type Skiplist struct {
 	maxLevel int
 }
 
+const (
+	ZsetEncodingListpack = "listpack"
+	ZsetEncodingSkiplist = "skiplist"
+)
+
+/*
+A zset starts as a listpack and is converted to skiplist + dict once it
+holds more than config.ZsetMaxListpackEntries members or a member longer
+than config.ZsetMaxListpackValue. Exactly one of `lp` and `zskiplist` is set.
+*/
 type ZSet struct {
+	lp        *listpack
 	zskiplist *Skiplist
-	dict      map[string]float64
+	dict      *hashTable[float64]
+	access
 }
 
 func NewZset() *ZSet {
 	return &ZSet{
-		zskiplist: NewSkiplist(32),
-		dict:      make(map[string]float64),
+		lp: newListpack(),
+	}
+}
+
+func (z *ZSet) Encoding() string {
+	if z.lp != nil {
+		return ZsetEncodingListpack
+	}
+	return ZsetEncodingSkiplist
+}
+
+func fitsListpack(entries int, eleLen int) bool {
+	return int64(entries) <= config.ZsetMaxListpackEntries.Load() && int64(eleLen) <= config.ZsetMaxListpackValue.Load()
+}
+
+/*
+Move a listpack encoded zset to skiplist + dict
+*/
+func (z *ZSet) convert() {
+	elements := z.lp.elements()
+	z.zskiplist = newSkiplistFromSorted(elements, 32)
+	z.dict = newHashTableSize[float64](len(elements))
+	for _, e := range elements {
+		z.dict.Set(e.Member, e.Score)
+	}
+	z.lp = nil
+}
+
+func (z *ZSet) score(ele string) (float64, bool) {
+	if z.lp != nil {
+		_, _, score, ok := z.lp.find(ele)
+		return score, ok
+	}
+	score, ok := z.dict.Get(ele)
+	return score, ok
+}
+
+/*
+Call `fn` on every element in (score, member) order until it returns false
+*/
+func (z *ZSet) each(fn func(ele string, score float64) bool) {
+	if z.lp != nil {
+		for _, e := range z.lp.elements() {
+			if !fn(e.Member, e.Score) {
+				return
+			}
+		}
+		return
+	}
+	for node := z.zskiplist.head.levels[0].forward; node != nil; node = node.levels[0].forward {
+		if !fn(node.ele, node.score) {
+			return
+		}
 	}
 }
 
@@ -111,13 +179,10 @@ func (s *Skiplist) skiplistDel(node *SkiplistNode, backList []*SkiplistNode) {
 		back.levels[i].span += node.levels[i].span - 1
 		if i == 0 {
 			if next != nil {
-				next.backward = back
+				next.backward = node.backward
 				continue
 			}
-			s.tail = back
-			if back == s.head {
-				s.tail = nil
-			}
+			s.tail = node.backward
 		}
 	}
 
@@ -133,57 +198,72 @@ func (s *Skiplist) skiplistDel(node *SkiplistNode, backList []*SkiplistNode) {
 
 func (z *ZSet) zsetDel(node *SkiplistNode, backList []*SkiplistNode) {
 	z.zskiplist.skiplistDel(node, backList)
-	delete(z.dict, node.ele)
+	z.dict.Delete(node.ele)
 }
 
-func (s *Skiplist) skiplistAdd(ele string, score float64) {
+/*
+Insert a new node, keeping every span equal to the number of level-0 hops it
+covers so rank lookups can be answered by summing spans on the way down.
+The first node has a nil backward pointer, the head is never a back link.
+*/
+func (s *Skiplist) skiplistAdd(ele string, score float64) *SkiplistNode {
 	h := s.coinFlip()
 	node := newNode(ele, score, h)
 	backList, rank := s.getBackList(node)
 	if h > s.level {
 		for i := s.level; i < h; i++ {
 			backList = append(backList, s.head)
-			rank = append(rank, rank[s.level-1])
+			rank = append(rank, 0)
+			s.head.levels[i].span = s.length
 		}
 		s.level = h
 	}
 
-	node.backward = backList[0]
-
 	for i := 0; i < h; i++ {
-		next := backList[i].levels[i].forward
-		node.levels[i].forward = next
+		node.levels[i].forward = backList[i].levels[i].forward
 		backList[i].levels[i].forward = node
 
-		if next != nil {
-			if i == 0 {
-				backList[i].levels[i].span = 1
-				node.levels[i].span = 1
-			} else {
-				oldSpan := backList[i].levels[i].span
-				backList[i].levels[i].span = rank[i] - rank[0] + 1
-				node.levels[i].span = oldSpan - (rank[i] - rank[0])
-			}
-			next.backward = node
-		} else {
-			if i == 0 {
-				backList[i].levels[i].span = 1
-			} else {
-				backList[i].levels[i].span = rank[i] - rank[0] + 1
-			}
-			node.levels[i].span = 0
-			s.tail = node
-		}
+		node.levels[i].span = backList[i].levels[i].span - (rank[0] - rank[i])
+		backList[i].levels[i].span = rank[0] - rank[i] + 1
 	}
 
 	for i := h; i < s.level; i++ {
 		backList[i].levels[i].span++
 	}
+
+	if backList[0] != s.head {
+		node.backward = backList[0]
+	}
+	if next := node.levels[0].forward; next != nil {
+		next.backward = node
+	} else {
+		s.tail = node
+	}
 	s.length++
+	return node
 }
 
 func (z *ZSet) Zadd(ele string, score float64) int {
-	if oldScore, exists := z.dict[ele]; exists {
+	if z.lp != nil {
+		pos, _, oldScore, exists := z.lp.find(ele)
+		if exists && oldScore == score {
+			return 0
+		}
+		entries := z.lp.n
+		if !exists {
+			entries++
+		}
+		if fitsListpack(entries, len(ele)) {
+			if exists {
+				z.lp.deleteAt(pos)
+			}
+			z.lp.insert(ele, score)
+			return 1
+		}
+		z.convert()
+	}
+
+	if oldScore, exists := z.dict.Get(ele); exists {
 		if oldScore == score {
 			return 0
 		}
@@ -192,13 +272,63 @@ func (z *ZSet) Zadd(ele string, score float64) int {
 		z.zsetDel(backList[0].levels[0].forward, backList)
 	}
 
-	z.dict[ele] = score
+	z.dict.Set(ele, score)
 	z.zskiplist.skiplistAdd(ele, score)
 	return 1
 }
 
+const (
+	ZaddNX = 1 << iota
+	ZaddXX
+	ZaddGT
+	ZaddLT
+	ZaddCH
+	ZaddINCR
+)
+
+const (
+	ZaddNop = iota
+	ZaddUnchanged
+	ZaddAdded
+	ZaddUpdated
+)
+
+/*
+ZADD for a single pair honouring NX/XX/GT/LT/INCR. Returns what happened
+to `ele` (ZaddNop when a flag prevented the write) and its score afterwards.
+Flag compatibility is checked by the caller.
+*/
+func (z *ZSet) ZaddGeneric(ele string, score float64, flags int) (int, float64, error) {
+	oldScore, exists := z.score(ele)
+	if !exists {
+		if flags&ZaddXX != 0 {
+			return ZaddNop, 0, nil
+		}
+		z.Zadd(ele, score)
+		return ZaddAdded, score, nil
+	}
+
+	if flags&ZaddNX != 0 {
+		return ZaddNop, oldScore, nil
+	}
+	if flags&ZaddINCR != 0 {
+		score += oldScore
+		if math.IsNaN(score) {
+			return ZaddNop, 0, errors.New("ERR resulting score is not a number (NaN)")
+		}
+	}
+	if (flags&ZaddGT != 0 && score <= oldScore) || (flags&ZaddLT != 0 && score >= oldScore) {
+		return ZaddNop, oldScore, nil
+	}
+	if score == oldScore {
+		return ZaddUnchanged, score, nil
+	}
+	z.Zadd(ele, score)
+	return ZaddUpdated, score, nil
+}
+
 func (z *ZSet) Zscore(ele string) interface{} {
-	score, exists := z.dict[ele]
+	score, exists := z.score(ele)
 	if !exists {
 		return nil
 	}
@@ -206,8 +336,16 @@ func (z *ZSet) Zscore(ele string) interface{} {
 }
 
 func (z *ZSet) Zrank(ele string) int {
+	if z.lp != nil {
+		_, idx, _, exists := z.lp.find(ele)
+		if !exists {
+			return -1
+		}
+		return idx
+	}
+
 	s := z.zskiplist
-	score, exists := z.dict[ele]
+	score, exists := z.dict.Get(ele)
 	if !exists {
 		return -1
 	}
@@ -232,3 +370,320 @@ func (z *ZSet) Zrank(ele string) int {
 
 	return -1
 }
+
+type ZElement struct {
+	Member string
+	Score  float64
+}
+
+/*
+Get node at 1-based `rank` by summing spans top-down, O(log n)
+*/
+func (s *Skiplist) getNodeByRank(rank uint32) *SkiplistNode {
+	if rank == 0 || rank > s.length {
+		return nil
+	}
+	curr := s.head
+	traversed := uint32(0)
+	for i := s.level - 1; i >= 0; i-- {
+		for curr.levels[i].forward != nil && traversed+curr.levels[i].span <= rank {
+			traversed += curr.levels[i].span
+			curr = curr.levels[i].forward
+		}
+		if traversed == rank {
+			return curr
+		}
+	}
+	return nil
+}
+
+func (s *Skiplist) inRange(r zrange) bool {
+	if r.isEmpty() || s.tail == nil {
+		return false
+	}
+	return r.gteMin(s.tail.score, s.tail.ele) && r.lteMax(s.head.levels[0].forward.score, s.head.levels[0].forward.ele)
+}
+
+/*
+First node inside `r` together with its 1-based rank
+*/
+func (s *Skiplist) firstInRange(r zrange) (*SkiplistNode, uint32) {
+	if !s.inRange(r) {
+		return nil, 0
+	}
+	curr := s.head
+	rank := uint32(0)
+	for i := s.level - 1; i >= 0; i-- {
+		for next := curr.levels[i].forward; next != nil && !r.gteMin(next.score, next.ele); next = curr.levels[i].forward {
+			rank += curr.levels[i].span
+			curr = next
+		}
+	}
+	next := curr.levels[0].forward
+	if next == nil || !r.lteMax(next.score, next.ele) {
+		return nil, 0
+	}
+	return next, rank + 1
+}
+
+/*
+Last node inside `r` together with its 1-based rank
+*/
+func (s *Skiplist) lastInRange(r zrange) (*SkiplistNode, uint32) {
+	if !s.inRange(r) {
+		return nil, 0
+	}
+	curr := s.head
+	rank := uint32(0)
+	for i := s.level - 1; i >= 0; i-- {
+		for next := curr.levels[i].forward; next != nil && r.lteMax(next.score, next.ele); next = curr.levels[i].forward {
+			rank += curr.levels[i].span
+			curr = next
+		}
+	}
+	if curr == s.head || !r.gteMin(curr.score, curr.ele) {
+		return nil, 0
+	}
+	return curr, rank
+}
+
+func (s *Skiplist) countInRange(r zrange) int {
+	_, first := s.firstInRange(r)
+	if first == 0 {
+		return 0
+	}
+	_, last := s.lastInRange(r)
+	return int(last - first + 1)
+}
+
+/*
+Walk from the node at 1-based `rank` towards the tail (or head when `rev`),
+collecting at most `count` elements (count < 0 means all) while `keep` holds
+*/
+func (s *Skiplist) collect(rank uint32, rev bool, count int, keep func(float64, string) bool) []ZElement {
+	res := make([]ZElement, 0)
+	node := s.getNodeByRank(rank)
+	for node != nil && count != 0 && keep(node.score, node.ele) {
+		res = append(res, ZElement{Member: node.ele, Score: node.score})
+		count--
+		if rev {
+			node = node.backward
+		} else {
+			node = node.levels[0].forward
+		}
+	}
+	return res
+}
+
+func (z *ZSet) getNode(ele string) *SkiplistNode {
+	score, exists := z.dict.Get(ele)
+	if !exists {
+		return nil
+	}
+	backList, _ := z.zskiplist.getBackList(newNode(ele, score, 1))
+	return backList[0].levels[0].forward
+}
+
+func (z *ZSet) Zcard() int {
+	if z.lp != nil {
+		return z.lp.n
+	}
+	return int(z.zskiplist.length)
+}
+
+func (z *ZSet) Zrevrank(ele string) int {
+	rank := z.Zrank(ele)
+	if rank == -1 {
+		return -1
+	}
+	return z.Zcard() - 1 - rank
+}
+
+func (z *ZSet) Zrem(eles ...string) int {
+	cnt := 0
+	for _, ele := range eles {
+		if z.lp != nil {
+			if pos, _, _, ok := z.lp.find(ele); ok {
+				z.lp.deleteAt(pos)
+				cnt++
+			}
+			continue
+		}
+		node := z.getNode(ele)
+		if node == nil {
+			continue
+		}
+		z.zsetDel(node, nil)
+		cnt++
+	}
+	return cnt
+}
+
+/*
+Add `incr` to the score of `ele` (0 when absent), rejecting NaN results
+such as +inf + -inf
+*/
+func (z *ZSet) Zincrby(ele string, incr float64) (float64, error) {
+	score, _ := z.score(ele)
+	score += incr
+	if math.IsNaN(score) {
+		return 0, errors.New("ERR resulting score is not a number (NaN)")
+	}
+	z.Zadd(ele, score)
+	return score, nil
+}
+
+func (z *ZSet) countInRange(r zrange) int {
+	if z.lp != nil {
+		first, last, ok := sortedBounds(z.lp.elements(), r)
+		if !ok {
+			return 0
+		}
+		return last - first + 1
+	}
+	return z.zskiplist.countInRange(r)
+}
+
+func (z *ZSet) Zcount(r *ScoreRange) int {
+	return z.countInRange(r)
+}
+
+func (z *ZSet) Zlexcount(r *LexRange) int {
+	return z.countInRange(r)
+}
+
+func (z *ZSet) Range(spec *ZRangeSpec) []ZElement {
+	if z.lp != nil {
+		return rangeSorted(z.lp.elements(), spec)
+	}
+
+	s := z.zskiplist
+	if spec.By == ZRangeByRank {
+		start, stop, ok := normalizeRange(spec.Start, spec.Stop, int(s.length))
+		if !ok {
+			return []ZElement{}
+		}
+		rank := uint32(start + 1)
+		if spec.Rev {
+			rank = s.length - uint32(start)
+		}
+		return s.collect(rank, spec.Rev, stop-start+1, func(float64, string) bool { return true })
+	}
+
+	r := spec.zrange()
+	if spec.Offset < 0 {
+		return []ZElement{}
+	}
+	if spec.Rev {
+		_, rank := s.lastInRange(r)
+		if rank <= uint32(spec.Offset) {
+			return []ZElement{}
+		}
+		return s.collect(rank-uint32(spec.Offset), true, spec.Count, r.gteMin)
+	}
+	_, rank := s.firstInRange(r)
+	if rank == 0 {
+		return []ZElement{}
+	}
+	return s.collect(rank+uint32(spec.Offset), false, spec.Count, r.lteMax)
+}
+
+func (z *ZSet) removeAll(elements []ZElement) int {
+	for _, e := range elements {
+		z.Zrem(e.Member)
+	}
+	return len(elements)
+}
+
+func (z *ZSet) ZremRangeByRank(start int, stop int) int {
+	return z.removeAll(z.Range(&ZRangeSpec{By: ZRangeByRank, Start: start, Stop: stop}))
+}
+
+func (z *ZSet) ZremRangeByScore(r *ScoreRange) int {
+	return z.removeAll(z.Range(&ZRangeSpec{By: ZRangeByScore, Score: *r, Count: -1}))
+}
+
+func (z *ZSet) ZremRangeByLex(r *LexRange) int {
+	return z.removeAll(z.Range(&ZRangeSpec{By: ZRangeByLex, Lex: *r, Count: -1}))
+}
+
+/*
+Remove and return up to `count` lowest (or highest when `max`) elements
+*/
+func (z *ZSet) Pop(count int, max bool) []ZElement {
+	// A stop of -1 would be the whole set
+	if count == 0 {
+		return []ZElement{}
+	}
+	spec := &ZRangeSpec{By: ZRangeByRank, Start: 0, Stop: count - 1, Rev: max}
+	res := z.Range(spec)
+	z.removeAll(res)
+	return res
+}
+
+/*
+Random members following ZRANDMEMBER rules: a positive count returns
+distinct members, a negative one may repeat members
+*/
+func (z *ZSet) RandMember(count int) []ZElement {
+	length := z.Zcard()
+	if length == 0 || count == 0 {
+		return []ZElement{}
+	}
+
+	var pick func(rank uint32) ZElement
+	if z.lp != nil {
+		elements := z.lp.elements()
+		pick = func(rank uint32) ZElement {
+			return elements[rank-1]
+		}
+	} else {
+		pick = func(rank uint32) ZElement {
+			node := z.zskiplist.getNodeByRank(rank)
+			return ZElement{Member: node.ele, Score: node.score}
+		}
+	}
+
+	res := make([]ZElement, 0)
+	if count < 0 {
+		for range -count {
+			res = append(res, pick(uint32(rand.Intn(length)+1)))
+		}
+		return res
+	}
+
+	if count >= length {
+		return z.Range(&ZRangeSpec{By: ZRangeByRank, Start: 0, Stop: -1})
+	}
+	if count*3 > length {
+		for _, i := range rand.Perm(length)[:count] {
+			res = append(res, pick(uint32(i+1)))
+		}
+		return res
+	}
+	picked := make(map[int]struct{}, count)
+	for len(picked) < count {
+		i := rand.Intn(length)
+		if _, ok := picked[i]; ok {
+			continue
+		}
+		picked[i] = struct{}{}
+		res = append(res, pick(uint32(i+1)))
+	}
+	return res
+}
+
+/*
+Deep copy keeping the encoding
+*/
+func (z *ZSet) clone() *ZSet {
+	if z.lp != nil {
+		return &ZSet{lp: &listpack{buf: slices.Clone(z.lp.buf), n: z.lp.n}}
+	}
+	elements := make([]ZElement, 0, z.dict.Len())
+	z.each(func(ele string, score float64) bool {
+		elements = append(elements, ZElement{Member: ele, Score: score})
+		return true
+	})
+	return &ZSet{zskiplist: newSkiplistFromSorted(elements, 32), dict: z.dict.clone()}
+}
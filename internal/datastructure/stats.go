@@ -1,8 +1,9 @@
 package datastructure
 
+/*
+Size of a database, as reported by INFO keyspace
+*/
 type KeySpaceStat struct {
 	Key     int64
 	Expires int64
 }
-
-var HashKeySpace = KeySpaceStat{Key: 0, Expires: 0}
@@ -1,43 +1,229 @@
 package datastructure
 
 import (
+	"errors"
+	"fmt"
+	"slices"
 	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
+
+	"tcp-server.com/m/internal/config"
 )
 
+/*
+Logical database. SWAPDB and FLUSHDB exchange or replace its keyspace while
+the Storage itself, with its watched keys and blocked clients, stays in place
+*/
 type Storage struct {
-	mu        sync.RWMutex
-	dict      Dict
-	sortedSet map[string]*ZSet
-	cms       map[string]*CMS
-	bf        map[string]*Bloom
+	mu sync.RWMutex
+	// Index of the database, as selected by SELECT
+	id int
+	keyspace
+	// Clients blocked in XREAD/XREADGROUP, woken up by XADD on the key
+	streamWaiters map[string][]chan struct{}
+	notifier      *notifier
+	// Keys WATCHed by at least one client
+	watched map[string]*watchedKey
+	// Number of changes made to the dataset
+	dirty atomic.Uint64
+}
+
+type watchedKey struct {
+	version  uint64
+	watchers int
 }
 
+/*
+Database 0, for users of a single database
+*/
 func NewStorage() *Storage {
-	return &Storage{
-		dict: Dict{
-			dictStore:        make(map[string]*Obj),
-			expiredDictStore: make(map[string]uint64),
-		},
-		sortedSet: make(map[string]*ZSet),
-		cms:       make(map[string]*CMS),
-		bf:        make(map[string]*Bloom),
+	n := &notifier{}
+	flags, _ := ParseNotifyFlags(config.NotifyKeyspaceEvents.Load().(string))
+	n.flags.Store(int64(flags))
+	s := &Storage{
+		keyspace:      newKeyspace(),
+		streamWaiters: make(map[string][]chan struct{}),
+		notifier:      n,
+		watched:       make(map[string]*watchedKey),
+	}
+	s.dict.modified = s.notify
+	return s
+}
+
+/*
+Databases 0 to n-1
+*/
+func NewDatabases(n int) []*Storage {
+	res := make([]*Storage, n)
+	for i := range res {
+		res[i] = NewStorage()
+		res[i].id = i
+	}
+	return res
+}
+
+/*
+Index of the database
+*/
+func (s *Storage) ID() int {
+	return s.id
+}
+
+/*
+Publish keyspace events to `pub`, nothing is published until it is set
+*/
+func (s *Storage) SetPublisher(pub Publisher) {
+	s.notifier.pub = pub
+}
+
+/*
+Change the event classes published, as parsed by ParseNotifyFlags
+*/
+func (s *Storage) SetNotifyFlags(flags int) {
+	s.notifier.flags.Store(int64(flags))
+}
+
+/*
+Record a change of `key`: invalidate the transactions watching it and
+publish the keyspace event. Every write goes through here
+*/
+func (s *Storage) notify(class int, event string, key string) {
+	// A miss is only an event, nothing changed
+	if class != NotifyKeyMiss {
+		if w, ok := s.watched[key]; ok {
+			w.version++
+		}
+		s.dirty.Add(1)
+	}
+	s.notifier.notify(s.id, class, event, key)
+}
+
+/*
+Counter of the changes made to the dataset, it only grows
+*/
+func (s *Storage) Dirty() uint64 {
+	return s.dirty.Load()
+}
+
+/*
+Start watching `keys`, returns their current versions
+*/
+func (s *Storage) Watch(keys []string) []uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	res := make([]uint64, len(keys))
+	for i, key := range keys {
+		w, ok := s.watched[key]
+		if !ok {
+			w = &watchedKey{}
+			s.watched[key] = w
+		}
+		w.watchers++
+		res[i] = w.version
+	}
+	return res
+}
+
+func (s *Storage) Unwatch(keys []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, key := range keys {
+		w, ok := s.watched[key]
+		if !ok {
+			continue
+		}
+		if w.watchers--; w.watchers == 0 {
+			delete(s.watched, key)
+		}
+	}
+}
+
+/*
+Whether any key of `versions`, as returned by Watch, was modified since
+*/
+func (s *Storage) WatchedChanged(versions map[string]uint64) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for key, version := range versions {
+		if w, ok := s.watched[key]; !ok || w.version != version {
+			return true
+		}
+	}
+	return false
+}
+
+/*
+Active expiry, run periodically so that keys nobody reads still expire.
+Like Redis it keeps sampling while more than a quarter of the sampled keys
+were expired, bounded by `config.ActiveExpireMaxRounds`
+*/
+func (s *Storage) ActiveExpireCycle() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	total := 0
+	for i := 0; i < config.ActiveExpireMaxRounds; i++ {
+		checked, expired := s.dict.activeExpire(config.ActiveExpireSamples)
+		total += expired
+		if checked == 0 || expired*4 <= checked {
+			break
+		}
+	}
+	return total
+}
+
+/*
+Spend about a millisecond on each table of the database moving its buckets,
+so that a database nobody writes to still finishes resizing. Returns true
+while some buckets are left
+*/
+func (s *Storage) ActiveRehash() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	left := false
+	for _, rehash := range []func(time.Duration) bool{
+		s.dict.dictStore.rehashFor, s.dict.expiredDictStore.rehashFor, s.index.rehashFor,
+	} {
+		left = rehash(time.Millisecond) || left
 	}
+	return left
 }
 
 func (s *Storage) NewCMS(key string, errRate float64, errProb float64) int {
-	if _, ok := s.cms[key]; ok {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := lookup(s.cms, key); ok {
+		return -1
+	}
+	s.put(key, NewCMS(errRate, errProb), 0)
+	s.notify(NotifyModule, "cms.initbyprob", key)
+	return 1
+}
+
+func (s *Storage) NewCMSByDim(key string, width uint32, depth uint32) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := lookup(s.cms, key); ok {
 		return -1
 	}
-	s.cms[key] = NewCMS(errRate, errProb)
+	s.put(key, NewCMSByDim(width, depth), 0)
+	s.notify(NotifyModule, "cms.initbydim", key)
 	return 1
 }
 
-func (s *Storage) NewBF(key string, errRate float64, entriesNum uint64) int {
-	if _, ok := s.bf[key]; ok {
+/*
+Reserve a bloom filter, `expansion` 0 creates a NONSCALING filter
+*/
+func (s *Storage) NewBF(key string, errRate float64, entriesNum uint64, expansion uint64) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := lookup(s.bf, key); ok {
 		return -1
 	}
-	s.bf[key] = NewBloom(errRate, entriesNum)
+	s.put(key, NewScalableBloom(errRate, entriesNum, expansion), 0)
+	s.notify(NotifyModule, "bf.reserve", key)
 	return 1
 }
 
@@ -47,10 +233,17 @@ func (s *Storage) Set(key string, value interface{}, expir uint64) {
 	s.dict.Set(key, value, expir)
 }
 
+/*
+Takes the write lock since an expired key is deleted on access
+*/
 func (s *Storage) Get(key string) (Obj, bool) {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
-	return s.dict.Get(key)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	obj, ok := s.dict.Get(key)
+	if !ok {
+		s.notify(NotifyKeyMiss, "keymiss", key)
+	}
+	return obj, ok
 }
 
 func (s *Storage) Ttl(key string) (uint64, bool) {
@@ -66,91 +259,1457 @@ func (s *Storage) Expire(key string, expr uint64) (int, bool) {
 }
 
 func (s *Storage) Del(keys []string) (int, bool) {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-	return s.dict.Del(keys)
+	return s.Delete(keys), true
 }
 
 func (s *Storage) Exist(keys []string) (int, bool) {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
+	s.mu.Lock()
+	defer s.mu.Unlock()
 	return s.dict.Exist(keys)
 }
 
 /*
-Create new zdict for `key`
+Redis stores strings that fit an int64 as integers and short strings
+(<= 44 bytes) embedded in the object header
 */
-func (s *Storage) zdictExisted(key string) {
-	if _, ok := s.sortedSet[key]; !ok {
-		s.sortedSet[key] = NewZset()
+func stringEncoding(value interface{}) string {
+	str, ok := value.(string)
+	if !ok {
+		return "raw"
 	}
+	if _, err := strconv.ParseInt(str, 10, 64); err == nil && len(str) <= 20 {
+		return "int"
+	}
+	if len(str) <= 44 {
+		return "embstr"
+	}
+	return "raw"
 }
 
 /*
-Currently only support single `element - score` zadd
+Create new zdict for `key`, returns true when it did not exist
 */
-func (s *Storage) Zadd(key string, args []string) int {
-	if len(args) != 2 {
-		return -1
+func (s *Storage) zdictExisted(key string) bool {
+	if _, ok := lookup(s.sortedSet, key); !ok {
+		s.put(key, NewZset(), 0)
+		return true
 	}
+	return false
+}
 
+/*
+Add every `score member` pair of ZADD atomically. Returns the number of new
+members, or of new plus updated members when ZaddCH is set
+*/
+func (s *Storage) Zadd(key string, flags int, elements []ZElement) (int, error) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	s.zdictExisted(key)
+	created := s.zdictExisted(key)
+	defer s.zdictCleanup(key)
 
-	ele := args[0]
-	score, _ := strconv.ParseFloat(args[1], 64)
-	return s.sortedSet[key].Zadd(ele, score)
+	z := s.sortedSet[key]
+	cnt, changed := 0, false
+	for _, e := range elements {
+		res, _, err := z.ZaddGeneric(e.Member, e.Score, flags)
+		if err != nil {
+			return cnt, err
+		}
+		changed = changed || res == ZaddAdded || res == ZaddUpdated
+		if res == ZaddAdded || (res == ZaddUpdated && flags&ZaddCH != 0) {
+			cnt++
+		}
+	}
+	if changed {
+		s.zsetModified(key, "zadd", created)
+	}
+	return cnt, nil
 }
 
-func (s *Storage) Zscore(key string, ele string) float64 {
+/*
+ZADD ... INCR, returns false when NX/XX/GT/LT prevented the update
+*/
+func (s *Storage) ZaddIncr(key string, flags int, ele string, incr float64) (float64, bool, error) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	s.zdictExisted(key)
+	created := s.zdictExisted(key)
+	defer s.zdictCleanup(key)
+
+	res, score, err := s.sortedSet[key].ZaddGeneric(ele, incr, flags|ZaddINCR)
+	if err != nil || res == ZaddNop {
+		return 0, false, err
+	}
+	if res != ZaddUnchanged {
+		s.zsetModified(key, "zincr", created)
+	}
+	return score, true, nil
+}
+
+/*
+Get the zset at `key` without creating it, nil when missing
+*/
+func (s *Storage) zset(key string) *ZSet {
+	z, _ := lookup(s.sortedSet, key)
+	return z
+}
+
+/*
+Drop `key` once its zset has no member left, like Redis does
+*/
+func (s *Storage) zdictCleanup(key string) {
+	if z, ok := s.sortedSet[key]; ok && z.Zcard() == 0 {
+		dropKey(&s.keyspace, s.sortedSet, key)
+	}
+}
+
+/*
+Publish `event` after a write to the zset at `key`, preceded by `new` when
+the write created it and followed by `del` when it left the zset empty
+*/
+func (s *Storage) zsetModified(key string, event string, created bool) {
+	if created {
+		s.notify(NotifyNew, "new", key)
+	}
+	s.notify(NotifyZset, event, key)
+	if z, ok := s.sortedSet[key]; ok && z.Zcard() == 0 {
+		dropKey(&s.keyspace, s.sortedSet, key)
+		s.notify(NotifyGeneric, "del", key)
+	}
+}
 
-	res := s.sortedSet[key].Zscore(ele)
+func (s *Storage) Zscore(key string, ele string) (float64, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	z := s.zset(key)
+	if z == nil {
+		return 0, false
+	}
+	res := z.Zscore(ele)
 	if res == nil {
-		return -1
+		return 0, false
+	}
+	return res.(float64), true
+}
+
+func (s *Storage) Zmscore(key string, eles []string) []any {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	z := s.zset(key)
+	res := make([]any, len(eles))
+	for i, ele := range eles {
+		if z != nil {
+			res[i] = z.Zscore(ele)
+		}
 	}
-	return res.(float64)
+	return res
 }
 
 func (s *Storage) Zrank(key string, ele string) int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	z := s.zset(key)
+	if z == nil {
+		return -1
+	}
+	return z.Zrank(ele)
+}
+
+func (s *Storage) Zrevrank(key string, ele string) int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	z := s.zset(key)
+	if z == nil {
+		return -1
+	}
+	return z.Zrevrank(ele)
+}
+
+func (s *Storage) Zcard(key string) int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	z := s.zset(key)
+	if z == nil {
+		return 0
+	}
+	return z.Zcard()
+}
+
+func (s *Storage) Zrem(key string, eles []string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	z := s.zset(key)
+	if z == nil {
+		return 0
+	}
+	removed := z.Zrem(eles...)
+	if removed > 0 {
+		s.zsetModified(key, "zrem", false)
+	}
+	return removed
+}
+
+func (s *Storage) Zincrby(key string, incr float64, ele string) (float64, error) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	s.zdictExisted(key)
+	created := s.zdictExisted(key)
+	defer s.zdictCleanup(key)
+	score, err := s.sortedSet[key].Zincrby(ele, incr)
+	if err != nil {
+		return 0, err
+	}
+	s.zsetModified(key, "zincr", created)
+	return score, nil
+}
+
+func (s *Storage) Zcount(key string, r ScoreRange) int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	z := s.zset(key)
+	if z == nil {
+		return 0
+	}
+	return z.Zcount(&r)
+}
 
-	return s.sortedSet[key].Zrank(ele)
+func (s *Storage) Zlexcount(key string, r LexRange) int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	z := s.zset(key)
+	if z == nil {
+		return 0
+	}
+	return z.Zlexcount(&r)
+}
+
+func (s *Storage) Zrange(key string, spec *ZRangeSpec) []ZElement {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	z := s.zset(key)
+	if z == nil {
+		return []ZElement{}
+	}
+	return z.Range(spec)
 }
 
-func (s *Storage) CMSIncrBy(key string, item string, value uint32) uint32 {
+/*
+Store the result of ZRANGE `src` into `dst`, replacing it. An empty result
+deletes `dst`
+*/
+func (s *Storage) ZrangeStore(dst string, src string, spec *ZRangeSpec) int {
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	return s.cms[key].IncrBy(item, value)
+	res := []ZElement{}
+	if z := s.zset(src); z != nil {
+		res = z.Range(spec)
+	}
+	if spec.Rev {
+		slices.Reverse(res)
+	}
+	s.zstore(dst, res, "zrangestore")
+	return len(res)
+}
+
+/*
+Replace `dst` with a zset bulk built from sorted `elements` and publish
+`event`, or `del` when an existing `dst` is emptied
+*/
+func (s *Storage) zstore(dst string, elements []ZElement, event string) {
+	_, existed := lookup(s.sortedSet, dst)
+	dropKey(&s.keyspace, s.sortedSet, dst)
+	if len(elements) == 0 {
+		if existed {
+			s.notify(NotifyGeneric, "del", dst)
+		}
+		return
+	}
+	s.put(dst, NewZsetFromSorted(elements), 0)
+	s.zsetModified(dst, event, !existed)
+}
+
+const (
+	ZsetOpUnion = iota
+	ZsetOpInter
+	ZsetOpDiff
+)
+
+func (s *Storage) zsetOp(op int, keys []string, weights []float64, agg int) []ZElement {
+	sets := make([]*ZSet, len(keys))
+	for i, key := range keys {
+		sets[i] = s.zset(key)
+	}
+	switch op {
+	case ZsetOpInter:
+		return ZInter(sets, weights, agg)
+	case ZsetOpDiff:
+		return ZDiff(sets)
+	}
+	return ZUnion(sets, weights, agg)
+}
+
+/*
+ZUNION/ZINTER/ZDIFF over `keys`, missing keys count as empty zsets
+*/
+func (s *Storage) ZsetOp(op int, keys []string, weights []float64, agg int) []ZElement {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.zsetOp(op, keys, weights, agg)
 }
 
-func (s *Storage) CMSQuery(key string, item string) uint32 {
+func (s *Storage) ZsetOpStore(dst string, op int, keys []string, weights []float64, agg int) int {
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	return s.cms[key].Query(item)
+	res := s.zsetOp(op, keys, weights, agg)
+	event := "zunionstore"
+	switch op {
+	case ZsetOpInter:
+		event = "zinterstore"
+	case ZsetOpDiff:
+		event = "zdiffstore"
+	}
+	s.zstore(dst, res, event)
+	return len(res)
 }
 
-func (s *Storage) BFAdd(key string, item string) int {
-	if _, ok := s.bf[key]; !ok {
-		return -1
+func (s *Storage) Zintercard(keys []string, limit int) int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	sets := make([]*ZSet, len(keys))
+	for i, key := range keys {
+		sets[i] = s.zset(key)
 	}
-	s.bf[key].Add(item)
-	return 1
+	return ZInterCard(sets, limit)
 }
 
-func (s *Storage) BFQuery(key string, item string) int {
-	if _, ok := s.bf[key]; !ok {
-		return -1
+func (s *Storage) ZremRangeByRank(key string, start int, stop int) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	z := s.zset(key)
+	if z == nil {
+		return 0
 	}
-	res := s.bf[key].Exist(item)
-	if res {
-		return 1
+	removed := z.ZremRangeByRank(start, stop)
+	if removed > 0 {
+		s.zsetModified(key, "zremrangebyrank", false)
 	}
+	return removed
+}
 
-	return 0
+func (s *Storage) ZremRangeByScore(key string, r ScoreRange) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	z := s.zset(key)
+	if z == nil {
+		return 0
+	}
+	removed := z.ZremRangeByScore(&r)
+	if removed > 0 {
+		s.zsetModified(key, "zremrangebyscore", false)
+	}
+	return removed
+}
+
+func (s *Storage) ZremRangeByLex(key string, r LexRange) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	z := s.zset(key)
+	if z == nil {
+		return 0
+	}
+	removed := z.ZremRangeByLex(&r)
+	if removed > 0 {
+		s.zsetModified(key, "zremrangebylex", false)
+	}
+	return removed
+}
+
+func (s *Storage) Zpop(key string, count int, max bool) []ZElement {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	z := s.zset(key)
+	if z == nil {
+		return []ZElement{}
+	}
+	res := z.Pop(count, max)
+	if len(res) > 0 {
+		event := "zpopmin"
+		if max {
+			event = "zpopmax"
+		}
+		s.zsetModified(key, event, false)
+	}
+	return res
+}
+
+func (s *Storage) ZrandMember(key string, count int) ([]ZElement, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	z := s.zset(key)
+	if z == nil {
+		return nil, false
+	}
+	return z.RandMember(count), true
+}
+
+/*
+Increase every item by its matching value, returns the estimated counts after
+the increase or false when the sketch does not exist
+*/
+func (s *Storage) CMSIncrBy(key string, items []string, values []uint32) ([]int, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	cms, ok := lookup(s.cms, key)
+	if !ok {
+		return nil, false
+	}
+	res := make([]int, len(items))
+	for i, item := range items {
+		res[i] = int(cms.IncrBy(item, values[i]))
+	}
+	s.notify(NotifyModule, "cms.incrby", key)
+	return res, true
+}
+
+func (s *Storage) CMSQuery(key string, items []string) ([]int, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	cms, ok := lookup(s.cms, key)
+	if !ok {
+		return nil, false
+	}
+	res := make([]int, len(items))
+	for i, item := range items {
+		res[i] = int(cms.Query(item))
+	}
+	return res, true
+}
+
+/*
+Merge the `srcs` sketches into `dest` with `weights`, all of them must
+already exist
+*/
+func (s *Storage) CMSMerge(dest string, srcs []string, weights []int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	target, ok := lookup(s.cms, dest)
+	if !ok {
+		return ErrCMSNotFound
+	}
+	sketches := make([]*CMS, len(srcs))
+	for i, src := range srcs {
+		if sketches[i], ok = lookup(s.cms, src); !ok {
+			return ErrCMSNotFound
+		}
+	}
+	if err := target.Merge(sketches, weights); err != nil {
+		return err
+	}
+	s.notify(NotifyModule, "cms.merge", dest)
+	return nil
+}
+
+func (s *Storage) CMSInfo(key string) (CMSInfo, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	cms, ok := lookup(s.cms, key)
+	if !ok {
+		return CMSInfo{}, false
+	}
+	return cms.Info(), true
+}
+
+/*
+Add `items` to the bloom filter at `key`, creating it with `errRate`,
+`capacity` and `expansion` unless `noCreate` is set. Every item gets 1 when
+newly added, 0 when already present or an error when the filter is full.
+Returns nil when the filter does not exist and cannot be created
+*/
+func (s *Storage) BFInsert(key string, errRate float64, capacity uint64, expansion uint64, noCreate bool, items []string) []any {
+	return s.bfInsert(key, errRate, capacity, expansion, noCreate, items, "bf.insert")
+}
+
+func (s *Storage) bfInsert(key string, errRate float64, capacity uint64, expansion uint64, noCreate bool, items []string, event string) []any {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, existed := lookup(s.bf, key)
+	if !existed {
+		if noCreate {
+			return nil
+		}
+		s.put(key, NewScalableBloom(errRate, capacity, expansion), 0)
+	}
+
+	res := make([]any, len(items))
+	changed := !existed
+	for i, item := range items {
+		added, err := s.bf[key].Add(item)
+		switch {
+		case err != nil:
+			res[i] = err
+		case added:
+			res[i] = 1
+			changed = true
+		default:
+			res[i] = 0
+		}
+	}
+	if changed {
+		s.notify(NotifyModule, event, key)
+	}
+	return res
+}
+
+/*
+BF.ADD/BF.MADD, creating the filter with the configured defaults
+*/
+func (s *Storage) BFAdd(key string, items []string) []any {
+	return s.bfInsert(key, config.BFDefaultErrorRate, config.BFDefaultCapacity, config.BFDefaultExpansion, false, items, "bf.add")
+}
+
+/*
+Check `items` against the bloom filter at `key`, a missing filter contains
+nothing
+*/
+func (s *Storage) BFQuery(key string, items []string) []int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	res := make([]int, len(items))
+	bloom, ok := lookup(s.bf, key)
+	if !ok {
+		return res
+	}
+	for i, item := range items {
+		if bloom.Exist(item) {
+			res[i] = 1
+		}
+	}
+	return res
+}
+
+func (s *Storage) BFInfo(key string) (BloomInfo, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	bloom, ok := lookup(s.bf, key)
+	if !ok {
+		return BloomInfo{}, false
+	}
+	return bloom.Info(), true
+}
+
+func (s *Storage) BFScanDump(key string, iter int64) (int64, []byte, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	bloom, ok := lookup(s.bf, key)
+	if !ok {
+		return 0, nil, false
+	}
+	next, chunk := bloom.ScanDump(iter)
+	return next, chunk, true
+}
+
+/*
+Restore a chunk produced by BF.SCANDUMP, iterator 1 carries the header and
+creates the filter
+*/
+func (s *Storage) BFLoadChunk(key string, iter int64, data []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	bloom, ok := lookup(s.bf, key)
+	if iter == 1 {
+		if ok {
+			return errors.New("ERR item exists")
+		}
+		bloom, err := scalableBloomFromHeader(data)
+		if err != nil {
+			return err
+		}
+		s.put(key, bloom, 0)
+		s.notify(NotifyModule, "bf.loadchunk", key)
+		return nil
+	}
+	if !ok {
+		return errors.New("ERR not found")
+	}
+	if err := bloom.LoadChunk(iter, data); err != nil {
+		return err
+	}
+	s.notify(NotifyModule, "bf.loadchunk", key)
+	return nil
+}
+
+func (s *Storage) CMSScanDump(key string, iter int64) (int64, []byte, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	cms, ok := lookup(s.cms, key)
+	if !ok {
+		return 0, nil, false
+	}
+	next, chunk := cms.ScanDump(iter)
+	return next, chunk, true
+}
+
+/*
+Restore a chunk produced by CMS.SCANDUMP, iterator 1 carries the header and
+creates the sketch
+*/
+func (s *Storage) CMSLoadChunk(key string, iter int64, data []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	cms, ok := lookup(s.cms, key)
+	if iter == 1 {
+		if ok {
+			return errors.New("ERR item exists")
+		}
+		cms, err := cmsFromHeader(data)
+		if err != nil {
+			return err
+		}
+		s.put(key, cms, 0)
+		s.notify(NotifyModule, "cms.loadchunk", key)
+		return nil
+	}
+	if !ok {
+		return errors.New("ERR not found")
+	}
+	if err := cms.LoadChunk(iter, data); err != nil {
+		return err
+	}
+	s.notify(NotifyModule, "cms.loadchunk", key)
+	return nil
+}
+
+func (s *Storage) NewCF(key string, capacity uint64, bucketSize uint64, maxIterations int, expansion uint64) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := lookup(s.cf, key); ok {
+		return -1
+	}
+	s.put(key, NewCuckoo(capacity, bucketSize, maxIterations, expansion), 0)
+	s.notify(NotifyModule, "cf.reserve", key)
+	return 1
+}
+
+/*
+Add `items` to the cuckoo filter at `key`, creating it with `capacity` and
+the configured defaults unless `noCreate` is set. With `nx` items already
+present are skipped. Every item gets 1 when added, 0 when skipped or an
+error when the filter is full. Returns nil when the filter does not exist
+and cannot be created
+*/
+func (s *Storage) CFInsert(key string, capacity uint64, noCreate bool, nx bool, items []string) []any {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	cf, ok := lookup(s.cf, key)
+	if !ok {
+		if noCreate {
+			return nil
+		}
+		cf = NewCuckoo(capacity, config.CFDefaultBucketSize, config.CFDefaultMaxIterations, config.CFDefaultExpansion)
+		s.put(key, cf, 0)
+	}
+
+	res := make([]any, len(items))
+	changed := !ok
+	for i, item := range items {
+		added, err := true, error(nil)
+		if nx {
+			added, err = cf.AddNX(item)
+		} else {
+			err = cf.Add(item)
+		}
+		switch {
+		case err != nil:
+			res[i] = err
+		case added:
+			res[i] = 1
+			changed = true
+		default:
+			res[i] = 0
+		}
+	}
+	if changed {
+		s.notify(NotifyModule, "cf.insert", key)
+	}
+	return res
+}
+
+func (s *Storage) CFAdd(key string, items []string, nx bool) []any {
+	return s.CFInsert(key, config.CFDefaultCapacity, false, nx, items)
+}
+
+func (s *Storage) CFExists(key string, items []string) []int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	res := make([]int, len(items))
+	cf, ok := lookup(s.cf, key)
+	if !ok {
+		return res
+	}
+	for i, item := range items {
+		if cf.Exist(item) {
+			res[i] = 1
+		}
+	}
+	return res
+}
+
+func (s *Storage) CFDel(key string, item string) (int, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	cf, ok := lookup(s.cf, key)
+	if !ok {
+		return 0, false
+	}
+	if cf.Del(item) {
+		s.notify(NotifyModule, "cf.del", key)
+		return 1, true
+	}
+	return 0, true
+}
+
+func (s *Storage) CFCount(key string, item string) int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	cf, ok := lookup(s.cf, key)
+	if !ok {
+		return 0
+	}
+	return cf.Count(item)
+}
+
+func (s *Storage) CFInfo(key string) (CuckooInfo, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	cf, ok := lookup(s.cf, key)
+	if !ok {
+		return CuckooInfo{}, false
+	}
+	return cf.Info(), true
+}
+
+func (s *Storage) NewTopK(key string, k uint32, width uint32, depth uint32, decay float64) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := lookup(s.topk, key); ok {
+		return -1
+	}
+	s.put(key, NewTopK(k, width, depth, decay), 0)
+	s.notify(NotifyModule, "topk.reserve", key)
+	return 1
+}
+
+/*
+Increase every item by its matching value, each entry of the result is the
+item expelled from the top k list or nil
+*/
+func (s *Storage) TopKIncrBy(key string, items []string, values []uint32) ([]any, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	topk, ok := lookup(s.topk, key)
+	if !ok {
+		return nil, false
+	}
+	res := make([]any, len(items))
+	for i, item := range items {
+		if expelled, ok := topk.IncrBy(item, values[i]); ok {
+			res[i] = expelled
+		}
+	}
+	s.notify(NotifyModule, "topk.incrby", key)
+	return res, true
+}
+
+func (s *Storage) TopKQuery(key string, items []string) ([]int, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	topk, ok := lookup(s.topk, key)
+	if !ok {
+		return nil, false
+	}
+	res := make([]int, len(items))
+	for i, item := range items {
+		if topk.Query(item) {
+			res[i] = 1
+		}
+	}
+	return res, true
+}
+
+func (s *Storage) TopKCount(key string, items []string) ([]int, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	topk, ok := lookup(s.topk, key)
+	if !ok {
+		return nil, false
+	}
+	res := make([]int, len(items))
+	for i, item := range items {
+		res[i] = int(topk.Count(item))
+	}
+	return res, true
+}
+
+func (s *Storage) TopKList(key string) ([]TopKItem, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	topk, ok := lookup(s.topk, key)
+	if !ok {
+		return nil, false
+	}
+	return topk.List(), true
+}
+
+func (s *Storage) TopKInfo(key string) (TopKInfo, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	topk, ok := lookup(s.topk, key)
+	if !ok {
+		return TopKInfo{}, false
+	}
+	return topk.Info(), true
+}
+
+/*
+HyperLogLog stored at `key`, nil when the key does not exist
+*/
+func (s *Storage) hll(key string) (*HLL, error) {
+	obj, ok := s.dict.Get(key)
+	if !ok {
+		return nil, nil
+	}
+	str, ok := obj.Value.(string)
+	if !ok {
+		return nil, ErrHLLWrongType
+	}
+	return HLLFromString(str)
+}
+
+/*
+Add `items` to the HyperLogLog at `key`, creating it when missing. Returns 1
+when the key was created or a register changed
+*/
+func (s *Storage) PFAdd(key string, items []string) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	h, err := s.hll(key)
+	if err != nil {
+		return 0, err
+	}
+	created := h == nil
+	if created {
+		h = NewHLL()
+	}
+	if !h.Add(items...) && !created {
+		return 0, nil
+	}
+	s.dict.SetKeepTTL(key, h.String())
+	s.notify(NotifyString, "pfadd", key)
+	return 1, nil
+}
+
+/*
+Cardinality of the union of `keys`, missing keys count as empty. A single
+key gets its cached cardinality refreshed
+*/
+func (s *Storage) PFCount(keys []string) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	hlls := make([]*HLL, 0, len(keys))
+	for _, key := range keys {
+		h, err := s.hll(key)
+		if err != nil {
+			return 0, err
+		}
+		if h != nil {
+			hlls = append(hlls, h)
+		}
+	}
+
+	if len(keys) == 1 {
+		if len(hlls) == 0 {
+			return 0, nil
+		}
+		card := hlls[0].Count()
+		s.dict.SetKeepTTL(keys[0], hlls[0].String())
+		return int(card), nil
+	}
+	return int(HLLUnionCount(hlls)), nil
+}
+
+/*
+Merge the `srcs` HyperLogLogs into `dest`, which is created when missing
+*/
+func (s *Storage) PFMerge(dest string, srcs []string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	target, err := s.hll(dest)
+	if err != nil {
+		return err
+	}
+	hlls := make([]*HLL, 0, len(srcs))
+	for _, key := range srcs {
+		h, err := s.hll(key)
+		if err != nil {
+			return err
+		}
+		if h != nil {
+			hlls = append(hlls, h)
+		}
+	}
+
+	if target == nil {
+		target = NewHLL()
+	}
+	target.Merge(hlls)
+	s.dict.SetKeepTTL(dest, target.String())
+	s.notify(NotifyString, "pfadd", dest)
+	return nil
+}
+
+func (s *Storage) NewTDigest(key string, compression float64) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := lookup(s.tdigest, key); ok {
+		return -1
+	}
+	s.put(key, NewTDigest(compression), 0)
+	s.notify(NotifyModule, "tdigest.create", key)
+	return 1
+}
+
+func (s *Storage) TDigestAdd(key string, values []float64) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	td, ok := lookup(s.tdigest, key)
+	if !ok {
+		return false
+	}
+	for _, v := range values {
+		td.Add(v)
+	}
+	s.notify(NotifyModule, "tdigest.add", key)
+	return true
+}
+
+func (s *Storage) TDigestReset(key string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	td, ok := lookup(s.tdigest, key)
+	if !ok {
+		return false
+	}
+	td.Reset()
+	s.notify(NotifyModule, "tdigest.reset", key)
+	return true
+}
+
+/*
+Run `fn` on the digest at `key`. Queries flush the digest buffer, so this
+takes the write lock
+*/
+func (s *Storage) TDigestQuery(key string, fn func(td *TDigest)) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	td, ok := lookup(s.tdigest, key)
+	if !ok {
+		return false
+	}
+	fn(td)
+	return true
+}
+
+/*
+Merge the `srcs` digests into `dest`. A missing `dest` is created with
+`compression`, or the largest source compression when it is 0. `override`
+discards the current content of `dest` first
+*/
+func (s *Storage) TDigestMerge(dest string, srcs []string, compression float64, override bool) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	digests := make([]*TDigest, len(srcs))
+	var maxCompression float64
+	for i, src := range srcs {
+		td, ok := lookup(s.tdigest, src)
+		if !ok {
+			return false
+		}
+		digests[i] = td
+		maxCompression = max(maxCompression, td.Compression())
+	}
+	if compression == 0 {
+		compression = maxCompression
+	}
+
+	target, ok := lookup(s.tdigest, dest)
+	if !ok || override {
+		target = NewTDigest(compression)
+	}
+	target.Merge(digests)
+	s.put(dest, target, 0)
+	s.notify(NotifyModule, "tdigest.merge", dest)
+	return true
+}
+
+type TSCreateOpts struct {
+	Retention       int64
+	DuplicatePolicy string
+	Labels          []TSLabel
+}
+
+type TSRangeResult struct {
+	Key     string
+	Labels  []TSLabel
+	Samples []Sample
+}
+
+func (s *Storage) TSCreate(key string, opts TSCreateOpts) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := lookup(s.tseries, key); ok {
+		return ErrTSExists
+	}
+	s.put(key, NewTimeSeries(opts.Retention, opts.DuplicatePolicy, opts.Labels), 0)
+	s.notify(NotifyModule, "ts.create", key)
+	return nil
+}
+
+/*
+Add a sample to the series at `key`, creating it with `opts` when missing
+unless `opts` is nil. `onDuplicate` overrides the DUPLICATE_POLICY of the
+series for this sample
+*/
+func (s *Storage) TSAdd(key string, timestamp int64, value float64, onDuplicate string, opts *TSCreateOpts) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := lookup(s.tseries, key); !ok {
+		if opts == nil {
+			return ErrTSNotFound
+		}
+		s.put(key, NewTimeSeries(opts.Retention, opts.DuplicatePolicy, opts.Labels), 0)
+	}
+	return s.tsAdd(key, Sample{Timestamp: timestamp, Value: value}, onDuplicate)
+}
+
+/*
+Add `sample` and cascade whatever the compaction rules emit into their
+destination series
+*/
+func (s *Storage) tsAdd(key string, sample Sample, onDuplicate string) error {
+	series, ok := lookup(s.tseries, key)
+	if !ok {
+		return ErrTSNotFound
+	}
+	emitted, err := series.Add(sample.Timestamp, sample.Value, onDuplicate)
+	if err != nil {
+		return err
+	}
+	s.notify(NotifyModule, "ts.add", key)
+	for dest, samples := range emitted {
+		for _, sample := range samples {
+			s.tsAdd(dest, sample, TSDuplicateLast)
+		}
+	}
+	return nil
+}
+
+func (s *Storage) TSRange(key string, from int64, to int64) ([]Sample, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	series, ok := lookup(s.tseries, key)
+	if !ok {
+		return nil, ErrTSNotFound
+	}
+	return series.Range(from, to), nil
+}
+
+/*
+Range of every series matching all `filters`, ordered by key
+*/
+func (s *Storage) TSMRange(from int64, to int64, filters []TSFilter) []TSRangeResult {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	res := make([]TSRangeResult, 0)
+	for key, series := range s.tseries {
+		if series.matches(filters) {
+			res = append(res, TSRangeResult{Key: key, Labels: series.Labels(), Samples: series.Range(from, to)})
+		}
+	}
+	slices.SortFunc(res, func(a, b TSRangeResult) int {
+		return strings.Compare(a.Key, b.Key)
+	})
+	return res
+}
+
+/*
+Compact `src` into `dest` with `agg` over buckets of `bucket` milliseconds.
+A destination is fed by a single source and cannot compact further itself
+*/
+func (s *Storage) TSCreateRule(src string, dest string, agg string, bucket int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if src == dest {
+		return ErrTSRuleSameKey
+	}
+	source, ok := lookup(s.tseries, src)
+	if !ok {
+		return ErrTSNotFound
+	}
+	target, ok := lookup(s.tseries, dest)
+	if !ok {
+		return ErrTSNotFound
+	}
+	if target.srcKey != "" {
+		return ErrTSRuleDestSrc
+	}
+	if len(target.rules) > 0 {
+		return ErrTSRuleDestRules
+	}
+	if err := source.addRule(dest, agg, bucket); err != nil {
+		return err
+	}
+	target.srcKey = src
+	s.notify(NotifyModule, "ts.createrule", src)
+	return nil
+}
+
+var ErrStreamKeyRequired = errors.New("ERR The XGROUP subcommand requires the key to exist. Note that for CREATE you may want to use the MKSTREAM option to create an empty stream automatically.")
+
+type StreamReadResult struct {
+	Key     string
+	Entries []StreamEntry
+}
+
+/*
+Add an entry to the stream at `key` and trim it with `trim` when not nil.
+A missing stream is created unless `noMkStream` is set, in which case false
+is returned
+*/
+func (s *Storage) XAdd(key string, idSpec string, fields []string, noMkStream bool, trim *StreamTrim) (StreamID, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	st, ok := lookup(s.streams, key)
+	if !ok {
+		if noMkStream {
+			return StreamID{}, false, nil
+		}
+		st = NewStream()
+	}
+	id, err := st.NextID(idSpec)
+	if err != nil {
+		return id, false, err
+	}
+	st.Add(id, fields)
+	s.put(key, st, 0)
+	if !ok {
+		s.notify(NotifyNew, "new", key)
+	}
+	s.notify(NotifyStream, "xadd", key)
+	if trim != nil && st.Trim(*trim) > 0 {
+		s.notify(NotifyStream, "xtrim", key)
+	}
+	s.signalStream(key)
+	return id, true, nil
+}
+
+func (s *Storage) XLen(key string) int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if st, ok := lookup(s.streams, key); ok {
+		return st.Len()
+	}
+	return 0
+}
+
+func (s *Storage) XRange(key string, start StreamID, end StreamID, count int, rev bool) []StreamEntry {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	st, ok := lookup(s.streams, key)
+	if !ok {
+		return make([]StreamEntry, 0)
+	}
+	return st.Range(start, end, count, rev)
+}
+
+func (s *Storage) XDel(key string, ids []StreamID) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	st, ok := lookup(s.streams, key)
+	if !ok {
+		return 0
+	}
+	deleted := st.Del(ids)
+	if deleted > 0 {
+		s.notify(NotifyStream, "xdel", key)
+	}
+	return deleted
+}
+
+func (s *Storage) XTrim(key string, trim StreamTrim) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	st, ok := lookup(s.streams, key)
+	if !ok {
+		return 0
+	}
+	trimmed := st.Trim(trim)
+	if trimmed > 0 {
+		s.notify(NotifyStream, "xtrim", key)
+	}
+	return trimmed
+}
+
+/*
+Wake up the clients blocked on `key`
+*/
+func (s *Storage) signalStream(key string) {
+	for _, wake := range s.streamWaiters[key] {
+		select {
+		case wake <- struct{}{}:
+		default:
+		}
+	}
+	delete(s.streamWaiters, key)
+}
+
+func (s *Storage) removeStreamWaiter(keys []string, wake chan struct{}) {
+	for _, key := range keys {
+		waiters := slices.DeleteFunc(s.streamWaiters[key], func(c chan struct{}) bool { return c == wake })
+		if len(waiters) == 0 {
+			delete(s.streamWaiters, key)
+		} else {
+			s.streamWaiters[key] = waiters
+		}
+	}
+}
+
+/*
+Run `try` under the lock until it returns true, waiting for an XADD on one
+of `keys` in between. A negative `block` does not wait and 0 waits forever.
+Returns false on timeout
+*/
+func (s *Storage) blockOnStreams(keys []string, block time.Duration, try func() bool) bool {
+	var timeout <-chan time.Time
+	if block > 0 {
+		timer := time.NewTimer(block)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	for {
+		s.mu.Lock()
+		if try() {
+			s.mu.Unlock()
+			return true
+		}
+		if block < 0 {
+			s.mu.Unlock()
+			return false
+		}
+		wake := make(chan struct{}, 1)
+		for _, key := range keys {
+			s.streamWaiters[key] = append(s.streamWaiters[key], wake)
+		}
+		s.mu.Unlock()
+
+		timedOut := false
+		select {
+		case <-wake:
+		case <-timeout:
+			timedOut = true
+		}
+		s.mu.Lock()
+		s.removeStreamWaiter(keys, wake)
+		s.mu.Unlock()
+		if timedOut {
+			return false
+		}
+	}
+}
+
+/*
+XREAD: entries after `after[i]` for every `keys[i]`, a nil ID standing for
+the last ID of the stream when the command was called. Returns nil when no
+stream has new entries before `block` expires
+*/
+func (s *Storage) XRead(keys []string, after []*StreamID, count int, block time.Duration) []StreamReadResult {
+	from := make([]StreamID, len(keys))
+	s.mu.RLock()
+	for i, key := range keys {
+		if after[i] != nil {
+			from[i] = *after[i]
+		} else if st, ok := lookup(s.streams, key); ok {
+			from[i] = st.LastID()
+		}
+	}
+	s.mu.RUnlock()
+
+	var res []StreamReadResult
+	s.blockOnStreams(keys, block, func() bool {
+		for i, key := range keys {
+			st, ok := lookup(s.streams, key)
+			if !ok {
+				continue
+			}
+			start, ok := from[i].next()
+			if !ok {
+				continue
+			}
+			if entries := st.Range(start, MaxStreamID, count, false); len(entries) > 0 {
+				res = append(res, StreamReadResult{Key: key, Entries: entries})
+			}
+		}
+		return res != nil
+	})
+	return res
+}
+
+/*
+XREADGROUP for `consumer` of `group`. A nil ID (`>`) asks for entries never
+delivered to the group, which is what blocking waits for; an explicit ID
+reads back the pending entries of the consumer and never blocks
+*/
+func (s *Storage) XReadGroup(group string, consumer string, keys []string, after []*StreamID, count int, noAck bool, block time.Duration) ([]StreamReadResult, error) {
+	var res []StreamReadResult
+	var err error
+	history := !slices.Contains(after, nil)
+	if history {
+		block = -1
+	}
+	s.blockOnStreams(keys, block, func() bool {
+		res = res[:0]
+		for i, key := range keys {
+			st, g, gErr := s.streamGroup(key, group)
+			if gErr != nil {
+				err = fmt.Errorf("%w in XREADGROUP with GROUP option", gErr)
+				return true
+			}
+			var entries []StreamEntry
+			if after[i] == nil {
+				entries = st.ReadGroup(g, consumer, StreamID{}, true, count, noAck)
+			} else {
+				entries = st.ReadGroup(g, consumer, *after[i], false, count, noAck)
+			}
+			if len(entries) > 0 || history {
+				res = append(res, StreamReadResult{Key: key, Entries: entries})
+			}
+		}
+		return len(res) > 0
+	})
+	if err != nil || len(res) == 0 {
+		return nil, err
+	}
+	return res, nil
+}
+
+func (s *Storage) streamGroup(key string, group string) (*Stream, *ConsumerGroup, error) {
+	st, ok := lookup(s.streams, key)
+	if !ok {
+		return nil, nil, NoGroupError(key, group)
+	}
+	g, ok := st.Group(group)
+	if !ok {
+		return nil, nil, NoGroupError(key, group)
+	}
+	return st, g, nil
+}
+
+/*
+XGROUP CREATE, a nil `id` ($) starting from the last entry of the stream
+*/
+func (s *Storage) XGroupCreate(key string, group string, id *StreamID, mkStream bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	st, ok := lookup(s.streams, key)
+	if !ok {
+		if !mkStream {
+			return ErrStreamKeyRequired
+		}
+		st = NewStream()
+		s.put(key, st, 0)
+		s.notify(NotifyNew, "new", key)
+	}
+	lastID := st.LastID()
+	if id != nil {
+		lastID = *id
+	}
+	if err := st.CreateGroup(group, lastID); err != nil {
+		return err
+	}
+	s.notify(NotifyStream, "xgroup-create", key)
+	return nil
+}
+
+/*
+Run `fn` on `group` of the stream at `key` under the write lock
+*/
+func (s *Storage) XGroupQuery(key string, group string, fn func(st *Stream, g *ConsumerGroup)) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	st, g, err := s.streamGroup(key, group)
+	if err != nil {
+		return err
+	}
+	fn(st, g)
+	return nil
+}
+
+func (s *Storage) XAck(key string, group string, ids []StreamID) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, g, err := s.streamGroup(key, group)
+	if err != nil {
+		return 0
+	}
+	return g.Ack(ids)
+}
+
+/*
+Run `fn` on the stream at `key` under the write lock
+*/
+func (s *Storage) XStreamQuery(key string, fn func(st *Stream)) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	st, ok := lookup(s.streams, key)
+	if !ok {
+		return false
+	}
+	fn(st)
+	return true
+}
+
+/*
+GEOSEARCH over the geo index at `key`, a missing key is an empty index
+*/
+func (s *Storage) GeoSearch(key string, q *GeoQuery) ([]GeoPoint, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	z := s.zset(key)
+	if z == nil {
+		return []GeoPoint{}, nil
+	}
+	return z.GeoSearch(q)
+}
+
+/*
+GEOSEARCHSTORE: replace `dest` with the points found in `src`, scored by
+their geohash or, with `storeDist`, by their distance divided by `unit`
+*/
+func (s *Storage) GeoSearchStore(dest string, src string, q *GeoQuery, storeDist bool, unit float64) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var points []GeoPoint
+	if z := s.zset(src); z != nil {
+		var err error
+		if points, err = z.GeoSearch(q); err != nil {
+			return 0, err
+		}
+	}
+	elements := make([]ZElement, len(points))
+	for i, p := range points {
+		elements[i] = ZElement{Member: p.Member, Score: p.Score}
+		if storeDist {
+			elements[i].Score = p.Dist / unit
+		}
+	}
+	sortZElements(elements)
+	s.zstore(dest, elements, "geosearchstore")
+	return len(elements), nil
 }
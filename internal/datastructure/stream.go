@@ -0,0 +1,571 @@
+package datastructure
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"tcp-server.com/m/internal/config"
+)
+
+var (
+	ErrStreamID          = errors.New("ERR Invalid stream ID specified as stream command argument")
+	ErrStreamIDTooSmall  = errors.New("ERR The ID specified in XADD is equal or smaller than the target stream top item")
+	ErrStreamIDZero      = errors.New("ERR The ID specified in XADD must be greater than 0-0")
+	ErrStreamIDExhausted = errors.New("ERR The stream has exhausted the last possible ID, unable to add more items")
+)
+
+type StreamID struct {
+	Ms, Seq uint64
+}
+
+var MaxStreamID = StreamID{Ms: math.MaxUint64, Seq: math.MaxUint64}
+
+func (id StreamID) String() string {
+	return strconv.FormatUint(id.Ms, 10) + "-" + strconv.FormatUint(id.Seq, 10)
+}
+
+func (id StreamID) Compare(other StreamID) int {
+	switch {
+	case id.Ms < other.Ms:
+		return -1
+	case id.Ms > other.Ms:
+		return 1
+	case id.Seq < other.Seq:
+		return -1
+	case id.Seq > other.Seq:
+		return 1
+	}
+	return 0
+}
+
+/*
+Big endian key, so the radix tree orders IDs numerically
+*/
+func (id StreamID) key() []byte {
+	buf := make([]byte, 16)
+	binary.BigEndian.PutUint64(buf, id.Ms)
+	binary.BigEndian.PutUint64(buf[8:], id.Seq)
+	return buf
+}
+
+func streamIDFromKey(key []byte) StreamID {
+	return StreamID{Ms: binary.BigEndian.Uint64(key), Seq: binary.BigEndian.Uint64(key[8:])}
+}
+
+func (id StreamID) next() (StreamID, bool) {
+	switch {
+	case id.Seq < math.MaxUint64:
+		return StreamID{Ms: id.Ms, Seq: id.Seq + 1}, true
+	case id.Ms < math.MaxUint64:
+		return StreamID{Ms: id.Ms + 1}, true
+	}
+	return id, false
+}
+
+func (id StreamID) prev() (StreamID, bool) {
+	switch {
+	case id.Seq > 0:
+		return StreamID{Ms: id.Ms, Seq: id.Seq - 1}, true
+	case id.Ms > 0:
+		return StreamID{Ms: id.Ms - 1, Seq: math.MaxUint64}, true
+	}
+	return id, false
+}
+
+/*
+Parse `ms-seq` or `ms`, a missing sequence taking `missingSeq`
+*/
+func ParseStreamID(arg string, missingSeq uint64) (StreamID, error) {
+	msPart, seqPart, hasSeq := strings.Cut(arg, "-")
+	ms, err := strconv.ParseUint(msPart, 10, 64)
+	if err != nil {
+		return StreamID{}, ErrStreamID
+	}
+	if !hasSeq {
+		return StreamID{Ms: ms, Seq: missingSeq}, nil
+	}
+	seq, err := strconv.ParseUint(seqPart, 10, 64)
+	if err != nil {
+		return StreamID{}, ErrStreamID
+	}
+	return StreamID{Ms: ms, Seq: seq}, nil
+}
+
+/*
+Parse a bound of XRANGE: `-` and `+` for the smallest and largest IDs, and a
+leading `(` for an exclusive bound
+*/
+func ParseStreamRangeID(arg string, isEnd bool) (StreamID, error) {
+	switch arg {
+	case "-":
+		return StreamID{}, nil
+	case "+":
+		return MaxStreamID, nil
+	}
+	exclusive := strings.HasPrefix(arg, "(")
+	missingSeq := uint64(0)
+	if isEnd {
+		missingSeq = math.MaxUint64
+	}
+	id, err := ParseStreamID(strings.TrimPrefix(arg, "("), missingSeq)
+	if err != nil || !exclusive {
+		return id, err
+	}
+
+	var ok bool
+	if isEnd {
+		id, ok = id.prev()
+	} else {
+		id, ok = id.next()
+	}
+	if !ok {
+		return id, errors.New("ERR invalid start ID for the interval")
+	}
+	return id, nil
+}
+
+type StreamEntry struct {
+	ID StreamID
+	// Flattened field value pairs, nil for an entry deleted while pending
+	Fields []string
+}
+
+const (
+	streamFlagDeleted    = 1 << 0
+	streamFlagSameFields = 1 << 1
+)
+
+/*
+Packed run of entries, keyed in the radix tree by its first (master) ID.
+Every entry is a flags byte, the ms delta to the master ID as uvarint, the
+seq delta as varint and then, unless it reuses the field names of the master
+entry (streamFlagSameFields), the field count and names, followed by the
+values. Strings are length prefixed. Deleting an entry only sets its flag
+*/
+type streamNode struct {
+	master       StreamID
+	masterFields []string
+	buf          []byte
+	count        int
+	live         int
+}
+
+type streamRawEntry struct {
+	offset int
+	StreamEntry
+	deleted bool
+}
+
+func appendString(buf []byte, s string) []byte {
+	buf = binary.AppendUvarint(buf, uint64(len(s)))
+	return append(buf, s...)
+}
+
+func readString(buf []byte) (string, []byte) {
+	n, size := binary.Uvarint(buf)
+	buf = buf[size:]
+	return string(buf[:n]), buf[n:]
+}
+
+func newStreamNode(id StreamID, fields []string) *streamNode {
+	names := make([]string, 0, len(fields)/2)
+	for i := 0; i < len(fields); i += 2 {
+		names = append(names, fields[i])
+	}
+	return &streamNode{master: id, masterFields: names}
+}
+
+func (n *streamNode) full() bool {
+	return n.count >= config.StreamNodeMaxEntries || len(n.buf) >= config.StreamNodeMaxBytes
+}
+
+func (n *streamNode) sameFields(fields []string) bool {
+	if len(fields) != len(n.masterFields)*2 {
+		return false
+	}
+	for i, name := range n.masterFields {
+		if fields[i*2] != name {
+			return false
+		}
+	}
+	return true
+}
+
+func (n *streamNode) append(id StreamID, fields []string) {
+	same := n.sameFields(fields)
+	flags := byte(0)
+	if same {
+		flags |= streamFlagSameFields
+	}
+	n.buf = append(n.buf, flags)
+	n.buf = binary.AppendUvarint(n.buf, id.Ms-n.master.Ms)
+	n.buf = binary.AppendVarint(n.buf, int64(id.Seq-n.master.Seq))
+	if !same {
+		n.buf = binary.AppendUvarint(n.buf, uint64(len(fields)/2))
+		for i := 0; i < len(fields); i += 2 {
+			n.buf = appendString(n.buf, fields[i])
+		}
+	}
+	for i := 1; i < len(fields); i += 2 {
+		n.buf = appendString(n.buf, fields[i])
+	}
+	n.count++
+	n.live++
+}
+
+func (n *streamNode) entries() []streamRawEntry {
+	res := make([]streamRawEntry, 0, n.count)
+	buf := n.buf
+	for len(buf) > 0 {
+		e := streamRawEntry{offset: len(n.buf) - len(buf)}
+		flags := buf[0]
+		buf = buf[1:]
+		msDelta, size := binary.Uvarint(buf)
+		buf = buf[size:]
+		seqDelta, size := binary.Varint(buf)
+		buf = buf[size:]
+		e.ID = StreamID{Ms: n.master.Ms + msDelta, Seq: n.master.Seq + uint64(seqDelta)}
+		e.deleted = flags&streamFlagDeleted != 0
+
+		names := n.masterFields
+		if flags&streamFlagSameFields == 0 {
+			num, size := binary.Uvarint(buf)
+			buf = buf[size:]
+			names = make([]string, num)
+			for i := range names {
+				names[i], buf = readString(buf)
+			}
+		}
+		e.Fields = make([]string, 0, len(names)*2)
+		for _, name := range names {
+			var value string
+			value, buf = readString(buf)
+			e.Fields = append(e.Fields, name, value)
+		}
+		res = append(res, e)
+	}
+	return res
+}
+
+func (n *streamNode) markDeleted(e streamRawEntry) {
+	n.buf[e.offset] |= streamFlagDeleted
+	n.live--
+}
+
+func (n *streamNode) lastID() StreamID {
+	entries := n.entries()
+	return entries[len(entries)-1].ID
+}
+
+type Stream struct {
+	rax          *rax
+	length       int
+	lastID       StreamID
+	maxDeletedID StreamID
+	entriesAdded uint64
+	groups       map[string]*ConsumerGroup
+	groupNames   []string
+	access
+}
+
+func NewStream() *Stream {
+	return &Stream{rax: newRax(), groups: make(map[string]*ConsumerGroup)}
+}
+
+func (s *Stream) Len() int {
+	return s.length
+}
+
+func (s *Stream) LastID() StreamID {
+	return s.lastID
+}
+
+/*
+ID for XADD from `*`, `ms-*` or an explicit `ms-seq`, which must be greater
+than the last ID of the stream
+*/
+func (s *Stream) NextID(spec string) (StreamID, error) {
+	if spec == "*" {
+		ms := uint64(time.Now().UnixMilli())
+		if ms > s.lastID.Ms {
+			return StreamID{Ms: ms}, nil
+		}
+		id, ok := s.lastID.next()
+		if !ok {
+			return id, ErrStreamIDExhausted
+		}
+		return id, nil
+	}
+
+	var id StreamID
+	if msPart, found := strings.CutSuffix(spec, "-*"); found {
+		ms, err := strconv.ParseUint(msPart, 10, 64)
+		if err != nil {
+			return id, ErrStreamID
+		}
+		id = StreamID{Ms: ms}
+		if ms == s.lastID.Ms {
+			if s.lastID.Seq == math.MaxUint64 {
+				return id, ErrStreamIDTooSmall
+			}
+			id.Seq = s.lastID.Seq + 1
+		}
+	} else {
+		var err error
+		if id, err = ParseStreamID(spec, 0); err != nil {
+			return id, err
+		}
+	}
+
+	if id == (StreamID{}) {
+		return id, ErrStreamIDZero
+	}
+	if id.Compare(s.lastID) <= 0 {
+		return id, ErrStreamIDTooSmall
+	}
+	return id, nil
+}
+
+func (s *Stream) lastNode() *streamNode {
+	var res *streamNode
+	s.rax.Descend(nil, func(_ []byte, v any) bool {
+		res = v.(*streamNode)
+		return false
+	})
+	return res
+}
+
+/*
+Node holding `id`: the one with the greatest master ID <= `id`
+*/
+func (s *Stream) floorNode(id StreamID) (*streamNode, bool) {
+	var res *streamNode
+	s.rax.Descend(id.key(), func(_ []byte, v any) bool {
+		res = v.(*streamNode)
+		return false
+	})
+	return res, res != nil
+}
+
+/*
+Append an entry, `id` must come from NextID
+*/
+func (s *Stream) Add(id StreamID, fields []string) {
+	n := s.lastNode()
+	if n == nil || n.full() {
+		n = newStreamNode(id, fields)
+		s.rax.Insert(id.key(), n)
+	}
+	n.append(id, fields)
+	s.length++
+	s.lastID = id
+	s.entriesAdded++
+}
+
+/*
+Entries with IDs between `start` and `end` inclusive, at most `count` of
+them when positive, in descending order when `rev` is set
+*/
+func (s *Stream) Range(start StreamID, end StreamID, count int, rev bool) []StreamEntry {
+	res := make([]StreamEntry, 0)
+	if start.Compare(end) > 0 {
+		return res
+	}
+	visit := func(e streamRawEntry) bool {
+		if !e.deleted && e.ID.Compare(start) >= 0 && e.ID.Compare(end) <= 0 {
+			res = append(res, e.StreamEntry)
+		}
+		return count <= 0 || len(res) < count
+	}
+
+	if rev {
+		s.rax.Descend(end.key(), func(_ []byte, v any) bool {
+			n := v.(*streamNode)
+			entries := n.entries()
+			for i := len(entries) - 1; i >= 0; i-- {
+				if !visit(entries[i]) {
+					return false
+				}
+			}
+			return n.master.Compare(start) > 0
+		})
+		return res
+	}
+
+	from := start
+	if n, ok := s.floorNode(start); ok {
+		from = n.master
+	}
+	s.rax.Ascend(from.key(), func(_ []byte, v any) bool {
+		n := v.(*streamNode)
+		if n.master.Compare(end) > 0 {
+			return false
+		}
+		for _, e := range n.entries() {
+			if !visit(e) {
+				return false
+			}
+		}
+		return true
+	})
+	return res
+}
+
+func (s *Stream) Get(id StreamID) (StreamEntry, bool) {
+	res := s.Range(id, id, 1, false)
+	if len(res) == 0 {
+		return StreamEntry{}, false
+	}
+	return res[0], true
+}
+
+func (s *Stream) removeNode(n *streamNode) {
+	s.rax.Remove(n.master.key())
+}
+
+/*
+Delete entries by ID, returns how many existed
+*/
+func (s *Stream) Del(ids []StreamID) int {
+	deleted := 0
+	for _, id := range ids {
+		n, ok := s.floorNode(id)
+		if !ok {
+			continue
+		}
+		for _, e := range n.entries() {
+			if e.ID != id || e.deleted {
+				continue
+			}
+			n.markDeleted(e)
+			if n.live == 0 {
+				s.removeNode(n)
+			}
+			s.length--
+			deleted++
+			if id.Compare(s.maxDeletedID) > 0 {
+				s.maxDeletedID = id
+			}
+		}
+	}
+	return deleted
+}
+
+const (
+	StreamTrimMaxLen = iota
+	StreamTrimMinID
+)
+
+type StreamTrim struct {
+	Strategy int
+	MaxLen   int
+	MinID    StreamID
+	// Approximate trimming (~) only drops whole nodes, at most Limit entries
+	// when Limit is positive
+	Approx bool
+	Limit  int
+}
+
+func (t *StreamTrim) exceeds(s *Stream, id StreamID) bool {
+	if t.Strategy == StreamTrimMaxLen {
+		return s.length > t.MaxLen
+	}
+	return id.Compare(t.MinID) < 0
+}
+
+/*
+Evict the oldest entries according to `t`, returns the number removed
+*/
+func (s *Stream) Trim(t StreamTrim) int {
+	removed := 0
+	for s.length > 0 {
+		var n *streamNode
+		s.rax.Ascend(nil, func(_ []byte, v any) bool {
+			n = v.(*streamNode)
+			return false
+		})
+
+		// Drop the node as a whole when all of its entries must go
+		whole := s.length-n.live >= t.MaxLen
+		if t.Strategy == StreamTrimMinID {
+			whole = n.lastID().Compare(t.MinID) < 0
+		}
+		if whole {
+			if t.Approx && t.Limit > 0 && removed+n.live > t.Limit {
+				break
+			}
+			s.removeNode(n)
+			s.length -= n.live
+			removed += n.live
+			continue
+		}
+		if t.Approx {
+			break
+		}
+
+		for _, e := range n.entries() {
+			if e.deleted {
+				continue
+			}
+			if !t.exceeds(s, e.ID) {
+				break
+			}
+			n.markDeleted(e)
+			s.length--
+			removed++
+		}
+		break
+	}
+	return removed
+}
+
+type StreamInfo struct {
+	Length       int
+	RaxKeys      int
+	RaxNodes     int
+	LastID       StreamID
+	MaxDeletedID StreamID
+	EntriesAdded uint64
+	Groups       int
+	First, Last  *StreamEntry
+}
+
+func (s *Stream) Info() StreamInfo {
+	info := StreamInfo{
+		Length:       s.length,
+		RaxKeys:      s.rax.Len(),
+		RaxNodes:     s.rax.Nodes(),
+		LastID:       s.lastID,
+		MaxDeletedID: s.maxDeletedID,
+		EntriesAdded: s.entriesAdded,
+		Groups:       len(s.groups),
+	}
+	if first := s.Range(StreamID{}, MaxStreamID, 1, false); len(first) > 0 {
+		info.First = &first[0]
+	}
+	if last := s.Range(StreamID{}, MaxStreamID, 1, true); len(last) > 0 {
+		info.Last = &last[0]
+	}
+	return info
+}
+
+func (s *Stream) clone() *Stream {
+	res := *s
+	res.rax = s.rax.clone(func(value any) any {
+		n := *value.(*streamNode)
+		n.masterFields = slices.Clone(n.masterFields)
+		n.buf = slices.Clone(n.buf)
+		return &n
+	})
+	res.groups = make(map[string]*ConsumerGroup, len(s.groups))
+	for name, g := range s.groups {
+		res.groups[name] = g.clone()
+	}
+	res.groupNames = slices.Clone(s.groupNames)
+	return &res
+}
@@ -0,0 +1,228 @@
+package datastructure
+
+import (
+	"math/rand"
+	"slices"
+	"sort"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestRaxAgainstSortedKeys(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	tree := newRax()
+	keys := make(map[string]bool)
+	for i := 0; i < 5000; i++ {
+		key := make([]byte, 1+r.Intn(6))
+		for j := range key {
+			key[j] = byte('a' + r.Intn(4))
+		}
+		if r.Intn(3) == 0 {
+			if tree.Remove(key) != keys[string(key)] {
+				t.Fatalf("Remove(%q) disagrees with the reference set", key)
+			}
+			delete(keys, string(key))
+		} else {
+			if tree.Insert(key, string(key)) == keys[string(key)] {
+				t.Fatalf("Insert(%q) disagrees with the reference set", key)
+			}
+			keys[string(key)] = true
+		}
+	}
+	if tree.Len() != len(keys) {
+		t.Fatalf("Len() = %d, want %d", tree.Len(), len(keys))
+	}
+
+	sorted := make([]string, 0, len(keys))
+	for k := range keys {
+		sorted = append(sorted, k)
+	}
+	sort.Strings(sorted)
+
+	for _, from := range []string{"", "b", "bca", "dddddd"} {
+		var got []string
+		tree.Ascend([]byte(from), func(key []byte, v any) bool {
+			if string(key) != v.(string) {
+				t.Fatalf("key %q holds value %q", key, v)
+			}
+			got = append(got, string(key))
+			return true
+		})
+		i := sort.SearchStrings(sorted, from)
+		if !slices.Equal(got, sorted[i:]) {
+			t.Fatalf("Ascend(%q) returned %d keys, want %d", from, len(got), len(sorted[i:]))
+		}
+
+		got = got[:0]
+		tree.Descend([]byte(from), func(key []byte, _ any) bool {
+			got = append(got, string(key))
+			return true
+		})
+		want := slices.Clone(sorted[:sort.Search(len(sorted), func(j int) bool { return sorted[j] > from })])
+		slices.Reverse(want)
+		if !slices.Equal(got, want) {
+			t.Fatalf("Descend(%q) returned %d keys, want %d", from, len(got), len(want))
+		}
+	}
+}
+
+func TestStreamRangeAcrossNodes(t *testing.T) {
+	s := NewStream()
+	var ids []StreamID
+	for i := 0; i < 1000; i++ {
+		id, err := s.NextID(strconv.Itoa(i/3+1) + "-*")
+		if err != nil {
+			t.Fatalf("NextID failed: %v", err)
+		}
+		fields := []string{"n", strconv.Itoa(i)}
+		if i%7 == 0 {
+			fields = []string{"other", strconv.Itoa(i), "x", "y"}
+		}
+		s.Add(id, fields)
+		ids = append(ids, id)
+	}
+	if s.rax.Len() < 2 {
+		t.Fatalf("expected several nodes, got %d", s.rax.Len())
+	}
+
+	all := s.Range(StreamID{}, MaxStreamID, 0, false)
+	if len(all) != len(ids) {
+		t.Fatalf("Range returned %d entries, want %d", len(all), len(ids))
+	}
+	for i, e := range all {
+		if e.ID != ids[i] || e.Fields[1] != strconv.Itoa(i) {
+			t.Fatalf("entry %d = %v %v", i, e.ID, e.Fields)
+		}
+	}
+
+	rev := s.Range(ids[500], ids[520], 5, true)
+	if len(rev) != 5 || rev[0].ID != ids[520] || rev[4].ID != ids[516] {
+		t.Fatalf("reverse range = %v", rev)
+	}
+
+	// Deleting every entry of the first node drops the node
+	first := s.rax.Len()
+	if s.Del(ids[:100]) != 100 || s.Len() != 900 || s.rax.Len() != first-1 {
+		t.Fatalf("after Del: len %d, nodes %d", s.Len(), s.rax.Len())
+	}
+	if _, ok := s.Get(ids[50]); ok {
+		t.Fatal("deleted entry is still returned")
+	}
+
+	if n := s.Trim(StreamTrim{Strategy: StreamTrimMaxLen, MaxLen: 250}); n != 650 || s.Len() != 250 {
+		t.Fatalf("MAXLEN trim removed %d, length %d", n, s.Len())
+	}
+	if got := s.Range(StreamID{}, MaxStreamID, 1, false); got[0].ID != ids[750] {
+		t.Fatalf("first entry after trim = %v, want %v", got[0].ID, ids[750])
+	}
+	if n := s.Trim(StreamTrim{Strategy: StreamTrimMinID, MinID: ids[800], Approx: true}); s.Len()+n != 250 || s.Len() < 200 {
+		t.Fatalf("approximate MINID trim removed %d, length %d", n, s.Len())
+	}
+}
+
+func TestStreamNodeEncoding(t *testing.T) {
+	n := newStreamNode(StreamID{Ms: 10, Seq: 5}, []string{"a", "1"})
+	n.append(StreamID{Ms: 10, Seq: 5}, []string{"a", "1"})
+	n.append(StreamID{Ms: 12, Seq: 0}, []string{"a", "2"})
+	n.append(StreamID{Ms: 1 << 40, Seq: 3}, []string{"b", "3", "c", ""})
+	entries := n.entries()
+	if len(entries) != 3 || entries[1].ID != (StreamID{Ms: 12}) || entries[2].Fields[2] != "c" {
+		t.Fatalf("decoded entries = %+v", entries)
+	}
+	if n.buf[entries[1].offset]&streamFlagSameFields == 0 || n.buf[entries[2].offset]&streamFlagSameFields != 0 {
+		t.Fatal("field names of the master entry are not reused")
+	}
+}
+
+func TestConsumerGroupLifecycle(t *testing.T) {
+	s := NewStream()
+	for i := 1; i <= 5; i++ {
+		s.Add(StreamID{Ms: uint64(i)}, []string{"f", strconv.Itoa(i)})
+	}
+	if err := s.CreateGroup("g", StreamID{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.CreateGroup("g", StreamID{}); err != ErrStreamGroupExists {
+		t.Fatalf("duplicate group error = %v", err)
+	}
+	g, _ := s.Group("g")
+
+	if got := s.ReadGroup(g, "alice", StreamID{}, true, 3, false); len(got) != 3 {
+		t.Fatalf("alice read %d entries", len(got))
+	}
+	if got := s.ReadGroup(g, "bob", StreamID{}, true, 0, false); len(got) != 2 || got[0].ID.Ms != 4 {
+		t.Fatalf("bob read %v", got)
+	}
+	if sum := g.PendingSummary(); sum.Count != 5 || sum.Min.Ms != 1 || sum.Max.Ms != 5 || len(sum.Consumers) != 2 {
+		t.Fatalf("pending summary = %+v", sum)
+	}
+
+	s.Del([]StreamID{{Ms: 2}})
+	history := s.ReadGroup(g, "alice", StreamID{}, false, 0, false)
+	if len(history) != 3 || history[1].Fields != nil {
+		t.Fatalf("alice history = %v", history)
+	}
+	if p := g.PendingRange(0, StreamID{}, MaxStreamID, 10, "alice"); p[0].DeliveryCount != 2 {
+		t.Fatalf("delivery count after history read = %d", p[0].DeliveryCount)
+	}
+
+	if g.Ack([]StreamID{{Ms: 1}, {Ms: 1}, {Ms: 9}}) != 1 {
+		t.Fatal("Ack counted a missing or duplicate ID")
+	}
+
+	claimed := s.Claim(g, "bob", 0, []StreamID{{Ms: 2}, {Ms: 3}}, ClaimOpts{Idle: -1, Time: -1, RetryCount: -1})
+	if len(claimed) != 1 || claimed[0].ID.Ms != 3 {
+		t.Fatalf("claimed %v", claimed)
+	}
+	if p := g.PendingRange(0, StreamID{}, MaxStreamID, 10, ""); len(p) != 3 || p[0].Consumer != "bob" {
+		t.Fatalf("pending after claim = %+v", p)
+	}
+	if claimed := s.Claim(g, "carol", time.Hour.Milliseconds(), []StreamID{{Ms: 3}}, ClaimOpts{Idle: -1, Time: -1, RetryCount: -1}); len(claimed) != 0 {
+		t.Fatal("claimed an entry that was not idle long enough")
+	}
+
+	next, claimed, deleted := s.AutoClaim(g, "carol", 0, StreamID{}, 2, false)
+	if next.Ms != 5 || len(claimed) != 2 || len(deleted) != 0 {
+		t.Fatalf("AutoClaim = %v %v %v", next, claimed, deleted)
+	}
+	if pending := g.DelConsumer("carol"); pending != 2 || g.pel.Len() != 1 {
+		t.Fatalf("DelConsumer dropped %d, %d still pending", pending, g.pel.Len())
+	}
+}
+
+func TestStorageXReadBlocks(t *testing.T) {
+	s := NewStorage()
+	if _, _, err := s.XAdd("s", "1-0", []string{"a", "1"}, false, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan []StreamReadResult)
+	go func() {
+		done <- s.XRead([]string{"s"}, []*StreamID{nil}, 0, 0)
+	}()
+	time.Sleep(20 * time.Millisecond)
+	if _, _, err := s.XAdd("s", "2-0", []string{"a", "2"}, false, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case res := <-done:
+		if len(res) != 1 || len(res[0].Entries) != 1 || res[0].Entries[0].ID.Ms != 2 {
+			t.Fatalf("blocked XREAD returned %+v", res)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("XADD did not wake up the blocked reader")
+	}
+
+	start := time.Now()
+	if res := s.XRead([]string{"s"}, []*StreamID{nil}, 0, 30*time.Millisecond); res != nil {
+		t.Fatalf("XREAD without new entries returned %+v", res)
+	}
+	if time.Since(start) < 30*time.Millisecond {
+		t.Fatal("XREAD returned before its timeout")
+	}
+	if len(s.streamWaiters) != 0 {
+		t.Fatalf("%d waiter lists left behind", len(s.streamWaiters))
+	}
+}
@@ -0,0 +1,440 @@
+package datastructure
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+)
+
+var ErrStreamGroupExists = errors.New("BUSYGROUP Consumer Group name already exists")
+
+func NoGroupError(key string, group string) error {
+	return fmt.Errorf("NOGROUP No such key '%s' or consumer group '%s'", key, group)
+}
+
+/*
+Entry delivered to a consumer and not acknowledged yet
+*/
+type pendingEntry struct {
+	id            StreamID
+	consumer      *Consumer
+	deliveryTime  int64
+	deliveryCount int
+}
+
+type Consumer struct {
+	name       string
+	seenTime   int64
+	activeTime int64
+	pel        *rax
+}
+
+/*
+Consumer group: the last ID delivered to the group and the pending entries
+list (PEL), indexed both group wide and per consumer
+*/
+type ConsumerGroup struct {
+	name          string
+	lastID        StreamID
+	pel           *rax
+	consumers     map[string]*Consumer
+	consumerNames []string
+}
+
+type PendingInfo struct {
+	ID            StreamID
+	Consumer      string
+	Idle          int64
+	DeliveryCount int
+}
+
+type PendingSummary struct {
+	Count     int
+	Min, Max  StreamID
+	Consumers []ConsumerPending
+}
+
+type ConsumerPending struct {
+	Name  string
+	Count int
+}
+
+type GroupInfo struct {
+	Name            string
+	Consumers       int
+	Pending         int
+	LastDeliveredID StreamID
+}
+
+type ConsumerInfo struct {
+	Name     string
+	Pending  int
+	Idle     int64
+	Inactive int64
+}
+
+/*
+Options of XCLAIM, Idle and Time are -1 when not given
+*/
+type ClaimOpts struct {
+	Idle       int64
+	Time       int64
+	RetryCount int
+	Force      bool
+	JustID     bool
+	LastID     *StreamID
+}
+
+func nowMs() int64 {
+	return time.Now().UnixMilli()
+}
+
+func (s *Stream) Group(name string) (*ConsumerGroup, bool) {
+	g, ok := s.groups[name]
+	return g, ok
+}
+
+func (s *Stream) CreateGroup(name string, lastID StreamID) error {
+	if _, ok := s.groups[name]; ok {
+		return ErrStreamGroupExists
+	}
+	s.groups[name] = &ConsumerGroup{name: name, lastID: lastID, pel: newRax(), consumers: make(map[string]*Consumer)}
+	s.groupNames = append(s.groupNames, name)
+	return nil
+}
+
+func (s *Stream) DestroyGroup(name string) bool {
+	if _, ok := s.groups[name]; !ok {
+		return false
+	}
+	delete(s.groups, name)
+	s.groupNames = slices.DeleteFunc(s.groupNames, func(n string) bool { return n == name })
+	return true
+}
+
+func (g *ConsumerGroup) SetID(id StreamID) {
+	g.lastID = id
+}
+
+/*
+Consumer `name`, created when missing. The bool reports the creation
+*/
+func (g *ConsumerGroup) consumer(name string) (*Consumer, bool) {
+	if c, ok := g.consumers[name]; ok {
+		return c, false
+	}
+	now := nowMs()
+	c := &Consumer{name: name, seenTime: now, activeTime: -1, pel: newRax()}
+	g.consumers[name] = c
+	g.consumerNames = append(g.consumerNames, name)
+	return c, true
+}
+
+func (g *ConsumerGroup) CreateConsumer(name string) bool {
+	_, created := g.consumer(name)
+	return created
+}
+
+/*
+Delete consumer `name` together with its pending entries, returns how many
+entries were pending
+*/
+func (g *ConsumerGroup) DelConsumer(name string) int {
+	c, ok := g.consumers[name]
+	if !ok {
+		return 0
+	}
+	pending := c.pel.Len()
+	c.pel.Ascend(nil, func(key []byte, _ any) bool {
+		g.pel.Remove(key)
+		return true
+	})
+	delete(g.consumers, name)
+	g.consumerNames = slices.DeleteFunc(g.consumerNames, func(n string) bool { return n == name })
+	return pending
+}
+
+func (g *ConsumerGroup) pending(id StreamID) (*pendingEntry, bool) {
+	v, ok := g.pel.Find(id.key())
+	if !ok {
+		return nil, false
+	}
+	return v.(*pendingEntry), true
+}
+
+/*
+Record `id` as delivered to `c`, moving it from its previous owner
+*/
+func (g *ConsumerGroup) deliver(c *Consumer, id StreamID, now int64) *pendingEntry {
+	p, ok := g.pending(id)
+	if !ok {
+		p = &pendingEntry{id: id}
+		g.pel.Insert(id.key(), p)
+	} else if p.consumer != c {
+		p.consumer.pel.Remove(id.key())
+	}
+	p.consumer = c
+	p.deliveryTime = now
+	c.pel.Insert(id.key(), p)
+	return p
+}
+
+func (g *ConsumerGroup) ack(id StreamID) bool {
+	p, ok := g.pending(id)
+	if !ok {
+		return false
+	}
+	g.pel.Remove(id.key())
+	p.consumer.pel.Remove(id.key())
+	return true
+}
+
+/*
+XREADGROUP for `consumer`: with `newOnly` the entries never delivered to the
+group, added to the PEL unless `noAck`; otherwise the consumer's own pending
+entries after `after`, deleted entries coming back with nil fields
+*/
+func (s *Stream) ReadGroup(g *ConsumerGroup, consumer string, after StreamID, newOnly bool, count int, noAck bool) []StreamEntry {
+	now := nowMs()
+	c, _ := g.consumer(consumer)
+	c.seenTime = now
+
+	if !newOnly {
+		res := make([]StreamEntry, 0)
+		from, ok := after.next()
+		if !ok {
+			return res
+		}
+		c.pel.Ascend(from.key(), func(_ []byte, v any) bool {
+			p := v.(*pendingEntry)
+			e, ok := s.Get(p.id)
+			if !ok {
+				e = StreamEntry{ID: p.id}
+			}
+			p.deliveryTime = now
+			p.deliveryCount++
+			res = append(res, e)
+			return count <= 0 || len(res) < count
+		})
+		return res
+	}
+
+	start, ok := g.lastID.next()
+	if !ok {
+		return make([]StreamEntry, 0)
+	}
+	res := s.Range(start, MaxStreamID, count, false)
+	if len(res) == 0 {
+		return res
+	}
+	c.activeTime = now
+	g.lastID = res[len(res)-1].ID
+	if !noAck {
+		for _, e := range res {
+			g.deliver(c, e.ID, now).deliveryCount = 1
+		}
+	}
+	return res
+}
+
+func (g *ConsumerGroup) Ack(ids []StreamID) int {
+	acked := 0
+	for _, id := range ids {
+		if g.ack(id) {
+			acked++
+		}
+	}
+	return acked
+}
+
+func (g *ConsumerGroup) PendingSummary() PendingSummary {
+	res := PendingSummary{Count: g.pel.Len(), Consumers: make([]ConsumerPending, 0)}
+	if res.Count == 0 {
+		return res
+	}
+	g.pel.Ascend(nil, func(key []byte, _ any) bool {
+		res.Min = streamIDFromKey(key)
+		return false
+	})
+	g.pel.Descend(nil, func(key []byte, _ any) bool {
+		res.Max = streamIDFromKey(key)
+		return false
+	})
+	for _, name := range g.consumerNames {
+		if n := g.consumers[name].pel.Len(); n > 0 {
+			res.Consumers = append(res.Consumers, ConsumerPending{Name: name, Count: n})
+		}
+	}
+	return res
+}
+
+/*
+Pending entries between `start` and `end` idle for at least `minIdle`, of
+`consumer` only when not empty
+*/
+func (g *ConsumerGroup) PendingRange(minIdle int64, start StreamID, end StreamID, count int, consumer string) []PendingInfo {
+	res := make([]PendingInfo, 0)
+	pel := g.pel
+	if consumer != "" {
+		c, ok := g.consumers[consumer]
+		if !ok {
+			return res
+		}
+		pel = c.pel
+	}
+
+	now := nowMs()
+	pel.Ascend(start.key(), func(_ []byte, v any) bool {
+		p := v.(*pendingEntry)
+		if p.id.Compare(end) > 0 || len(res) >= count {
+			return false
+		}
+		if idle := now - p.deliveryTime; idle >= minIdle {
+			res = append(res, PendingInfo{ID: p.id, Consumer: p.consumer.name, Idle: idle, DeliveryCount: p.deliveryCount})
+		}
+		return true
+	})
+	return res
+}
+
+/*
+XCLAIM: transfer the pending entries of `ids` idle for at least `minIdle` to
+`consumer`. Entries deleted from the stream are dropped from the PEL
+*/
+func (s *Stream) Claim(g *ConsumerGroup, consumer string, minIdle int64, ids []StreamID, opts ClaimOpts) []StreamEntry {
+	now := nowMs()
+	c, _ := g.consumer(consumer)
+	c.seenTime = now
+	if opts.LastID != nil && opts.LastID.Compare(g.lastID) > 0 {
+		g.lastID = *opts.LastID
+	}
+
+	deliveryTime := now
+	switch {
+	case opts.Idle >= 0:
+		deliveryTime = now - opts.Idle
+	case opts.Time >= 0:
+		deliveryTime = opts.Time
+	}
+
+	res := make([]StreamEntry, 0)
+	for _, id := range ids {
+		e, exists := s.Get(id)
+		p, pending := g.pending(id)
+		if !pending {
+			if !opts.Force || !exists {
+				continue
+			}
+		} else if !exists {
+			g.ack(id)
+			continue
+		} else if now-p.deliveryTime < minIdle {
+			continue
+		}
+
+		p = g.deliver(c, id, deliveryTime)
+		switch {
+		case opts.RetryCount >= 0:
+			p.deliveryCount = opts.RetryCount
+		case !opts.JustID:
+			p.deliveryCount++
+		}
+		c.activeTime = now
+		if opts.JustID {
+			e = StreamEntry{ID: id}
+		}
+		res = append(res, e)
+	}
+	return res
+}
+
+/*
+XAUTOCLAIM: scan up to `count` pending entries from `start` and claim the
+ones idle for at least `minIdle`. Returns the ID to resume the scan from
+(0-0 once done), the claimed entries and the IDs found deleted
+*/
+func (s *Stream) AutoClaim(g *ConsumerGroup, consumer string, minIdle int64, start StreamID, count int, justID bool) (StreamID, []StreamEntry, []StreamID) {
+	now := nowMs()
+	c, _ := g.consumer(consumer)
+	c.seenTime = now
+
+	var candidates []*pendingEntry
+	next := StreamID{}
+	g.pel.Ascend(start.key(), func(_ []byte, v any) bool {
+		if len(candidates) == count {
+			next = v.(*pendingEntry).id
+			return false
+		}
+		candidates = append(candidates, v.(*pendingEntry))
+		return true
+	})
+
+	claimed := make([]StreamEntry, 0)
+	deleted := make([]StreamID, 0)
+	for _, p := range candidates {
+		if now-p.deliveryTime < minIdle {
+			continue
+		}
+		e, ok := s.Get(p.id)
+		if !ok {
+			g.ack(p.id)
+			deleted = append(deleted, p.id)
+			continue
+		}
+		g.deliver(c, p.id, now)
+		if justID {
+			e = StreamEntry{ID: p.id}
+		} else {
+			p.deliveryCount++
+		}
+		c.activeTime = now
+		claimed = append(claimed, e)
+	}
+	return next, claimed, deleted
+}
+
+func (s *Stream) GroupsInfo() []GroupInfo {
+	res := make([]GroupInfo, 0, len(s.groupNames))
+	for _, name := range s.groupNames {
+		g := s.groups[name]
+		res = append(res, GroupInfo{Name: name, Consumers: len(g.consumers), Pending: g.pel.Len(), LastDeliveredID: g.lastID})
+	}
+	return res
+}
+
+func (g *ConsumerGroup) ConsumersInfo() []ConsumerInfo {
+	now := nowMs()
+	res := make([]ConsumerInfo, 0, len(g.consumerNames))
+	for _, name := range g.consumerNames {
+		c := g.consumers[name]
+		info := ConsumerInfo{Name: name, Pending: c.pel.Len(), Idle: now - c.seenTime, Inactive: -1}
+		if c.activeTime >= 0 {
+			info.Inactive = now - c.activeTime
+		}
+		res = append(res, info)
+	}
+	return res
+}
+
+/*
+Deep copy of the group, pending entries pointing to the copied consumers
+*/
+func (g *ConsumerGroup) clone() *ConsumerGroup {
+	res := &ConsumerGroup{
+		name:          g.name,
+		lastID:        g.lastID,
+		consumers:     make(map[string]*Consumer, len(g.consumers)),
+		consumerNames: slices.Clone(g.consumerNames),
+	}
+	for name, c := range g.consumers {
+		res.consumers[name] = &Consumer{name: c.name, seenTime: c.seenTime, activeTime: c.activeTime, pel: newRax()}
+	}
+	res.pel = g.pel.clone(func(value any) any {
+		p := *value.(*pendingEntry)
+		p.consumer = res.consumers[p.consumer.name]
+		p.consumer.pel.Insert(p.id.key(), &p)
+		return &p
+	})
+	return res
+}
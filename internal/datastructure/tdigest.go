@@ -0,0 +1,264 @@
+package datastructure
+
+import (
+	"math"
+	"slices"
+)
+
+type centroid struct {
+	mean, weight float64
+}
+
+/*
+Merging t-digest: values are buffered and periodically folded into a sorted
+list of centroids. The k1 scale function bounds the weight of each centroid
+by its quantile, so centroids near the tails stay small (down to single
+samples) and tail quantiles such as p99 remain accurate while the total
+number of centroids stays around `compression`
+*/
+type TDigest struct {
+	compression float64
+	centroids   []centroid
+	unmerged    []centroid
+	weight      float64
+	min, max    float64
+	access
+}
+
+func NewTDigest(compression float64) *TDigest {
+	td := &TDigest{compression: compression}
+	td.Reset()
+	return td
+}
+
+func (td *TDigest) Reset() {
+	td.centroids = nil
+	td.unmerged = make([]centroid, 0, td.bufferSize())
+	td.weight = 0
+	td.min, td.max = math.Inf(1), math.Inf(-1)
+}
+
+func (td *TDigest) bufferSize() int {
+	return 5 * int(math.Ceil(td.compression))
+}
+
+func (td *TDigest) Compression() float64 {
+	return td.compression
+}
+
+func (td *TDigest) Add(value float64) {
+	td.unmerged = append(td.unmerged, centroid{mean: value, weight: 1})
+	td.weight++
+	td.min, td.max = min(td.min, value), max(td.max, value)
+	if len(td.unmerged) >= td.bufferSize() {
+		td.flush()
+	}
+}
+
+/*
+k1 scale function and its inverse
+*/
+func (td *TDigest) k(q float64) float64 {
+	return td.compression / (2 * math.Pi) * math.Asin(2*q-1)
+}
+
+func (td *TDigest) q(k float64) float64 {
+	k = min(max(k, td.k(0)), td.k(1))
+	return (math.Sin(k*2*math.Pi/td.compression) + 1) / 2
+}
+
+/*
+Fold the buffered values into the centroids
+*/
+func (td *TDigest) flush() {
+	if len(td.unmerged) == 0 {
+		return
+	}
+	all := append(td.unmerged, td.centroids...)
+	slices.SortFunc(all, func(a, b centroid) int {
+		switch {
+		case a.mean < b.mean:
+			return -1
+		case a.mean > b.mean:
+			return 1
+		}
+		return 0
+	})
+
+	merged := make([]centroid, 0, len(td.centroids)+1)
+	cur := all[0]
+	qLeft := 0.0
+	qLimit := td.q(td.k(qLeft) + 1)
+	for _, c := range all[1:] {
+		if qLeft+(cur.weight+c.weight)/td.weight <= qLimit {
+			cur.weight += c.weight
+			cur.mean += (c.mean - cur.mean) * c.weight / cur.weight
+			continue
+		}
+		merged = append(merged, cur)
+		qLeft += cur.weight / td.weight
+		qLimit = td.q(td.k(qLeft) + 1)
+		cur = c
+	}
+	td.centroids = append(merged, cur)
+	td.unmerged = td.unmerged[:0]
+}
+
+/*
+Merge every digest of `srcs` into `td`. Sources are read before `td` is
+modified, so `td` may be one of them
+*/
+func (td *TDigest) Merge(srcs []*TDigest) {
+	var incoming []centroid
+	for _, src := range srcs {
+		src.flush()
+		incoming = append(incoming, src.centroids...)
+		td.min, td.max = min(td.min, src.min), max(td.max, src.max)
+	}
+	for _, c := range incoming {
+		td.unmerged = append(td.unmerged, c)
+		td.weight += c.weight
+	}
+	td.flush()
+}
+
+func (td *TDigest) Count() float64 {
+	return td.weight
+}
+
+/*
+Smallest value added, NaN when empty
+*/
+func (td *TDigest) Min() float64 {
+	if td.weight == 0 {
+		return math.NaN()
+	}
+	return td.min
+}
+
+func (td *TDigest) Max() float64 {
+	if td.weight == 0 {
+		return math.NaN()
+	}
+	return td.max
+}
+
+/*
+Estimated value at quantile `q` in [0, 1], interpolating between centroid
+means, and between the extremes and the first and last centroids
+*/
+func (td *TDigest) Quantile(q float64) float64 {
+	td.flush()
+	if td.weight == 0 {
+		return math.NaN()
+	}
+	if q <= 0 {
+		return td.min
+	}
+	if q >= 1 {
+		return td.max
+	}
+
+	index := q * td.weight
+	cs := td.centroids
+	first, last := cs[0], cs[len(cs)-1]
+	if index < first.weight/2 {
+		return td.min + (first.mean-td.min)*index/(first.weight/2)
+	}
+
+	cum := first.weight / 2
+	for i := 0; i < len(cs)-1; i++ {
+		dw := (cs[i].weight + cs[i+1].weight) / 2
+		if cum+dw > index {
+			return cs[i].mean + (cs[i+1].mean-cs[i].mean)*(index-cum)/dw
+		}
+		cum += dw
+	}
+	return last.mean + (td.max-last.mean)*min((index-cum)/(last.weight/2), 1)
+}
+
+/*
+Estimated fraction of values below `value`, values equal to it counting for
+half
+*/
+func (td *TDigest) CDF(value float64) float64 {
+	td.flush()
+	switch {
+	case td.weight == 0:
+		return math.NaN()
+	case value < td.min:
+		return 0
+	case value > td.max:
+		return 1
+	case td.min == td.max:
+		return 0.5
+	}
+
+	cs := td.centroids
+	first, last := cs[0], cs[len(cs)-1]
+	if value < first.mean {
+		return first.weight / 2 * (value - td.min) / (first.mean - td.min) / td.weight
+	}
+
+	cum := 0.0
+	for i := 0; i < len(cs)-1; i++ {
+		if value < cs[i+1].mean {
+			dw := (cs[i].weight + cs[i+1].weight) / 2
+			left := cum + cs[i].weight/2
+			return (left + dw*(value-cs[i].mean)/(cs[i+1].mean-cs[i].mean)) / td.weight
+		}
+		cum += cs[i].weight
+	}
+
+	left := cum + last.weight/2
+	if td.max == last.mean {
+		return left / td.weight
+	}
+	return (left + last.weight/2*(value-last.mean)/(td.max-last.mean)) / td.weight
+}
+
+/*
+Estimated number of values smaller than `value`, so the minimum has rank 0.
+-1 below the minimum, the total count above the maximum and -2 when the
+digest is empty
+*/
+func (td *TDigest) Rank(value float64) int {
+	switch {
+	case td.weight == 0:
+		return -2
+	case value < td.min:
+		return -1
+	case value > td.max:
+		return int(td.weight)
+	}
+	return int(math.Floor(td.CDF(value) * td.weight))
+}
+
+/*
+Mean of the values between quantiles `low` and `high`, centroids crossing a
+cut contribute the fraction of their weight inside it
+*/
+func (td *TDigest) TrimmedMean(low float64, high float64) float64 {
+	td.flush()
+	lowW, highW := low*td.weight, high*td.weight
+	var cum, sum, count float64
+	for _, c := range td.centroids {
+		overlap := min(cum+c.weight, highW) - max(cum, lowW)
+		if overlap > 0 {
+			sum += c.mean * overlap
+			count += overlap
+		}
+		cum += c.weight
+	}
+	if count == 0 {
+		return math.NaN()
+	}
+	return sum / count
+}
+
+func (td *TDigest) clone() *TDigest {
+	res := *td
+	res.centroids = slices.Clone(td.centroids)
+	res.unmerged = slices.Clone(td.unmerged)
+	return &res
+}
@@ -0,0 +1,82 @@
+package datastructure
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+func TestTDigestQuantile(t *testing.T) {
+	td := NewTDigest(100)
+	r := rand.New(rand.NewSource(1))
+	n := 100000
+	for i := 0; i < n; i++ {
+		td.Add(r.Float64() * 1000)
+	}
+
+	tests := []struct {
+		q, tolerance float64
+	}{
+		{q: 0.01, tolerance: 1},
+		{q: 0.5, tolerance: 10},
+		{q: 0.99, tolerance: 1},
+		{q: 0.999, tolerance: 0.5},
+	}
+	for _, tt := range tests {
+		if got, want := td.Quantile(tt.q), tt.q*1000; math.Abs(got-want) > tt.tolerance {
+			t.Errorf("Quantile(%v) = %v, want %v +- %v", tt.q, got, want, tt.tolerance)
+		}
+	}
+	if len(td.centroids) > 200 {
+		t.Errorf("%d centroids for compression 100", len(td.centroids))
+	}
+}
+
+func TestTDigestSmall(t *testing.T) {
+	td := NewTDigest(100)
+	if !math.IsNaN(td.Quantile(0.5)) || td.Rank(1) != -2 {
+		t.Errorf("empty digest should report NaN and rank -2")
+	}
+	for i := 1; i <= 10; i++ {
+		td.Add(float64(i))
+	}
+
+	if td.Min() != 1 || td.Max() != 10 {
+		t.Errorf("Min/Max = %v/%v, want 1/10", td.Min(), td.Max())
+	}
+	if got := td.Quantile(0.5); got != 5.5 {
+		t.Errorf("Quantile(0.5) = %v, want 5.5", got)
+	}
+	if got := td.CDF(5); got != 0.45 {
+		t.Errorf("CDF(5) = %v, want 0.45", got)
+	}
+	for value, want := range map[float64]int{0: -1, 1: 0, 5: 4, 10: 9, 11: 10} {
+		if got := td.Rank(value); got != want {
+			t.Errorf("Rank(%v) = %d, want %d", value, got, want)
+		}
+	}
+	if got := td.TrimmedMean(0.1, 0.9); got != 5.5 {
+		t.Errorf("TrimmedMean(0.1, 0.9) = %v, want 5.5", got)
+	}
+
+	td.Reset()
+	if td.Count() != 0 || !math.IsNaN(td.Min()) {
+		t.Errorf("Reset did not empty the digest")
+	}
+}
+
+func TestTDigestMerge(t *testing.T) {
+	a, b := NewTDigest(100), NewTDigest(100)
+	for i := 0; i < 1000; i++ {
+		a.Add(float64(i))
+		b.Add(float64(i + 1000))
+	}
+
+	a.Merge([]*TDigest{a, b})
+	if a.Count() != 3000 || a.Min() != 0 || a.Max() != 1999 {
+		t.Errorf("merged count/min/max = %v/%v/%v", a.Count(), a.Min(), a.Max())
+	}
+	if b.Count() != 1000 {
+		t.Errorf("source modified by merge, count %v", b.Count())
+	}
+}
@@ -0,0 +1,364 @@
+package datastructure
+
+import (
+	"errors"
+	"math"
+	"slices"
+	"strings"
+
+	"tcp-server.com/m/internal/config"
+)
+
+const (
+	TSDuplicateBlock = "BLOCK"
+	TSDuplicateFirst = "FIRST"
+	TSDuplicateLast  = "LAST"
+	TSDuplicateMin   = "MIN"
+	TSDuplicateMax   = "MAX"
+	TSDuplicateSum   = "SUM"
+)
+
+const (
+	TSAggAvg   = "AVG"
+	TSAggSum   = "SUM"
+	TSAggMin   = "MIN"
+	TSAggMax   = "MAX"
+	TSAggCount = "COUNT"
+)
+
+var (
+	ErrTSNotFound      = errors.New("ERR TSDB: the key does not exist")
+	ErrTSExists        = errors.New("ERR TSDB: key already exists")
+	ErrTSDuplicate     = errors.New("ERR TSDB: Error at upsert, update is not supported when DUPLICATE_POLICY is set to BLOCK mode")
+	ErrTSRetention     = errors.New("ERR TSDB: Timestamp is older than retention")
+	ErrTSRuleSameKey   = errors.New("ERR TSDB: the source key and destination key should be different")
+	ErrTSRuleDestSrc   = errors.New("ERR TSDB: the destination key already has a src rule")
+	ErrTSRuleDestRules = errors.New("ERR TSDB: the destination key already has rules")
+	ErrTSRuleExists    = errors.New("ERR TSDB: compaction rule already exists")
+)
+
+type Sample struct {
+	Timestamp int64
+	Value     float64
+}
+
+type TSLabel struct {
+	Name, Value string
+}
+
+func IsTSDuplicatePolicy(policy string) bool {
+	switch policy {
+	case TSDuplicateBlock, TSDuplicateFirst, TSDuplicateLast, TSDuplicateMin, TSDuplicateMax, TSDuplicateSum:
+		return true
+	}
+	return false
+}
+
+func IsTSAggregation(agg string) bool {
+	switch agg {
+	case TSAggAvg, TSAggSum, TSAggMin, TSAggMax, TSAggCount:
+		return true
+	}
+	return false
+}
+
+type tsAggregator struct {
+	kind     string
+	sum      float64
+	min, max float64
+	count    int
+}
+
+func (a *tsAggregator) add(v float64) {
+	if a.count == 0 {
+		a.min, a.max = v, v
+	}
+	a.sum += v
+	a.min, a.max = min(a.min, v), max(a.max, v)
+	a.count++
+}
+
+func (a *tsAggregator) value() float64 {
+	switch a.kind {
+	case TSAggAvg:
+		return a.sum / float64(a.count)
+	case TSAggSum:
+		return a.sum
+	case TSAggMin:
+		return a.min
+	case TSAggMax:
+		return a.max
+	}
+	return float64(a.count)
+}
+
+func (a *tsAggregator) reset() {
+	*a = tsAggregator{kind: a.kind}
+}
+
+/*
+Aggregate `samples` (sorted by timestamp) into buckets of `bucket`
+milliseconds aligned to 0, each reported at its start timestamp
+*/
+func TSAggregate(samples []Sample, agg string, bucket int64) []Sample {
+	res := make([]Sample, 0)
+	a := tsAggregator{kind: agg}
+	var start int64
+	for _, s := range samples {
+		bs := bucketStart(s.Timestamp, bucket)
+		if a.count > 0 && bs != start {
+			res = append(res, Sample{Timestamp: start, Value: a.value()})
+			a.reset()
+		}
+		start = bs
+		a.add(s.Value)
+	}
+	if a.count > 0 {
+		res = append(res, Sample{Timestamp: start, Value: a.value()})
+	}
+	return res
+}
+
+func bucketStart(ts int64, bucket int64) int64 {
+	start := ts - ts%bucket
+	if ts < 0 && ts%bucket != 0 {
+		start -= bucket
+	}
+	return start
+}
+
+/*
+Compaction rule: samples of the source series are aggregated per bucket and
+the result is added to `dest` once a sample of a later bucket arrives
+*/
+type tsRule struct {
+	dest   string
+	bucket int64
+	agg    tsAggregator
+	start  int64
+}
+
+type TimeSeries struct {
+	chunks          []*tsChunk
+	retention       int64
+	duplicatePolicy string
+	labels          []TSLabel
+	rules           []*tsRule
+	srcKey          string
+	total           int
+	access
+}
+
+func NewTimeSeries(retention int64, duplicatePolicy string, labels []TSLabel) *TimeSeries {
+	return &TimeSeries{
+		retention:       retention,
+		duplicatePolicy: duplicatePolicy,
+		labels:          labels,
+	}
+}
+
+func (ts *TimeSeries) Labels() []TSLabel {
+	return ts.labels
+}
+
+func (ts *TimeSeries) Total() int {
+	return ts.total
+}
+
+func (ts *TimeSeries) lastTimestamp() (int64, bool) {
+	if len(ts.chunks) == 0 {
+		return 0, false
+	}
+	return ts.chunks[len(ts.chunks)-1].last, true
+}
+
+/*
+Oldest timestamp kept by the retention window
+*/
+func (ts *TimeSeries) retentionStart() int64 {
+	last, ok := ts.lastTimestamp()
+	if !ok || ts.retention == 0 {
+		return math.MinInt64
+	}
+	return last - ts.retention
+}
+
+/*
+Add a sample. Newer samples are appended to the last chunk; older ones
+rewrite the chunk covering them and resolve clashes with `policy`, or the
+series' DUPLICATE_POLICY when empty. Returns the samples the compaction
+rules emitted, keyed by destination
+*/
+func (ts *TimeSeries) Add(timestamp int64, value float64, policy string) (map[string][]Sample, error) {
+	if last, ok := ts.lastTimestamp(); ok && timestamp <= last {
+		if timestamp < ts.retentionStart() {
+			return nil, ErrTSRetention
+		}
+		if policy == "" {
+			policy = ts.duplicatePolicy
+		}
+		return nil, ts.upsert(timestamp, value, policy)
+	}
+
+	if len(ts.chunks) == 0 || ts.chunks[len(ts.chunks)-1].size() >= config.TSChunkSizeBytes {
+		ts.chunks = append(ts.chunks, &tsChunk{})
+	}
+	ts.chunks[len(ts.chunks)-1].append(timestamp, value)
+	ts.total++
+	ts.trim()
+	return ts.compact(timestamp, value), nil
+}
+
+func (ts *TimeSeries) upsert(timestamp int64, value float64, policy string) error {
+	i, _ := slices.BinarySearchFunc(ts.chunks, timestamp, func(c *tsChunk, t int64) int {
+		switch {
+		case c.last < t:
+			return -1
+		case c.first > t:
+			return 1
+		}
+		return 0
+	})
+	i = min(i, len(ts.chunks)-1)
+
+	samples := ts.chunks[i].samples()
+	j, found := slices.BinarySearchFunc(samples, timestamp, func(s Sample, t int64) int {
+		return int(max(min(s.Timestamp-t, 1), -1))
+	})
+	if found {
+		old := samples[j].Value
+		switch policy {
+		case TSDuplicateBlock:
+			return ErrTSDuplicate
+		case TSDuplicateFirst:
+			value = old
+		case TSDuplicateMin:
+			value = min(old, value)
+		case TSDuplicateMax:
+			value = max(old, value)
+		case TSDuplicateSum:
+			value += old
+		}
+		samples[j].Value = value
+	} else {
+		samples = slices.Insert(samples, j, Sample{Timestamp: timestamp, Value: value})
+		ts.total++
+	}
+	ts.chunks[i] = newChunkFromSamples(samples)
+	return nil
+}
+
+/*
+Drop the chunks entirely outside of the retention window
+*/
+func (ts *TimeSeries) trim() {
+	start := ts.retentionStart()
+	n := 0
+	for n < len(ts.chunks)-1 && ts.chunks[n].last < start {
+		ts.total -= ts.chunks[n].count
+		n++
+	}
+	ts.chunks = ts.chunks[n:]
+}
+
+/*
+Feed an appended sample to the compaction rules. Late samples rewriting a
+closed bucket are not propagated
+*/
+func (ts *TimeSeries) compact(timestamp int64, value float64) map[string][]Sample {
+	var res map[string][]Sample
+	for _, r := range ts.rules {
+		start := bucketStart(timestamp, r.bucket)
+		if r.agg.count > 0 && start != r.start {
+			if res == nil {
+				res = make(map[string][]Sample)
+			}
+			res[r.dest] = append(res[r.dest], Sample{Timestamp: r.start, Value: r.agg.value()})
+			r.agg.reset()
+		}
+		r.start = start
+		r.agg.add(value)
+	}
+	return res
+}
+
+/*
+Samples between `from` and `to` inclusive, within the retention window
+*/
+func (ts *TimeSeries) Range(from int64, to int64) []Sample {
+	from = max(from, ts.retentionStart())
+	res := make([]Sample, 0)
+	for _, c := range ts.chunks {
+		if c.last < from || c.first > to {
+			continue
+		}
+		for _, s := range c.samples() {
+			if s.Timestamp >= from && s.Timestamp <= to {
+				res = append(res, s)
+			}
+		}
+	}
+	return res
+}
+
+func (ts *TimeSeries) addRule(dest string, agg string, bucket int64) error {
+	for _, r := range ts.rules {
+		if r.dest == dest {
+			return ErrTSRuleExists
+		}
+	}
+	ts.rules = append(ts.rules, &tsRule{dest: dest, bucket: bucket, agg: tsAggregator{kind: agg}})
+	return nil
+}
+
+/*
+Label matcher of TS.MRANGE FILTER: `label=value` or `label!=value`, an empty
+value matching series without the label
+*/
+type TSFilter struct {
+	Label, Value string
+	Negate       bool
+}
+
+func ParseTSFilter(expr string) (TSFilter, bool) {
+	if i := strings.Index(expr, "!="); i > 0 {
+		return TSFilter{Label: expr[:i], Value: expr[i+2:], Negate: true}, true
+	}
+	if i := strings.Index(expr, "="); i > 0 {
+		return TSFilter{Label: expr[:i], Value: expr[i+1:]}, true
+	}
+	return TSFilter{}, false
+}
+
+func (ts *TimeSeries) matches(filters []TSFilter) bool {
+	for _, f := range filters {
+		value := ""
+		for _, l := range ts.labels {
+			if l.Name == f.Label {
+				value = l.Value
+			}
+		}
+		if (value == f.Value) == f.Negate {
+			return false
+		}
+	}
+	return true
+}
+
+/*
+Deep copy of the samples, labels and settings. Compaction rules are left
+out: they name their destination key, which the copy does not own
+*/
+func (ts *TimeSeries) clone() *TimeSeries {
+	res := *ts
+	res.chunks = make([]*tsChunk, len(ts.chunks))
+	for i, c := range ts.chunks {
+		chunk := *c
+		chunk.bs.buf = slices.Clone(c.bs.buf)
+		res.chunks[i] = &chunk
+	}
+	res.labels = slices.Clone(ts.labels)
+	res.rules = nil
+	res.srcKey = ""
+	return &res
+}
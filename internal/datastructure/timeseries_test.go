@@ -0,0 +1,150 @@
+package datastructure
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+func TestGorillaChunkRoundTrip(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	var samples []Sample
+	ts := int64(1700000000000)
+	value := 100.0
+	for i := 0; i < 2000; i++ {
+		// Mostly regular intervals with jitter and occasional large gaps
+		switch r.Intn(10) {
+		case 0:
+			ts += r.Int63n(1 << 40)
+		case 1:
+			ts += 1 + r.Int63n(3000)
+		default:
+			ts += 1000
+		}
+		switch r.Intn(4) {
+		case 0:
+			value = r.NormFloat64() * 1e6
+		case 1:
+			value += 0.5
+		case 2:
+			value = math.Inf(1)
+		}
+		samples = append(samples, Sample{Timestamp: ts, Value: value})
+	}
+
+	c := newChunkFromSamples(samples)
+	got := c.samples()
+	if len(got) != len(samples) {
+		t.Fatalf("decoded %d samples, want %d", len(got), len(samples))
+	}
+	for i := range samples {
+		if got[i] != samples[i] {
+			t.Fatalf("sample %d = %+v, want %+v", i, got[i], samples[i])
+		}
+	}
+	if raw := len(samples) * 16; c.size() >= raw {
+		t.Errorf("chunk of %d bytes is not smaller than %d raw bytes", c.size(), raw)
+	}
+}
+
+func TestTimeSeriesChunksAndUpsert(t *testing.T) {
+	ts := NewTimeSeries(0, TSDuplicateBlock, nil)
+	for i := int64(0); i < 10000; i++ {
+		if _, err := ts.Add(i*10, float64(i), ""); err != nil {
+			t.Fatalf("Add(%d) failed: %v", i*10, err)
+		}
+	}
+	if len(ts.chunks) < 2 {
+		t.Fatalf("expected several chunks, got %d", len(ts.chunks))
+	}
+
+	if _, err := ts.Add(500, 1, ""); err != ErrTSDuplicate {
+		t.Errorf("expected ErrTSDuplicate, got %v", err)
+	}
+	if _, err := ts.Add(500, 1, TSDuplicateSum); err != nil {
+		t.Fatalf("Add with SUM failed: %v", err)
+	}
+	if _, err := ts.Add(505, 42, ""); err != nil {
+		t.Fatalf("out of order Add failed: %v", err)
+	}
+
+	got := ts.Range(490, 510)
+	want := []Sample{{490, 49}, {500, 51}, {505, 42}, {510, 51}}
+	if len(got) != len(want) {
+		t.Fatalf("Range = %+v, want %+v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("Range[%d] = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+	if ts.Total() != 10001 {
+		t.Errorf("Total() = %d, want 10001", ts.Total())
+	}
+}
+
+func TestTimeSeriesRetention(t *testing.T) {
+	ts := NewTimeSeries(1000, TSDuplicateLast, nil)
+	for i := int64(0); i < 100000; i += 10 {
+		ts.Add(i, 1, "")
+	}
+	got := ts.Range(0, math.MaxInt64)
+	if len(got) == 0 || got[0].Timestamp < 99990-1000 {
+		t.Errorf("range starts at %d, outside of the retention window", got[0].Timestamp)
+	}
+	if _, err := ts.Add(10, 1, ""); err != ErrTSRetention {
+		t.Errorf("expected ErrTSRetention, got %v", err)
+	}
+}
+
+func TestTSAggregate(t *testing.T) {
+	samples := []Sample{{1, 1}, {5, 3}, {12, 10}, {31, 4}}
+	tests := []struct {
+		agg  string
+		want []Sample
+	}{
+		{agg: TSAggAvg, want: []Sample{{0, 2}, {10, 10}, {30, 4}}},
+		{agg: TSAggSum, want: []Sample{{0, 4}, {10, 10}, {30, 4}}},
+		{agg: TSAggMin, want: []Sample{{0, 1}, {10, 10}, {30, 4}}},
+		{agg: TSAggMax, want: []Sample{{0, 3}, {10, 10}, {30, 4}}},
+		{agg: TSAggCount, want: []Sample{{0, 2}, {10, 1}, {30, 1}}},
+	}
+	for _, tt := range tests {
+		got := TSAggregate(samples, tt.agg, 10)
+		if len(got) != len(tt.want) {
+			t.Fatalf("%s: got %+v, want %+v", tt.agg, got, tt.want)
+		}
+		for i := range got {
+			if got[i] != tt.want[i] {
+				t.Errorf("%s: bucket %d = %+v, want %+v", tt.agg, i, got[i], tt.want[i])
+			}
+		}
+	}
+}
+
+func TestTSCompactionRule(t *testing.T) {
+	storage := NewStorage()
+	storage.TSCreate("raw", TSCreateOpts{DuplicatePolicy: TSDuplicateBlock})
+	storage.TSCreate("avg", TSCreateOpts{DuplicatePolicy: TSDuplicateBlock})
+	if err := storage.TSCreateRule("raw", "avg", TSAggAvg, 100); err != nil {
+		t.Fatalf("TSCreateRule failed: %v", err)
+	}
+	if err := storage.TSCreateRule("avg", "raw", TSAggAvg, 100); err != ErrTSRuleDestRules {
+		t.Errorf("expected ErrTSRuleDestRules, got %v", err)
+	}
+
+	for i := int64(0); i < 350; i += 10 {
+		storage.TSAdd("raw", i, float64(i), "", nil)
+	}
+	got, _ := storage.TSRange("avg", 0, math.MaxInt64)
+	// The bucket starting at 300 is still open
+	want := []Sample{{0, 45}, {100, 145}, {200, 245}}
+	if len(got) != len(want) {
+		t.Fatalf("compacted series = %+v, want %+v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("bucket %d = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+}
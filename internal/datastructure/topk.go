@@ -0,0 +1,175 @@
+package datastructure
+
+import (
+	"cmp"
+	"container/heap"
+	"math"
+	"math/rand"
+	"slices"
+
+	"github.com/spaolacci/murmur3"
+)
+
+// Seed of the fingerprint hash, rows use their index as seed
+const topkFingerprintSeed = 1919
+
+type topkBucket struct {
+	fp    uint32
+	count uint32
+}
+
+type TopKItem struct {
+	Item  string
+	Count uint32
+}
+
+/*
+Min-heap of the current top k items, ordered by count. Unused slots hold a
+zero count and an empty item
+*/
+type topkHeap []TopKItem
+
+func (h topkHeap) Len() int           { return len(h) }
+func (h topkHeap) Less(i, j int) bool { return h[i].Count < h[j].Count }
+func (h topkHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+func (h *topkHeap) Push(x any)        { *h = append(*h, x.(TopKItem)) }
+func (h *topkHeap) Pop() any {
+	old := *h
+	x := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return x
+}
+
+/*
+HeavyKeeper top-k: a `depth` x `width` table of (fingerprint, count) buckets.
+An item owns its bucket in every row when the fingerprint matches; a
+colliding item decays the owner's count with probability decay^count and
+takes the bucket over once it reaches 0, so heavy hitters keep their buckets
+while the long tail churns. The heap tracks the k items with the highest
+estimated count
+*/
+type TopK struct {
+	k, width, depth uint32
+	decay           float64
+	buckets         []topkBucket
+	heap            topkHeap
+	access
+}
+
+type TopKInfo struct {
+	K, Width, Depth uint32
+	Decay           float64
+}
+
+func NewTopK(k uint32, width uint32, depth uint32, decay float64) *TopK {
+	return &TopK{
+		k:       k,
+		width:   width,
+		depth:   depth,
+		decay:   decay,
+		buckets: make([]topkBucket, uint64(width)*uint64(depth)),
+		heap:    make(topkHeap, k),
+	}
+}
+
+func (t *TopK) bucket(item string, row uint32) *topkBucket {
+	loc := murmur3.Sum32WithSeed([]byte(item), row) % t.width
+	return &t.buckets[row*t.width+loc]
+}
+
+func (t *TopK) find(item string) int {
+	return slices.IndexFunc(t.heap, func(e TopKItem) bool {
+		return e.Count > 0 && e.Item == item
+	})
+}
+
+/*
+Increase `item` by `incr`, returns the item expelled from the top k list to
+make room for it, if any
+*/
+func (t *TopK) IncrBy(item string, incr uint32) (string, bool) {
+	fp := murmur3.Sum32WithSeed([]byte(item), topkFingerprintSeed)
+	var maxCount uint32
+
+	for i := uint32(0); i < t.depth; i++ {
+		b := t.bucket(item, i)
+		switch {
+		case b.count == 0:
+			b.fp, b.count = fp, incr
+		case b.fp == fp:
+			b.count = uint32(min(uint64(b.count)+uint64(incr), math.MaxUint32))
+		default:
+			for left := incr; left > 0; left-- {
+				if rand.Float64() < math.Pow(t.decay, float64(b.count)) {
+					b.count--
+					if b.count == 0 {
+						b.fp, b.count = fp, left
+						break
+					}
+				}
+			}
+		}
+		if b.fp == fp {
+			maxCount = max(maxCount, b.count)
+		}
+	}
+
+	if maxCount == 0 || maxCount < t.heap[0].Count {
+		return "", false
+	}
+	if i := t.find(item); i != -1 {
+		t.heap[i].Count = maxCount
+		heap.Fix(&t.heap, i)
+		return "", false
+	}
+
+	expelled := t.heap[0]
+	t.heap[0] = TopKItem{Item: item, Count: maxCount}
+	heap.Fix(&t.heap, 0)
+	return expelled.Item, expelled.Count > 0
+}
+
+func (t *TopK) Query(item string) bool {
+	return t.find(item) != -1
+}
+
+/*
+Estimated count of `item`: the highest count among the buckets it owns
+*/
+func (t *TopK) Count(item string) uint32 {
+	fp := murmur3.Sum32WithSeed([]byte(item), topkFingerprintSeed)
+	var res uint32
+	for i := uint32(0); i < t.depth; i++ {
+		if b := t.bucket(item, i); b.fp == fp {
+			res = max(res, b.count)
+		}
+	}
+	return res
+}
+
+/*
+Items of the top k list, highest count first
+*/
+func (t *TopK) List() []TopKItem {
+	res := make([]TopKItem, 0, len(t.heap))
+	for _, e := range t.heap {
+		if e.Count > 0 {
+			res = append(res, e)
+		}
+	}
+	slices.SortStableFunc(res, func(a, b TopKItem) int {
+		return cmp.Compare(b.Count, a.Count)
+	})
+	return res
+}
+
+func (t *TopK) Info() TopKInfo {
+	return TopKInfo{K: t.k, Width: t.width, Depth: t.depth, Decay: t.decay}
+}
+
+func (t *TopK) clone() *TopK {
+	res := *t
+	res.buckets = slices.Clone(t.buckets)
+	res.heap = slices.Clone(t.heap)
+	return &res
+}
@@ -0,0 +1,50 @@
+package datastructure
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+)
+
+func TestTopKExpelled(t *testing.T) {
+	topk := NewTopK(2, 8, 7, 0.9)
+	for _, item := range []string{"a", "a", "b"} {
+		if expelled, ok := topk.IncrBy(item, 1); ok {
+			t.Fatalf("unexpected expelled item %q while the list is not full", expelled)
+		}
+	}
+
+	expelled, ok := topk.IncrBy("c", 5)
+	if !ok || expelled != "b" {
+		t.Errorf("IncrBy(c, 5) expelled %q, %v, want b", expelled, ok)
+	}
+
+	list := topk.List()
+	if len(list) != 2 || list[0].Item != "c" || list[1].Item != "a" {
+		t.Errorf("List() = %+v, want c then a", list)
+	}
+	if !topk.Query("a") || topk.Query("b") {
+		t.Errorf("Query mismatch: a should be in the top k, b should not")
+	}
+}
+
+func TestTopKHeavyHitters(t *testing.T) {
+	topk := NewTopK(5, 64, 5, 0.9)
+	r := rand.New(rand.NewSource(1))
+
+	// Five heavy items among a long tail of rare ones
+	for i := 0; i < 20000; i++ {
+		if r.Intn(2) == 0 {
+			topk.IncrBy(fmt.Sprintf("heavy:%d", r.Intn(5)), 1)
+		} else {
+			topk.IncrBy(fmt.Sprintf("tail:%d", r.Intn(5000)), 1)
+		}
+	}
+
+	for i := 0; i < 5; i++ {
+		item := fmt.Sprintf("heavy:%d", i)
+		if !topk.Query(item) {
+			t.Errorf("%s missing from the top k list %+v", item, topk.List())
+		}
+	}
+}
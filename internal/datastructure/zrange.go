@@ -0,0 +1,217 @@
+package datastructure
+
+import (
+	"errors"
+	"math"
+	"strconv"
+	"strings"
+)
+
+var (
+	ErrZMinMaxNotFloat = errors.New("ERR min or max is not a float")
+	ErrZMinMaxNotLex   = errors.New("ERR min or max not valid string range item")
+)
+
+/*
+A range over zset elements. Both encodings keep elements ordered by
+(score, ele) so any range that is monotonic on that order can reuse the same
+seek/walk helpers.
+*/
+type zrange interface {
+	gteMin(score float64, ele string) bool
+	lteMax(score float64, ele string) bool
+	isEmpty() bool
+}
+
+type ScoreRange struct {
+	Min, Max     float64
+	MinEx, MaxEx bool
+}
+
+/*
+Parse `min max` in the ZRANGEBYSCORE form: a float, optionally prefixed
+with `(` for an exclusive bound, or -inf/+inf
+*/
+func ParseScoreRange(min string, max string) (ScoreRange, error) {
+	var r ScoreRange
+	var err error
+	if r.Min, r.MinEx, err = parseScoreBound(min); err != nil {
+		return r, err
+	}
+	if r.Max, r.MaxEx, err = parseScoreBound(max); err != nil {
+		return r, err
+	}
+	return r, nil
+}
+
+func parseScoreBound(bound string) (float64, bool, error) {
+	exclusive := false
+	if strings.HasPrefix(bound, "(") {
+		exclusive = true
+		bound = bound[1:]
+	}
+	val, err := ParseScore(bound)
+	if err != nil {
+		return 0, false, ErrZMinMaxNotFloat
+	}
+	return val, exclusive, nil
+}
+
+/*
+Parse a score the way Redis does: any float including +inf/-inf, never NaN
+*/
+func ParseScore(s string) (float64, error) {
+	val, err := strconv.ParseFloat(s, 64)
+	if err != nil || math.IsNaN(val) {
+		return 0, errors.New("ERR value is not a valid float")
+	}
+	return val, nil
+}
+
+func (r *ScoreRange) gteMin(score float64, _ string) bool {
+	if r.MinEx {
+		return score > r.Min
+	}
+	return score >= r.Min
+}
+
+func (r *ScoreRange) lteMax(score float64, _ string) bool {
+	if r.MaxEx {
+		return score < r.Max
+	}
+	return score <= r.Max
+}
+
+func (r *ScoreRange) isEmpty() bool {
+	return r.Min > r.Max || (r.Min == r.Max && (r.MinEx || r.MaxEx))
+}
+
+/*
+One end of a lexicographical range. inf is -1 for `-`, 1 for `+` and 0 for
+a `[value` or `(value` bound
+*/
+type LexBound struct {
+	Value     string
+	Exclusive bool
+	inf       int
+}
+
+type LexRange struct {
+	Min, Max LexBound
+}
+
+/*
+Parse `min max` in the ZRANGEBYLEX form: `-`, `+`, `[value` or `(value`
+*/
+func ParseLexRange(min string, max string) (LexRange, error) {
+	var r LexRange
+	var err error
+	if r.Min, err = parseLexBound(min); err != nil {
+		return r, err
+	}
+	if r.Max, err = parseLexBound(max); err != nil {
+		return r, err
+	}
+	return r, nil
+}
+
+func parseLexBound(bound string) (LexBound, error) {
+	switch {
+	case bound == "-":
+		return LexBound{inf: -1}, nil
+	case bound == "+":
+		return LexBound{inf: 1}, nil
+	case strings.HasPrefix(bound, "["):
+		return LexBound{Value: bound[1:]}, nil
+	case strings.HasPrefix(bound, "("):
+		return LexBound{Value: bound[1:], Exclusive: true}, nil
+	default:
+		return LexBound{}, ErrZMinMaxNotLex
+	}
+}
+
+func (r *LexRange) gteMin(_ float64, ele string) bool {
+	switch r.Min.inf {
+	case -1:
+		return true
+	case 1:
+		return false
+	}
+	if r.Min.Exclusive {
+		return ele > r.Min.Value
+	}
+	return ele >= r.Min.Value
+}
+
+func (r *LexRange) lteMax(_ float64, ele string) bool {
+	switch r.Max.inf {
+	case 1:
+		return true
+	case -1:
+		return false
+	}
+	if r.Max.Exclusive {
+		return ele < r.Max.Value
+	}
+	return ele <= r.Max.Value
+}
+
+func (r *LexRange) isEmpty() bool {
+	if r.Min.inf == 1 || r.Max.inf == -1 {
+		return true
+	}
+	if r.Min.inf != 0 || r.Max.inf != 0 {
+		return false
+	}
+	return r.Min.Value > r.Max.Value ||
+		(r.Min.Value == r.Max.Value && (r.Min.Exclusive || r.Max.Exclusive))
+}
+
+const (
+	ZRangeByRank = iota
+	ZRangeByScore
+	ZRangeByLex
+)
+
+/*
+Everything ZRANGE/ZRANGESTORE can ask for. Start/Stop are only used for
+ZRangeByRank, Score/Lex for the matching By. Count < 0 means no LIMIT.
+*/
+type ZRangeSpec struct {
+	By          int
+	Rev         bool
+	Start, Stop int
+	Score       ScoreRange
+	Lex         LexRange
+	Offset      int
+	Count       int
+}
+
+func (spec *ZRangeSpec) zrange() zrange {
+	if spec.By == ZRangeByLex {
+		return &spec.Lex
+	}
+	return &spec.Score
+}
+
+/*
+Clamp Redis style (possibly negative) inclusive indexes to [0, length)
+*/
+func normalizeRange(start int, stop int, length int) (int, int, bool) {
+	if start < 0 {
+		start += length
+	}
+	if stop < 0 {
+		stop += length
+	}
+	if start < 0 {
+		start = 0
+	}
+	if start > stop || start >= length {
+		return 0, 0, false
+	}
+	if stop >= length {
+		stop = length - 1
+	}
+	return start, stop, true
+}
@@ -0,0 +1,212 @@
+package datastructure
+
+import (
+	"math"
+	"sort"
+)
+
+const (
+	ZAggregateSum = iota
+	ZAggregateMin
+	ZAggregateMax
+)
+
+/*
+Build a skiplist from elements already sorted by (score, member) in one
+pass: every node is appended behind the last node seen at each of its levels
+so no per-element search is needed
+*/
+func newSkiplistFromSorted(elements []ZElement, maxLevel int) *Skiplist {
+	s := NewSkiplist(maxLevel)
+	last := make([]*SkiplistNode, maxLevel)
+	lastRank := make([]uint32, maxLevel)
+	for i := range last {
+		last[i] = s.head
+	}
+
+	var prev *SkiplistNode
+	for idx, e := range elements {
+		rank := uint32(idx + 1)
+		h := s.coinFlip()
+		node := newNode(e.Member, e.Score, h)
+		for i := 0; i < h; i++ {
+			last[i].levels[i].forward = node
+			last[i].levels[i].span = rank - lastRank[i]
+			last[i] = node
+			lastRank[i] = rank
+		}
+		if h > s.level {
+			s.level = h
+		}
+		node.backward = prev
+		prev = node
+	}
+
+	s.length = uint32(len(elements))
+	s.tail = prev
+	for i := 0; i < s.level; i++ {
+		last[i].levels[i].span = s.length - lastRank[i]
+	}
+	return s
+}
+
+/*
+Create a zset from elements sorted by (score, member) with unique members,
+picking the listpack encoding when the result is small enough
+*/
+func NewZsetFromSorted(elements []ZElement) *ZSet {
+	maxLen := 0
+	for _, e := range elements {
+		maxLen = max(maxLen, len(e.Member))
+	}
+	if fitsListpack(len(elements), maxLen) {
+		return &ZSet{lp: listpackFromSorted(elements)}
+	}
+
+	z := &ZSet{
+		zskiplist: newSkiplistFromSorted(elements, 32),
+		dict:      newHashTableSize[float64](len(elements)),
+	}
+	for _, e := range elements {
+		z.dict.Set(e.Member, e.Score)
+	}
+	return z
+}
+
+func sortZElements(elements []ZElement) {
+	sort.Slice(elements, func(i, j int) bool {
+		if elements[i].Score != elements[j].Score {
+			return elements[i].Score < elements[j].Score
+		}
+		return elements[i].Member < elements[j].Member
+	})
+}
+
+/*
+Weighted score, 0 * inf counts as 0 instead of NaN like in Redis
+*/
+func weighted(score float64, weight float64) float64 {
+	res := score * weight
+	if math.IsNaN(res) {
+		return 0
+	}
+	return res
+}
+
+func aggregate(acc float64, score float64, agg int) float64 {
+	switch agg {
+	case ZAggregateMin:
+		return math.Min(acc, score)
+	case ZAggregateMax:
+		return math.Max(acc, score)
+	}
+	res := acc + score
+	if math.IsNaN(res) {
+		return 0
+	}
+	return res
+}
+
+/*
+Union of `sets` (nil entries are missing keys), scores multiplied by
+`weights` and combined with `agg`. Result is sorted
+*/
+func ZUnion(sets []*ZSet, weights []float64, agg int) []ZElement {
+	scores := make(map[string]float64)
+	for i, z := range sets {
+		if z == nil {
+			continue
+		}
+		z.each(func(ele string, score float64) bool {
+			score = weighted(score, weights[i])
+			if acc, ok := scores[ele]; ok {
+				scores[ele] = aggregate(acc, score, agg)
+			} else {
+				scores[ele] = score
+			}
+			return true
+		})
+	}
+
+	res := make([]ZElement, 0, len(scores))
+	for ele, score := range scores {
+		res = append(res, ZElement{Member: ele, Score: score})
+	}
+	sortZElements(res)
+	return res
+}
+
+/*
+Intersection of `sets`, iterating the smallest one and probing the others.
+Stops after `limit` matches when limit > 0 (used by ZINTERCARD)
+*/
+func zinter(sets []*ZSet, weights []float64, agg int, limit int) []ZElement {
+	res := make([]ZElement, 0)
+	smallest := -1
+	for i, z := range sets {
+		if z == nil || z.Zcard() == 0 {
+			return res
+		}
+		if smallest == -1 || z.Zcard() < sets[smallest].Zcard() {
+			smallest = i
+		}
+	}
+
+	sets[smallest].each(func(ele string, _ float64) bool {
+		var score float64
+		for i, z := range sets {
+			s, ok := z.score(ele)
+			if !ok {
+				return true
+			}
+			if i == 0 {
+				score = weighted(s, weights[i])
+			} else {
+				score = aggregate(score, weighted(s, weights[i]), agg)
+			}
+		}
+		res = append(res, ZElement{Member: ele, Score: score})
+		return limit <= 0 || len(res) < limit
+	})
+	return res
+}
+
+func ZInter(sets []*ZSet, weights []float64, agg int) []ZElement {
+	res := zinter(sets, weights, agg, 0)
+	sortZElements(res)
+	return res
+}
+
+/*
+Number of members in the intersection, capped at `limit` when limit > 0
+*/
+func ZInterCard(sets []*ZSet, limit int) int {
+	weights := make([]float64, len(sets))
+	for i := range weights {
+		weights[i] = 1
+	}
+	return len(zinter(sets, weights, ZAggregateSum, limit))
+}
+
+/*
+Members of the first set missing from every other one, keeping their score
+*/
+func ZDiff(sets []*ZSet) []ZElement {
+	res := make([]ZElement, 0)
+	if sets[0] == nil {
+		return res
+	}
+	sets[0].each(func(ele string, score float64) bool {
+		for _, z := range sets[1:] {
+			if z == nil {
+				continue
+			}
+			if _, ok := z.score(ele); ok {
+				return true
+			}
+		}
+		res = append(res, ZElement{Member: ele, Score: score})
+		return true
+	})
+	return res
+}
@@ -3,10 +3,21 @@ package protocol
 import (
 	"bytes"
 	"fmt"
+	"math"
 )
 
 type Encoder struct{}
 
+/*
+Value already encoded in RESP, written as is
+*/
+type Raw []byte
+
+/*
+Null array, the reply of a blocking read that timed out or an aborted EXEC
+*/
+var NullArray = Raw("*-1\r\n")
+
 var CRLF = "\r\n"
 
 func (e *Encoder) encodeStringArray(sa []string) []byte {
@@ -17,6 +28,13 @@ func (e *Encoder) encodeStringArray(sa []string) []byte {
 	return res
 }
 
+func toFloat64(v any) float64 {
+	if f, ok := v.(float32); ok {
+		return float64(f)
+	}
+	return v.(float64)
+}
+
 func (e *Encoder) Encode(value any, isSimpleString bool) []byte {
 	switch v := value.(type) {
 	case string:
@@ -27,9 +45,20 @@ func (e *Encoder) Encode(value any, isSimpleString bool) []byte {
 	case uint64, int64, uint32, int32, uint16, int16, uint8, int8, int:
 		return []byte(fmt.Sprintf(":%d%s", v, CRLF))
 	case float32, float64:
+		f := toFloat64(v)
+		switch {
+		case math.IsInf(f, 1):
+			return []byte(fmt.Sprintf(",inf%s", CRLF))
+		case math.IsInf(f, -1):
+			return []byte(fmt.Sprintf(",-inf%s", CRLF))
+		}
 		return []byte(fmt.Sprintf(",%f%s", v, CRLF))
 	case error:
 		return []byte(fmt.Sprintf("-%s%s", v, CRLF))
+	case Raw:
+		return v
+	case nil:
+		return []byte(fmt.Sprintf("$-1%s", CRLF))
 	case []string:
 		return e.encodeStringArray(value.([]string))
 	case [][]string:
@@ -39,6 +68,20 @@ func (e *Encoder) Encode(value any, isSimpleString bool) []byte {
 			buf.Write(e.encodeStringArray(sa))
 		}
 		return []byte(fmt.Sprintf("*%d%s%s", len(value.([][]string)), CRLF, buf.Bytes()))
+	case []int:
+		var b []byte
+		buf := bytes.NewBuffer(b)
+		for _, item := range v {
+			buf.Write(e.Encode(item, false))
+		}
+		return []byte(fmt.Sprintf("*%d%s%s", len(v), CRLF, buf.Bytes()))
+	case []any:
+		var b []byte
+		buf := bytes.NewBuffer(b)
+		for _, item := range v {
+			buf.Write(e.Encode(item, false))
+		}
+		return []byte(fmt.Sprintf("*%d%s%s", len(v), CRLF, buf.Bytes()))
 	default:
 		return nil
 	}
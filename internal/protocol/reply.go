@@ -0,0 +1,99 @@
+package protocol
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+/*
+Simple string of a decoded reply, told apart from bulk strings
+*/
+type Status string
+
+/*
+Decode a reply built by Encoder keeping its structure: Status, string, nil
+for null bulk strings and arrays, int64, float64, error and []any
+*/
+func DecodeReply(data []byte) (any, error) {
+	v, pos, err := decodeReply(data, 0)
+	if err != nil {
+		return nil, err
+	}
+	if pos != len(data) {
+		return nil, fmt.Errorf("trailing data after reply at pos: %d", pos)
+	}
+	return v, nil
+}
+
+/*
+Line starting after the type byte at `pos`, without its CRLF
+*/
+func replyLine(data []byte, pos int) (string, int, error) {
+	for i := pos + 1; i+1 < len(data); i++ {
+		if data[i] == '\r' && data[i+1] == '\n' {
+			return string(data[pos+1 : i]), i + 2, nil
+		}
+	}
+	return "", -1, fmt.Errorf("unterminated reply line: %w", ErrIncomplete)
+}
+
+func decodeReply(data []byte, pos int) (any, int, error) {
+	if pos >= len(data) {
+		return nil, -1, fmt.Errorf("unexpected end of reply: %w", ErrIncomplete)
+	}
+	line, next, err := replyLine(data, pos)
+	if err != nil {
+		return nil, -1, err
+	}
+	switch data[pos] {
+	case '+':
+		return Status(line), next, nil
+	case '-':
+		return errors.New(line), next, nil
+	case ':':
+		n, err := strconv.ParseInt(line, 10, 64)
+		if err != nil {
+			return nil, -1, fmt.Errorf("invalid integer reply: %w", err)
+		}
+		return n, next, nil
+	case ',':
+		f, err := strconv.ParseFloat(line, 64)
+		if err != nil {
+			return nil, -1, fmt.Errorf("invalid double reply: %w", err)
+		}
+		return f, next, nil
+	case '$':
+		n, err := strconv.Atoi(line)
+		if err != nil {
+			return nil, -1, fmt.Errorf("invalid bulk string length: %w", err)
+		}
+		if n < 0 {
+			return nil, next, nil
+		}
+		end := next + n
+		if end+2 > len(data) {
+			return nil, -1, fmt.Errorf("insufficient data for bulk string: %w", ErrIncomplete)
+		}
+		return string(data[next:end]), end + 2, nil
+	case '*':
+		n, err := strconv.Atoi(line)
+		if err != nil {
+			return nil, -1, fmt.Errorf("invalid array length: %w", err)
+		}
+		if n < 0 {
+			return nil, next, nil
+		}
+		res := make([]any, 0, n)
+		for i := 0; i < n; i++ {
+			item, npos, err := decodeReply(data, next)
+			if err != nil {
+				return nil, -1, err
+			}
+			res = append(res, item)
+			next = npos
+		}
+		return res, next, nil
+	}
+	return nil, -1, fmt.Errorf("invalid RESP type: %q at pos: %d", data[pos], pos)
+}
@@ -1,6 +1,7 @@
 package protocol
 
 import (
+	"errors"
 	"fmt"
 	"strconv"
 	"strings"
@@ -8,31 +9,41 @@ import (
 
 type REPSParser struct{}
 
+// ErrIncomplete is wrapped by every error caused by data ending before a full value
+var ErrIncomplete = errors.New("incomplete RESP value")
+
 // Parse returns the parsed command as a slice of strings (for arrays) or a single value
 func (p *REPSParser) Parse(data []byte) ([]string, error) {
+	res, _, err := p.ParseNext(data)
+	return res, err
+}
+
+// ParseNext parses the first command in data and returns how many bytes it used,
+// so callers can keep the rest of a pipelined or partially received buffer
+func (p *REPSParser) ParseNext(data []byte) ([]string, int, error) {
 	if len(data) == 0 {
-		return nil, fmt.Errorf("empty input")
+		return nil, -1, fmt.Errorf("empty input")
 	}
-	res, _, err := p.DecodeOne(data, 0)
+	res, pos, err := p.DecodeOne(data, 0)
 	if err != nil {
-		return nil, err
+		return nil, -1, err
 	}
 
 	// Convert result to string slice for command processing
 	switch v := res.(type) {
 	case []string:
-		return v, nil
+		return v, pos, nil
 	case string:
-		return []string{v}, nil
+		return []string{v}, pos, nil
 	default:
-		return []string{fmt.Sprintf("%v", v)}, nil
+		return []string{fmt.Sprintf("%v", v)}, pos, nil
 	}
 }
 
 // DecodeOne returns the parsed value as interface{}, position, and error
 func (p *REPSParser) DecodeOne(data []byte, pos int) (interface{}, int, error) {
 	if pos >= len(data) {
-		return nil, -1, fmt.Errorf("unexpected end of input")
+		return nil, -1, fmt.Errorf("unexpected end of input: %w", ErrIncomplete)
 	}
 	switch data[pos] {
 	case '+':
@@ -59,7 +70,10 @@ func (p *REPSParser) parseSimpleString(data []byte, pos int) (string, int, error
 	for pos < len(data) && data[pos] != '\r' {
 		pos++
 	}
-	if pos+1 >= len(data) || data[pos+1] != '\n' {
+	if pos+1 >= len(data) {
+		return "", -1, fmt.Errorf("invalid simple string format: %w", ErrIncomplete)
+	}
+	if data[pos+1] != '\n' {
 		return "", -1, fmt.Errorf("invalid simple string format")
 	}
 	return string(data[start:pos]), pos + 2, nil
@@ -72,7 +86,10 @@ func (p *REPSParser) parseBulkString(data []byte, pos int) (string, int, error)
 	for pos < len(data) && data[pos] != '\r' {
 		pos++
 	}
-	if pos+1 >= len(data) || data[pos+1] != '\n' {
+	if pos+1 >= len(data) {
+		return "", -1, fmt.Errorf("invalid bulk string format: %w", ErrIncomplete)
+	}
+	if data[pos+1] != '\n' {
 		return "", -1, fmt.Errorf("invalid bulk string format")
 	}
 
@@ -90,7 +107,10 @@ func (p *REPSParser) parseBulkString(data []byte, pos int) (string, int, error)
 
 	if n == 0 {
 		// Empty string
-		if pos+1 >= len(data) || data[pos] != '\r' || data[pos+1] != '\n' {
+		if pos+1 >= len(data) {
+			return "", -1, fmt.Errorf("invalid empty bulk string format: %w", ErrIncomplete)
+		}
+		if data[pos] != '\r' || data[pos+1] != '\n' {
 			return "", -1, fmt.Errorf("invalid empty bulk string format")
 		}
 		return "", pos + 2, nil
@@ -98,12 +118,12 @@ func (p *REPSParser) parseBulkString(data []byte, pos int) (string, int, error)
 
 	// Read exactly n bytes
 	end := pos + int(n)
-	if end > len(data) {
-		return "", -1, fmt.Errorf("insufficient data for bulk string")
+	if end+1 >= len(data) {
+		return "", -1, fmt.Errorf("insufficient data for bulk string: %w", ErrIncomplete)
 	}
 
 	// Verify CRLF after the n bytes
-	if end+1 >= len(data) || data[end] != '\r' || data[end+1] != '\n' {
+	if data[end] != '\r' || data[end+1] != '\n' {
 		return "", -1, fmt.Errorf("missing CRLF after bulk string")
 	}
 
@@ -117,7 +137,10 @@ func (p *REPSParser) parseInt(data []byte, pos int) (int64, int, error) {
 	for pos < len(data) && data[pos] != '\r' {
 		pos++
 	}
-	if pos+1 >= len(data) || data[pos+1] != '\n' {
+	if pos+1 >= len(data) {
+		return 0, -1, fmt.Errorf("invalid integer format: %w", ErrIncomplete)
+	}
+	if data[pos+1] != '\n' {
 		return 0, -1, fmt.Errorf("invalid integer format")
 	}
 
@@ -135,7 +158,10 @@ func (p *REPSParser) parseArray(data []byte, pos int) ([]string, int, error) {
 	for pos < len(data) && data[pos] != '\r' {
 		pos++
 	}
-	if pos+1 >= len(data) || data[pos+1] != '\n' {
+	if pos+1 >= len(data) {
+		return nil, -1, fmt.Errorf("invalid array format: %w", ErrIncomplete)
+	}
+	if data[pos+1] != '\n' {
 		return nil, -1, fmt.Errorf("invalid array format")
 	}
 
@@ -191,7 +217,10 @@ func (p *REPSParser) parseErr(data []byte, pos int) (error, int, error) {
 	for pos < len(data) && data[pos] != '\r' {
 		pos++
 	}
-	if pos+1 >= len(data) || data[pos+1] != '\n' {
+	if pos+1 >= len(data) {
+		return nil, -1, fmt.Errorf("invalid error format: %w", ErrIncomplete)
+	}
+	if data[pos+1] != '\n' {
 		return nil, -1, fmt.Errorf("invalid error format")
 	}
 	return fmt.Errorf("%s", string(data[start:pos])), pos + 2, nil
@@ -204,7 +233,10 @@ func (p *REPSParser) parseFloat(data []byte, pos int) (float64, int, error) {
 	for pos < len(data) && data[pos] != '\r' {
 		pos++
 	}
-	if pos+1 >= len(data) || data[pos+1] != '\n' {
+	if pos+1 >= len(data) {
+		return 0, -1, fmt.Errorf("invalid float format: %w", ErrIncomplete)
+	}
+	if data[pos+1] != '\n' {
 		return 0, -1, fmt.Errorf("invalid float format")
 	}
 
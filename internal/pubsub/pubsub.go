@@ -0,0 +1,191 @@
+package pubsub
+
+import (
+	"slices"
+	"sync"
+
+	"tcp-server.com/m/internal/glob"
+	"tcp-server.com/m/internal/protocol"
+)
+
+/*
+Receiver of published messages, in practice a client connection. Send must
+not block: slow subscribers buffer messages or get disconnected
+*/
+type Subscriber interface {
+	Send(msg []byte)
+}
+
+type subscribers map[Subscriber]struct{}
+
+/*
+Registry of channel, pattern and shard channel subscriptions. Shard channels
+behave like plain channels on a single node, they are kept apart because
+SPUBLISH only reaches SSUBSCRIBE clients
+*/
+type Broker struct {
+	mu            sync.RWMutex
+	channels      map[string]subscribers
+	patterns      map[string]subscribers
+	shardChannels map[string]subscribers
+}
+
+func NewBroker() *Broker {
+	return &Broker{
+		channels:      make(map[string]subscribers),
+		patterns:      make(map[string]subscribers),
+		shardChannels: make(map[string]subscribers),
+	}
+}
+
+func add(m map[string]subscribers, key string, s Subscriber) {
+	if m[key] == nil {
+		m[key] = make(subscribers)
+	}
+	m[key][s] = struct{}{}
+}
+
+func remove(m map[string]subscribers, key string, s Subscriber) {
+	delete(m[key], s)
+	if len(m[key]) == 0 {
+		delete(m, key)
+	}
+}
+
+func (b *Broker) Subscribe(s Subscriber, channel string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	add(b.channels, channel, s)
+}
+
+func (b *Broker) Unsubscribe(s Subscriber, channel string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	remove(b.channels, channel, s)
+}
+
+func (b *Broker) PSubscribe(s Subscriber, pattern string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	add(b.patterns, pattern, s)
+}
+
+func (b *Broker) PUnsubscribe(s Subscriber, pattern string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	remove(b.patterns, pattern, s)
+}
+
+func (b *Broker) SSubscribe(s Subscriber, channel string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	add(b.shardChannels, channel, s)
+}
+
+func (b *Broker) SUnsubscribe(s Subscriber, channel string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	remove(b.shardChannels, channel, s)
+}
+
+/*
+Deliver `message` to the subscribers of `channel` and of every matching
+pattern, returns the number of deliveries
+*/
+func (b *Broker) Publish(channel string, message string) int {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	en := protocol.Encoder{}
+	receivers := 0
+	if subs := b.channels[channel]; len(subs) > 0 {
+		msg := en.Encode([]any{"message", channel, message}, false)
+		for s := range subs {
+			s.Send(msg)
+		}
+		receivers += len(subs)
+	}
+	for pattern, subs := range b.patterns {
+		if !glob.Match(pattern, channel) {
+			continue
+		}
+		msg := en.Encode([]any{"pmessage", pattern, channel, message}, false)
+		for s := range subs {
+			s.Send(msg)
+		}
+		receivers += len(subs)
+	}
+	return receivers
+}
+
+func (b *Broker) SPublish(channel string, message string) int {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	en := protocol.Encoder{}
+	subs := b.shardChannels[channel]
+	if len(subs) > 0 {
+		msg := en.Encode([]any{"smessage", channel, message}, false)
+		for s := range subs {
+			s.Send(msg)
+		}
+	}
+	return len(subs)
+}
+
+func matching(m map[string]subscribers, pattern string) []string {
+	res := make([]string, 0)
+	for channel := range m {
+		if pattern == "" || glob.Match(pattern, channel) {
+			res = append(res, channel)
+		}
+	}
+	slices.Sort(res)
+	return res
+}
+
+/*
+Channels with at least one subscriber matching `pattern`, all of them when
+empty
+*/
+func (b *Broker) Channels(pattern string) []string {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return matching(b.channels, pattern)
+}
+
+func (b *Broker) ShardChannels(pattern string) []string {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return matching(b.shardChannels, pattern)
+}
+
+/*
+Flattened `channel count` pairs of PUBSUB NUMSUB
+*/
+func (b *Broker) NumSub(channels []string) []any {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	res := make([]any, 0, len(channels)*2)
+	for _, channel := range channels {
+		res = append(res, channel, len(b.channels[channel]))
+	}
+	return res
+}
+
+func (b *Broker) ShardNumSub(channels []string) []any {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	res := make([]any, 0, len(channels)*2)
+	for _, channel := range channels {
+		res = append(res, channel, len(b.shardChannels[channel]))
+	}
+	return res
+}
+
+/*
+Number of distinct patterns subscribed to
+*/
+func (b *Broker) NumPat() int {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return len(b.patterns)
+}
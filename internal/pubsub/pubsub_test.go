@@ -0,0 +1,55 @@
+package pubsub
+
+import (
+	"slices"
+	"testing"
+)
+
+type recorder struct {
+	msgs []string
+}
+
+func (r *recorder) Send(msg []byte) {
+	r.msgs = append(r.msgs, string(msg))
+}
+
+func TestBrokerPublish(t *testing.T) {
+	b := NewBroker()
+	a, p, s := &recorder{}, &recorder{}, &recorder{}
+	b.Subscribe(a, "news.tech")
+	b.PSubscribe(p, "news.*")
+	b.PSubscribe(p, "*")
+	b.SSubscribe(s, "news.tech")
+
+	if n := b.Publish("news.tech", "hi"); n != 3 {
+		t.Fatalf("Publish reached %d receivers, want 3", n)
+	}
+	if len(a.msgs) != 1 || a.msgs[0] != "*3\r\n$7\r\nmessage\r\n$9\r\nnews.tech\r\n$2\r\nhi\r\n" {
+		t.Fatalf("channel subscriber got %q", a.msgs)
+	}
+	if len(p.msgs) != 2 || len(s.msgs) != 0 {
+		t.Fatalf("pattern subscriber got %d messages, shard subscriber %d", len(p.msgs), len(s.msgs))
+	}
+	if n := b.SPublish("news.tech", "hi"); n != 1 || len(s.msgs) != 1 || len(a.msgs) != 1 {
+		t.Fatalf("SPublish reached %d receivers", n)
+	}
+
+	if got := b.Channels("news.*"); !slices.Equal(got, []string{"news.tech"}) {
+		t.Fatalf("Channels = %v", got)
+	}
+	if got := b.NumSub([]string{"news.tech", "other"}); !slices.Equal(got, []any{"news.tech", 1, "other", 0}) {
+		t.Fatalf("NumSub = %v", got)
+	}
+	if b.NumPat() != 2 {
+		t.Fatalf("NumPat = %d", b.NumPat())
+	}
+
+	b.Unsubscribe(a, "news.tech")
+	b.PUnsubscribe(p, "*")
+	if n := b.Publish("news.tech", "bye"); n != 1 {
+		t.Fatalf("Publish after unsubscribe reached %d receivers", n)
+	}
+	if len(b.Channels("")) != 0 {
+		t.Fatal("channel without subscribers is still listed")
+	}
+}
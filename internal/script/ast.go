@@ -0,0 +1,112 @@
+package script
+
+type expr interface{}
+
+type stmt interface{}
+
+type (
+	constExpr struct {
+		value Value
+	}
+	varargExpr struct {
+		line int
+	}
+	nameExpr struct {
+		name string
+		line int
+	}
+	indexExpr struct {
+		obj  expr
+		key  expr
+		line int
+	}
+	callExpr struct {
+		fn   expr
+		args []expr
+		line int
+	}
+	// obj:name(args), obj is evaluated once and passed as first argument
+	methodCallExpr struct {
+		obj  expr
+		name string
+		args []expr
+		line int
+	}
+	functionExpr struct {
+		params  []string
+		varargs bool
+		body    []stmt
+	}
+	binopExpr struct {
+		op   string
+		l, r expr
+		line int
+	}
+	unopExpr struct {
+		op   string
+		e    expr
+		line int
+	}
+	tableExpr struct {
+		// A nil key is a positional item
+		keys   []expr
+		values []expr
+		line   int
+	}
+	// Parenthesized expression, truncates multiple results to one
+	parenExpr struct {
+		e expr
+	}
+)
+
+type (
+	localStmt struct {
+		names []string
+		exprs []expr
+	}
+	localFunctionStmt struct {
+		name string
+		fn   *functionExpr
+	}
+	assignStmt struct {
+		targets []expr
+		exprs   []expr
+		line    int
+	}
+	callStmt struct {
+		call expr
+	}
+	doStmt struct {
+		body []stmt
+	}
+	whileStmt struct {
+		cond expr
+		body []stmt
+	}
+	repeatStmt struct {
+		body []stmt
+		cond expr
+	}
+	ifStmt struct {
+		conds  []expr
+		blocks [][]stmt
+		// nil when there is no else branch
+		elseBlock []stmt
+	}
+	numForStmt struct {
+		name               string
+		start, limit, step expr
+		body               []stmt
+		line               int
+	}
+	genForStmt struct {
+		names []string
+		exprs []expr
+		body  []stmt
+		line  int
+	}
+	returnStmt struct {
+		exprs []expr
+	}
+	breakStmt struct{}
+)
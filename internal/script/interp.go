@@ -0,0 +1,774 @@
+package script
+
+import (
+	"fmt"
+	"math"
+)
+
+/*
+Calls nested deeper fail with a stack overflow error
+*/
+const maxCallDepth = 200
+
+/*
+The hook runs every hookSteps statements or loop iterations
+*/
+const hookSteps = 1000
+
+/*
+Interpreter state: the globals and the libraries. Not safe for concurrent
+use, a Chunk may run on several Interp at once
+*/
+type Interp struct {
+	globals *Table
+	// Library used for the methods of strings
+	strlib *Table
+	// Called regularly while running, an error stops the script and is
+	// not catchable by pcall
+	Hook  func() error
+	steps int
+	depth int
+	// Line of the call being made, used by builtins reporting errors
+	line int
+}
+
+/*
+Interpreter with the base, string, table and math libraries
+*/
+func New() *Interp {
+	it := &Interp{globals: NewTable()}
+	openLibs(it)
+	it.globals.readonly = true
+	return it
+}
+
+/*
+Define the global `name`, scripts themselves cannot create globals
+*/
+func (it *Interp) SetGlobal(name string, value Value) {
+	it.globals.Set(name, value)
+}
+
+/*
+Run `chunk` and return the values of its return statement
+*/
+func (it *Interp) Run(chunk *Chunk) (res []Value, err error) {
+	defer func() {
+		// A script must not take the server down
+		if r := recover(); r != nil {
+			res, err = nil, &Error{Value: fmt.Sprintf("user_script: %v", r)}
+		}
+	}()
+	it.steps, it.depth = 0, 0
+	_, res, err = it.run(chunk.body, &scope{isFunc: true})
+	return res, err
+}
+
+/*
+Call `fn` with `args`, for builtins taking functions
+*/
+func (it *Interp) Call(fn Value, args []Value) ([]Value, error) {
+	return it.call(fn, args, it.line, nil, nil)
+}
+
+/*
+Runtime error at the line being run, for builtins
+*/
+func (it *Interp) Errorf(format string, args ...any) error {
+	return rtError(it.line, format, args...)
+}
+
+func rtError(line int, format string, args ...any) error {
+	return &Error{Value: fmt.Sprintf("user_script:%d: %s", line, fmt.Sprintf(format, args...))}
+}
+
+/*
+Variables of a block. Loops create one per iteration so that closures
+capture the variables of their own iteration
+*/
+type scope struct {
+	vars   map[string]Value
+	parent *scope
+	// Body of a function, holds its varargs
+	isFunc  bool
+	varargs []Value
+}
+
+func (s *scope) declare(name string, v Value) {
+	if s.vars == nil {
+		s.vars = make(map[string]Value)
+	}
+	s.vars[name] = v
+}
+
+/*
+Scope declaring `name`, nil for a global
+*/
+func (s *scope) lookup(name string) *scope {
+	for ; s != nil; s = s.parent {
+		if _, ok := s.vars[name]; ok {
+			return s
+		}
+	}
+	return nil
+}
+
+type ctrl int
+
+const (
+	ctrlNone ctrl = iota
+	ctrlBreak
+	ctrlReturn
+)
+
+func (it *Interp) step() error {
+	it.steps++
+	if it.steps%hookSteps == 0 && it.Hook != nil {
+		return it.Hook()
+	}
+	return nil
+}
+
+/*
+Run a block in a new scope
+*/
+func (it *Interp) block(body []stmt, parent *scope) (ctrl, []Value, error) {
+	return it.run(body, &scope{parent: parent})
+}
+
+/*
+Run statements in `sc`
+*/
+func (it *Interp) run(body []stmt, sc *scope) (ctrl, []Value, error) {
+	for _, s := range body {
+		if err := it.step(); err != nil {
+			return ctrlNone, nil, err
+		}
+		c, res, err := it.exec(s, sc)
+		if err != nil || c != ctrlNone {
+			return c, res, err
+		}
+	}
+	return ctrlNone, nil, nil
+}
+
+func (it *Interp) exec(s stmt, sc *scope) (ctrl, []Value, error) {
+	switch s := s.(type) {
+	case *localStmt:
+		values, err := it.evalMulti(s.exprs, sc, len(s.names))
+		if err != nil {
+			return ctrlNone, nil, err
+		}
+		for i, name := range s.names {
+			sc.declare(name, values[i])
+		}
+	case *localFunctionStmt:
+		sc.declare(s.name, nil)
+		sc.declare(s.name, &Function{proto: s.fn, scope: sc})
+	case *assignStmt:
+		return ctrlNone, nil, it.assign(s, sc)
+	case *callStmt:
+		_, err := it.evalCall(s.call, sc)
+		return ctrlNone, nil, err
+	case *doStmt:
+		return it.block(s.body, sc)
+	case *whileStmt:
+		for {
+			cond, err := it.eval(s.cond, sc)
+			if err != nil || !truthy(cond) {
+				return ctrlNone, nil, err
+			}
+			c, res, err := it.block(s.body, sc)
+			if err != nil || c == ctrlReturn {
+				return c, res, err
+			}
+			if c == ctrlBreak {
+				return ctrlNone, nil, nil
+			}
+			if err := it.step(); err != nil {
+				return ctrlNone, nil, err
+			}
+		}
+	case *repeatStmt:
+		for {
+			// The condition sees the locals of the body
+			inner := &scope{parent: sc}
+			c, res, err := it.run(s.body, inner)
+			if err != nil || c == ctrlReturn {
+				return c, res, err
+			}
+			if c == ctrlBreak {
+				return ctrlNone, nil, nil
+			}
+			cond, err := it.eval(s.cond, inner)
+			if err != nil || truthy(cond) {
+				return ctrlNone, nil, err
+			}
+			if err := it.step(); err != nil {
+				return ctrlNone, nil, err
+			}
+		}
+	case *ifStmt:
+		for i, cond := range s.conds {
+			v, err := it.eval(cond, sc)
+			if err != nil {
+				return ctrlNone, nil, err
+			}
+			if truthy(v) {
+				return it.block(s.blocks[i], sc)
+			}
+		}
+		if s.elseBlock != nil {
+			return it.block(s.elseBlock, sc)
+		}
+	case *numForStmt:
+		return it.numFor(s, sc)
+	case *genForStmt:
+		return it.genFor(s, sc)
+	case *returnStmt:
+		res, err := it.evalMultiAll(s.exprs, sc)
+		return ctrlReturn, res, err
+	case *breakStmt:
+		return ctrlBreak, nil, nil
+	}
+	return ctrlNone, nil, nil
+}
+
+func (it *Interp) numFor(s *numForStmt, sc *scope) (ctrl, []Value, error) {
+	start, err := it.forNumber(s.start, sc, s.line, "initial value")
+	if err != nil {
+		return ctrlNone, nil, err
+	}
+	limit, err := it.forNumber(s.limit, sc, s.line, "limit")
+	if err != nil {
+		return ctrlNone, nil, err
+	}
+	step := 1.0
+	if s.step != nil {
+		if step, err = it.forNumber(s.step, sc, s.line, "step"); err != nil {
+			return ctrlNone, nil, err
+		}
+	}
+	for v := start; (step > 0 && v <= limit) || (step <= 0 && v >= limit); v += step {
+		inner := &scope{parent: sc}
+		inner.declare(s.name, v)
+		c, res, err := it.run(s.body, inner)
+		if err != nil || c == ctrlReturn {
+			return c, res, err
+		}
+		if c == ctrlBreak {
+			break
+		}
+		if err := it.step(); err != nil {
+			return ctrlNone, nil, err
+		}
+	}
+	return ctrlNone, nil, nil
+}
+
+func (it *Interp) forNumber(e expr, sc *scope, line int, what string) (float64, error) {
+	v, err := it.eval(e, sc)
+	if err != nil {
+		return 0, err
+	}
+	n, ok := ToNumber(v)
+	if !ok {
+		return 0, rtError(line, "'for' %s must be a number", what)
+	}
+	return n, nil
+}
+
+func (it *Interp) genFor(s *genForStmt, sc *scope) (ctrl, []Value, error) {
+	init, err := it.evalMulti(s.exprs, sc, 3)
+	if err != nil {
+		return ctrlNone, nil, err
+	}
+	fn, state, control := init[0], init[1], init[2]
+	for {
+		res, err := it.call(fn, []Value{state, control}, s.line, nil, sc)
+		if err != nil {
+			return ctrlNone, nil, err
+		}
+		if len(res) == 0 || res[0] == nil {
+			return ctrlNone, nil, nil
+		}
+		control = res[0]
+		inner := &scope{parent: sc}
+		for i, name := range s.names {
+			var v Value
+			if i < len(res) {
+				v = res[i]
+			}
+			inner.declare(name, v)
+		}
+		c, ret, err := it.run(s.body, inner)
+		if err != nil || c == ctrlReturn {
+			return c, ret, err
+		}
+		if c == ctrlBreak {
+			return ctrlNone, nil, nil
+		}
+		if err := it.step(); err != nil {
+			return ctrlNone, nil, err
+		}
+	}
+}
+
+func (it *Interp) assign(s *assignStmt, sc *scope) error {
+	values, err := it.evalMulti(s.exprs, sc, len(s.targets))
+	if err != nil {
+		return err
+	}
+	for i, target := range s.targets {
+		switch t := target.(type) {
+		case *nameExpr:
+			if owner := sc.lookup(t.name); owner != nil {
+				owner.vars[t.name] = values[i]
+				continue
+			}
+			return rtError(s.line, "Attempt to modify a readonly table")
+		case *indexExpr:
+			obj, err := it.eval(t.obj, sc)
+			if err != nil {
+				return err
+			}
+			key, err := it.eval(t.key, sc)
+			if err != nil {
+				return err
+			}
+			if err := it.setIndex(obj, key, values[i], t, sc); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (it *Interp) setIndex(obj, key, value Value, e *indexExpr, sc *scope) error {
+	t, ok := obj.(*Table)
+	if !ok {
+		return it.typeError(e.line, "index", e.obj, obj, sc)
+	}
+	if t.readonly {
+		return rtError(e.line, "Attempt to modify a readonly table")
+	}
+	switch k := key.(type) {
+	case nil:
+		return rtError(e.line, "table index is nil")
+	case float64:
+		if math.IsNaN(k) {
+			return rtError(e.line, "table index is NaN")
+		}
+	}
+	t.Set(key, value)
+	return nil
+}
+
+/*
+Description of the variable `e` refers to for error messages, such as
+"local 'x'"
+*/
+func describe(e expr, sc *scope) string {
+	switch e := e.(type) {
+	case *nameExpr:
+		if sc != nil && sc.lookup(e.name) != nil {
+			return fmt.Sprintf("local '%s'", e.name)
+		}
+		return fmt.Sprintf("global '%s'", e.name)
+	case *indexExpr:
+		if k, ok := e.key.(*constExpr); ok {
+			if name, ok := k.value.(string); ok {
+				return fmt.Sprintf("field '%s'", name)
+			}
+		}
+	case *methodCallExpr:
+		return fmt.Sprintf("method '%s'", e.name)
+	}
+	return ""
+}
+
+/*
+"attempt to index local 'x' (a nil value)"
+*/
+func (it *Interp) typeError(line int, op string, e expr, v Value, sc *scope) error {
+	if info := describe(e, sc); info != "" {
+		return rtError(line, "attempt to %s %s (a %s value)", op, info, TypeName(v))
+	}
+	return rtError(line, "attempt to %s a %s value", op, TypeName(v))
+}
+
+/*
+Evaluate to a single value
+*/
+func (it *Interp) eval(e expr, sc *scope) (Value, error) {
+	switch e := e.(type) {
+	case *constExpr:
+		return e.value, nil
+	case *nameExpr:
+		if owner := sc.lookup(e.name); owner != nil {
+			return owner.vars[e.name], nil
+		}
+		v := it.globals.Get(e.name)
+		if v == nil {
+			return nil, rtError(e.line, "Script attempted to access nonexistent global variable '%s'", e.name)
+		}
+		return v, nil
+	case *varargExpr:
+		if args := varargs(sc); len(args) > 0 {
+			return args[0], nil
+		}
+		return nil, nil
+	case *indexExpr:
+		obj, err := it.eval(e.obj, sc)
+		if err != nil {
+			return nil, err
+		}
+		key, err := it.eval(e.key, sc)
+		if err != nil {
+			return nil, err
+		}
+		return it.index(obj, key, e.line, e.obj, sc)
+	case *callExpr, *methodCallExpr:
+		res, err := it.evalCall(e, sc)
+		if err != nil || len(res) == 0 {
+			return nil, err
+		}
+		return res[0], nil
+	case *functionExpr:
+		return &Function{proto: e, scope: sc}, nil
+	case *parenExpr:
+		return it.eval(e.e, sc)
+	case *tableExpr:
+		return it.table(e, sc)
+	case *unopExpr:
+		return it.unop(e, sc)
+	case *binopExpr:
+		return it.binop(e, sc)
+	}
+	return nil, fmt.Errorf("unknown expression %T", e)
+}
+
+func varargs(sc *scope) []Value {
+	for ; sc != nil; sc = sc.parent {
+		if sc.isFunc {
+			return sc.varargs
+		}
+	}
+	return nil
+}
+
+/*
+Whether `e` may produce several values
+*/
+func isMulti(e expr) bool {
+	switch e.(type) {
+	case *callExpr, *methodCallExpr, *varargExpr:
+		return true
+	}
+	return false
+}
+
+/*
+Evaluate `exprs` adjusting the result to `n` values
+*/
+func (it *Interp) evalMulti(exprs []expr, sc *scope, n int) ([]Value, error) {
+	res, err := it.evalMultiAll(exprs, sc)
+	if err != nil {
+		return nil, err
+	}
+	if len(res) >= n {
+		return res[:n], nil
+	}
+	return append(res, make([]Value, n-len(res))...), nil
+}
+
+/*
+Evaluate `exprs`, the last one expands to all its values
+*/
+func (it *Interp) evalMultiAll(exprs []expr, sc *scope) ([]Value, error) {
+	res := make([]Value, 0, len(exprs))
+	for i, e := range exprs {
+		if i == len(exprs)-1 && isMulti(e) {
+			rest, err := it.evalExpand(e, sc)
+			if err != nil {
+				return nil, err
+			}
+			return append(res, rest...), nil
+		}
+		v, err := it.eval(e, sc)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, v)
+	}
+	return res, nil
+}
+
+func (it *Interp) evalExpand(e expr, sc *scope) ([]Value, error) {
+	if _, ok := e.(*varargExpr); ok {
+		return varargs(sc), nil
+	}
+	return it.evalCall(e, sc)
+}
+
+func (it *Interp) evalCall(e expr, sc *scope) ([]Value, error) {
+	switch e := e.(type) {
+	case *callExpr:
+		fn, err := it.eval(e.fn, sc)
+		if err != nil {
+			return nil, err
+		}
+		args, err := it.evalMultiAll(e.args, sc)
+		if err != nil {
+			return nil, err
+		}
+		return it.call(fn, args, e.line, e.fn, sc)
+	case *methodCallExpr:
+		obj, err := it.eval(e.obj, sc)
+		if err != nil {
+			return nil, err
+		}
+		fn, err := it.index(obj, e.name, e.line, e.obj, sc)
+		if err != nil {
+			return nil, err
+		}
+		args, err := it.evalMultiAll(e.args, sc)
+		if err != nil {
+			return nil, err
+		}
+		return it.call(fn, append([]Value{obj}, args...), e.line, e, sc)
+	}
+	return nil, fmt.Errorf("unknown call %T", e)
+}
+
+/*
+Call `fn`, `e` is the expression it came from for error messages
+*/
+func (it *Interp) call(fn Value, args []Value, line int, e expr, sc *scope) ([]Value, error) {
+	switch f := fn.(type) {
+	case *GoFunction:
+		it.line = line
+		return f.Fn(it, args)
+	case *Function:
+		if it.depth >= maxCallDepth {
+			return nil, rtError(line, "stack overflow")
+		}
+		it.depth++
+		defer func() { it.depth-- }()
+		body := &scope{parent: f.scope, isFunc: true}
+		for i, name := range f.proto.params {
+			var v Value
+			if i < len(args) {
+				v = args[i]
+			}
+			body.declare(name, v)
+		}
+		if f.proto.varargs && len(args) > len(f.proto.params) {
+			body.varargs = args[len(f.proto.params):]
+		}
+		_, res, err := it.run(f.proto.body, body)
+		return res, err
+	}
+	return nil, it.typeError(line, "call", e, fn, sc)
+}
+
+func (it *Interp) index(obj, key Value, line int, e expr, sc *scope) (Value, error) {
+	switch o := obj.(type) {
+	case *Table:
+		return o.Get(key), nil
+	case string:
+		// Strings index the string library, for s:upper() and the like
+		return it.strlib.Get(key), nil
+	}
+	return nil, it.typeError(line, "index", e, obj, sc)
+}
+
+func (it *Interp) table(e *tableExpr, sc *scope) (Value, error) {
+	t := NewTable()
+	n := 0
+	for i, ve := range e.values {
+		if e.keys[i] != nil {
+			key, err := it.eval(e.keys[i], sc)
+			if err != nil {
+				return nil, err
+			}
+			v, err := it.eval(ve, sc)
+			if err != nil {
+				return nil, err
+			}
+			if key == nil {
+				return nil, rtError(e.line, "table index is nil")
+			}
+			if k, ok := key.(float64); ok && math.IsNaN(k) {
+				return nil, rtError(e.line, "table index is NaN")
+			}
+			t.Set(key, v)
+			continue
+		}
+		if i == len(e.values)-1 && isMulti(ve) {
+			rest, err := it.evalExpand(ve, sc)
+			if err != nil {
+				return nil, err
+			}
+			for _, v := range rest {
+				n++
+				t.Set(float64(n), v)
+			}
+			continue
+		}
+		v, err := it.eval(ve, sc)
+		if err != nil {
+			return nil, err
+		}
+		n++
+		t.Set(float64(n), v)
+	}
+	return t, nil
+}
+
+func (it *Interp) unop(e *unopExpr, sc *scope) (Value, error) {
+	v, err := it.eval(e.e, sc)
+	if err != nil {
+		return nil, err
+	}
+	switch e.op {
+	case "not":
+		return !truthy(v), nil
+	case "-":
+		n, ok := ToNumber(v)
+		if !ok {
+			return nil, it.typeError(e.line, "perform arithmetic on", e.e, v, sc)
+		}
+		return -n, nil
+	}
+	switch x := v.(type) {
+	case string:
+		return float64(len(x)), nil
+	case *Table:
+		return float64(x.Len()), nil
+	}
+	return nil, it.typeError(e.line, "get length of", e.e, v, sc)
+}
+
+func (it *Interp) binop(e *binopExpr, sc *scope) (Value, error) {
+	l, err := it.eval(e.l, sc)
+	if err != nil {
+		return nil, err
+	}
+	switch e.op {
+	case "and":
+		if !truthy(l) {
+			return l, nil
+		}
+		return it.eval(e.r, sc)
+	case "or":
+		if truthy(l) {
+			return l, nil
+		}
+		return it.eval(e.r, sc)
+	}
+	r, err := it.eval(e.r, sc)
+	if err != nil {
+		return nil, err
+	}
+
+	switch e.op {
+	case "==":
+		return l == r, nil
+	case "~=":
+		return l != r, nil
+	case "<", "<=", ">", ">=":
+		return compare(e.op, l, r, e.line)
+	case "..":
+		ls, lok := concatString(l)
+		rs, rok := concatString(r)
+		if !lok {
+			return nil, it.typeError(e.line, "concatenate", e.l, l, sc)
+		}
+		if !rok {
+			return nil, it.typeError(e.line, "concatenate", e.r, r, sc)
+		}
+		return ls + rs, nil
+	}
+
+	a, ok := ToNumber(l)
+	if !ok {
+		return nil, it.typeError(e.line, "perform arithmetic on", e.l, l, sc)
+	}
+	b, ok := ToNumber(r)
+	if !ok {
+		return nil, it.typeError(e.line, "perform arithmetic on", e.r, r, sc)
+	}
+	switch e.op {
+	case "+":
+		return a + b, nil
+	case "-":
+		return a - b, nil
+	case "*":
+		return a * b, nil
+	case "/":
+		return a / b, nil
+	case "%":
+		return a - math.Floor(a/b)*b, nil
+	case "^":
+		return math.Pow(a, b), nil
+	}
+	return nil, fmt.Errorf("unknown operator %s", e.op)
+}
+
+func concatString(v Value) (string, bool) {
+	switch x := v.(type) {
+	case string:
+		return x, true
+	case float64:
+		return formatNumber(x), true
+	}
+	return "", false
+}
+
+/*
+Order comparison, only between numbers or between strings
+*/
+func compare(op string, l, r Value, line int) (Value, error) {
+	var c int
+	switch a := l.(type) {
+	case float64:
+		b, ok := r.(float64)
+		if !ok {
+			break
+		}
+		switch op {
+		case "<":
+			return a < b, nil
+		case "<=":
+			return a <= b, nil
+		case ">":
+			return a > b, nil
+		}
+		return a >= b, nil
+	case string:
+		b, ok := r.(string)
+		if !ok {
+			break
+		}
+		switch {
+		case a < b:
+			c = -1
+		case a > b:
+			c = 1
+		}
+		switch op {
+		case "<":
+			return c < 0, nil
+		case "<=":
+			return c <= 0, nil
+		case ">":
+			return c > 0, nil
+		}
+		return c >= 0, nil
+	}
+	if TypeName(l) == TypeName(r) {
+		return nil, rtError(line, "attempt to compare two %s values", TypeName(l))
+	}
+	return nil, rtError(line, "attempt to compare %s with %s", TypeName(l), TypeName(r))
+}
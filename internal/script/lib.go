@@ -0,0 +1,766 @@
+package script
+
+import (
+	"fmt"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+/*
+Longest string string.rep may build, the proto-max-bulk-len of Redis
+*/
+const maxStringLen = 512 * 1024 * 1024
+
+func openLibs(it *Interp) {
+	g := it.globals
+	register(g, "type", baseType)
+	register(g, "tostring", baseToString)
+	register(g, "tonumber", baseToNumber)
+	register(g, "pairs", basePairs)
+	register(g, "ipairs", baseIpairs)
+	register(g, "next", baseNext)
+	register(g, "select", baseSelect)
+	register(g, "error", baseError)
+	register(g, "assert", baseAssert)
+	register(g, "pcall", basePcall)
+	register(g, "unpack", baseUnpack)
+
+	str := NewTable()
+	register(str, "len", strLen)
+	register(str, "sub", strSub)
+	register(str, "upper", strUpper)
+	register(str, "lower", strLower)
+	register(str, "rep", strRep)
+	register(str, "reverse", strReverse)
+	register(str, "byte", strByte)
+	register(str, "char", strChar)
+	register(str, "find", strFind)
+	register(str, "format", strFormat)
+	str.readonly = true
+	g.Set("string", str)
+	it.strlib = str
+
+	tbl := NewTable()
+	register(tbl, "insert", tblInsert)
+	register(tbl, "remove", tblRemove)
+	register(tbl, "concat", tblConcat)
+	register(tbl, "sort", tblSort)
+	register(tbl, "getn", tblGetn)
+	tbl.readonly = true
+	g.Set("table", tbl)
+
+	m := NewTable()
+	register(m, "floor", mathFunc(math.Floor))
+	register(m, "ceil", mathFunc(math.Ceil))
+	register(m, "abs", mathFunc(math.Abs))
+	register(m, "sqrt", mathFunc(math.Sqrt))
+	register(m, "log", mathFunc(math.Log))
+	register(m, "exp", mathFunc(math.Exp))
+	register(m, "fmod", mathFmod)
+	register(m, "pow", mathPow)
+	register(m, "max", mathMax)
+	register(m, "min", mathMin)
+	m.Set("huge", math.Inf(1))
+	m.Set("pi", math.Pi)
+	m.readonly = true
+	g.Set("math", m)
+}
+
+func register(t *Table, name string, fn func(it *Interp, args []Value) ([]Value, error)) {
+	t.Set(name, &GoFunction{Name: name, Fn: fn})
+}
+
+func arg(args []Value, n int) Value {
+	if n < len(args) {
+		return args[n]
+	}
+	return nil
+}
+
+/*
+"bad argument #1 to 'insert' (table expected, got nil)", `n` counts from 0
+*/
+func argError(it *Interp, n int, fname string, msg string) error {
+	return it.Errorf("bad argument #%d to '%s' (%s)", n+1, fname, msg)
+}
+
+func typeExpected(it *Interp, args []Value, n int, fname string, expected string) error {
+	got := "no value"
+	if n < len(args) {
+		got = TypeName(args[n])
+	}
+	return argError(it, n, fname, expected+" expected, got "+got)
+}
+
+func checkTable(it *Interp, args []Value, n int, fname string) (*Table, error) {
+	t, ok := arg(args, n).(*Table)
+	if !ok {
+		return nil, typeExpected(it, args, n, fname, "table")
+	}
+	return t, nil
+}
+
+func checkNumber(it *Interp, args []Value, n int, fname string) (float64, error) {
+	f, ok := ToNumber(arg(args, n))
+	if !ok {
+		return 0, typeExpected(it, args, n, fname, "number")
+	}
+	return f, nil
+}
+
+/*
+Integer argument, `def` when absent
+*/
+func optInt(it *Interp, args []Value, n int, fname string, def int) (int, error) {
+	if arg(args, n) == nil {
+		return def, nil
+	}
+	f, err := checkNumber(it, args, n, fname)
+	if err != nil {
+		return 0, err
+	}
+	return int(f), nil
+}
+
+/*
+String argument, numbers are converted
+*/
+func checkString(it *Interp, args []Value, n int, fname string) (string, error) {
+	switch v := arg(args, n).(type) {
+	case string:
+		return v, nil
+	case float64:
+		return formatNumber(v), nil
+	}
+	return "", typeExpected(it, args, n, fname, "string")
+}
+
+func baseType(it *Interp, args []Value) ([]Value, error) {
+	if len(args) == 0 {
+		return nil, argError(it, 0, "type", "value expected")
+	}
+	return []Value{TypeName(args[0])}, nil
+}
+
+func baseToString(it *Interp, args []Value) ([]Value, error) {
+	if len(args) == 0 {
+		return nil, argError(it, 0, "tostring", "value expected")
+	}
+	return []Value{ToString(args[0])}, nil
+}
+
+func baseToNumber(it *Interp, args []Value) ([]Value, error) {
+	base, err := optInt(it, args, 1, "tonumber", 10)
+	if err != nil {
+		return nil, err
+	}
+	if base == 10 {
+		if n, ok := ToNumber(arg(args, 0)); ok {
+			return []Value{n}, nil
+		}
+		return []Value{nil}, nil
+	}
+	if base < 2 || base > 36 {
+		return nil, argError(it, 1, "tonumber", "base out of range")
+	}
+	s, err := checkString(it, args, 0, "tonumber")
+	if err != nil {
+		return nil, err
+	}
+	n, err := strconv.ParseInt(strings.ToLower(strings.TrimSpace(s)), base, 64)
+	if err != nil {
+		return []Value{nil}, nil
+	}
+	return []Value{float64(n)}, nil
+}
+
+func basePairs(it *Interp, args []Value) ([]Value, error) {
+	t, err := checkTable(it, args, 0, "pairs")
+	if err != nil {
+		return nil, err
+	}
+	return []Value{it.globals.Get("next"), t, nil}, nil
+}
+
+func baseNext(it *Interp, args []Value) ([]Value, error) {
+	t, err := checkTable(it, args, 0, "next")
+	if err != nil {
+		return nil, err
+	}
+	k, v, found := t.Next(arg(args, 1))
+	if !found {
+		return nil, it.Errorf("invalid key to 'next'")
+	}
+	if k == nil {
+		return []Value{nil}, nil
+	}
+	return []Value{k, v}, nil
+}
+
+func ipairsStep(it *Interp, args []Value) ([]Value, error) {
+	t, err := checkTable(it, args, 0, "ipairs")
+	if err != nil {
+		return nil, err
+	}
+	i, err := checkNumber(it, args, 1, "ipairs")
+	if err != nil {
+		return nil, err
+	}
+	i++
+	v := t.Get(i)
+	if v == nil {
+		return []Value{nil}, nil
+	}
+	return []Value{i, v}, nil
+}
+
+func baseIpairs(it *Interp, args []Value) ([]Value, error) {
+	t, err := checkTable(it, args, 0, "ipairs")
+	if err != nil {
+		return nil, err
+	}
+	return []Value{&GoFunction{Name: "ipairs_step", Fn: ipairsStep}, t, 0.0}, nil
+}
+
+func baseSelect(it *Interp, args []Value) ([]Value, error) {
+	if s, ok := arg(args, 0).(string); ok && s == "#" {
+		return []Value{float64(len(args) - 1)}, nil
+	}
+	n, err := optInt(it, args, 0, "select", 0)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case n < 0:
+		n += len(args)
+		if n < 1 {
+			return nil, argError(it, 0, "select", "index out of range")
+		}
+	case n == 0:
+		return nil, argError(it, 0, "select", "index out of range")
+	case n >= len(args):
+		return nil, nil
+	}
+	return args[n:], nil
+}
+
+func baseError(it *Interp, args []Value) ([]Value, error) {
+	level, err := optInt(it, args, 1, "error", 1)
+	if err != nil {
+		return nil, err
+	}
+	v := arg(args, 0)
+	if s, ok := v.(string); ok && level > 0 {
+		return nil, it.Errorf("%s", s)
+	}
+	return nil, &Error{Value: v}
+}
+
+func baseAssert(it *Interp, args []Value) ([]Value, error) {
+	if len(args) == 0 {
+		return nil, argError(it, 0, "assert", "value expected")
+	}
+	if truthy(args[0]) {
+		return args, nil
+	}
+	if msg, ok := arg(args, 1).(string); ok {
+		return nil, &Error{Value: msg}
+	}
+	return nil, it.Errorf("assertion failed!")
+}
+
+/*
+Errors of the script are caught, others such as a killed script go through
+*/
+func basePcall(it *Interp, args []Value) ([]Value, error) {
+	if len(args) == 0 {
+		return nil, argError(it, 0, "pcall", "value expected")
+	}
+	res, err := it.Call(args[0], args[1:])
+	if err != nil {
+		if e, ok := err.(*Error); ok {
+			return []Value{false, e.Value}, nil
+		}
+		return nil, err
+	}
+	return append([]Value{true}, res...), nil
+}
+
+func baseUnpack(it *Interp, args []Value) ([]Value, error) {
+	t, err := checkTable(it, args, 0, "unpack")
+	if err != nil {
+		return nil, err
+	}
+	i, err := optInt(it, args, 1, "unpack", 1)
+	if err != nil {
+		return nil, err
+	}
+	j, err := optInt(it, args, 2, "unpack", t.Len())
+	if err != nil {
+		return nil, err
+	}
+	if i > j {
+		return nil, nil
+	}
+	if j-i >= 8000 {
+		return nil, it.Errorf("too many results to unpack")
+	}
+	res := make([]Value, 0, j-i+1)
+	for k := i; k <= j; k++ {
+		res = append(res, t.Get(float64(k)))
+	}
+	return res, nil
+}
+
+func strLen(it *Interp, args []Value) ([]Value, error) {
+	s, err := checkString(it, args, 0, "len")
+	if err != nil {
+		return nil, err
+	}
+	return []Value{float64(len(s))}, nil
+}
+
+/*
+Lua string positions: negative ones count from the end
+*/
+func strRange(i, j, n int) (int, int) {
+	if i < 0 {
+		i += n + 1
+	}
+	if j < 0 {
+		j += n + 1
+	}
+	if i < 1 {
+		i = 1
+	}
+	if j > n {
+		j = n
+	}
+	return i, j
+}
+
+func strSub(it *Interp, args []Value) ([]Value, error) {
+	s, err := checkString(it, args, 0, "sub")
+	if err != nil {
+		return nil, err
+	}
+	i, err := optInt(it, args, 1, "sub", 1)
+	if err != nil {
+		return nil, err
+	}
+	j, err := optInt(it, args, 2, "sub", -1)
+	if err != nil {
+		return nil, err
+	}
+	i, j = strRange(i, j, len(s))
+	if i > j {
+		return []Value{""}, nil
+	}
+	return []Value{s[i-1 : j]}, nil
+}
+
+func strUpper(it *Interp, args []Value) ([]Value, error) {
+	s, err := checkString(it, args, 0, "upper")
+	if err != nil {
+		return nil, err
+	}
+	return []Value{strings.ToUpper(s)}, nil
+}
+
+func strLower(it *Interp, args []Value) ([]Value, error) {
+	s, err := checkString(it, args, 0, "lower")
+	if err != nil {
+		return nil, err
+	}
+	return []Value{strings.ToLower(s)}, nil
+}
+
+func strRep(it *Interp, args []Value) ([]Value, error) {
+	s, err := checkString(it, args, 0, "rep")
+	if err != nil {
+		return nil, err
+	}
+	n, err := optInt(it, args, 1, "rep", 0)
+	if err != nil {
+		return nil, err
+	}
+	if n <= 0 || s == "" {
+		return []Value{""}, nil
+	}
+	if len(s) > maxStringLen/n {
+		return nil, it.Errorf("resulting string too large")
+	}
+	return []Value{strings.Repeat(s, n)}, nil
+}
+
+func strReverse(it *Interp, args []Value) ([]Value, error) {
+	s, err := checkString(it, args, 0, "reverse")
+	if err != nil {
+		return nil, err
+	}
+	b := []byte(s)
+	slices.Reverse(b)
+	return []Value{string(b)}, nil
+}
+
+func strByte(it *Interp, args []Value) ([]Value, error) {
+	s, err := checkString(it, args, 0, "byte")
+	if err != nil {
+		return nil, err
+	}
+	i, err := optInt(it, args, 1, "byte", 1)
+	if err != nil {
+		return nil, err
+	}
+	j, err := optInt(it, args, 2, "byte", i)
+	if err != nil {
+		return nil, err
+	}
+	i, j = strRange(i, j, len(s))
+	res := make([]Value, 0)
+	for k := i; k <= j; k++ {
+		res = append(res, float64(s[k-1]))
+	}
+	return res, nil
+}
+
+func strChar(it *Interp, args []Value) ([]Value, error) {
+	b := make([]byte, len(args))
+	for i := range args {
+		c, err := checkNumber(it, args, i, "char")
+		if err != nil {
+			return nil, err
+		}
+		if c < 0 || c > 255 {
+			return nil, argError(it, i, "char", "invalid value")
+		}
+		b[i] = byte(c)
+	}
+	return []Value{string(b)}, nil
+}
+
+/*
+Plain substring search, Lua patterns are not supported
+*/
+func strFind(it *Interp, args []Value) ([]Value, error) {
+	s, err := checkString(it, args, 0, "find")
+	if err != nil {
+		return nil, err
+	}
+	pattern, err := checkString(it, args, 1, "find")
+	if err != nil {
+		return nil, err
+	}
+	init, err := optInt(it, args, 2, "find", 1)
+	if err != nil {
+		return nil, err
+	}
+	if !truthy(arg(args, 3)) && strings.ContainsAny(pattern, "^$*+?.([%-") {
+		return nil, it.Errorf("Lua patterns are not supported, use plain find")
+	}
+	if init < 0 {
+		init += len(s) + 1
+	}
+	if init < 1 {
+		init = 1
+	}
+	if init > len(s)+1 {
+		return []Value{nil}, nil
+	}
+	idx := strings.Index(s[init-1:], pattern)
+	if idx < 0 {
+		return []Value{nil}, nil
+	}
+	start := init + idx
+	return []Value{float64(start), float64(start + len(pattern) - 1)}, nil
+}
+
+/*
+string.format with the C conversions %d %i %u %c %x %X %o %e %E %f %g %G %q
+%s and %%
+*/
+func strFormat(it *Interp, args []Value) ([]Value, error) {
+	format, err := checkString(it, args, 0, "format")
+	if err != nil {
+		return nil, err
+	}
+	var sb strings.Builder
+	n := 0
+	for i := 0; i < len(format); i++ {
+		c := format[i]
+		if c != '%' {
+			sb.WriteByte(c)
+			continue
+		}
+		i++
+		if i < len(format) && format[i] == '%' {
+			sb.WriteByte('%')
+			continue
+		}
+		start := i
+		for i < len(format) && strings.IndexByte("-+ #0123456789.", format[i]) >= 0 {
+			i++
+		}
+		if i >= len(format) {
+			return nil, it.Errorf("invalid option '%%' to 'format'")
+		}
+		spec := "%" + format[start:i]
+		n++
+		if n >= len(args) {
+			return nil, argError(it, n, "format", "no value")
+		}
+		switch conv := format[i]; conv {
+		case 'd', 'i', 'u':
+			v, err := checkNumber(it, args, n, "format")
+			if err != nil {
+				return nil, err
+			}
+			sb.WriteString(fmt.Sprintf(spec+"d", int64(v)))
+		case 'x', 'X', 'o':
+			v, err := checkNumber(it, args, n, "format")
+			if err != nil {
+				return nil, err
+			}
+			sb.WriteString(fmt.Sprintf(spec+string(conv), int64(v)))
+		case 'c':
+			v, err := checkNumber(it, args, n, "format")
+			if err != nil {
+				return nil, err
+			}
+			sb.WriteByte(byte(v))
+		case 'e', 'E', 'f', 'g', 'G':
+			v, err := checkNumber(it, args, n, "format")
+			if err != nil {
+				return nil, err
+			}
+			if !strings.Contains(spec, ".") {
+				// C defaults to 6 digits, Go to the shortest form for %g
+				spec += ".6"
+			}
+			sb.WriteString(fmt.Sprintf(spec+string(conv), v))
+		case 'q':
+			s, err := checkString(it, args, n, "format")
+			if err != nil {
+				return nil, err
+			}
+			sb.WriteString(quoteString(s))
+		case 's':
+			sb.WriteString(fmt.Sprintf(spec+"s", ToString(args[n])))
+		default:
+			return nil, it.Errorf("invalid option '%%%c' to 'format'", conv)
+		}
+	}
+	return []Value{sb.String()}, nil
+}
+
+func tblInsert(it *Interp, args []Value) ([]Value, error) {
+	t, err := checkTable(it, args, 0, "insert")
+	if err != nil {
+		return nil, err
+	}
+	if t.readonly {
+		return nil, it.Errorf("Attempt to modify a readonly table")
+	}
+	n := t.Len()
+	switch len(args) {
+	case 2:
+		t.Set(float64(n+1), args[1])
+	case 3:
+		pos, err := checkNumber(it, args, 1, "insert")
+		if err != nil {
+			return nil, err
+		}
+		p := int(pos)
+		for i := n; i >= p; i-- {
+			t.Set(float64(i+1), t.Get(float64(i)))
+		}
+		t.Set(float64(p), args[2])
+	default:
+		return nil, it.Errorf("wrong number of arguments to 'insert'")
+	}
+	return nil, nil
+}
+
+func tblRemove(it *Interp, args []Value) ([]Value, error) {
+	t, err := checkTable(it, args, 0, "remove")
+	if err != nil {
+		return nil, err
+	}
+	if t.readonly {
+		return nil, it.Errorf("Attempt to modify a readonly table")
+	}
+	n := t.Len()
+	pos, err := optInt(it, args, 1, "remove", n)
+	if err != nil {
+		return nil, err
+	}
+	if n == 0 {
+		return []Value{nil}, nil
+	}
+	v := t.Get(float64(pos))
+	for i := pos; i < n; i++ {
+		t.Set(float64(i), t.Get(float64(i+1)))
+	}
+	t.Set(float64(n), nil)
+	return []Value{v}, nil
+}
+
+func tblConcat(it *Interp, args []Value) ([]Value, error) {
+	t, err := checkTable(it, args, 0, "concat")
+	if err != nil {
+		return nil, err
+	}
+	sep := ""
+	if arg(args, 1) != nil {
+		if sep, err = checkString(it, args, 1, "concat"); err != nil {
+			return nil, err
+		}
+	}
+	i, err := optInt(it, args, 2, "concat", 1)
+	if err != nil {
+		return nil, err
+	}
+	j, err := optInt(it, args, 3, "concat", t.Len())
+	if err != nil {
+		return nil, err
+	}
+	parts := make([]string, 0)
+	for k := i; k <= j; k++ {
+		s, ok := concatString(t.Get(float64(k)))
+		if !ok {
+			return nil, it.Errorf("invalid value (at index %d) in table for 'concat'", k)
+		}
+		parts = append(parts, s)
+	}
+	return []Value{strings.Join(parts, sep)}, nil
+}
+
+func tblSort(it *Interp, args []Value) ([]Value, error) {
+	t, err := checkTable(it, args, 0, "sort")
+	if err != nil {
+		return nil, err
+	}
+	if t.readonly {
+		return nil, it.Errorf("Attempt to modify a readonly table")
+	}
+	comp := arg(args, 1)
+	values := make([]Value, t.Len())
+	for i := range values {
+		values[i] = t.Get(float64(i + 1))
+	}
+	less := func(a, b Value) (bool, error) {
+		if comp == nil {
+			res, err := compare("<", a, b, it.line)
+			if err != nil {
+				return false, err
+			}
+			return res.(bool), nil
+		}
+		res, err := it.Call(comp, []Value{a, b})
+		if err != nil {
+			return false, err
+		}
+		return len(res) > 0 && truthy(res[0]), nil
+	}
+	var sortErr error
+	slices.SortStableFunc(values, func(a, b Value) int {
+		if sortErr != nil {
+			return 0
+		}
+		lt, err := less(a, b)
+		if err != nil {
+			sortErr = err
+			return 0
+		}
+		if lt {
+			return -1
+		}
+		if gt, err := less(b, a); err != nil {
+			sortErr = err
+		} else if gt {
+			return 1
+		}
+		return 0
+	})
+	if sortErr != nil {
+		return nil, sortErr
+	}
+	for i, v := range values {
+		t.Set(float64(i+1), v)
+	}
+	return nil, nil
+}
+
+func tblGetn(it *Interp, args []Value) ([]Value, error) {
+	t, err := checkTable(it, args, 0, "getn")
+	if err != nil {
+		return nil, err
+	}
+	return []Value{float64(t.Len())}, nil
+}
+
+func mathFunc(fn func(float64) float64) func(it *Interp, args []Value) ([]Value, error) {
+	return func(it *Interp, args []Value) ([]Value, error) {
+		x, err := checkNumber(it, args, 0, "math")
+		if err != nil {
+			return nil, err
+		}
+		return []Value{fn(x)}, nil
+	}
+}
+
+func mathFmod(it *Interp, args []Value) ([]Value, error) {
+	a, err := checkNumber(it, args, 0, "fmod")
+	if err != nil {
+		return nil, err
+	}
+	b, err := checkNumber(it, args, 1, "fmod")
+	if err != nil {
+		return nil, err
+	}
+	return []Value{math.Mod(a, b)}, nil
+}
+
+func mathPow(it *Interp, args []Value) ([]Value, error) {
+	a, err := checkNumber(it, args, 0, "pow")
+	if err != nil {
+		return nil, err
+	}
+	b, err := checkNumber(it, args, 1, "pow")
+	if err != nil {
+		return nil, err
+	}
+	return []Value{math.Pow(a, b)}, nil
+}
+
+func mathMax(it *Interp, args []Value) ([]Value, error) {
+	res, err := checkNumber(it, args, 0, "max")
+	if err != nil {
+		return nil, err
+	}
+	for i := 1; i < len(args); i++ {
+		v, err := checkNumber(it, args, i, "max")
+		if err != nil {
+			return nil, err
+		}
+		res = max(res, v)
+	}
+	return []Value{res}, nil
+}
+
+func mathMin(it *Interp, args []Value) ([]Value, error) {
+	res, err := checkNumber(it, args, 0, "min")
+	if err != nil {
+		return nil, err
+	}
+	for i := 1; i < len(args); i++ {
+		v, err := checkNumber(it, args, i, "min")
+		if err != nil {
+			return nil, err
+		}
+		res = min(res, v)
+	}
+	return []Value{res}, nil
+}
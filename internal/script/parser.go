@@ -0,0 +1,692 @@
+package script
+
+import "fmt"
+
+/*
+Compiled script, safe to run several times and from several goroutines
+*/
+type Chunk struct {
+	body []stmt
+}
+
+/*
+Nesting limit of blocks and expressions, deeper sources would exhaust the
+stack of the parser and of the interpreter
+*/
+const maxSyntaxLevels = 200
+
+type parser struct {
+	toks []token
+	pos  int
+	// Current nesting of blocks and expressions
+	levels int
+}
+
+/*
+Parse `src`, errors are *SyntaxError
+*/
+func Compile(src string) (*Chunk, error) {
+	toks, err := tokenize(src)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{toks: toks}
+	body, err := p.block()
+	if err != nil {
+		return nil, err
+	}
+	if tok := p.peek(); tok.kind != tokEOF {
+		return nil, p.errorf("'<eof>' expected near '%s'", tok)
+	}
+	return &Chunk{body: body}, nil
+}
+
+func (p *parser) peek() token {
+	return p.toks[p.pos]
+}
+
+func (p *parser) advance() token {
+	tok := p.toks[p.pos]
+	if tok.kind != tokEOF {
+		p.pos++
+	}
+	return tok
+}
+
+func (p *parser) errorf(format string, args ...any) error {
+	return &SyntaxError{Line: p.peek().line, Msg: fmt.Sprintf(format, args...)}
+}
+
+/*
+Whether the next token is the keyword or symbol `text`
+*/
+func (p *parser) check(text string) bool {
+	tok := p.peek()
+	return (tok.kind == tokKeyword || tok.kind == tokSymbol) && tok.text == text
+}
+
+func (p *parser) accept(text string) bool {
+	if p.check(text) {
+		p.advance()
+		return true
+	}
+	return false
+}
+
+func (p *parser) expect(text string) error {
+	if !p.accept(text) {
+		return p.errorf("'%s' expected near '%s'", text, p.peek())
+	}
+	return nil
+}
+
+/*
+`what` opened at `line` must be closed by `text`
+*/
+func (p *parser) expectMatch(text string, what string, line int) error {
+	if p.accept(text) {
+		return nil
+	}
+	if line == p.peek().line {
+		return p.expect(text)
+	}
+	return p.errorf("'%s' expected (to close '%s' at line %d) near '%s'", text, what, line, p.peek())
+}
+
+func (p *parser) name() (string, error) {
+	tok := p.peek()
+	if tok.kind != tokName {
+		return "", p.errorf("<name> expected near '%s'", tok)
+	}
+	p.advance()
+	return tok.text, nil
+}
+
+/*
+Whether the next token ends a block
+*/
+func (p *parser) blockEnd() bool {
+	tok := p.peek()
+	if tok.kind == tokEOF {
+		return true
+	}
+	return tok.kind == tokKeyword && (tok.text == "end" || tok.text == "else" || tok.text == "elseif" || tok.text == "until")
+}
+
+func (p *parser) enterLevel() error {
+	p.levels++
+	if p.levels > maxSyntaxLevels {
+		return p.errorf("chunk has too many syntax levels")
+	}
+	return nil
+}
+
+func (p *parser) block() ([]stmt, error) {
+	if err := p.enterLevel(); err != nil {
+		return nil, err
+	}
+	defer func() { p.levels-- }()
+	res := make([]stmt, 0)
+	for !p.blockEnd() {
+		if p.check("return") || p.check("break") {
+			last, err := p.lastStatement()
+			if err != nil {
+				return nil, err
+			}
+			res = append(res, last)
+			p.accept(";")
+			if !p.blockEnd() {
+				return nil, p.errorf("'end' expected near '%s'", p.peek())
+			}
+			break
+		}
+		s, err := p.statement()
+		if err != nil {
+			return nil, err
+		}
+		if s != nil {
+			res = append(res, s)
+		}
+		p.accept(";")
+	}
+	return res, nil
+}
+
+func (p *parser) lastStatement() (stmt, error) {
+	if p.accept("break") {
+		return &breakStmt{}, nil
+	}
+	p.advance()
+	if p.blockEnd() || p.check(";") {
+		return &returnStmt{}, nil
+	}
+	exprs, err := p.exprList()
+	if err != nil {
+		return nil, err
+	}
+	return &returnStmt{exprs: exprs}, nil
+}
+
+func (p *parser) statement() (stmt, error) {
+	tok := p.peek()
+	if tok.kind == tokKeyword {
+		switch tok.text {
+		case "do":
+			p.advance()
+			body, err := p.block()
+			if err != nil {
+				return nil, err
+			}
+			return &doStmt{body: body}, p.expectMatch("end", "do", tok.line)
+		case "while":
+			return p.whileStatement()
+		case "repeat":
+			return p.repeatStatement()
+		case "if":
+			return p.ifStatement()
+		case "for":
+			return p.forStatement()
+		case "function":
+			return p.functionStatement()
+		case "local":
+			return p.localStatement()
+		}
+	}
+	return p.exprStatement()
+}
+
+func (p *parser) whileStatement() (stmt, error) {
+	line := p.advance().line
+	cond, err := p.expr()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expect("do"); err != nil {
+		return nil, err
+	}
+	body, err := p.block()
+	if err != nil {
+		return nil, err
+	}
+	return &whileStmt{cond: cond, body: body}, p.expectMatch("end", "while", line)
+}
+
+func (p *parser) repeatStatement() (stmt, error) {
+	line := p.advance().line
+	body, err := p.block()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expectMatch("until", "repeat", line); err != nil {
+		return nil, err
+	}
+	cond, err := p.expr()
+	if err != nil {
+		return nil, err
+	}
+	return &repeatStmt{body: body, cond: cond}, nil
+}
+
+func (p *parser) ifStatement() (stmt, error) {
+	line := p.advance().line
+	res := &ifStmt{}
+	for {
+		cond, err := p.expr()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect("then"); err != nil {
+			return nil, err
+		}
+		body, err := p.block()
+		if err != nil {
+			return nil, err
+		}
+		res.conds = append(res.conds, cond)
+		res.blocks = append(res.blocks, body)
+		if !p.accept("elseif") {
+			break
+		}
+	}
+	if p.accept("else") {
+		body, err := p.block()
+		if err != nil {
+			return nil, err
+		}
+		res.elseBlock = body
+	}
+	return res, p.expectMatch("end", "if", line)
+}
+
+func (p *parser) forStatement() (stmt, error) {
+	line := p.advance().line
+	first, err := p.name()
+	if err != nil {
+		return nil, err
+	}
+	if p.accept("=") {
+		res := &numForStmt{name: first, line: line}
+		if res.start, err = p.expr(); err != nil {
+			return nil, err
+		}
+		if err := p.expect(","); err != nil {
+			return nil, err
+		}
+		if res.limit, err = p.expr(); err != nil {
+			return nil, err
+		}
+		if p.accept(",") {
+			if res.step, err = p.expr(); err != nil {
+				return nil, err
+			}
+		}
+		if err := p.expect("do"); err != nil {
+			return nil, err
+		}
+		if res.body, err = p.block(); err != nil {
+			return nil, err
+		}
+		return res, p.expectMatch("end", "for", line)
+	}
+
+	res := &genForStmt{names: []string{first}, line: line}
+	for p.accept(",") {
+		name, err := p.name()
+		if err != nil {
+			return nil, err
+		}
+		res.names = append(res.names, name)
+	}
+	if err := p.expect("in"); err != nil {
+		return nil, err
+	}
+	if res.exprs, err = p.exprList(); err != nil {
+		return nil, err
+	}
+	if err := p.expect("do"); err != nil {
+		return nil, err
+	}
+	if res.body, err = p.block(); err != nil {
+		return nil, err
+	}
+	return res, p.expectMatch("end", "for", line)
+}
+
+/*
+function a.b.c:m(...) body end, sugar for an assignment
+*/
+func (p *parser) functionStatement() (stmt, error) {
+	line := p.advance().line
+	name, err := p.name()
+	if err != nil {
+		return nil, err
+	}
+	var target expr = &nameExpr{name: name, line: line}
+	method := false
+	for p.check(".") || p.check(":") {
+		method = p.advance().text == ":"
+		field, err := p.name()
+		if err != nil {
+			return nil, err
+		}
+		target = &indexExpr{obj: target, key: &constExpr{value: field}, line: line}
+		if method {
+			break
+		}
+	}
+	fn, err := p.functionBody(method, line)
+	if err != nil {
+		return nil, err
+	}
+	return &assignStmt{targets: []expr{target}, exprs: []expr{fn}, line: line}, nil
+}
+
+func (p *parser) localStatement() (stmt, error) {
+	line := p.advance().line
+	if p.accept("function") {
+		name, err := p.name()
+		if err != nil {
+			return nil, err
+		}
+		fn, err := p.functionBody(false, line)
+		if err != nil {
+			return nil, err
+		}
+		return &localFunctionStmt{name: name, fn: fn}, nil
+	}
+	res := &localStmt{}
+	for {
+		name, err := p.name()
+		if err != nil {
+			return nil, err
+		}
+		res.names = append(res.names, name)
+		if !p.accept(",") {
+			break
+		}
+	}
+	if p.accept("=") {
+		exprs, err := p.exprList()
+		if err != nil {
+			return nil, err
+		}
+		res.exprs = exprs
+	}
+	return res, nil
+}
+
+/*
+Function call or assignment
+*/
+func (p *parser) exprStatement() (stmt, error) {
+	line := p.peek().line
+	first, err := p.suffixedExpr()
+	if err != nil {
+		return nil, err
+	}
+	if !p.check("=") && !p.check(",") {
+		switch first.(type) {
+		case *callExpr, *methodCallExpr:
+			return &callStmt{call: first}, nil
+		}
+		return nil, p.errorf("syntax error near '%s'", p.peek())
+	}
+
+	targets := []expr{first}
+	for p.accept(",") {
+		target, err := p.suffixedExpr()
+		if err != nil {
+			return nil, err
+		}
+		targets = append(targets, target)
+	}
+	for _, target := range targets {
+		switch target.(type) {
+		case *nameExpr, *indexExpr:
+		default:
+			return nil, p.errorf("syntax error near '%s'", p.peek())
+		}
+	}
+	if err := p.expect("="); err != nil {
+		return nil, err
+	}
+	exprs, err := p.exprList()
+	if err != nil {
+		return nil, err
+	}
+	return &assignStmt{targets: targets, exprs: exprs, line: line}, nil
+}
+
+func (p *parser) functionBody(method bool, line int) (*functionExpr, error) {
+	fn := &functionExpr{}
+	if method {
+		fn.params = append(fn.params, "self")
+	}
+	if err := p.expect("("); err != nil {
+		return nil, err
+	}
+	if !p.check(")") {
+		for {
+			if p.accept("...") {
+				fn.varargs = true
+				break
+			}
+			name, err := p.name()
+			if err != nil {
+				return nil, err
+			}
+			fn.params = append(fn.params, name)
+			if !p.accept(",") {
+				break
+			}
+		}
+	}
+	if err := p.expect(")"); err != nil {
+		return nil, err
+	}
+	body, err := p.block()
+	if err != nil {
+		return nil, err
+	}
+	fn.body = body
+	return fn, p.expectMatch("end", "function", line)
+}
+
+func (p *parser) exprList() ([]expr, error) {
+	res := make([]expr, 0, 1)
+	for {
+		e, err := p.expr()
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, e)
+		if !p.accept(",") {
+			return res, nil
+		}
+	}
+}
+
+/*
+Left and right priorities of the binary operators, ^ and .. are right
+associative
+*/
+var binaryPriority = map[string][2]int{
+	"or": {1, 1}, "and": {2, 2},
+	"<": {3, 3}, ">": {3, 3}, "<=": {3, 3}, ">=": {3, 3}, "~=": {3, 3}, "==": {3, 3},
+	"..": {5, 4},
+	"+":  {6, 6}, "-": {6, 6},
+	"*": {7, 7}, "/": {7, 7}, "%": {7, 7},
+	"^": {10, 9},
+}
+
+const unaryPriority = 8
+
+func (p *parser) expr() (expr, error) {
+	return p.subExpr(0)
+}
+
+/*
+Precedence climbing: parse operators binding tighter than `limit`
+*/
+func (p *parser) subExpr(limit int) (expr, error) {
+	if err := p.enterLevel(); err != nil {
+		return nil, err
+	}
+	defer func() { p.levels-- }()
+	var left expr
+	tok := p.peek()
+	if (tok.kind == tokKeyword && tok.text == "not") || (tok.kind == tokSymbol && (tok.text == "-" || tok.text == "#")) {
+		p.advance()
+		operand, err := p.subExpr(unaryPriority)
+		if err != nil {
+			return nil, err
+		}
+		left = &unopExpr{op: tok.text, e: operand, line: tok.line}
+	} else {
+		var err error
+		if left, err = p.simpleExpr(); err != nil {
+			return nil, err
+		}
+	}
+
+	for {
+		tok := p.peek()
+		if tok.kind != tokKeyword && tok.kind != tokSymbol {
+			return left, nil
+		}
+		prio, ok := binaryPriority[tok.text]
+		if !ok || prio[0] <= limit {
+			return left, nil
+		}
+		p.advance()
+		right, err := p.subExpr(prio[1])
+		if err != nil {
+			return nil, err
+		}
+		left = &binopExpr{op: tok.text, l: left, r: right, line: tok.line}
+	}
+}
+
+func (p *parser) simpleExpr() (expr, error) {
+	tok := p.peek()
+	switch tok.kind {
+	case tokNumber:
+		p.advance()
+		return &constExpr{value: tok.num}, nil
+	case tokString:
+		p.advance()
+		return &constExpr{value: tok.text}, nil
+	case tokKeyword:
+		switch tok.text {
+		case "nil":
+			p.advance()
+			return &constExpr{value: nil}, nil
+		case "true":
+			p.advance()
+			return &constExpr{value: true}, nil
+		case "false":
+			p.advance()
+			return &constExpr{value: false}, nil
+		case "function":
+			p.advance()
+			return p.functionBody(false, tok.line)
+		}
+	case tokSymbol:
+		switch tok.text {
+		case "...":
+			p.advance()
+			return &varargExpr{line: tok.line}, nil
+		case "{":
+			return p.tableConstructor()
+		}
+	}
+	return p.suffixedExpr()
+}
+
+func (p *parser) primaryExpr() (expr, error) {
+	tok := p.peek()
+	if tok.kind == tokName {
+		p.advance()
+		return &nameExpr{name: tok.text, line: tok.line}, nil
+	}
+	if p.accept("(") {
+		e, err := p.expr()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expectMatch(")", "(", tok.line); err != nil {
+			return nil, err
+		}
+		return &parenExpr{e: e}, nil
+	}
+	return nil, p.errorf("unexpected symbol near '%s'", tok)
+}
+
+/*
+Primary expression followed by any number of field accesses and calls
+*/
+func (p *parser) suffixedExpr() (expr, error) {
+	e, err := p.primaryExpr()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		tok := p.peek()
+		switch {
+		case p.accept("."):
+			field, err := p.name()
+			if err != nil {
+				return nil, err
+			}
+			e = &indexExpr{obj: e, key: &constExpr{value: field}, line: tok.line}
+		case p.accept("["):
+			key, err := p.expr()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expect("]"); err != nil {
+				return nil, err
+			}
+			e = &indexExpr{obj: e, key: key, line: tok.line}
+		case p.accept(":"):
+			name, err := p.name()
+			if err != nil {
+				return nil, err
+			}
+			args, err := p.callArgs()
+			if err != nil {
+				return nil, err
+			}
+			e = &methodCallExpr{obj: e, name: name, args: args, line: tok.line}
+		case p.check("(") || p.check("{") || tok.kind == tokString:
+			args, err := p.callArgs()
+			if err != nil {
+				return nil, err
+			}
+			e = &callExpr{fn: e, args: args, line: tok.line}
+		default:
+			return e, nil
+		}
+	}
+}
+
+func (p *parser) callArgs() ([]expr, error) {
+	tok := p.peek()
+	switch {
+	case tok.kind == tokString:
+		p.advance()
+		return []expr{&constExpr{value: tok.text}}, nil
+	case p.check("{"):
+		t, err := p.tableConstructor()
+		if err != nil {
+			return nil, err
+		}
+		return []expr{t}, nil
+	case p.accept("("):
+		if p.accept(")") {
+			return nil, nil
+		}
+		args, err := p.exprList()
+		if err != nil {
+			return nil, err
+		}
+		return args, p.expectMatch(")", "(", tok.line)
+	}
+	return nil, p.errorf("function arguments expected near '%s'", tok)
+}
+
+func (p *parser) tableConstructor() (expr, error) {
+	line := p.advance().line
+	res := &tableExpr{line: line}
+	for !p.check("}") {
+		var key expr
+		switch {
+		case p.check("["):
+			p.advance()
+			k, err := p.expr()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expect("]"); err != nil {
+				return nil, err
+			}
+			if err := p.expect("="); err != nil {
+				return nil, err
+			}
+			key = k
+		case p.peek().kind == tokName && p.toks[p.pos+1].kind == tokSymbol && p.toks[p.pos+1].text == "=":
+			key = &constExpr{value: p.advance().text}
+			p.advance()
+		}
+		value, err := p.expr()
+		if err != nil {
+			return nil, err
+		}
+		res.keys = append(res.keys, key)
+		res.values = append(res.values, value)
+		if !p.accept(",") && !p.accept(";") {
+			break
+		}
+	}
+	return res, p.expectMatch("}", "{", line)
+}
@@ -0,0 +1,146 @@
+package script
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func run(t *testing.T, src string) []Value {
+	t.Helper()
+	chunk, err := Compile(src)
+	if err != nil {
+		t.Fatalf("compile %q: %v", src, err)
+	}
+	res, err := New().Run(chunk)
+	if err != nil {
+		t.Fatalf("run %q: %v", src, err)
+	}
+	return res
+}
+
+func TestScripts(t *testing.T) {
+	cases := map[string]Value{
+		"return 1 + 2 * 3 ^ 2":                                           19.0,
+		"return 2 ^ 3 ^ 2":                                               512.0,
+		"return -7 % 3":                                                  2.0,
+		"return 'a' .. 1 .. 'b'":                                         "a1b",
+		"return '10' + 5":                                                15.0,
+		"return #'hello'":                                                5.0,
+		"return not nil and 1 or 2":                                      1.0,
+		"return 1 < 2, 'a' < 'b'":                                        true,
+		"local t = {1, 2, 3} return #t":                                  3.0,
+		"local t = {x = 1, ['y'] = 2} return t.x + t.y":                  3.0,
+		"local s = 0 for i = 1, 10 do s = s + i end return s":            55.0,
+		"local s = 0 for i = 10, 1, -2 do s = s + i end return s":        30.0,
+		"local s = 0 while s < 5 do s = s + 1 end return s":              5.0,
+		"local s = 0 repeat local n = s + 1 s = n until n >= 3 return s": 3.0,
+		"local s = '' for i, v in ipairs({'a', 'b'}) do s = s .. i .. v end return s":                          "1a2b",
+		"local n = 0 for k, v in pairs({a = 1, b = 2, 3}) do n = n + v end return n":                           6.0,
+		"local function f(n) if n < 2 then return n end return f(n - 1) + f(n - 2) end return f(15)":           610.0,
+		"local function f(...) return select('#', ...) end return f(1, nil, 3)":                                3.0,
+		"local t = {} function t:add(n) self.n = (self.n or 0) + n return self.n end t:add(2) return t:add(3)": 5.0,
+		"local ok, err = pcall(error, 'boom', 0) return err":                                                   "boom",
+		"local ok, err = pcall(error, {code = 7}) return err.code":                                             7.0,
+		"return ('abc'):upper()":                                                                     "ABC",
+		"return string.sub('hello', 2, -2)":                                                          "ell",
+		"return string.format('%d-%5.2f-%s', 3.7, 1.5, 'x')":                                         "3- 1.50-x",
+		"return table.concat({1, 2, 3}, ',')":                                                        "1,2,3",
+		"local t = {3, 1, 2} table.sort(t) return table.concat(t)":                                   "123",
+		"local t = {3, 1, 2} table.sort(t, function(a, b) return a > b end) return table.concat(t)":  "321",
+		"local t = {1, 2, 3} table.insert(t, 1, 0) table.remove(t) return table.concat(t)":           "012",
+		"local fs = {} for i = 1, 3 do fs[i] = function() return i end end return fs[1]() + fs[3]()": 4.0,
+		"local t = {1, 2, 3} for k in pairs(t) do t[k] = nil end return next(t)":                     nil,
+		"return tonumber('0x10'), tonumber('z', 36)":                                                 16.0,
+		"return math.max(1, 5, 3) + math.floor(2.5)":                                                 7.0,
+		"return string.find('hello world', 'o w')":                                                   5.0,
+		"return tostring(1e15), tostring(0.1)":                                                       "1e+15",
+	}
+	for src, want := range cases {
+		res := run(t, src)
+		if len(res) == 0 {
+			if want != nil {
+				t.Errorf("%q: no result, want %v", src, want)
+			}
+			continue
+		}
+		if res[0] != want {
+			t.Errorf("%q: got %v, want %v", src, res[0], want)
+		}
+	}
+}
+
+func TestScriptErrors(t *testing.T) {
+	cases := map[string]string{
+		"return x":            "user_script:1: Script attempted to access nonexistent global variable 'x'",
+		"x = 1":               "user_script:1: Attempt to modify a readonly table",
+		"local t\nreturn t.x": "user_script:2: attempt to index local 't' (a nil value)",
+		"return 1 + {}":       "user_script:1: attempt to perform arithmetic on a table value",
+		"return 1 < 'a'":      "user_script:1: attempt to compare number with string",
+		"error('boom')":       "user_script:1: boom",
+		"local function f() return f() + 1 end return f()": "user_script:1: stack overflow",
+		"string.x = 1":              "user_script:1: Attempt to modify a readonly table",
+		"return table.concat({{}})": "user_script:1: invalid value (at index 1) in table for 'concat'",
+	}
+	for src, want := range cases {
+		chunk, err := Compile(src)
+		if err != nil {
+			t.Fatalf("compile %q: %v", src, err)
+		}
+		_, err = New().Run(chunk)
+		if err == nil || err.Error() != want {
+			t.Errorf("%q: got %v, want %q", src, err, want)
+		}
+	}
+}
+
+func TestSyntaxErrors(t *testing.T) {
+	cases := map[string]string{
+		"return +":             "user_script:1: unexpected symbol near '+'",
+		"if x then":            "user_script:1: 'end' expected near '<eof>'",
+		"while true do\n\nx()": "user_script:3: 'end' expected (to close 'while' at line 1) near '<eof>'",
+		"return 'abc":          "user_script:1: unfinished string",
+		"return 3x":            "user_script:1: malformed number near '3x'",
+		"return " + strings.Repeat("(", 300) + "1" + strings.Repeat(")", 300): "user_script:1: chunk has too many syntax levels",
+	}
+	for src, want := range cases {
+		_, err := Compile(src)
+		var syntaxErr *SyntaxError
+		if !errors.As(err, &syntaxErr) || err.Error() != want {
+			t.Errorf("%q: got %v, want %q", src, err, want)
+		}
+	}
+}
+
+func TestHook(t *testing.T) {
+	chunk, err := Compile("local ok = pcall(function() while true do end end) return ok")
+	if err != nil {
+		t.Fatal(err)
+	}
+	stop := errors.New("stopped")
+	it := New()
+	it.Hook = func() error { return stop }
+	if _, err := it.Run(chunk); err != stop {
+		t.Fatalf("got %v, want the hook error", err)
+	}
+}
+
+func TestGoFunction(t *testing.T) {
+	chunk, err := Compile("return double(21), ARGV[2]")
+	if err != nil {
+		t.Fatal(err)
+	}
+	it := New()
+	it.SetGlobal("double", &GoFunction{Name: "double", Fn: func(it *Interp, args []Value) ([]Value, error) {
+		n, _ := ToNumber(args[0])
+		return []Value{n * 2}, nil
+	}})
+	it.SetGlobal("ARGV", NewArray([]Value{"a", "b"}))
+	res, err := it.Run(chunk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res) != 2 || res[0] != 42.0 || res[1] != "b" {
+		t.Fatalf("got %v", res)
+	}
+}
@@ -0,0 +1,328 @@
+package script
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+/*
+Script value: nil, bool, float64, string, *Table, *Function or *GoFunction.
+Like Lua 5.1 every number is a float64
+*/
+type Value any
+
+type Function struct {
+	proto *functionExpr
+	// Scope the function was created in, captured locals live there
+	scope *scope
+}
+
+/*
+Builtin implemented in Go. Errors meant to be catchable by pcall must be
+*Error
+*/
+type GoFunction struct {
+	Name string
+	Fn   func(it *Interp, args []Value) ([]Value, error)
+}
+
+/*
+Error raised by a script, Value is what was passed to error() or a message
+for runtime errors
+*/
+type Error struct {
+	Value Value
+}
+
+func (e *Error) Error() string {
+	if s, ok := e.Value.(string); ok {
+		return s
+	}
+	if t, ok := e.Value.(*Table); ok {
+		if msg, ok := t.Get("err").(string); ok {
+			return msg
+		}
+	}
+	return ToString(e.Value)
+}
+
+/*
+Table with an array part for the keys 1..n and a hash part keeping the
+insertion order, so that next() can walk it while fields are cleared. The
+array part may have holes but never ends with nil
+*/
+type Table struct {
+	arr   []Value
+	hash  map[Value]Value
+	order []Value
+	index map[Value]int
+	// Assignments fail, used for the globals and the libraries
+	readonly bool
+}
+
+func NewTable() *Table {
+	return &Table{}
+}
+
+/*
+Make assignments from scripts fail, for tables of libraries
+*/
+func (t *Table) Freeze() {
+	t.readonly = true
+}
+
+/*
+Table holding `values` in its array part
+*/
+func NewArray(values []Value) *Table {
+	t := &Table{arr: make([]Value, 0, len(values))}
+	for _, v := range values {
+		if v == nil {
+			break
+		}
+		t.arr = append(t.arr, v)
+	}
+	return t
+}
+
+/*
+Positive integral number key usable as an array index
+*/
+func arrayIndex(key Value) (int, bool) {
+	f, ok := key.(float64)
+	if !ok || f < 1 || f != math.Floor(f) || f > math.MaxInt32 {
+		return 0, false
+	}
+	return int(f), true
+}
+
+func (t *Table) Get(key Value) Value {
+	if i, ok := arrayIndex(key); ok && i <= len(t.arr) {
+		return t.arr[i-1]
+	}
+	if t.hash == nil {
+		return nil
+	}
+	return t.hash[key]
+}
+
+/*
+Assign `value` to `key`, nil removes the key. The key must not be nil or NaN
+*/
+func (t *Table) Set(key Value, value Value) {
+	if i, ok := arrayIndex(key); ok {
+		switch {
+		case i <= len(t.arr):
+			t.arr[i-1] = value
+			for len(t.arr) > 0 && t.arr[len(t.arr)-1] == nil {
+				t.arr = t.arr[:len(t.arr)-1]
+			}
+			return
+		case i == len(t.arr)+1 && value != nil:
+			t.arr = append(t.arr, value)
+			t.delHash(key)
+			t.migrateFromHash()
+			return
+		}
+	}
+	if value == nil {
+		t.delHash(key)
+		return
+	}
+	if t.hash == nil {
+		t.hash = make(map[Value]Value)
+		t.index = make(map[Value]int)
+	}
+	if _, ok := t.hash[key]; !ok {
+		if len(t.order) > 32 && len(t.order) > 4*len(t.hash) {
+			t.compact()
+		}
+		t.index[key] = len(t.order)
+		t.order = append(t.order, key)
+	}
+	t.hash[key] = value
+}
+
+func (t *Table) delHash(key Value) {
+	if t.hash == nil {
+		return
+	}
+	if _, ok := t.hash[key]; !ok {
+		return
+	}
+	// The order slot stays until the next compaction, iterations in
+	// progress can still find their position
+	delete(t.hash, key)
+}
+
+func (t *Table) compact() {
+	order := make([]Value, 0, len(t.hash))
+	index := make(map[Value]int, len(t.hash))
+	for _, k := range t.order {
+		if _, ok := t.hash[k]; ok {
+			if _, seen := index[k]; !seen {
+				index[k] = len(order)
+				order = append(order, k)
+			}
+		}
+	}
+	t.order, t.index = order, index
+}
+
+/*
+Keys n+1, n+2... of the hash part move to the array part once the array
+reaches them
+*/
+func (t *Table) migrateFromHash() {
+	for t.hash != nil {
+		key := float64(len(t.arr) + 1)
+		v, ok := t.hash[key]
+		if !ok {
+			return
+		}
+		t.arr = append(t.arr, v)
+		delete(t.hash, key)
+	}
+}
+
+/*
+Length operator, the size of the array part which is a border: t[n] is not
+nil and t[n+1] is
+*/
+func (t *Table) Len() int {
+	return len(t.arr)
+}
+
+/*
+Entry following `key`, nil key for the first one. Returns a nil key after the
+last entry and false when `key` is not in the table
+*/
+func (t *Table) Next(key Value) (Value, Value, bool) {
+	pos := 0
+	if key != nil {
+		idx, inHash := t.index[key]
+		i, isIndex := arrayIndex(key)
+		switch {
+		case isIndex && i <= len(t.arr):
+			pos = i
+		case inHash:
+			pos = len(t.arr) + idx + 1
+		case isIndex:
+			// The end of the array part was cleared during the traversal
+			pos = len(t.arr)
+		default:
+			return nil, nil, false
+		}
+	}
+	for ; pos < len(t.arr); pos++ {
+		if t.arr[pos] != nil {
+			return float64(pos + 1), t.arr[pos], true
+		}
+	}
+	for i := pos - len(t.arr); i < len(t.order); i++ {
+		k := t.order[i]
+		if v, ok := t.hash[k]; ok && t.index[k] == i {
+			return k, v, true
+		}
+	}
+	return nil, nil, true
+}
+
+func TypeName(v Value) string {
+	switch v.(type) {
+	case nil:
+		return "nil"
+	case bool:
+		return "boolean"
+	case float64:
+		return "number"
+	case string:
+		return "string"
+	case *Table:
+		return "table"
+	case *Function, *GoFunction:
+		return "function"
+	}
+	return "userdata"
+}
+
+func formatNumber(f float64) string {
+	switch {
+	case math.IsInf(f, 1):
+		return "inf"
+	case math.IsInf(f, -1):
+		return "-inf"
+	case math.IsNaN(f):
+		return "nan"
+	}
+	return fmt.Sprintf("%.14g", f)
+}
+
+/*
+tostring() of a value
+*/
+func ToString(v Value) string {
+	switch x := v.(type) {
+	case nil:
+		return "nil"
+	case bool:
+		if x {
+			return "true"
+		}
+		return "false"
+	case float64:
+		return formatNumber(x)
+	case string:
+		return x
+	}
+	return fmt.Sprintf("%s: %p", TypeName(v), v)
+}
+
+/*
+Number value of `v`, strings are converted like Lua does for arithmetic
+*/
+func ToNumber(v Value) (float64, bool) {
+	switch x := v.(type) {
+	case float64:
+		return x, true
+	case string:
+		return parseNumber(x)
+	}
+	return 0, false
+}
+
+func truthy(v Value) bool {
+	if v == nil {
+		return false
+	}
+	if b, ok := v.(bool); ok {
+		return b
+	}
+	return true
+}
+
+/*
+Escape `s` as a Lua string literal, for %q
+*/
+func quoteString(s string) string {
+	var sb strings.Builder
+	sb.WriteByte('"')
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; c {
+		case '"', '\\':
+			sb.WriteByte('\\')
+			sb.WriteByte(c)
+		case '\n':
+			sb.WriteString("\\n")
+		case '\r':
+			sb.WriteString("\\r")
+		case 0:
+			sb.WriteString("\\000")
+		default:
+			sb.WriteByte(c)
+		}
+	}
+	sb.WriteByte('"')
+	return sb.String()
+}
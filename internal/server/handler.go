@@ -1,48 +1,160 @@
 package server
 
 import (
+	"errors"
 	"fmt"
 	"log"
 	"net"
+	"sync"
 
+	"tcp-server.com/m/internal/command"
+	"tcp-server.com/m/internal/config"
 	"tcp-server.com/m/internal/protocol"
 )
 
 type Handler struct {
 	conn net.Conn
+	// Executor of the connection, it holds the database selected
+	executor *command.Executor
+
+	// Replies and published messages are queued and written by a single
+	// goroutine, so pushed messages never interleave with a reply
+	mu     sync.Mutex
+	queue  [][]byte
+	queued int
+	notify chan struct{}
+	closed bool
+	done   chan struct{}
+
+	channels      map[string]struct{}
+	patterns      map[string]struct{}
+	shardChannels map[string]struct{}
+
+	tx transaction
 }
 
-func NewHandler(conn net.Conn) *Handler {
+func NewHandler(conn net.Conn, executor *command.Executor) *Handler {
 	return &Handler{
-		conn: conn,
+		conn:          conn,
+		executor:      executor,
+		notify:        make(chan struct{}, 1),
+		done:          make(chan struct{}),
+		channels:      make(map[string]struct{}),
+		patterns:      make(map[string]struct{}),
+		shardChannels: make(map[string]struct{}),
 	}
 }
+
+func (h *Handler) enqueue(msg []byte, limited bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.closed {
+		return
+	}
+	if limited && h.queued+len(msg) > config.PubSubOutputBufferLimit {
+		// Like Redis, a subscriber that cannot keep up is disconnected
+		// instead of buffering without bound
+		log.Printf("Client %s exceeded the pubsub output buffer limit\n", h.conn.RemoteAddr().String())
+		h.closed = true
+		h.conn.Close()
+		return
+	}
+	h.queue = append(h.queue, msg)
+	h.queued += len(msg)
+	select {
+	case h.notify <- struct{}{}:
+	default:
+	}
+}
+
+/*
+Queue a reply to the client
+*/
+func (h *Handler) write(res []byte) {
+	h.enqueue(res, false)
+}
+
+/*
+Queue a published message, implements pubsub.Subscriber
+*/
+func (h *Handler) Send(msg []byte) {
+	h.enqueue(msg, true)
+}
+
+func (h *Handler) writeLoop() {
+	defer close(h.done)
+	for range h.notify {
+		h.mu.Lock()
+		batch := h.queue
+		h.queue, h.queued = nil, 0
+		h.mu.Unlock()
+		for _, msg := range batch {
+			if _, err := h.conn.Write(msg); err != nil {
+				return
+			}
+		}
+	}
+}
+
+/*
+Stop queueing and wait for the queued output to be written
+*/
+func (h *Handler) close() {
+	h.mu.Lock()
+	h.closed = true
+	close(h.notify)
+	h.mu.Unlock()
+	<-h.done
+}
+
 func (h *Handler) HandleConnection(s *Server) {
+	go h.writeLoop()
 	defer func() {
+		h.unsubscribeAll(s)
+		h.unwatch(s)
+		h.close()
 		_ = h.conn.Close()
 		log.Printf("Client disconnected: %s\n", h.conn.RemoteAddr().String())
 	}()
+
+	parser := protocol.REPSParser{}
+	buf := make([]byte, 4096)
+	// Bytes received but not parsed yet: a command may span several reads
+	// and a single read may carry several pipelined commands
+	var pending []byte
 	for {
-		buf := make([]byte, 4096)
 		n, err := h.conn.Read(buf)
 		if err != nil {
 			return
 		}
+		pending = append(pending, buf[:n]...)
 
-		parser := protocol.REPSParser{}
-		cmdParts, err := parser.Parse(buf[:n])
-		if err != nil {
-			fmt.Fprintf(h.conn, "-ERR %s\r\n", err)
-			continue
-		}
+		for len(pending) > 0 {
+			cmdParts, pos, err := parser.ParseNext(pending)
+			if errors.Is(err, protocol.ErrIncomplete) {
+				break
+			}
+			if err != nil {
+				h.write([]byte(fmt.Sprintf("-ERR %s\r\n", err)))
+				pending = nil
+				break
+			}
+			pending = pending[pos:]
 
-		cmd, err := s.executor.CmdParser(cmdParts)
-		if err != nil {
-			fmt.Fprintf(h.conn, "-ERR %s\r\n", err)
-			continue
-		}
+			cmd, err := s.executor.CmdParser(cmdParts)
+			if err != nil {
+				h.write([]byte(fmt.Sprintf("-ERR %s\r\n", err)))
+				continue
+			}
 
-		res := s.executor.Execute(cmd)
-		h.conn.Write(res)
+			if res, handled, quit := h.handleConnCommand(s, cmd); handled {
+				h.write(res)
+				if quit {
+					return
+				}
+				continue
+			}
+			h.write(h.executor.Execute(cmd))
+		}
 	}
 }
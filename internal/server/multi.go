@@ -0,0 +1,137 @@
+package server
+
+import (
+	"errors"
+	"maps"
+	"slices"
+
+	"tcp-server.com/m/internal/command"
+	"tcp-server.com/m/internal/datastructure"
+	"tcp-server.com/m/internal/protocol"
+)
+
+/*
+MULTI/EXEC state of a connection
+*/
+type transaction struct {
+	active bool
+	queue  []*command.Command
+	// A command failed to queue, EXEC discards the transaction
+	aborted bool
+	// Versions of the WATCHed keys when they were watched, by database
+	watched map[*datastructure.Storage]map[string]uint64
+}
+
+var errExecAbort = errors.New("EXECABORT Transaction discarded because of previous errors.")
+
+/*
+Commands run by the connection itself, they cannot be queued
+*/
+var noMultiCmds = []string{"SUBSCRIBE", "PSUBSCRIBE", "SSUBSCRIBE", "UNSUBSCRIBE", "PUNSUBSCRIBE", "SUNSUBSCRIBE", "WATCH", "UNWATCH"}
+
+/*
+MULTI, EXEC, DISCARD, WATCH and UNWATCH, plus queueing while a transaction
+is open. Returns false when `cmd` is not part of a transaction
+*/
+func (h *Handler) handleTransaction(s *Server, cmd *command.Command) ([]byte, bool) {
+	en := protocol.Encoder{}
+	switch cmd.Name {
+	case "MULTI":
+		if h.tx.active {
+			return en.Encode(errors.New("ERR MULTI calls can not be nested"), false), true
+		}
+		h.tx.active = true
+		return en.Encode("OK", true), true
+	case "EXEC":
+		if !h.tx.active {
+			return en.Encode(errors.New("ERR EXEC without MULTI"), false), true
+		}
+		return h.exec(s), true
+	case "DISCARD":
+		if !h.tx.active {
+			return en.Encode(errors.New("ERR DISCARD without MULTI"), false), true
+		}
+		h.discard(s)
+		return en.Encode("OK", true), true
+	case "WATCH":
+		if h.tx.active {
+			return en.Encode(errors.New("ERR WATCH inside MULTI is not allowed"), false), true
+		}
+		h.watch(s, cmd.Args)
+		return en.Encode("OK", true), true
+	case "UNWATCH":
+		if !h.tx.active {
+			h.unwatch(s)
+			return en.Encode("OK", true), true
+		}
+	}
+	if !h.tx.active || cmd.Name == "QUIT" || cmd.Name == "RESET" {
+		return nil, false
+	}
+
+	if slices.Contains(noMultiCmds, cmd.Name) {
+		h.tx.aborted = true
+		return en.Encode(errors.New("ERR Command not allowed inside a transaction"), false), true
+	}
+	h.tx.queue = append(h.tx.queue, cmd)
+	return en.Encode("QUEUED", true), true
+}
+
+func (h *Handler) exec(s *Server) []byte {
+	en := protocol.Encoder{}
+	defer h.discard(s)
+	if h.tx.aborted {
+		return en.Encode(errExecAbort, false)
+	}
+	replies := h.executor.Exec(h.tx.queue, h.tx.watched)
+	if replies == nil {
+		// A watched key was modified
+		return protocol.NullArray
+	}
+	res := make([]any, len(replies))
+	for i, reply := range replies {
+		res[i] = protocol.Raw(reply)
+	}
+	return en.Encode(res, false)
+}
+
+/*
+Leave MULTI, EXEC and DISCARD also forget the watched keys
+*/
+func (h *Handler) discard(s *Server) {
+	h.tx.active = false
+	h.tx.queue = nil
+	h.tx.aborted = false
+	h.unwatch(s)
+}
+
+/*
+Watch `keys` of the selected database
+*/
+func (h *Handler) watch(s *Server, keys []string) {
+	db := h.executor.Store()
+	if h.tx.watched == nil {
+		h.tx.watched = make(map[*datastructure.Storage]map[string]uint64)
+	}
+	versions, ok := h.tx.watched[db]
+	if !ok {
+		versions = make(map[string]uint64)
+		h.tx.watched[db] = versions
+	}
+	fresh := make([]string, 0, len(keys))
+	for _, key := range keys {
+		if _, ok := versions[key]; !ok && !slices.Contains(fresh, key) {
+			fresh = append(fresh, key)
+		}
+	}
+	for i, version := range db.Watch(fresh) {
+		versions[fresh[i]] = version
+	}
+}
+
+func (h *Handler) unwatch(s *Server) {
+	for db, versions := range h.tx.watched {
+		db.Unwatch(slices.Collect(maps.Keys(versions)))
+	}
+	h.tx.watched = nil
+}
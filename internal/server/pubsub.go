@@ -0,0 +1,146 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"tcp-server.com/m/internal/command"
+	"tcp-server.com/m/internal/protocol"
+)
+
+/*
+Commands still accepted once the connection is in subscribe mode (RESP2)
+*/
+var subscribeModeCmds = []string{"SUBSCRIBE", "PSUBSCRIBE", "SSUBSCRIBE", "UNSUBSCRIBE", "PUNSUBSCRIBE", "SUNSUBSCRIBE", "PING", "QUIT", "RESET"}
+
+func (h *Handler) subscribeMode() bool {
+	return len(h.channels)+len(h.patterns)+len(h.shardChannels) > 0
+}
+
+/*
+Commands acting on the connection state rather than on the keyspace. Returns
+false when `cmd` must go through the executor, and whether the connection
+must be closed after the reply
+*/
+func (h *Handler) handleConnCommand(s *Server, cmd *command.Command) ([]byte, bool, bool) {
+	en := protocol.Encoder{}
+	if err := s.executor.Validate(cmd); err != nil {
+		// Errors detected while queueing make EXEC fail, like Redis does
+		if h.tx.active {
+			h.tx.aborted = true
+		}
+		return en.Encode(err, false), true, false
+	}
+	if h.subscribeMode() && !slices.Contains(subscribeModeCmds, cmd.Name) {
+		err := fmt.Errorf("ERR Can't execute '%s': only (P|S)SUBSCRIBE / (P|S)UNSUBSCRIBE / PING / QUIT / RESET are allowed in this context", strings.ToLower(cmd.Name))
+		return en.Encode(err, false), true, false
+	}
+	if res, handled := h.handleTransaction(s, cmd); handled {
+		return res, true, false
+	}
+
+	switch cmd.Name {
+	case "SUBSCRIBE", "PSUBSCRIBE", "SSUBSCRIBE":
+		return h.subscribe(s, cmd.Name, cmd.Args), true, false
+	case "UNSUBSCRIBE", "PUNSUBSCRIBE", "SUNSUBSCRIBE":
+		return h.unsubscribe(s, cmd.Name, cmd.Args), true, false
+	case "PING":
+		if !h.subscribeMode() {
+			return nil, false, false
+		}
+		if len(cmd.Args) > 1 {
+			return en.Encode(errors.New("ERR wrong number of arguments for 'ping' command"), false), true, false
+		}
+		msg := ""
+		if len(cmd.Args) == 1 {
+			msg = cmd.Args[0]
+		}
+		return en.Encode([]any{"pong", msg}, false), true, false
+	case "RESET":
+		h.unsubscribeAll(s)
+		h.discard(s)
+		return en.Encode("RESET", true), true, false
+	case "QUIT":
+		return en.Encode("OK", true), true, true
+	}
+	return nil, false, false
+}
+
+/*
+Subscription set of the connection and broker hooks for a (un)subscribe
+command, plus the kind reported in replies
+*/
+func (h *Handler) subscriptions(s *Server, name string) (map[string]struct{}, func(string), func(string), string) {
+	b := s.broker
+	switch name {
+	case "PSUBSCRIBE", "PUNSUBSCRIBE":
+		return h.patterns, func(p string) { b.PSubscribe(h, p) }, func(p string) { b.PUnsubscribe(h, p) }, "p"
+	case "SSUBSCRIBE", "SUNSUBSCRIBE":
+		return h.shardChannels, func(c string) { b.SSubscribe(h, c) }, func(c string) { b.SUnsubscribe(h, c) }, "s"
+	}
+	return h.channels, func(c string) { b.Subscribe(h, c) }, func(c string) { b.Unsubscribe(h, c) }, ""
+}
+
+/*
+Number reported in (un)subscribe replies: shard subscriptions are counted on
+their own, channels and patterns together
+*/
+func (h *Handler) subscriptionCount(kind string) int {
+	if kind == "s" {
+		return len(h.shardChannels)
+	}
+	return len(h.channels) + len(h.patterns)
+}
+
+func (h *Handler) subscribe(s *Server, name string, targets []string) []byte {
+	en := protocol.Encoder{}
+	set, sub, _, kind := h.subscriptions(s, name)
+	var res []byte
+	for _, target := range targets {
+		if _, ok := set[target]; !ok {
+			set[target] = struct{}{}
+			sub(target)
+		}
+		res = append(res, en.Encode([]any{kind + "subscribe", target, h.subscriptionCount(kind)}, false)...)
+	}
+	return res
+}
+
+/*
+Unsubscribe from `targets`, or from every subscription of that kind when
+empty
+*/
+func (h *Handler) unsubscribe(s *Server, name string, targets []string) []byte {
+	en := protocol.Encoder{}
+	set, _, unsub, kind := h.subscriptions(s, name)
+	if len(targets) == 0 {
+		for target := range set {
+			targets = append(targets, target)
+		}
+		slices.Sort(targets)
+		if len(targets) == 0 {
+			return en.Encode([]any{kind + "unsubscribe", nil, h.subscriptionCount(kind)}, false)
+		}
+	}
+	var res []byte
+	for _, target := range targets {
+		if _, ok := set[target]; ok {
+			delete(set, target)
+			unsub(target)
+		}
+		res = append(res, en.Encode([]any{kind + "unsubscribe", target, h.subscriptionCount(kind)}, false)...)
+	}
+	return res
+}
+
+func (h *Handler) unsubscribeAll(s *Server) {
+	for _, name := range []string{"UNSUBSCRIBE", "PUNSUBSCRIBE", "SUNSUBSCRIBE"} {
+		set, _, unsub, _ := h.subscriptions(s, name)
+		for target := range set {
+			delete(set, target)
+			unsub(target)
+		}
+	}
+}
@@ -5,22 +5,35 @@ import (
 	"fmt"
 	"log"
 	"net"
+	"time"
 
 	"tcp-server.com/m/internal/command"
 	"tcp-server.com/m/internal/config"
 	"tcp-server.com/m/internal/datastructure"
+	"tcp-server.com/m/internal/pubsub"
 )
 
 type Server struct {
 	listener net.Listener
 	port     string
 	executor command.Executor
+	broker   *pubsub.Broker
+	dbs      []*datastructure.Storage
+	stop     chan struct{}
 }
 
 func NewServer(port string) *Server {
+	broker := pubsub.NewBroker()
+	dbs := datastructure.NewDatabases(config.Databases)
+	for _, db := range dbs {
+		db.SetPublisher(broker)
+	}
 	return &Server{
 		port:     port,
-		executor: *command.NewExecutor(datastructure.NewStorage()),
+		executor: *command.NewExecutor(dbs, broker),
+		broker:   broker,
+		dbs:      dbs,
+		stop:     make(chan struct{}),
 	}
 }
 
@@ -28,15 +41,43 @@ func Stop(s *Server) error {
 	if s.listener != nil {
 		s.listener.Close()
 	}
+	select {
+	case <-s.stop:
+	default:
+		close(s.stop)
+	}
 	return nil
 }
 
+/*
+Periodically delete expired keys that are never accessed again, and move
+on the incremental rehash of idle databases
+*/
+func (s *Server) activeExpire() {
+	ticker := time.NewTicker(time.Second / time.Duration(config.ActiveExpireHz))
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-ticker.C:
+			for _, db := range s.dbs {
+				db.ActiveExpireCycle()
+				if config.ActiveRehashing {
+					db.ActiveRehash()
+				}
+			}
+		}
+	}
+}
+
 func (s *Server) Start() error {
 	listen, err := net.Listen(config.Protocol, s.port)
 	if err != nil {
 		return fmt.Errorf("error establising new TCP server:\n%v", err)
 	}
 	s.listener = listen
+	go s.activeExpire()
 
 	log.Printf("Listening on port %s", s.port)
 	for {
@@ -49,7 +90,7 @@ func (s *Server) Start() error {
 			log.Printf("error establishing connection on port %s\n%v", s.port, err)
 			continue
 		}
-		handler := NewHandler(conn)
+		handler := NewHandler(conn, s.executor.Session())
 
 		go handler.HandleConnection(s)
 	}
@@ -0,0 +1,213 @@
+/*
+Package module lets Go code extend the server at startup with its own data
+types and commands, without touching the executor:
+
+	counter := &module.Type{Name: "counter", Save: ..., Load: ...}
+	module.RegisterType(counter)
+	module.RegisterCommand(module.Command{
+		Name: "COUNTER.INCR", Arity: 2, Flags: "write fast",
+		FirstKey: 1, LastKey: 1, Step: 1,
+		Handler: func(ctx *module.Ctx, args []string) any { ... },
+	})
+
+Registration must happen before the server starts. Module commands run with
+no other command in between, handlers need no locking of their own
+*/
+package module
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"tcp-server.com/m/internal/command"
+	"tcp-server.com/m/internal/datastructure"
+	"tcp-server.com/m/internal/protocol"
+)
+
+/*
+Data type stored in the keyspace by a module
+*/
+type Type struct {
+	// Unique name, reported by OBJECT ENCODING
+	Name string
+	// Persistence callbacks: serialize a value and build it back. Values
+	// leave and enter the keyspace through them when keys are copied or
+	// persisted
+	Save func(value any) ([]byte, error)
+	Load func(data []byte) (any, error)
+	// Optional, called when a value is deleted or overwritten
+	Free func(value any)
+}
+
+/*
+Adapter giving the storage access to the callbacks
+*/
+type storedType struct {
+	t *Type
+}
+
+func (s storedType) TypeName() string {
+	return s.t.Name
+}
+
+func (s storedType) Save(value any) ([]byte, error) {
+	return s.t.Save(value)
+}
+
+func (s storedType) Load(data []byte) (any, error) {
+	return s.t.Load(data)
+}
+
+func (s storedType) Free(value any) {
+	if s.t.Free != nil {
+		s.t.Free(value)
+	}
+}
+
+var types = struct {
+	sync.Mutex
+	byName map[string]*Type
+}{byName: make(map[string]*Type)}
+
+/*
+Make `t` storable, its name must be unique and Save and Load are required
+*/
+func RegisterType(t *Type) error {
+	if t.Name == "" || strings.ContainsAny(t.Name, " \r\n") {
+		return fmt.Errorf("invalid type name '%s'", t.Name)
+	}
+	if t.Save == nil || t.Load == nil {
+		return fmt.Errorf("type '%s' needs Save and Load callbacks", t.Name)
+	}
+	types.Lock()
+	defer types.Unlock()
+	if _, ok := types.byName[t.Name]; ok {
+		return fmt.Errorf("type '%s' is already registered", t.Name)
+	}
+	types.byName[t.Name] = t
+	return nil
+}
+
+/*
+Status reply, encoded as a simple string instead of a bulk string
+*/
+type SimpleString string
+
+/*
+Handler of a module command. The reply may be a string, SimpleString, an
+integer, a float64, an error, nil or a []any of those
+*/
+type CommandFunc func(ctx *Ctx, args []string) any
+
+/*
+Command added by a module. Arity counts the command name, negative means at
+least that many arguments. Flags are space separated among write, readonly,
+fast, blocking, noscript, admin and pubsub. Keys are at positions FirstKey
+to LastKey every Step, LastKey -1 being the last argument. Module and
+Summary are reported by COMMAND DOCS
+*/
+type Command struct {
+	Name     string
+	Arity    int
+	Flags    string
+	FirstKey int
+	LastKey  int
+	Step     int
+	Handler  CommandFunc
+	Module   string
+	Summary  string
+}
+
+/*
+Add `cmd` to the commands of the server, its name must not be taken
+*/
+func RegisterCommand(cmd Command) error {
+	flags, err := command.ParseFlags(cmd.Flags)
+	if err != nil {
+		return err
+	}
+	if cmd.Handler == nil {
+		return fmt.Errorf("command '%s' has no handler", cmd.Name)
+	}
+	handler := cmd.Handler
+	return command.RegisterExclusive(&command.Spec{
+		Name:     cmd.Name,
+		Arity:    cmd.Arity,
+		Flags:    flags,
+		FirstKey: cmd.FirstKey,
+		LastKey:  cmd.LastKey,
+		Step:     cmd.Step,
+		Group:    "module",
+		Summary:  cmd.Summary,
+		Module:   cmd.Module,
+		Handler: func(e *command.Executor, args []string) []byte {
+			return encodeReply(handler(&Ctx{store: e.Store()}, args))
+		},
+	})
+}
+
+func encodeReply(reply any) []byte {
+	en := protocol.Encoder{}
+	switch r := reply.(type) {
+	case SimpleString:
+		return en.Encode(string(r), true)
+	case []any:
+		items := make([]any, len(r))
+		for i, item := range r {
+			items[i] = protocol.Raw(encodeReply(item))
+		}
+		return en.Encode(items, false)
+	}
+	if res := en.Encode(reply, false); res != nil {
+		return res
+	}
+	return en.Encode(fmt.Errorf("ERR module reply of unsupported type %T", reply), false)
+}
+
+var errWrongType = errors.New("WRONGTYPE Operation against a key holding the wrong kind of value")
+
+/*
+Access to the keyspace given to command handlers
+*/
+type Ctx struct {
+	store *datastructure.Storage
+}
+
+/*
+Value of type `t` at `key`. Fails with a WRONGTYPE error, which handlers
+may return as is, when the key holds another type
+*/
+func (c *Ctx) Get(t *Type, key string) (any, bool, error) {
+	mv, ok := c.store.ModuleGet(key)
+	if !ok {
+		return nil, false, nil
+	}
+	if st, ok := mv.Type.(storedType); !ok || st.t != t {
+		return nil, false, errWrongType
+	}
+	return mv.Value, true, nil
+}
+
+/*
+Store `value` of type `t` at `key` and publish the keyspace `event`
+*/
+func (c *Ctx) Set(t *Type, key string, value any, event string) {
+	c.store.ModuleSet(key, storedType{t}, value, event)
+}
+
+/*
+Delete the module value at `key`, returns whether there was one
+*/
+func (c *Ctx) Delete(key string) bool {
+	return c.store.ModuleDel(key)
+}
+
+/*
+Publish the keyspace `event` after changing the value at `key` in place,
+this also invalidates the transactions watching it
+*/
+func (c *Ctx) Notify(event string, key string) {
+	c.store.ModuleNotify(event, key)
+}
@@ -0,0 +1,169 @@
+package module
+
+import (
+	"encoding/binary"
+	"errors"
+	"strconv"
+	"strings"
+	"testing"
+
+	"tcp-server.com/m/internal/command"
+	"tcp-server.com/m/internal/datastructure"
+	"tcp-server.com/m/internal/pubsub"
+)
+
+var counterType = &Type{
+	Name: "counter",
+	Save: func(value any) ([]byte, error) {
+		return binary.AppendVarint(nil, *value.(*int64)), nil
+	},
+	Load: func(data []byte) (any, error) {
+		n, size := binary.Varint(data)
+		if size <= 0 {
+			return nil, errors.New("bad counter")
+		}
+		return &n, nil
+	},
+}
+
+func counterIncr(ctx *Ctx, args []string) any {
+	v, ok, err := ctx.Get(counterType, args[0])
+	if err != nil {
+		return err
+	}
+	if !ok {
+		n := int64(0)
+		v = &n
+		ctx.Set(counterType, args[0], v, "counter.incr")
+	} else {
+		ctx.Notify("counter.incr", args[0])
+	}
+	n := v.(*int64)
+	*n++
+	return *n
+}
+
+func init() {
+	if err := RegisterType(counterType); err != nil {
+		panic(err)
+	}
+	err := RegisterCommand(Command{
+		Name: "counter.incr", Arity: 2, Flags: "write fast",
+		FirstKey: 1, LastKey: 1, Step: 1, Handler: counterIncr,
+		Module: "counter", Summary: "Increments a counter.",
+	})
+	if err != nil {
+		panic(err)
+	}
+	err = RegisterCommand(Command{
+		Name: "COUNTER.DEL", Arity: 2, Flags: "write",
+		FirstKey: 1, LastKey: 1, Step: 1,
+		Handler: func(ctx *Ctx, args []string) any {
+			if ctx.Delete(args[0]) {
+				return SimpleString("OK")
+			}
+			return nil
+		},
+	})
+	if err != nil {
+		panic(err)
+	}
+}
+
+func run(e *command.Executor, args ...string) string {
+	cmd, _ := e.CmdParser(args)
+	return string(e.Execute(cmd))
+}
+
+func TestModuleCommands(t *testing.T) {
+	e := command.NewExecutor(datastructure.NewDatabases(1), pubsub.NewBroker())
+	for i := 1; i <= 3; i++ {
+		if got, want := run(e, "COUNTER.INCR", "c"), ":"+strconv.Itoa(i)+"\r\n"; got != want {
+			t.Fatalf("incr %d: got %q, want %q", i, got, want)
+		}
+	}
+	if got := run(e, "OBJECT", "ENCODING", "c"); got != "$7\r\ncounter\r\n" {
+		t.Fatalf("got %q", got)
+	}
+	if got := run(e, "COUNTER.DEL", "c"); got != "+OK\r\n" {
+		t.Fatalf("got %q", got)
+	}
+	if got := run(e, "COUNTER.INCR", "c"); got != ":1\r\n" {
+		t.Fatalf("got %q", got)
+	}
+	if err := e.Validate(&command.Command{Name: "COUNTER.INCR"}); err == nil {
+		t.Fatal("arity not checked")
+	}
+}
+
+func TestCommandIntrospection(t *testing.T) {
+	e := command.NewExecutor(datastructure.NewDatabases(1), pubsub.NewBroker())
+	cases := map[string][]string{
+		"*1\r\n$12\r\ncounter.incr\r\n": {"COMMAND", "LIST", "FILTERBY", "MODULE", "counter"},
+		"*2\r\n$12\r\ncounter.incr\r\n*6\r\n$7\r\nsummary\r\n$21\r\nIncrements a counter.\r\n$5\r\ngroup\r\n$6\r\nmodule\r\n$6\r\nmodule\r\n$7\r\ncounter\r\n": {"COMMAND", "DOCS", "counter.incr"},
+		"*1\r\n$1\r\nc\r\n":                                               {"COMMAND", "GETKEYS", "COUNTER.INCR", "c"},
+		"*3\r\n$1\r\nd\r\n$1\r\na\r\n$1\r\nb\r\n":                         {"COMMAND", "GETKEYS", "ZUNIONSTORE", "d", "2", "a", "b", "WEIGHTS", "1", "2"},
+		"*2\r\n$1\r\na\r\n$1\r\nb\r\n":                                    {"COMMAND", "GETKEYS", "XREAD", "COUNT", "2", "STREAMS", "a", "b", "0", "0"},
+		"-ERR The command has no key arguments\r\n":                       {"COMMAND", "GETKEYS", "PING"},
+		"-ERR Invalid number of arguments specified for command\r\n":      {"COMMAND", "GETKEYS", "GET"},
+		"-ERR unknown command 'nope', with args beginning with: 'x' \r\n": {"NOPE", "x"},
+		"-ERR wrong number of arguments for 'get' command\r\n":            {"GET"},
+	}
+	for want, args := range cases {
+		if got := run(e, args...); got != want {
+			t.Errorf("%v: got %q, want %q", args, got, want)
+		}
+	}
+	info := run(e, "COMMAND", "INFO", "counter.incr", "nope")
+	for _, part := range []string{"+write\r\n+fast\r\n:1\r\n:1\r\n:1\r\n", "+@write\r\n+@fast\r\n", "$-1\r\n"} {
+		if !strings.Contains(info, part) {
+			t.Errorf("info %q lacks %q", info, part)
+		}
+	}
+}
+
+func TestWrongType(t *testing.T) {
+	other := &Type{Name: "other", Save: counterType.Save, Load: counterType.Load}
+	if err := RegisterType(other); err != nil {
+		t.Fatal(err)
+	}
+	ctx := &Ctx{store: datastructure.NewStorage()}
+	ctx.Set(other, "k", new(int64), "other.set")
+	if _, _, err := ctx.Get(counterType, "k"); err != errWrongType {
+		t.Fatalf("got %v", err)
+	}
+}
+
+func TestRegisterErrors(t *testing.T) {
+	if err := RegisterType(counterType); err == nil {
+		t.Fatal("type registered twice")
+	}
+	if err := RegisterType(&Type{Name: "nosave"}); err == nil {
+		t.Fatal("type without callbacks")
+	}
+	cases := []Command{
+		{Name: "GET", Arity: 2, Handler: counterIncr},
+		{Name: "COUNTER.INCR", Arity: 2, Handler: counterIncr},
+		{Name: "X.BADFLAG", Arity: 2, Flags: "quick", Handler: counterIncr},
+		{Name: "X.NOARITY", Handler: counterIncr},
+		{Name: "X.NOHANDLER", Arity: 1},
+		{Name: "X.BOTH", Arity: 1, Flags: "write readonly", Handler: counterIncr},
+	}
+	for _, cmd := range cases {
+		if err := RegisterCommand(cmd); err == nil {
+			t.Errorf("%s registered", cmd.Name)
+		}
+	}
+}
+
+func TestPersistenceCallbacks(t *testing.T) {
+	n := int64(-42)
+	data, err := counterType.Save(&n)
+	if err != nil {
+		t.Fatal(err)
+	}
+	v, err := counterType.Load(data)
+	if err != nil || *v.(*int64) != -42 {
+		t.Fatalf("got %v, %v", v, err)
+	}
+}